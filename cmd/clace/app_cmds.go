@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/claceio/clace/internal/system"
 	"github.com/claceio/clace/internal/types"
@@ -43,6 +44,10 @@ func initAppCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *c
 			appApproveCommand(commonFlags, clientConfig),
 			appReloadCommand(commonFlags, clientConfig),
 			appPromoteCommand(commonFlags, clientConfig),
+			appCanaryCommand(commonFlags, clientConfig),
+			appLogsCommand(commonFlags, clientConfig),
+			appStatsCommand(commonFlags, clientConfig),
+			appExecCommand(commonFlags, clientConfig),
 			appUpdateSettingsCommand(commonFlags, clientConfig),
 			appUpdateMetadataCommand(commonFlags, clientConfig),
 		},
@@ -60,7 +65,8 @@ func appCreateCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	flags = append(flags, newBoolFlag("approve", "a", "Approve the app permissions", false))
 	flags = append(flags, newStringFlag("auth", "", "The authentication mode for the app: can be default or none or system or an OAuth account config", "default"))
 	flags = append(flags, newStringFlag("branch", "b", "The branch to checkout if using git source", "main"))
-	flags = append(flags, newStringFlag("commit", "c", "The commit SHA to checkout if using git source. This takes precedence over branch", ""))
+	flags = append(flags, newStringFlag("tag", "", "The tag to checkout if using git source. A pattern like v1.* or latest tracks the highest matching semver tag. This takes precedence over branch", ""))
+	flags = append(flags, newStringFlag("commit", "c", "The commit SHA to checkout if using git source. This takes precedence over tag and branch", ""))
 	flags = append(flags, newStringFlag("git-auth", "g", "The name of the git_auth entry in server config to use", ""))
 	flags = append(flags, newStringFlag("spec", "", "The spec to use for the app", ""))
 	flags = append(flags,
@@ -195,6 +201,7 @@ Examples:
 				IsDev:            cCtx.Bool("dev"),
 				AppAuthn:         types.AppAuthnType(cCtx.String("auth")),
 				GitBranch:        cCtx.String("branch"),
+				GitTag:           cCtx.String("tag"),
 				GitCommit:        cCtx.String("commit"),
 				GitAuthName:      cCtx.String("git-auth"),
 				Spec:             types.AppSpec(cCtx.String("spec")),
@@ -326,7 +333,7 @@ func printAppList(cCtx *cli.Context, apps []types.AppResponse, format string) {
 		for _, app := range apps {
 			gitInfo := ""
 			if app.Metadata.VersionMetadata.GitBranch != "" || app.Metadata.VersionMetadata.GitCommit != "" {
-				gitInfo = fmt.Sprintf("%s:%.20s", app.Metadata.VersionMetadata.GitBranch, app.Metadata.VersionMetadata.GitCommit)
+				gitInfo = fmt.Sprintf("%s:%.20s", cmp.Or(app.Metadata.VersionMetadata.GitTag, app.Metadata.VersionMetadata.GitBranch), app.Metadata.VersionMetadata.GitCommit)
 			}
 			fmt.Fprintf(cCtx.App.Writer, formatStrData, app.Metadata.Name, app.Id, appType(app), app.Metadata.VersionMetadata.Version, authType(app),
 				app.AppEntry.AppPathDomain(), app.SourceUrl, app.Metadata.Spec, gitInfo)
@@ -538,7 +545,8 @@ func appReloadCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	flags = append(flags, newBoolFlag("promote", "p", "Promote the change from stage to prod", false))
 	flags = append(flags, newBoolFlag("force-reload", "f", "Force reload even if there is no new commit", false))
 	flags = append(flags, newStringFlag("branch", "b", "The branch to checkout if using git source", ""))
-	flags = append(flags, newStringFlag("commit", "c", "The commit SHA to checkout if using git source. This takes precedence over branch", ""))
+	flags = append(flags, newStringFlag("tag", "", "The tag to checkout if using git source. A pattern like v1.* or latest tracks the highest matching semver tag. This takes precedence over branch", ""))
+	flags = append(flags, newStringFlag("commit", "c", "The commit SHA to checkout if using git source. This takes precedence over tag and branch", ""))
 	flags = append(flags, newStringFlag("git-auth", "g", "The name of the git_auth entry to use", ""))
 	flags = append(flags, dryRunFlag())
 
@@ -563,6 +571,8 @@ func appReloadCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	  Reload and promote apps in the example.com domain: clace app reload --promote "example.com:**"
 	  Reload, approve and promote apps in the example.com domain: clace app reload --approve --promote "example.com:**"
 	  Reload all apps from main branch: clace app reload --branch main all
+	  Reload an app from a tag: clace app reload --tag v1.4.2 /myapp1
+	  Reload an app and track the latest v1 tag: clace app reload --tag "v1.*" /myapp1
 	  Reload an app from particular commit: clace app reload --commit 1c119e7c5845e19845dd1d794268b350ced5b71b /myapp1`,
 
 		Action: func(cCtx *cli.Context) error {
@@ -577,6 +587,7 @@ func appReloadCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 			values.Add("promote", strconv.FormatBool(cCtx.Bool("promote")))
 			values.Add("forceReload", strconv.FormatBool(cCtx.Bool("force-reload")))
 			values.Add("branch", cCtx.String("branch"))
+			values.Add("tag", cCtx.String("tag"))
 			values.Add("commit", cCtx.String("commit"))
 			values.Add("gitAuth", cCtx.String("git-auth"))
 			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
@@ -645,6 +656,259 @@ func appReloadCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	}
 }
 
+func printVerifyResult(cCtx *cli.Context, verifyResult types.VerifyResult) {
+	switch {
+	case verifyResult.Success:
+		fmt.Fprintf(cCtx.App.Writer, "Verified %s version %d\n", verifyResult.AppPathDomain, verifyResult.Version)
+	case verifyResult.RevertedTo > 0:
+		fmt.Fprintf(cCtx.App.Writer, "Verification failed for %s version %d, reverted to version %d: %s\n",
+			verifyResult.AppPathDomain, verifyResult.Version, verifyResult.RevertedTo, verifyResult.Error)
+	default:
+		fmt.Fprintf(cCtx.App.Writer, "Verification failed for %s version %d: %s\n",
+			verifyResult.AppPathDomain, verifyResult.Version, verifyResult.Error)
+	}
+}
+
+func appCanaryCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newIntFlag("percent", "", "Percentage of users to route to the staged version, 0 to disable canary", 0))
+	flags = append(flags, newStringFlag("sticky", "", "How users are assigned to a version: cookie or user", string(types.CanaryStickyCookie)))
+	flags = append(flags, dryRunFlag())
+
+	return &cli.Command{
+		Name:      "canary",
+		Usage:     "Route a percentage of users to the staged version of the app",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<appPath>",
+		UsageText: `args: <appPath>
+
+<appPath> is the path of a prod app. If --percent is not specified, the current canary status is shown.
+The request and error counts for each version are shown, use "app promote" to promote the staged version
+or set percent to zero to end the canary.
+
+	Examples:
+	  Route 10% of users to the staged version: clace app canary --percent 10 /myapp
+	  Route by user id hash: clace app canary --percent 25 --sticky user /myapp
+	  Show canary status: clace app canary /myapp
+	  End the canary: clace app canary --percent 0 /myapp`,
+
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				return fmt.Errorf("requires one argument: <appPath>")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("appPath", cCtx.Args().First())
+
+			var canaryResponse types.AppCanaryResponse
+			if !cCtx.IsSet("percent") {
+				if err := client.Get("/_clace/app_canary", values, &canaryResponse); err != nil {
+					return err
+				}
+			} else {
+				values.Add("percent", strconv.Itoa(cCtx.Int("percent")))
+				values.Add("sticky", cCtx.String("sticky"))
+				values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+				if err := client.Post("/_clace/app_canary", values, nil, &canaryResponse); err != nil {
+					return err
+				}
+			}
+
+			printCanaryStatus(cCtx, &canaryResponse)
+			if canaryResponse.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+			return nil
+		},
+	}
+}
+
+func appLogsCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+6)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newBoolFlag("follow", "f", "Stream new log lines until interrupted", false))
+	flags = append(flags, newStringFlag("since", "", "Show logs newer than the duration, like 10m or 2h", ""))
+	flags = append(flags, newIntFlag("tail", "", "Number of lines to show from the end of the logs, all lines if zero", 0))
+	flags = append(flags, newBoolFlag("linked", "l", "Include the logs for the stage and preview apps", false))
+	flags = append(flags, newBoolFlag("build", "", "Show the image build logs instead of the container logs", false))
+	flags = append(flags, newIntFlag("version", "", "The app version to show the build logs for, current version if zero", 0))
+
+	return &cli.Command{
+		Name:      "logs",
+		Usage:     "Show the container logs for an app",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<appPath>",
+		UsageText: `args: <appPath>
+
+<appPath> is the path of a container app, the stage or preview app path can be specified to view their logs.
+With --linked, the logs for the stage and preview apps of the main app are included. If there are multiple
+containers, like with replicas, each log line is prefixed with the app path and container name. For apps
+with command lifetime containers, the logs for the recent command runs are shown. With --build, the
+image build output is shown, for the current version or the version specified using --version.
+
+	Examples:
+	  Show logs: clace app logs /myapp
+	  Follow the last 200 lines: clace app logs --follow --tail 200 /myapp
+	  Logs from the last ten minutes: clace app logs --since 10m /myapp
+	  Logs for the stage app: clace app logs /myapp_cl_stage
+	  Logs for the prod, stage and preview apps: clace app logs --linked /myapp
+	  Image build logs for version 3: clace app logs --build --version 3 /myapp`,
+
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				return fmt.Errorf("requires one argument: <appPath>")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("appPath", cCtx.Args().First())
+			values.Add("follow", strconv.FormatBool(cCtx.Bool("follow")))
+			values.Add("linked", strconv.FormatBool(cCtx.Bool("linked")))
+			values.Add("build", strconv.FormatBool(cCtx.Bool("build")))
+			if cCtx.Int("version") > 0 {
+				values.Add("version", strconv.Itoa(cCtx.Int("version")))
+			}
+			if cCtx.String("since") != "" {
+				values.Add("since", cCtx.String("since"))
+			}
+			if cCtx.Int("tail") > 0 {
+				values.Add("tail", strconv.Itoa(cCtx.Int("tail")))
+			}
+
+			return client.Stream("/_clace/app_logs", values, cCtx.App.Writer)
+		},
+	}
+}
+
+func appStatsCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+3)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newBoolFlag("internal", "i", "Include internal apps", false))
+	flags = append(flags, newStringFlag("since", "", "Duration for computing the peak usage, like 1h or 168h", "24h"))
+	flags = append(flags, newStringFlag("format", "f", "The display format. Valid options are table, basic, csv, json, jsonl and jsonl_pretty", ""))
+
+	return &cli.Command{
+		Name:      "stats",
+		Usage:     "Show the container cpu and memory usage for apps",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "[<appPathGlob>]",
+		UsageText: `args: [<appPathGlob>]
+
+<appPathGlob> defaults to "*:**" (same as "all"). The current usage is from the latest sample, the peak usage
+is the max across the samples in the since duration. The cpu usage is the percent of one cpu, summed across the
+app replicas and services. The usage is sampled by the app status check, as per the container.stats_interval_secs
+app config. Apps without samples, like apps which do not use containers, are not listed.
+` + PATH_SPEC_HELP +
+			`
+Examples:
+  Show usage for all apps: clace app stats
+  Show usage for apps under /utils, with peak usage in the last hour: clace app stats --since 1h "/utils/**"
+  Show usage including the stage apps, in json format: clace app stats --internal --format json`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 1 {
+				return fmt.Errorf("only one argument expected: <appPathGlob>")
+			}
+			values := url.Values{}
+			values.Add("internal", strconv.FormatBool(cCtx.Bool("internal")))
+			values.Add("since", cCtx.String("since"))
+			if cCtx.NArg() == 1 {
+				values.Add("appPathGlob", cCtx.Args().Get(0))
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			var response types.AppStatsResponse
+			if err := client.Get("/_clace/app_stats", values, &response); err != nil {
+				return err
+			}
+			printAppStats(cCtx, response.Stats, cmp.Or(cCtx.String("format"), clientConfig.Client.DefaultFormat))
+			return nil
+		},
+	}
+}
+
+func printAppStats(cCtx *cli.Context, stats []types.AppStats, format string) {
+	switch format {
+	case FORMAT_JSON:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		enc.Encode(stats)
+	case FORMAT_JSONL:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		for _, s := range stats {
+			enc.Encode(s)
+		}
+	case FORMAT_JSONL_PRETTY:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		for _, s := range stats {
+			enc.Encode(s)
+		}
+	case FORMAT_BASIC:
+		formatStr := "%-8s %-10s %-8s %-10s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "Cpu", "Memory", "PeakCpu", "PeakMemory", "AppPath")
+		for _, s := range stats {
+			fmt.Fprintf(cCtx.App.Writer, formatStr, formatCpu(s.CpuPercent), formatMemory(s.MemoryBytes),
+				formatCpu(s.PeakCpuPercent), formatMemory(s.PeakMemoryBytes), s.AppPathDomain)
+		}
+	case FORMAT_TABLE:
+		formatStr := "%-35s %-10s %-8s %-10s %-8s %-10s %-7s %-20s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "Id", "Containers", "Cpu", "Memory", "PeakCpu", "PeakMemory", "Samples", "LastSample", "AppPath")
+		for _, s := range stats {
+			fmt.Fprintf(cCtx.App.Writer, formatStr, s.Id, strconv.Itoa(s.Containers), formatCpu(s.CpuPercent), formatMemory(s.MemoryBytes),
+				formatCpu(s.PeakCpuPercent), formatMemory(s.PeakMemoryBytes), strconv.Itoa(s.Samples),
+				s.LastSampleTime.Format(time.RFC3339), s.AppPathDomain)
+		}
+	case FORMAT_CSV:
+		for _, s := range stats {
+			fmt.Fprintf(cCtx.App.Writer, "%s,%d,%.2f,%d,%.2f,%d,%d,%s,\"%s\"\n", s.Id, s.Containers, s.CpuPercent, s.MemoryBytes,
+				s.PeakCpuPercent, s.PeakMemoryBytes, s.Samples, s.LastSampleTime.Format(time.RFC3339), s.AppPathDomain)
+		}
+	default:
+		panic(fmt.Errorf("unknown format %s", format))
+	}
+}
+
+func formatCpu(percent float64) string {
+	return fmt.Sprintf("%.1f%%", percent)
+}
+
+// formatMemory formats the memory in MiB, or GiB for values above 1GiB
+func formatMemory(bytes int64) string {
+	if bytes >= 1<<30 {
+		return fmt.Sprintf("%.2fGiB", float64(bytes)/(1<<30))
+	}
+	return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+}
+
+func printCanaryStatus(cCtx *cli.Context, canaryResponse *types.AppCanaryResponse) {
+	canary := canaryResponse.Canary
+	if canary.Percent == 0 {
+		fmt.Fprintf(cCtx.App.Writer, "Canary disabled for %s\n", canaryResponse.AppPathDomain)
+		return
+	}
+
+	fmt.Fprintf(cCtx.App.Writer, "Canary enabled for %s: %d%% of users (%s) routed to stage, started %s\n",
+		canaryResponse.AppPathDomain, canary.Percent, canary.Sticky, canary.StartTime.Format(time.RFC3339))
+	formatStr := "%-6s %-7s %-40s %-10s %-8s %-s\n"
+	fmt.Fprintf(cCtx.App.Writer, formatStr, "Type", "Version", "App", "Requests", "Errors", "ErrorRate")
+	for _, stats := range []struct {
+		name  string
+		stats types.CanaryVersionStats
+	}{{"prod", canaryResponse.Prod}, {"stage", canaryResponse.Stage}} {
+		errorRate := 0.0
+		if stats.stats.Requests > 0 {
+			errorRate = float64(stats.stats.Errors) * 100 / float64(stats.stats.Requests)
+		}
+		fmt.Fprintf(cCtx.App.Writer, formatStr, stats.name, strconv.Itoa(stats.stats.Version), stats.stats.AppPathDomain,
+			strconv.Itoa(stats.stats.Requests), strconv.Itoa(stats.stats.Errors), fmt.Sprintf("%.1f%%", errorRate))
+	}
+}
+
 func appPromoteCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
 	flags := make([]cli.Flag, 0, len(commonFlags)+2)
 	flags = append(flags, commonFlags...)
@@ -683,6 +947,9 @@ func appPromoteCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 			for _, approveResult := range promoteResponse.PromoteResults {
 				fmt.Printf("Promoting %s\n", approveResult)
 			}
+			for _, verifyResult := range promoteResponse.VerifyResults {
+				printVerifyResult(cCtx, verifyResult)
+			}
 			fmt.Fprintf(cCtx.App.Writer, "%d app(s) promoted.\n", len(promoteResponse.PromoteResults))
 
 			if promoteResponse.DryRun {
@@ -0,0 +1,183 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"golang.org/x/term"
+)
+
+func appExecCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newBoolFlag("interactive", "i", "Pass the input to the command, enabled by default if the input is a terminal", false))
+	flags = append(flags, newIntFlag("replica", "", "The replica container to run the command in, starting from zero", 0))
+
+	return &cli.Command{
+		Name:      "exec",
+		Usage:     "Run a command in the app container",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<appPath> -- <command> [<args>...]",
+		UsageText: `args: <appPath> -- <command> [<args>...]
+
+<appPath> is the path of a container app. The command is run in the container for the current version of the
+app, the first replica is used by default. If the input is a terminal, a TTY is allocated and the input is
+passed to the command. Otherwise the command output is returned, with the exit code of the command as the
+exit code. Each exec session is audited. A TTY is allocated only with the api container runtime.
+
+	Examples:
+	  Shell in the container: clace app exec /myapp -- sh
+	  Run a command: clace app exec /myapp -- ls /data
+	  Pass the input to the command: echo hello | clace app exec -i /myapp -- cat
+	  Run in the second replica: clace app exec --replica 1 /myapp -- ps`,
+
+		Action: func(cCtx *cli.Context) error {
+			cmdArgs := cCtx.Args().Tail()
+			if len(cmdArgs) > 0 && cmdArgs[0] == "--" {
+				// Flag parsing stops at the app path, the separator is not removed
+				cmdArgs = cmdArgs[1:]
+			}
+			if cCtx.NArg() == 0 || len(cmdArgs) == 0 {
+				return fmt.Errorf("requires arguments: <appPath> -- <command> [<args>...]")
+			}
+
+			stdinFd, stdoutFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+			tty := term.IsTerminal(stdinFd) && term.IsTerminal(stdoutFd)
+			interactive := tty || cCtx.Bool("interactive")
+
+			values := url.Values{}
+			values.Add("appPath", cCtx.Args().First())
+			for _, arg := range cmdArgs {
+				values.Add("cmd", arg)
+			}
+			values.Add("tty", strconv.FormatBool(tty))
+			values.Add("interactive", strconv.FormatBool(interactive))
+			values.Add("replica", strconv.Itoa(cCtx.Int("replica")))
+			if tty {
+				if cols, rows, err := term.GetSize(stdoutFd); err == nil {
+					values.Add("size", fmt.Sprintf("%d %d", rows, cols))
+				}
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			conn, err := client.Upgrade("/_clace/app_exec", values, system.EXEC_PROTOCOL)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			ttyAllocated, err := readExecStart(conn)
+			if err != nil {
+				return err
+			}
+
+			var lock sync.Mutex
+			if tty && ttyAllocated {
+				// The terminal is switched to raw mode only if the server allocated a TTY, otherwise the
+				// terminal handles the line editing and the signals
+				oldState, err := term.MakeRaw(stdinFd)
+				if err != nil {
+					return fmt.Errorf("error setting terminal to raw mode: %w", err)
+				}
+				defer term.Restore(stdinFd, oldState)
+				go relayResize(conn, &lock, stdoutFd)
+			}
+			if interactive {
+				go relayInput(conn, &lock, os.Stdin)
+			}
+
+			exitCode, err := readExecOutput(conn, cCtx.App.Writer, cCtx.App.ErrWriter)
+			if err != nil {
+				return err
+			}
+			if exitCode != 0 {
+				return cli.Exit("", exitCode)
+			}
+			return nil
+		},
+	}
+}
+
+// relayInput sends the input to the server, followed by the end of input frame
+func relayInput(conn io.Writer, lock *sync.Mutex, input io.Reader) {
+	if _, err := io.Copy(&system.ExecFrameWriter{W: conn, Type: system.ExecStdin, Lock: lock}, input); err != nil {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	_ = system.WriteExecFrame(conn, system.ExecStdinClose, nil)
+}
+
+// relayResize sends the terminal size to the server when the terminal is resized
+func relayResize(conn io.Writer, lock *sync.Mutex, fd int) {
+	signals := make(chan os.Signal, 1)
+	system.NotifyTermResize(signals)
+	for range signals {
+		cols, rows, err := term.GetSize(fd)
+		if err != nil {
+			continue
+		}
+		lock.Lock()
+		err = system.WriteExecFrame(conn, system.ExecResize, fmt.Appendf(nil, "%d %d", rows, cols))
+		lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readExecStart reads the start frame sent by the server, returns whether a TTY was allocated for the command
+func readExecStart(conn io.Reader) (bool, error) {
+	frameType, data, err := system.ReadExecFrame(conn)
+	if err != nil {
+		return false, fmt.Errorf("error reading exec start: %w", err)
+	}
+	switch frameType {
+	case system.ExecStart:
+		return string(data) == "true", nil
+	case system.ExecError:
+		return false, errors.New(string(data))
+	default:
+		return false, fmt.Errorf("unexpected exec frame type %d, expected start", frameType)
+	}
+}
+
+// readExecOutput writes the command output from the server to stdout and stderr, until the exit code
+// is received. An error is returned if the server reports an error running the command
+func readExecOutput(conn io.Reader, stdout, stderr io.Writer) (int, error) {
+	for {
+		frameType, data, err := system.ReadExecFrame(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return -1, fmt.Errorf("connection closed before the command completed")
+			}
+			return -1, err
+		}
+		switch frameType {
+		case system.ExecStdout:
+			_, err = stdout.Write(data)
+		case system.ExecStderr:
+			_, err = stderr.Write(data)
+		case system.ExecExit:
+			return strconv.Atoi(string(data))
+		case system.ExecError:
+			return -1, errors.New(string(data))
+		}
+		if err != nil {
+			return -1, err
+		}
+	}
+}
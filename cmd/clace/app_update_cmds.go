@@ -23,6 +23,8 @@ func appUpdateSettingsCommand(commonFlags []cli.Flag, clientConfig *types.Client
 			appUpdatePreviewWrite(commonFlags, clientConfig),
 			appUpdateAuthnType(commonFlags, clientConfig),
 			appUpdateGitAuth(commonFlags, clientConfig),
+			appUpdateIPList(commonFlags, clientConfig, "allow-ips", "Update the IP allow list for apps"),
+			appUpdateIPList(commonFlags, clientConfig, "deny-ips", "Update the IP deny list for apps"),
 		},
 	}
 }
@@ -258,6 +260,65 @@ The second required argument is <appPathGlob>. ` + PATH_SPEC_HELP + `
 	}
 }
 
+func appUpdateIPList(commonFlags []cli.Flag, clientConfig *types.ClientConfig, name, usage string) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, dryRunFlag())
+
+	return &cli.Command{
+		Name:      name,
+		Usage:     usage,
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<cidrList> <appPathGlob>",
+
+		UsageText: `args: <cidrList> <appPathGlob>
+
+The first required argument <cidrList> is a comma separated list of CIDR ranges or IP addresses. Set to "-" to clear the list.
+If an allow list is set, only requests from the listed ranges are permitted. The deny list takes precedence over the allow list.
+The remote IP is determined using the security.trusted_proxies server config. The rules apply even if the app has auth set to none.
+The second required argument is <appPathGlob>. ` + PATH_SPEC_HELP + `
+
+	Examples:
+	  Allow access only from the VPN range: clace app update-settings ` + name + ` "10.8.0.0/16,192.168.1.10" /myapp
+	  Clear the list: clace app update-settings ` + name + ` - /myapp`,
+
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 2 {
+				return fmt.Errorf("requires two arguments: <cidrList> <appPathGlob>")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("appPathGlob", cCtx.Args().Get(1))
+			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+
+			body := types.CreateUpdateAppRequest()
+			if name == "allow-ips" {
+				body.AllowIPs = types.StringValue(cCtx.Args().Get(0))
+			} else {
+				body.DenyIPs = types.StringValue(cCtx.Args().Get(0))
+			}
+
+			var updateResponse types.AppUpdateSettingsResponse
+			if err := client.Post("/_clace/app_settings", values, body, &updateResponse); err != nil {
+				return err
+			}
+
+			for _, updateResult := range updateResponse.UpdateResults {
+				fmt.Printf("Updating %s\n", updateResult)
+			}
+			fmt.Fprintf(cCtx.App.Writer, "%d app(s) updated.\n", len(updateResponse.UpdateResults))
+
+			if updateResponse.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+
+			return nil
+		},
+	}
+}
+
 func appUpdateMetadataCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
 	return &cli.Command{
 		Name:  "update-metadata",
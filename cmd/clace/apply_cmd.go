@@ -26,6 +26,8 @@ func initApplyCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	flags = append(flags, newBoolFlag("promote", "p", "Promote changes from stage to prod", false))
 	flags = append(flags, newBoolFlag("clobber", "", "Force update app config, overwriting non-declarative changes", false))
 	flags = append(flags, newBoolFlag("force-reload", "f", "Force reload even if there is no new commit", false))
+	flags = append(flags, newStringFlag("env", "", "The environment name, available as the environment variable in the apply file", ""))
+	flags = append(flags, pruneFlags()...)
 	flags = append(flags, dryRunFlag())
 
 	return &cli.Command{
@@ -45,6 +47,8 @@ Examples:
   Apply app config for example.com domain apps: clace apply --reload=updated ./app.ace example.com:**
   Apply app config from git for all apps: clace apply --promote --approve github.com/claceio/apps/apps.ace all
   Apply app config from git for all apps, overwriting changes: clace apply --promote --clobber github.com/claceio/apps/apps.ace all
+  Preview apps which would be deleted since they are removed from config: clace apply --prune --dry-run github.com/claceio/apps/apps.ace
+  Apply app config for the staging environment: clace apply --env staging github.com/claceio/apps/apps.ace
 `,
 
 		Action: func(cCtx *cli.Context) error {
@@ -61,6 +65,10 @@ Examples:
 			if err != nil {
 				return err
 			}
+			prune, err := getPruneOption(cCtx)
+			if err != nil {
+				return err
+			}
 
 			values := url.Values{}
 			values.Add("applyPath", sourceUrl)
@@ -74,6 +82,8 @@ Examples:
 			values.Add("promote", strconv.FormatBool(cCtx.Bool("promote")))
 			values.Add("clobber", strconv.FormatBool(cCtx.Bool("clobber")))
 			values.Add("forceReload", strconv.FormatBool(cCtx.Bool("force-reload")))
+			values.Add("prune", string(prune))
+			values.Add("env", cCtx.String("env"))
 
 			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
 			var applyResponse types.AppApplyResponse
@@ -160,8 +170,80 @@ func printApplyResponse(cCtx *cli.Context, applyResponse *types.AppApplyResponse
 		fmt.Fprintln(cCtx.App.Writer)
 	}
 
-	fmt.Fprintf(cCtx.App.Writer, "%d app(s) created, %d app(s) updated, %d app(s) reloaded, %d app(s) skipped, %d app(s) approved, %d app(s) promoted.\n",
+	if applyResponse.DryRun && len(applyResponse.Diffs) > 0 {
+		printApplyPlan(cCtx, applyResponse.Diffs)
+	}
+
+	if len(applyResponse.PruneResults) > 0 {
+		fmt.Fprintf(cCtx.App.Writer, "Pruned apps (%s): ", applyResponse.PruneMode)
+		for i, pruneResult := range applyResponse.PruneResults {
+			if i > 0 {
+				fmt.Fprintf(cCtx.App.Writer, ", ")
+			}
+			fmt.Fprintf(cCtx.App.Writer, "%s", pruneResult)
+		}
+		fmt.Fprintln(cCtx.App.Writer)
+	}
+
+	fmt.Fprintf(cCtx.App.Writer, "%d app(s) created, %d app(s) updated, %d app(s) reloaded, %d app(s) skipped, %d app(s) approved, %d app(s) promoted",
 		len(applyResponse.CreateResults), len(applyResponse.UpdateResults), len(applyResponse.ReloadResults), len(applyResponse.SkippedResults), len(applyResponse.ApproveResults), len(applyResponse.PromoteResults))
+	if applyResponse.PruneMode != types.ApplyPruneNone {
+		fmt.Fprintf(cCtx.App.Writer, ", %d app(s) pruned", len(applyResponse.PruneResults))
+	}
+	fmt.Fprintln(cCtx.App.Writer, ".")
 
 	return nil
 }
+
+// printApplyPlan prints the field level changes which the apply would do, in a format similar to terraform plan
+func printApplyPlan(cCtx *cli.Context, diffs []types.AppDiff) {
+	counts := map[types.AppDiffAction]int{}
+	fmt.Fprintf(cCtx.App.Writer, "\nApply plan:\n")
+	for _, diff := range diffs {
+		counts[diff.Action]++
+		fmt.Fprintf(cCtx.App.Writer, "  %s %s (%s)\n", diffSymbol(diff.Action), diff.AppPathDomain, diff.Action)
+		for _, change := range diff.Changes {
+			switch {
+			case change.Old == "":
+				fmt.Fprintf(cCtx.App.Writer, "      + %s: %q\n", change.Field, change.New)
+			case change.New == "":
+				fmt.Fprintf(cCtx.App.Writer, "      - %s: %q\n", change.Field, change.Old)
+			default:
+				fmt.Fprintf(cCtx.App.Writer, "      ~ %s: %q -> %q\n", change.Field, change.Old, change.New)
+			}
+		}
+	}
+	fmt.Fprintf(cCtx.App.Writer, "Plan: %d to create, %d to update, %d to delete, %d to disable.\n\n",
+		counts[types.AppDiffCreate], counts[types.AppDiffUpdate], counts[types.AppDiffDelete], counts[types.AppDiffDisable])
+}
+
+func diffSymbol(action types.AppDiffAction) string {
+	switch action {
+	case types.AppDiffCreate:
+		return "+"
+	case types.AppDiffDelete:
+		return "-"
+	case types.AppDiffDisable:
+		return "!"
+	default:
+		return "~"
+	}
+}
+
+func pruneFlags() []cli.Flag {
+	return []cli.Flag{
+		newBoolFlag("prune", "", "Prune apps created by this apply file which are no longer present in the config", false),
+		newStringFlag("prune-mode", "", "The prune action for removed apps: delete or disable", string(types.ApplyPruneDelete)),
+	}
+}
+
+func getPruneOption(cCtx *cli.Context) (types.ApplyPruneOption, error) {
+	if !cCtx.Bool("prune") {
+		return types.ApplyPruneNone, nil
+	}
+	prune := types.ApplyPruneOption(cCtx.String("prune-mode"))
+	if prune != types.ApplyPruneDelete && prune != types.ApplyPruneDisable {
+		return "", fmt.Errorf("invalid prune-mode %s, expected delete or disable", prune)
+	}
+	return prune, nil
+}
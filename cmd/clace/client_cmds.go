@@ -16,8 +16,10 @@ func getClientCommands(clientConfig *types.ClientConfig) ([]*cli.Command, error)
 	commands = append(commands, initSyncCommand(flags, clientConfig))
 	commands = append(commands, initParamCommand(flags, clientConfig))
 	commands = append(commands, initVersionCommand(flags, clientConfig))
+	commands = append(commands, initContainerCommand(flags, clientConfig))
 	commands = append(commands, initWebhookCommand(flags, clientConfig))
 	commands = append(commands, initPreviewCommand(flags, clientConfig))
 	commands = append(commands, initAccountCommand(flags, clientConfig))
+	commands = append(commands, initSessionCommand(flags, clientConfig))
 	return commands, nil
 }
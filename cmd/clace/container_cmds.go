@@ -0,0 +1,101 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+func initContainerCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	return &cli.Command{
+		Name:  "container",
+		Usage: "Manage app containers",
+		Subcommands: []*cli.Command{
+			containerGCCommand(commonFlags, clientConfig),
+		},
+	}
+}
+
+func containerGCCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, dryRunFlag())
+	flags = append(flags, newBoolFlag("volumes", "", "Remove the volumes for deleted apps", false))
+
+	return &cli.Command{
+		Name:      "gc",
+		Usage:     "Remove the containers, images and networks no longer used by any app",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: " ",
+		UsageText: `args: none
+
+	Only the objects created by this server are considered. The containers for the active and previous versions
+	of each app are retained, along with their images. Running containers and service containers are retained,
+	except for deleted apps. Networks are removed only after the app is deleted. The volumes for deleted apps are
+	reported, they are removed only if --volumes is specified. The gc is also run in the background if enabled
+	with the container_gc_mins server config, volumes are never removed by the background gc. Use --dry-run to
+	report what would be removed.
+
+	Examples:
+		clace container gc --dry-run
+		clace container gc --volumes`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 0 {
+				return fmt.Errorf("no arguments expected")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+			values.Add("volumes", strconv.FormatBool(cCtx.Bool("volumes")))
+
+			var response types.ContainerGCResponse
+			err := client.Post("/_clace/container/gc", values, nil, &response)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range []struct {
+				kind  string
+				names []string
+			}{{"container", response.Containers}, {"image", response.Images}, {"network", response.Networks}} {
+				for _, name := range entry.names {
+					fmt.Fprintf(cCtx.App.Writer, "Removed %s %s\n", entry.kind, name)
+				}
+			}
+			volumeAction := "Unused"
+			if response.RemoveVolumes {
+				volumeAction = "Removed"
+			}
+			for _, name := range response.Volumes {
+				fmt.Fprintf(cCtx.App.Writer, "%s volume %s\n", volumeAction, name)
+			}
+			for _, e := range response.Errors {
+				fmt.Fprintf(cCtx.App.ErrWriter, "Error: %s\n", e)
+			}
+			fmt.Fprintf(cCtx.App.Writer, "Removed %d containers, %d images, %d networks\n",
+				len(response.Containers), len(response.Images), len(response.Networks))
+			if len(response.Volumes) > 0 {
+				if response.RemoveVolumes {
+					fmt.Fprintf(cCtx.App.Writer, "Removed %d volumes\n", len(response.Volumes))
+				} else {
+					fmt.Fprintf(cCtx.App.Writer, "%d volumes for deleted apps not removed, use --volumes to remove\n", len(response.Volumes))
+				}
+			}
+
+			if response.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+			return nil
+		},
+	}
+}
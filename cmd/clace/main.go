@@ -198,8 +198,15 @@ func main() {
 		},
 		ExitErrHandler: func(c *cli.Context, err error) {
 			if err != nil {
-				fmt.Fprintf(cli.ErrWriter, RED+"error: %s\n"+RESET, err)
-				os.Exit(1)
+				exitCode := 1
+				if exitErr, ok := err.(cli.ExitCoder); ok {
+					// Exit code from the command, like the exit code of the app exec command
+					exitCode = exitErr.ExitCode()
+				}
+				if err.Error() != "" {
+					fmt.Fprintf(cli.ErrWriter, RED+"error: %s\n"+RESET, err)
+				}
+				os.Exit(exitCode)
 			}
 		},
 		Commands: allCommands,
@@ -0,0 +1,158 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+func initSessionCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	return &cli.Command{
+		Name:  "session",
+		Usage: "Manage SSO sessions, requires security.session_store to be enabled on the server",
+		Subcommands: []*cli.Command{
+			sessionListCommand(commonFlags, clientConfig),
+			sessionRevokeCommand(commonFlags, clientConfig),
+		},
+	}
+}
+
+func sessionListCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newStringFlag("user", "u", "List sessions for the specified user only", ""))
+	flags = append(flags, newStringFlag("format", "f", "The display format. Valid options are table, basic, csv, json, jsonl and jsonl_pretty", ""))
+
+	return &cli.Command{
+		Name:      "list",
+		Usage:     "List the active SSO sessions",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "",
+		UsageText: `
+	Examples:
+	  List all sessions: clace session list
+	  List sessions for user: clace session list --user user@example.com`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 0 {
+				return fmt.Errorf("no args expected")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("user", cCtx.String("user"))
+
+			var response types.SessionListResponse
+			err := client.Get("/_clace/session", values, &response)
+			if err != nil {
+				return err
+			}
+
+			printSessionList(cCtx, response.Sessions, cmp.Or(cCtx.String("format"), clientConfig.Client.DefaultFormat))
+			return nil
+		},
+	}
+}
+
+func sessionRevokeCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+3)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newStringFlag("user", "u", "Revoke all sessions for the specified user", ""))
+	flags = append(flags, newStringFlag("id", "i", "Revoke the session with the specified id", ""))
+	flags = append(flags, dryRunFlag())
+
+	return &cli.Command{
+		Name:      "revoke",
+		Usage:     "Revoke SSO sessions, the user has to login again",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "",
+		UsageText: `
+	Examples:
+	  Revoke all sessions for user: clace session revoke --user user@example.com
+	  Revoke specific session: clace session revoke --id 9xD0k3Zb...`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 0 {
+				return fmt.Errorf("no args expected")
+			}
+			if cCtx.String("user") == "" && cCtx.String("id") == "" {
+				return fmt.Errorf("one of --user or --id is required")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("user", cCtx.String("user"))
+			values.Add("id", cCtx.String("id"))
+			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+
+			var response types.SessionRevokeResponse
+			err := client.Delete("/_clace/session", values, &response)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range response.Revoked {
+				fmt.Fprintf(cCtx.App.Writer, "Revoked session %s\n", id)
+			}
+			fmt.Fprintf(cCtx.App.Writer, "%d session(s) revoked\n", len(response.Revoked))
+
+			if response.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+			return nil
+		},
+	}
+}
+
+func printSessionList(cCtx *cli.Context, sessions []*types.SessionEntry, format string) {
+	switch format {
+	case FORMAT_JSON:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		enc.Encode(sessions)
+	case FORMAT_JSONL:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		for _, s := range sessions {
+			enc.Encode(s)
+		}
+	case FORMAT_JSONL_PRETTY:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		for _, s := range sessions {
+			enc.Encode(s)
+		}
+	case FORMAT_BASIC:
+		formatStr := "%-43s %-30s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "Id", "User", "LastSeen")
+
+		for _, s := range sessions {
+			fmt.Fprintf(cCtx.App.Writer, formatStr, s.Id, s.UserId, s.LastSeen.Local().Format(time.RFC3339))
+		}
+	case FORMAT_TABLE:
+		formatStr := "%-43s %-30s %-15s %-20s %-25s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "Id", "User", "Provider", "RemoteIP", "CreateTime", "LastSeen")
+
+		for _, s := range sessions {
+			fmt.Fprintf(cCtx.App.Writer, formatStr, s.Id, s.UserId, s.Provider, s.RemoteIP,
+				s.CreateTime.Local().Format(time.RFC3339), s.LastSeen.Local().Format(time.RFC3339))
+		}
+	case FORMAT_CSV:
+		for _, s := range sessions {
+			fmt.Fprintf(cCtx.App.Writer, "%s,%s,%s,%s,%s,%s\n", s.Id, s.UserId, s.Provider, s.RemoteIP,
+				s.CreateTime.Format(time.RFC3339), s.LastSeen.Format(time.RFC3339))
+		}
+	default:
+		panic(fmt.Errorf("unknown format %s", format))
+	}
+}
@@ -22,9 +22,11 @@ func initSyncCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *
 		Usage: "Manage sync operations, scheduled and webhook",
 		Subcommands: []*cli.Command{
 			syncScheduleCommand(commonFlags, clientConfig),
+			syncWebhookCommand(commonFlags, clientConfig),
 			syncRunCommand(commonFlags, clientConfig),
 			syncListCommand(commonFlags, clientConfig),
 			syncDeleteCommand(commonFlags, clientConfig),
+			syncDriftCommand(commonFlags, clientConfig),
 		},
 	}
 }
@@ -40,6 +42,8 @@ func syncScheduleCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfi
 	flags = append(flags, newIntFlag("minutes", "s", "Schedule sync for every N minutes", 0))
 	flags = append(flags, newBoolFlag("clobber", "", "Force update app config, overwriting non-declarative changes", false))
 	flags = append(flags, newBoolFlag("force-reload", "f", "Force reload even if there are no new commits", false))
+	flags = append(flags, newStringFlag("env", "", "The environment name, available as the environment variable in the apply file", ""))
+	flags = append(flags, pruneFlags()...)
 	flags = append(flags, dryRunFlag())
 
 	return &cli.Command{
@@ -70,6 +74,10 @@ Examples:
 			if err != nil {
 				return err
 			}
+			prune, err := getPruneOption(cCtx)
+			if err != nil {
+				return err
+			}
 
 			values.Add("path", sourceUrl)
 			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
@@ -83,6 +91,8 @@ Examples:
 				Reload:            string(reloadMode),
 				Clobber:           cCtx.Bool("clobber"),
 				ForceReload:       cCtx.Bool("force-reload"),
+				Prune:             prune,
+				Environment:       cCtx.String("env"),
 				ScheduleFrequency: cCtx.Int("minutes"),
 			}
 
@@ -109,6 +119,93 @@ Examples:
 	}
 }
 
+func syncWebhookCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newStringFlag("branch", "b", "The branch to checkout if using git source", "main"))
+	flags = append(flags, newStringFlag("git-auth", "g", "The name of the git_auth entry in server config to use", ""))
+	flags = append(flags, newBoolFlag("approve", "a", "Approve the app permissions", false))
+	flags = append(flags, newStringFlag("reload", "r", "Which apps to reload: none, updated, matched", ""))
+	flags = append(flags, newBoolFlag("promote", "p", "Promote changes from stage to prod", false))
+	flags = append(flags, newBoolFlag("clobber", "", "Force update app config, overwriting non-declarative changes", false))
+	flags = append(flags, newBoolFlag("force-reload", "f", "Force reload even if there are no new commits", false))
+	flags = append(flags, newStringFlag("env", "", "The environment name, available as the environment variable in the apply file", ""))
+	flags = append(flags, pruneFlags()...)
+	flags = append(flags, dryRunFlag())
+
+	return &cli.Command{
+		Name:      "webhook",
+		Usage:     "Create webhook triggered sync job for updating app config",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<filePath>",
+		UsageText: `args: <filePath>
+
+<filePath> is the git path to the apply file containing the app configuration. The returned webhook url and
+secret should be configured as a push webhook in GitHub, GitLab or Gitea. Pushes to other branches are ignored.
+
+Examples:
+  Create webhook sync, reloading apps with code changes: clace sync webhook github.com/claceio/apps/apps.ace
+  Create webhook sync, promoting changes: clace sync webhook --promote --approve github.com/claceio/apps/apps.ace
+`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				return fmt.Errorf("expected one arg : <filePath>")
+			}
+
+			reloadMode := types.AppReloadOption(cmp.Or(cCtx.String("reload"), string(types.AppReloadOptionMatched)))
+			values := url.Values{}
+
+			sourceUrl, err := makeAbsolute(cCtx.Args().Get(0))
+			if err != nil {
+				return err
+			}
+			prune, err := getPruneOption(cCtx)
+			if err != nil {
+				return err
+			}
+
+			values.Add("path", sourceUrl)
+			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+			values.Add("scheduled", "false")
+
+			sync := types.SyncMetadata{
+				GitBranch:   cCtx.String("branch"),
+				GitAuth:     cCtx.String("git-auth"),
+				Promote:     cCtx.Bool("promote"),
+				Approve:     cCtx.Bool("approve"),
+				Reload:      string(reloadMode),
+				Clobber:     cCtx.Bool("clobber"),
+				ForceReload: cCtx.Bool("force-reload"),
+				Prune:       prune,
+				Environment: cCtx.String("env"),
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			var syncResponse types.SyncCreateResponse
+			err = client.Post("/_clace/sync", values, sync, &syncResponse)
+			if err != nil {
+				return err
+			}
+
+			if syncResponse.SyncJobStatus.Error != "" {
+				return fmt.Errorf("error creating sync job: %s", syncResponse.SyncJobStatus.Error)
+			}
+
+			printApplyResponse(cCtx, &syncResponse.SyncJobStatus.ApplyResponse)
+
+			fmt.Printf("\nSync job created with Id: %s\n", syncResponse.Id)
+			fmt.Printf("Webhook Url: %s\n", syncResponse.WebhookUrl)
+			fmt.Printf("Webhook Secret: %s\n", syncResponse.WebhookSecret)
+			if syncResponse.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+
+			return nil
+		},
+	}
+}
+
 func syncListCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
 	flags := make([]cli.Flag, 0, len(commonFlags)+2)
 	flags = append(flags, commonFlags...)
@@ -231,6 +328,91 @@ func syncDeleteCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig)
 	}
 }
 
+func syncDriftCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newBoolFlag("audit", "", "Record an audit event for each drifted app", false))
+	flags = append(flags, newStringFlag("format", "f", "The display format. Valid options are table, basic, csv, json, jsonl and jsonl_pretty", ""))
+
+	return &cli.Command{
+		Name:      "drift",
+		Usage:     "Report apps which have drifted from the applied config",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "[<filePath>]",
+		UsageText: `args: [<filePath>]
+
+<filePath> is the path to the apply file. If not specified, all apps created through apply are checked.
+Changes done through update-param and update-metadata which are not in the applied config are reported.
+
+Examples:
+  Check drift for all apps: clace sync drift
+  Check drift for apps from an apply file: clace sync drift github.com/claceio/apps/apps.ace
+  Check drift and record audit events: clace sync drift --audit github.com/claceio/apps/apps.ace`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 1 {
+				return fmt.Errorf("expected zero or one arg : [<filePath>]")
+			}
+
+			values := url.Values{}
+			if cCtx.NArg() == 1 {
+				sourceUrl, err := makeAbsolute(cCtx.Args().First())
+				if err != nil {
+					return err
+				}
+				values.Add("path", sourceUrl)
+			}
+			values.Add("audit", strconv.FormatBool(cCtx.Bool("audit")))
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			var response types.SyncDriftResponse
+			err := client.Get("/_clace/sync/drift", values, &response)
+			if err != nil {
+				return err
+			}
+
+			printSyncDrift(cCtx, response.Drifts, cmp.Or(cCtx.String("format"), clientConfig.Client.DefaultFormat))
+			return nil
+		},
+	}
+}
+
+func printSyncDrift(cCtx *cli.Context, drifts []*types.AppDrift, format string) {
+	switch format {
+	case FORMAT_JSON:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		enc.Encode(drifts)
+	case FORMAT_JSONL:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		for _, d := range drifts {
+			enc.Encode(d)
+		}
+	case FORMAT_JSONL_PRETTY:
+		enc := json.NewEncoder(cCtx.App.Writer)
+		enc.SetIndent("", "  ")
+		for _, d := range drifts {
+			enc.Encode(d)
+		}
+	case FORMAT_BASIC, FORMAT_TABLE:
+		formatStr := "%-30s %-30s %-25s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "App", "Field", "Applied", "Live")
+		for _, d := range drifts {
+			for _, c := range d.Changes {
+				fmt.Fprintf(cCtx.App.Writer, formatStr, d.AppPathDomain, c.Field, c.Old, c.New)
+			}
+		}
+	case FORMAT_CSV:
+		for _, d := range drifts {
+			for _, c := range d.Changes {
+				fmt.Fprintf(cCtx.App.Writer, "%s,%s,%s,\"%s\",\"%s\"\n", d.AppPathDomain, d.ApplySource, c.Field, c.Old, c.New)
+			}
+		}
+	default:
+		panic(fmt.Errorf("unknown format %s", format))
+	}
+}
+
 func printSyncList(cCtx *cli.Context, sync []*types.SyncEntry, format string) {
 	switch format {
 	case FORMAT_JSON:
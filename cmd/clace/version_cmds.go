@@ -23,8 +23,10 @@ func initVersionCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig
 		Subcommands: []*cli.Command{
 			versionListCommand(commonFlags, clientConfig),
 			versionFilesCommand(commonFlags, clientConfig),
+			versionDiffCommand(commonFlags, clientConfig),
 			versionSwitchCommand(commonFlags, clientConfig),
 			versionRevertCommand(commonFlags, clientConfig),
+			versionGCCommand(commonFlags, clientConfig),
 		},
 	}
 }
@@ -194,6 +196,86 @@ func printFileList(cCtx *cli.Context, files []types.AppFile, format string) {
 	}
 }
 
+func versionDiffCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, newStringFlag("format", "f", "The display format. Valid options are table, basic and json", ""))
+
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "Show the file and metadata changes between two versions of the app",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: "<appPath> <fromVersion> <toVersion>",
+		UsageText: `args: <appPath> <fromVersion> <toVersion>
+
+    <app_path> is a required first argument. The optional domain and path are separated by a ":". This is the app for which versions are compared.
+	<fromVersion> and <toVersion> are the required versions to compare. The output is a unified diff of the changed source files,
+	preceded by the metadata (params, permissions, container options, git commit and message) changes.
+
+	Examples:
+		clace version diff example.com:/myapp 12 15`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 3 {
+				return fmt.Errorf("requires three arguments: <appPath> <fromVersion> <toVersion>")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add("appPath", cCtx.Args().First())
+			values.Add("from", cCtx.Args().Get(1))
+			values.Add("to", cCtx.Args().Get(2))
+
+			var response types.AppVersionDiffResponse
+			err := client.Get("/_clace/version/diff", values, &response)
+			if err != nil {
+				return err
+			}
+
+			printVersionDiff(cCtx, response, cmp.Or(cCtx.String("format"), clientConfig.Client.DefaultFormat))
+			return nil
+		},
+	}
+}
+
+func printVersionDiff(cCtx *cli.Context, response types.AppVersionDiffResponse, format string) {
+	if format == FORMAT_JSON || format == FORMAT_JSONL || format == FORMAT_JSONL_PRETTY {
+		enc := json.NewEncoder(cCtx.App.Writer)
+		if format != FORMAT_JSONL {
+			enc.SetIndent("", "  ")
+		}
+		enc.Encode(response)
+		return
+	}
+
+	if len(response.MetadataChanges) == 0 && len(response.Files) == 0 {
+		fmt.Fprintf(cCtx.App.Writer, "No changes between version %d and %d\n", response.FromVersion, response.ToVersion)
+		return
+	}
+
+	if len(response.MetadataChanges) > 0 {
+		formatStr := "%-30s %-30s %-s\n"
+		fmt.Fprintf(cCtx.App.Writer, "Metadata changes from version %d to %d:\n", response.FromVersion, response.ToVersion)
+		fmt.Fprintf(cCtx.App.Writer, formatStr, "Field", "Old", "New")
+		for _, c := range response.MetadataChanges {
+			fmt.Fprintf(cCtx.App.Writer, formatStr, c.Field, c.Old, c.New)
+		}
+		fmt.Fprintln(cCtx.App.Writer)
+	}
+
+	for _, f := range response.Files {
+		if f.Binary {
+			fmt.Fprintf(cCtx.App.Writer, "Binary file %s %s\n", f.Name, f.Status)
+			continue
+		}
+		if f.Diff == "" {
+			fmt.Fprintf(cCtx.App.Writer, "Empty file %s %s\n", f.Name, f.Status)
+			continue
+		}
+		fmt.Fprint(cCtx.App.Writer, f.Diff)
+	}
+}
+
 func versionSwitchCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
 	flags := make([]cli.Flag, 0, len(commonFlags)+2)
 	flags = append(flags, commonFlags...)
@@ -233,6 +315,9 @@ func versionSwitchCommand(commonFlags []cli.Flag, clientConfig *types.ClientConf
 			}
 
 			fmt.Fprintf(cCtx.App.Writer, "Switched %s from version %d to version %d\n", cCtx.Args().Get(1), response.FromVersion, response.ToVersion)
+			if response.VerifyResult != nil {
+				printVerifyResult(cCtx, *response.VerifyResult)
+			}
 
 			if response.DryRun {
 				fmt.Print(DRY_RUN_MESSAGE)
@@ -280,6 +365,57 @@ func versionRevertCommand(commonFlags []cli.Flag, clientConfig *types.ClientConf
 			}
 
 			fmt.Fprintf(cCtx.App.Writer, "Reverted %s from version %d to version %d\n", cCtx.Args().First(), response.FromVersion, response.ToVersion)
+			if response.VerifyResult != nil {
+				printVerifyResult(cCtx, *response.VerifyResult)
+			}
+
+			if response.DryRun {
+				fmt.Print(DRY_RUN_MESSAGE)
+			}
+
+			return nil
+		},
+	}
+}
+
+func versionGCCommand(commonFlags []cli.Flag, clientConfig *types.ClientConfig) *cli.Command {
+	flags := make([]cli.Flag, 0, len(commonFlags)+2)
+	flags = append(flags, commonFlags...)
+	flags = append(flags, dryRunFlag())
+
+	return &cli.Command{
+		Name:      "gc",
+		Usage:     "Delete old app versions and the files no longer used by any version",
+		Flags:     flags,
+		Before:    altsrc.InitInputSourceWithContext(flags, altsrc.NewTomlSourceFromFlagFunc(configFileFlagName)),
+		ArgsUsage: " ",
+		UsageText: `args: none
+
+	Versions are retained as per the version_keep_count and version_keep_days server config. The active version
+	and the previous version of each app are always retained. Use --dry-run to report the space which would be reclaimed.
+
+	Examples:
+		clace version gc --dry-run`,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 0 {
+				return fmt.Errorf("no arguments expected")
+			}
+
+			client := system.NewHttpClient(clientConfig.ServerUri, clientConfig.AdminUser, clientConfig.Client.AdminPassword, clientConfig.Client.SkipCertCheck)
+			values := url.Values{}
+			values.Add(DRY_RUN_ARG, strconv.FormatBool(cCtx.Bool(DRY_RUN_FLAG)))
+
+			var response types.VersionGCResponse
+			err := client.Post("/_clace/version/gc", values, nil, &response)
+			if err != nil {
+				return err
+			}
+
+			for _, app := range response.Apps {
+				fmt.Fprintf(cCtx.App.Writer, "%s: deleted versions %v\n", app.AppPathDomain, app.Versions)
+			}
+			fmt.Fprintf(cCtx.App.Writer, "Deleted %d versions, %d files, %d bytes reclaimed\n",
+				response.VersionsDeleted, response.FilesDeleted, response.BytesReclaimed)
 
 			if response.DryRun {
 				fmt.Print(DRY_RUN_MESSAGE)
@@ -67,13 +67,14 @@ type Action struct {
 	auditInsert       func(*types.AuditEvent) error
 	containerManager  any // Container manager, if available, used to run commands in the container
 	esmLibs           []types.JSLibrary
+	csrfProtection    bool
 }
 
 // NewAction creates a new action
 func NewAction(logger *types.Logger, sourceFS *appfs.SourceFs, isDev bool, name, description, apath string, run, suggest starlark.Callable,
 	params []apptype.AppParam, paramValuesStr map[string]string, paramDict starlark.StringDict,
 	appPath string, styleType types.StyleType, containerProxyUrl string, hidden []string, showValidate bool,
-	auditInsert func(*types.AuditEvent) error, containerManager any, jsLibs []types.JSLibrary) (*Action, error) {
+	auditInsert func(*types.AuditEvent) error, containerManager any, jsLibs []types.JSLibrary, csrfProtection bool) (*Action, error) {
 
 	funcMap := system.GetFuncMap()
 
@@ -146,6 +147,7 @@ func NewAction(logger *types.Logger, sourceFS *appfs.SourceFs, isDev bool, name,
 		auditInsert:       auditInsert,
 		containerManager:  containerManager,
 		esmLibs:           esmLibs,
+		csrfProtection:    csrfProtection,
 		// Links, AppTemplate and Theme names are initialized later
 	}, nil
 }
@@ -205,6 +207,11 @@ func (a *Action) execAction(w http.ResponseWriter, r *http.Request, isSuggest, i
 		return
 	}
 
+	if a.csrfProtection && !system.ValidateCsrfToken(r, system.GetContextAppId(r.Context())) {
+		http.Error(w, "CSRF token validation failed", http.StatusForbidden)
+		return
+	}
+
 	thread := &starlark.Thread{
 		Name:  a.name,
 		Print: func(_ *starlark.Thread, msg string) { fmt.Println(msg) },
@@ -461,6 +468,7 @@ func (a *Action) execAction(w http.ResponseWriter, r *http.Request, isSuggest, i
 		"lightTheme":  a.LightTheme,
 		"darkTheme":   a.DarkTheme,
 		"esmLibs":     a.esmLibs,
+		"cspNonce":    system.GetContextValue(r.Context(), types.CSP_NONCE),
 	}
 
 	if !isHtmxRequest {
@@ -804,6 +812,10 @@ func (a *Action) getForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	linksWithQS := a.getLinksWithQS(r.URL.RawQuery)
+	csrfToken := ""
+	if a.csrfProtection {
+		csrfToken = system.GetCsrfToken(w, r, system.GetContextAppId(r.Context()), a.appPath)
+	}
 	input := map[string]any{
 		"dev":           a.isDev,
 		"name":          a.name,
@@ -819,6 +831,8 @@ func (a *Action) getForm(w http.ResponseWriter, r *http.Request) {
 		"showSuggest":   a.suggest != nil,
 		"showValidate":  a.showValidate,
 		"esmLibs":       a.esmLibs,
+		"csrfToken":     csrfToken,
+		"cspNonce":      system.GetContextValue(r.Context(), types.CSP_NONCE),
 	}
 	err := a.actionTemplate.ExecuteTemplate(w, "form.go.html", input)
 	if err != nil {
@@ -5,6 +5,7 @@ package app
 
 import (
 	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,6 +25,7 @@ import (
 	"github.com/claceio/clace/internal/app/action"
 	"github.com/claceio/clace/internal/app/appfs"
 	"github.com/claceio/clace/internal/app/apptype"
+	"github.com/claceio/clace/internal/app/container"
 	"github.com/claceio/clace/internal/app/dev"
 	"github.com/claceio/clace/internal/app/starlark_type"
 	"github.com/claceio/clace/internal/system"
@@ -59,21 +61,26 @@ type App struct {
 	containerManager *ContainerManager
 	serverConfig     *types.ServerConfig
 
+	previousContainers []container.ContainerName // containers of the previous version, set when it is retired
+
 	globals      starlark.StringDict    // global variables defined in starlark code
 	appDef       *starlarkstruct.Struct // app starlark definition
 	errorHandler starlark.Callable      // error handler function
 	appRouter    *chi.Mux               // router for the app
 	actions      []*action.Action       // actions defined for the app
 
-	usesHtmlTemplate bool                          // Whether the app uses HTML templates, false if only JSON APIs
-	template         *template.Template            // unstructured templates, no base_templates defined
-	templateMap      map[string]*template.Template // structured templates, base_templates defined
-	staticOnly       bool                          // app has only static files, no HTML routes
-	jsLibs           []types.JSLibrary             // JS libraries used by the app
+	usesHtmlTemplate  bool                          // Whether the app uses HTML templates, false if only JSON APIs
+	template          *template.Template            // unstructured templates, no base_templates defined
+	templateMap       map[string]*template.Template // structured templates, base_templates defined
+	canaryTemplate    *template.Template            // stage apps only, templates for canary requests served at the prod path
+	canaryTemplateMap map[string]*template.Template // stage apps only, structured templates for canary requests
+	staticOnly        bool                          // app has only static files, no HTML routes
+	jsLibs            []types.JSLibrary             // JS libraries used by the app
 
 	watcher       *fsnotify.Watcher
 	sseListeners  []chan SSEMessage
 	funcMap       template.FuncMap
+	canaryFuncMap template.FuncMap // stage apps only, static paths are under the prod app path
 	starlarkCache map[string]*starlarkCacheEntry
 
 	// App config that takes default values from toml config, overridden with app level metadata.
@@ -81,10 +88,16 @@ type App struct {
 	// config defaults are applied.
 	AppConfig types.AppConfig
 
-	lastRequestTime atomic.Int64
-	secretEvalFunc  func([][]string, string, string) (string, error)
-	auditInsert     func(*types.AuditEvent) error
-	AppRunPath      string // path to the app run directory
+	lastRequestTime  atomic.Int64
+	inflightRequests atomic.Int64 // used to drain requests before the app is retired
+	secretEvalFunc   func([][]string, string, string) (string, error)
+	auditInsert      func(*types.AuditEvent) error
+	statsInsert      func(*types.ContainerStatsSample) error
+	AppRunPath       string // path to the app run directory
+
+	ipFilter       *system.IPFilter // nil if there are no IP allow/deny rules
+	requestLimiter *RateLimiter     // nil if request rate limiting is disabled
+	pluginLimiter  *RateLimiter     // nil if plugin call rate limiting is disabled
 }
 
 type starlarkCacheEntry struct {
@@ -101,7 +114,8 @@ func NewApp(sourceFS *appfs.SourceFs, workFS *appfs.WorkFs, logger *types.Logger
 	appEntry *types.AppEntry, systemConfig *types.SystemConfig,
 	plugins map[string]types.PluginSettings, appConfig types.AppConfig, notifyClose chan<- types.AppPathDomain,
 	secretEvalFunc func([][]string, string, string) (string, error),
-	auditInsert func(*types.AuditEvent) error, serverConfig *types.ServerConfig) (*App, error) {
+	auditInsert func(*types.AuditEvent) error, statsInsert func(*types.ContainerStatsSample) error,
+	serverConfig *types.ServerConfig) (*App, error) {
 	newApp := &App{
 		sourceFS:       sourceFS,
 		Logger:         logger,
@@ -112,6 +126,7 @@ func NewApp(sourceFS *appfs.SourceFs, workFS *appfs.WorkFs, logger *types.Logger
 		secretEvalFunc: secretEvalFunc,
 		appStyle:       &dev.AppStyle{},
 		auditInsert:    auditInsert,
+		statsInsert:    statsInsert,
 		serverConfig:   serverConfig,
 	}
 	newApp.plugins = NewAppPlugins(newApp, plugins, appEntry.Metadata.Accounts)
@@ -119,15 +134,37 @@ func NewApp(sourceFS *appfs.SourceFs, workFS *appfs.WorkFs, logger *types.Logger
 	if err := newApp.updateAppConfig(); err != nil {
 		return nil, err
 	}
+	newApp.initRateLimiters()
+
+	var err error
+	if newApp.ipFilter, err = system.NewIPFilter(appEntry.Settings.AllowIPs, appEntry.Settings.DenyIPs); err != nil {
+		return nil, err
+	}
 
 	if appEntry.IsDev {
 		newApp.appDev = dev.NewAppDev(logger, &appfs.WritableSourceFs{SourceFs: sourceFS}, workFS, newApp.appStyle, systemConfig)
 	}
 
+	newApp.funcMap = newFuncMap(newApp.Path, sourceFS)
+	if strings.HasPrefix(string(appEntry.Id), types.ID_PREFIX_APP_STAGE) {
+		// The stage app serves the canary requests for the prod app, at the prod app path
+		newApp.canaryFuncMap = newFuncMap(cmp.Or(strings.TrimSuffix(newApp.Path, types.STAGE_SUFFIX), "/"), sourceFS)
+	}
+
+	clHome := cmp.Or(os.Getenv("CL_HOME"), "./")
+	newApp.AppRunPath = fmt.Sprintf("%s/run/app/%s", clHome, appEntry.Id)
+	if err := os.MkdirAll(newApp.AppRunPath, 0700); err != nil {
+		return nil, err
+	}
+	return newApp, nil
+}
+
+// newFuncMap returns the template functions for the app, static file paths are under the app path
+func newFuncMap(appPath string, sourceFS *appfs.SourceFs) template.FuncMap {
 	funcMap := system.GetFuncMap()
 	funcMap["static"] = func(name string) string {
 		staticPath := path.Join("static", name)
-		fullPath := path.Join(newApp.Path, sourceFS.HashName(staticPath))
+		fullPath := path.Join(appPath, sourceFS.HashName(staticPath))
 		return fullPath
 	}
 	funcMap["fileNonEmpty"] = func(name string) bool {
@@ -138,15 +175,7 @@ func NewApp(sourceFS *appfs.SourceFs, workFS *appfs.WorkFs, logger *types.Logger
 		}
 		return fi.Size() > 0
 	}
-
-	newApp.funcMap = funcMap
-
-	clHome := cmp.Or(os.Getenv("CL_HOME"), "./")
-	newApp.AppRunPath = fmt.Sprintf("%s/run/app/%s", clHome, appEntry.Id)
-	if err := os.MkdirAll(newApp.AppRunPath, 0700); err != nil {
-		return nil, err
-	}
-	return newApp, nil
+	return funcMap
 }
 
 func (a *App) Initialize(dryRun types.DryRun) error {
@@ -307,46 +336,13 @@ func (a *App) Reload(force, immediate bool, dryRun types.DryRun) (bool, error) {
 		return false, err
 	}
 
-	if len(baseFiles) == 0 {
-		// No base templates found, use the default unstructured templates
-		if a.template, err = a.sourceFS.ParseFS(a.funcMap, a.codeConfig.Routing.TemplateLocations...); err != nil {
-			if strings.Contains(err.Error(), "pattern matches no files") {
-				if a.usesHtmlTemplate {
-					// No html templates found, but app has html routes
-					return false, err
-				}
-				// no html templates, ignore error
-			} else {
-				// Some other error parsing templates, report
-				return false, err
-			}
-		}
-	} else {
-		// Base templates found, using structured templates
-		base, err := a.sourceFS.ParseFS(a.funcMap, baseFiles...)
-		if err != nil {
+	if a.template, a.templateMap, err = a.parseTemplates(a.funcMap, baseFiles); err != nil {
+		return false, err
+	}
+	if a.canaryFuncMap != nil {
+		if a.canaryTemplate, a.canaryTemplateMap, err = a.parseTemplates(a.canaryFuncMap, baseFiles); err != nil {
 			return false, err
 		}
-
-		a.templateMap = make(map[string]*template.Template)
-		for _, paths := range a.codeConfig.Routing.TemplateLocations {
-			files, err := a.sourceFS.Glob(paths)
-			if err != nil {
-				return false, err
-			}
-
-			for _, file := range files {
-				tmpl, err := base.Clone()
-				if err != nil {
-					return false, err
-				}
-
-				a.templateMap[file], err = tmpl.ParseFS(a.sourceFS.ReadableFS, file)
-				if err != nil {
-					return false, err
-				}
-			}
-		}
 	}
 	for _, action := range a.actions {
 		// structured templates are not supported for actions currently
@@ -366,6 +362,8 @@ func (a *App) Reload(force, immediate bool, dryRun types.DryRun) (bool, error) {
 const (
 	CONTAINERFILE = "Containerfile"
 	DOCKERFILE    = "Dockerfile"
+
+	DRAIN_POLL_INTERVAL = 100 * time.Millisecond
 )
 
 func (a *App) loadContainerManager(stripAppPath bool) error {
@@ -375,10 +373,10 @@ func (a *App) loadContainerManager(stripAppPath bool) error {
 		return nil
 	}
 
-	if a.systemConfig.ContainerCommand == "" {
+	if !container.RuntimeEnabled(a.systemConfig) {
 		return fmt.Errorf("app requires container support. Container management is not enabled in Clace server config. " +
 			"Install Docker/Podman and set the container_command in system config or set to auto (default) and ensure that " +
-			"the container manager command is in the PATH")
+			"the container manager command is in the PATH. For the api container_runtime, ensure that the container_socket is available")
 	}
 
 	var ok bool
@@ -455,6 +453,11 @@ func (a *App) loadContainerManager(stripAppPath bool) error {
 		return fmt.Errorf("error reading cargs: %w", err)
 	}
 
+	services, err := apptype.GetDictAttr(configAttr, "services", true)
+	if err != nil {
+		return fmt.Errorf("error reading services: %w", err)
+	}
+
 	// Parse the source file specification
 	var fileName string
 	switch src {
@@ -499,7 +502,7 @@ func (a *App) loadContainerManager(stripAppPath bool) error {
 	a.containerManager, err = NewContainerManager(a.Logger, a,
 		fileName, a.systemConfig, port, lifetime, scheme, health, buildDir,
 		a.sourceFS, a.paramValuesStr, a.AppConfig.Container, stripAppPath, volumes,
-		a.getSecretsAllowed("container.in", "config"), cargs)
+		a.getSecretsAllowed("container.in", "config"), cargs, services)
 	if err != nil {
 		return fmt.Errorf("error creating container manager: %w", err)
 	}
@@ -507,26 +510,94 @@ func (a *App) loadContainerManager(stripAppPath bool) error {
 	return nil
 }
 
-func (a *App) executeTemplate(w io.Writer, template, partial string, data any) error {
+// parseTemplates parses the app templates with the template functions. If there are no base templates,
+// the unstructured template is returned. Otherwise the structured templates are returned, one per file
+func (a *App) parseTemplates(funcMap template.FuncMap, baseFiles []string) (*template.Template, map[string]*template.Template, error) {
+	if len(baseFiles) == 0 {
+		// No base templates found, use the default unstructured templates
+		tmpl, err := a.sourceFS.ParseFS(funcMap, a.codeConfig.Routing.TemplateLocations...)
+		if err != nil {
+			if strings.Contains(err.Error(), "pattern matches no files") {
+				if a.usesHtmlTemplate {
+					// No html templates found, but app has html routes
+					return nil, nil, err
+				}
+				// no html templates, ignore error
+				return nil, nil, nil
+			}
+			// Some other error parsing templates, report
+			return nil, nil, err
+		}
+		return tmpl, nil, nil
+	}
+
+	// Base templates found, using structured templates
+	base, err := a.sourceFS.ParseFS(funcMap, baseFiles...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	templateMap := make(map[string]*template.Template)
+	for _, paths := range a.codeConfig.Routing.TemplateLocations {
+		files, err := a.sourceFS.Glob(paths)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, file := range files {
+			tmpl, err := base.Clone()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			templateMap[file], err = tmpl.ParseFS(a.sourceFS.ReadableFS, file)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return nil, templateMap, nil
+}
+
+// requestAppPath returns the app path as seen by the client. For canary requests served by the stage
+// app, this is the prod app path
+func (a *App) requestAppPath(r *http.Request) string {
+	if prodPath := system.GetContextValue(r.Context(), types.CANARY_PROD_PATH); prodPath != "" && a.canaryFuncMap != nil {
+		return prodPath
+	}
+	return a.Path
+}
+
+// isCanaryRequest returns true for canary requests for the prod app served by the stage app. These are
+// prod user requests, so the stage app write access restriction does not apply
+func isCanaryRequest(ctx context.Context) bool {
+	return ctx != nil && system.GetContextValue(ctx, types.CANARY_PROD_PATH) != ""
+}
+
+func (a *App) executeTemplate(w io.Writer, r *http.Request, template, partial string, data any) error {
 	var err error
-	if a.template != nil {
+	appTemplate, templateMap := a.template, a.templateMap
+	if a.requestAppPath(r) != a.Path {
+		appTemplate, templateMap = a.canaryTemplate, a.canaryTemplateMap
+	}
+	if appTemplate != nil {
 		exec := partial
 		if partial == "" {
 			exec = template
 		}
-		if err = a.template.ExecuteTemplate(w, exec, data); err != nil {
+		if err = appTemplate.ExecuteTemplate(w, exec, data); err != nil {
 			return err
 		}
 	} else {
 		if template == "" {
-			if _, ok := a.templateMap[partial]; ok {
+			if _, ok := templateMap[partial]; ok {
 				template = partial
 			} else {
 				template = "index.go.html"
 			}
 		}
 
-		t, ok := a.templateMap[template]
+		t, ok := templateMap[template]
 		if !ok {
 			return fmt.Errorf("template %s not found", template)
 		}
@@ -588,6 +659,8 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r = a.addSecurityHeaders(w, r)
+
 	if a.AppConfig.CORS.AllowOrigin != "" {
 		origin := a.AppConfig.CORS.AllowOrigin
 		if a.AppConfig.CORS.AllowOrigin == "origin" {
@@ -611,10 +684,182 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if a.requestLimiter != nil || a.pluginLimiter != nil {
+		rateLimitKey := a.rateLimitKey(r)
+		if !a.checkRequestRateLimit(w, r, rateLimitKey) {
+			return
+		}
+		// Save the key in the context, used for the plugin call limits
+		r = r.WithContext(context.WithValue(r.Context(), types.RATE_LIMIT_KEY, rateLimitKey))
+	}
+
 	a.lastRequestTime.Store(time.Now().Unix()) // new api call, update last request time
+	a.inflightRequests.Add(1)
+	defer a.inflightRequests.Add(-1)
 	a.appRouter.ServeHTTP(w, r)
 }
 
+// HasContainers returns true if the app is initialized and has running containers. For such apps, the
+// new version is started before the app is switched, see Retire
+func (a *App) HasContainers() bool {
+	a.initMutex.Lock()
+	defer a.initMutex.Unlock()
+	return a.initialized && !a.IsDev && a.containerManager != nil && len(a.containerManager.replicaNames()) > 0
+}
+
+// ContainerImage returns the image used by the app containers. Empty if the app is not initialized or
+// does not use containers
+func (a *App) ContainerImage() container.ImageName {
+	a.initMutex.Lock()
+	defer a.initMutex.Unlock()
+	if !a.initialized || a.containerManager == nil {
+		return ""
+	}
+	return a.containerManager.GenImageName
+}
+
+// ContainerNames returns the names of the app containers for the active and previous versions. The previous
+// version containers are known only if that version was replaced by this app in the current server run. Nil
+// if the app is not initialized, does not use containers or if the previous version containers are not known
+func (a *App) ContainerNames() []container.ContainerName {
+	a.initMutex.Lock()
+	defer a.initMutex.Unlock()
+	if !a.initialized || a.containerManager == nil {
+		return nil
+	}
+	if a.AppEntry != nil && a.Metadata.VersionMetadata.PreviousVersion != 0 && a.previousContainers == nil {
+		return nil
+	}
+	return append(a.containerManager.replicaNames(), a.previousContainers...)
+}
+
+// Retire is called after the app has been replaced by newApp in the app cache. In-flight requests
+// are drained, up to the drain timeout, and the containers which are not used by the new app are stopped. The
+// service containers which are not used by the new app are removed
+func (a *App) Retire(newApp *App) {
+	deadline := time.Now().Add(time.Duration(a.AppConfig.Container.DrainTimeoutSecs) * time.Second)
+	for a.inflightRequests.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(DRAIN_POLL_INTERVAL)
+	}
+	if pending := a.inflightRequests.Load(); pending > 0 {
+		a.Warn().Msgf("Drain timeout for app %s, %d requests in progress", a.Id, pending)
+	}
+
+	if err := a.Close(); err != nil {
+		a.Error().Err(err).Msgf("Error closing app %s", a.Id)
+	}
+
+	if a.containerManager == nil {
+		return
+	}
+	keep := map[container.ContainerName]bool{}
+	if newApp != nil && newApp.containerManager != nil {
+		for _, name := range newApp.containerManager.replicaNames() {
+			keep[name] = true
+		}
+	}
+	if newApp != nil && newApp.AppEntry != nil && a.AppEntry != nil {
+		// Record the containers for the previous version, the container gc retains them while it is the previous version
+		newApp.initMutex.Lock()
+		if newApp.Metadata.VersionMetadata.PreviousVersion == a.Metadata.VersionMetadata.Version {
+			newApp.previousContainers = a.containerManager.replicaNames()
+		} else if newApp.Metadata.VersionMetadata.Version == a.Metadata.VersionMetadata.Version {
+			// Same version, like after a settings update, the previous version is unchanged
+			newApp.previousContainers = a.previousContainers
+		}
+		newApp.initMutex.Unlock()
+	}
+	a.containerManager.stopReplicas(keep)
+
+	var newManager *ContainerManager
+	if newApp != nil {
+		newManager = newApp.containerManager
+	}
+	a.containerManager.removeRetiredServices(newManager)
+}
+
+// Verify checks whether the app is working, used after promote. The container health check is done
+// for container apps and, if a verify route is configured, a GET request is done on the route
+func (a *App) Verify(ctx context.Context) error {
+	if a.reloadError != nil {
+		return fmt.Errorf("app load failed: %w", a.reloadError)
+	}
+
+	attempts := max(a.AppConfig.Verify.Attempts, 1)
+	if a.containerManager != nil {
+		if err := a.containerManager.WaitForHealth(attempts); err != nil {
+			return fmt.Errorf("container health check failed: %w", err)
+		}
+	}
+
+	if a.AppConfig.Verify.Route == "" {
+		return nil
+	}
+
+	verifyPath := path.Join(a.Path, a.AppConfig.Verify.Route)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(1 * time.Second)
+		}
+
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, verifyPath, nil)
+		if reqErr != nil {
+			return reqErr
+		}
+		req.RequestURI = verifyPath
+		req.Host = cmp.Or(a.Domain, "localhost")
+		req.RemoteAddr = "127.0.0.1:0"
+		resp := &verifyResponseWriter{header: http.Header{}}
+		a.ServeHTTP(resp, req)
+		if resp.Status() < http.StatusBadRequest {
+			return nil
+		}
+		err = fmt.Errorf("verify route %s returned status %d", verifyPath, resp.Status())
+		a.Debug().Msgf("Verify attempt %d failed: %s", attempt, err)
+	}
+	return err
+}
+
+// verifyResponseWriter is a http.ResponseWriter which records the response status and discards the body
+type verifyResponseWriter struct {
+	header http.Header
+	status int
+}
+
+var _ http.ResponseWriter = (*verifyResponseWriter)(nil)
+
+func (v *verifyResponseWriter) Header() http.Header {
+	return v.header
+}
+
+func (v *verifyResponseWriter) Write(b []byte) (int, error) {
+	if v.status == 0 {
+		v.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (v *verifyResponseWriter) WriteHeader(statusCode int) {
+	// Informational responses like early hints are followed by the final status
+	if v.status == 0 && statusCode >= http.StatusOK {
+		v.status = statusCode
+	}
+}
+
+// Status returns the response status, defaulting to 200 if nothing was written
+func (v *verifyResponseWriter) Status() int {
+	if v.status == 0 {
+		return http.StatusOK
+	}
+	return v.status
+}
+
+// IPAllowed checks whether the remote IP is permitted by the app's IP allow/deny rules
+func (a *App) IPAllowed(remoteIP string) bool {
+	return a.ipFilter.Allowed(remoteIP)
+}
+
 func (a *App) startWatcher() error {
 	a.initMutex.Lock()
 	defer a.initMutex.Unlock()
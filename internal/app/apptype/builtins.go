@@ -416,7 +416,8 @@ func createAPIBuiltin(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tup
 	var path, rtype starlark.String
 	var handler starlark.Callable
 	var method starlark.String
-	if err := starlark.UnpackArgs(API, args, kwargs, "path", &path, "handler?", &handler, "method?", &method, "type?", &rtype); err != nil {
+	var csrf starlark.Bool = true
+	if err := starlark.UnpackArgs(API, args, kwargs, "path", &path, "handler?", &handler, "method?", &method, "type?", &rtype, "csrf?", &csrf); err != nil {
 		return nil, fmt.Errorf("error unpacking api args: %w", err)
 	}
 
@@ -436,6 +437,7 @@ func createAPIBuiltin(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tup
 		"path":   path,
 		"method": method,
 		"type":   starlark.String(rtypeStr),
+		"csrf":   csrf,
 	}
 	if handler != nil {
 		fields["handler"] = handler
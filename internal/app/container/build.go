@@ -0,0 +1,63 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// BuildOptions are the options for building the app image
+type BuildOptions struct {
+	// BuildKit enables BuildKit for the docker CLI, required for cache mounts in the container file.
+	// Podman supports cache mounts by default. The API runtime uses the classic builder
+	BuildKit bool
+	// CacheFrom has the images used as the layer cache source, like the image for the previous version
+	CacheFrom []ImageName
+	// InlineCache adds the BuildKit cache metadata to the built image, so that it can be used as the
+	// cache source for the later builds
+	InlineCache bool
+	// Output, if set, gets the build output
+	Output io.Writer
+}
+
+// RegistryImageName returns the name of the image in the registry, registry is the registry host
+// with an optional path prefix, like "localhost:5000/clace"
+func RegistryImageName(registry string, name ImageName) ImageName {
+	return ImageName(strings.TrimSuffix(registry, "/") + "/" + string(name))
+}
+
+func (c ContainerCommand) TagImage(config *types.SystemConfig, source, target ImageName) error {
+	c.Debug().Msgf("Tagging image %s as %s", source, target)
+	cmd := exec.Command(config.ContainerCommand, "tag", string(source), string(target))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error tagging image %s: %s : %s", source, output, err)
+	}
+	return nil
+}
+
+func (c ContainerCommand) PushImage(config *types.SystemConfig, name ImageName) error {
+	c.Debug().Msgf("Pushing image %s", name)
+	cmd := exec.Command(config.ContainerCommand, "push", string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error pushing image %s: %s : %s", name, output, err)
+	}
+	return nil
+}
+
+func (c ContainerCommand) PullImage(config *types.SystemConfig, name ImageName) error {
+	c.Debug().Msgf("Pulling image %s", name)
+	cmd := exec.Command(config.ContainerCommand, "pull", string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error pulling image %s: %s : %s", name, output, err)
+	}
+	return nil
+}
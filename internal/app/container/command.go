@@ -7,11 +7,15 @@ import (
 	"bufio"
 	"bytes"
 	"container/ring"
+	"context"
 	"encoding/base32"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -26,12 +30,32 @@ type Container struct {
 	Status     string `json:"Status"`
 	PortString string `json:"Ports"`
 	Port       int
+	LabelStr   string            `json:"Labels"` // comma separated labels, in the docker CLI format
+	Labels     map[string]string `json:"-"`
 }
 
 type Image struct {
 	Repository string `json:"Repository"`
 }
 
+// parseLabels parses the labels in the docker CLI format, "k1=v1,k2=v2". Values with commas are
+// not handled, the clace labels used for lookups do not have commas
+func parseLabels(labelStr string) map[string]string {
+	ret := map[string]string{}
+	for _, label := range strings.Split(labelStr, ",") {
+		if k, v, ok := strings.Cut(label, "="); ok {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// NormalizeImageName removes the registry prefix added by podman for local images and the latest tag
+func NormalizeImageName(name string) string {
+	name = strings.TrimPrefix(name, "localhost/")
+	return strings.TrimSuffix(name, ":latest")
+}
+
 type ContainerName string
 
 type ImageName string
@@ -61,6 +85,20 @@ func GenImageName(appId types.AppId, contentHash string) ImageName {
 	}
 }
 
+// ParseAppId returns the app id from a clace container, image, volume or network name. Empty string is returned
+// if the name is not in the format used for clace apps
+func ParseAppId(name string) types.AppId {
+	for _, prefix := range []string{"clc-", "cli-", "clv-", "cln-"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			id, _, _ := strings.Cut(rest, "-")
+			if strings.HasPrefix(id, "app_") {
+				return types.AppId(id)
+			}
+		}
+	}
+	return ""
+}
+
 type ContainerCommand struct {
 	*types.Logger
 }
@@ -75,22 +113,40 @@ func (c ContainerCommand) RemoveImage(config *types.SystemConfig, name ImageName
 	return nil
 }
 
-func (c ContainerCommand) BuildImage(config *types.SystemConfig, name ImageName, sourceUrl, containerFile string, containerArgs map[string]string) error {
+func (c ContainerCommand) BuildImage(config *types.SystemConfig, name ImageName, sourceUrl, containerFile string,
+	containerArgs map[string]string, opts BuildOptions) error {
 	c.Debug().Msgf("Building image %s from %s with %s", name, containerFile, sourceUrl)
-	args := []string{config.ContainerCommand, "build", "-t", string(name), "-f", containerFile}
+	args := []string{config.ContainerCommand, "build", "-t", string(name), "-f", containerFile,
+		"--label", INSTANCE_LABEL + "=" + InstanceId()}
 
 	for k, v := range containerArgs {
 		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", k, v))
 	}
+	for _, cacheImage := range opts.CacheFrom {
+		args = append(args, "--cache-from", string(cacheImage))
+	}
+	if opts.BuildKit && opts.InlineCache {
+		// Add the cache metadata to the image, so that it can be used as the cache source for the next build
+		args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+	}
 
 	args = append(args, ".")
 	cmd := exec.Command(args[0], args[1:]...)
+	if opts.BuildKit {
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
 
 	c.Debug().Msgf("Running command: %s", cmd.String())
 	cmd.Dir = sourceUrl
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error building image: %s : %s", output, err)
+	var output bytes.Buffer
+	if opts.Output != nil {
+		cmd.Stdout = io.MultiWriter(&output, opts.Output)
+	} else {
+		cmd.Stdout = &output
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error building image: %s : %s", output.Bytes(), err)
 	}
 
 	return nil
@@ -137,12 +193,13 @@ func (c ContainerCommand) GetContainers(config *types.SystemConfig, name Contain
 		}
 
 		type ContainerPodman struct {
-			ID     string   `json:"ID"`
-			Names  []string `json:"Names"`
-			Image  string   `json:"Image"`
-			State  string   `json:"State"`
-			Status string   `json:"Status"`
-			Ports  []Port   `json:"Ports"`
+			ID     string            `json:"ID"`
+			Names  []string          `json:"Names"`
+			Image  string            `json:"Image"`
+			State  string            `json:"State"`
+			Status string            `json:"Status"`
+			Ports  []Port            `json:"Ports"`
+			Labels map[string]string `json:"Labels"`
 		}
 		result := []ContainerPodman{}
 
@@ -164,6 +221,7 @@ func (c ContainerCommand) GetContainers(config *types.SystemConfig, name Contain
 				State:  c.State,
 				Status: c.Status,
 				Port:   port,
+				Labels: c.Labels,
 			})
 		}
 	} else if output[0] == '{' {
@@ -191,6 +249,7 @@ func (c ContainerCommand) GetContainers(config *types.SystemConfig, name Contain
 					return nil, fmt.Errorf("error converting to int port string: %s", v)
 				}
 			}
+			c.Labels = parseLabels(c.LabelStr)
 
 			resp = append(resp, c)
 		}
@@ -212,6 +271,33 @@ func (c ContainerCommand) GetContainerLogs(config *types.SystemConfig, name Cont
 	return strings.Join(lines, "\n"), nil
 }
 
+// StreamContainerLogs writes the container logs to w. The container stdout and stderr are both written to w
+func (c ContainerCommand) StreamContainerLogs(ctx context.Context, config *types.SystemConfig, name ContainerName, opts LogOptions, w io.Writer) error {
+	c.Debug().Msgf("Streaming container logs %s %+v", name, opts)
+	args := []string{"logs"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Since > 0 {
+		args = append(args, "--since", opts.Since.String())
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+	args = append(args, string(name))
+
+	cmd := exec.CommandContext(ctx, config.ContainerCommand, args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil // request was cancelled, like the client closing a follow request
+		}
+		return fmt.Errorf("error streaming container %s logs: %w", name, err)
+	}
+	return nil
+}
+
 func (c ContainerCommand) StopContainer(config *types.SystemConfig, name ContainerName) error {
 	c.Debug().Msgf("Stopping container %s", name)
 	cmd := exec.Command(config.ContainerCommand, "stop", "-t", "1", string(name))
@@ -236,26 +322,26 @@ func (c ContainerCommand) StartContainer(config *types.SystemConfig, name Contai
 
 const LABEL_PREFIX = "io.clace."
 
+// INSTANCE_LABEL is the label with the id of the server instance which created the object
+const INSTANCE_LABEL = LABEL_PREFIX + "instance"
+
 func (c ContainerCommand) RunContainer(config *types.SystemConfig, appEntry *types.AppEntry, containerName ContainerName,
 	imageName ImageName, port int64, envMap map[string]string, mountArgs []string,
 	containerOptions map[string]string) error {
 	c.Debug().Msgf("Running container %s from image %s with port %d env %+v mountArgs %+v",
 		containerName, imageName, port, envMap, mountArgs)
-	publish := fmt.Sprintf("127.0.0.1::%d", port)
-
-	args := []string{"run", "--name", string(containerName), "--detach", "--publish", publish}
+	args := []string{"run", "--name", string(containerName), "--detach"}
+	if port != 0 {
+		// Service containers are not published, they are reachable only on the app network
+		args = append(args, "--publish", fmt.Sprintf("127.0.0.1::%d", port))
+	}
 	if len(mountArgs) > 0 {
 		args = append(args, mountArgs...)
 	}
 
-	args = append(args, "--label", LABEL_PREFIX+"app.id="+string(appEntry.Id))
-	if appEntry.IsDev {
-		args = append(args, "--label", LABEL_PREFIX+"dev=true")
-	} else {
-		args = append(args, "--label", LABEL_PREFIX+"dev=false")
-		args = append(args, "--label", LABEL_PREFIX+"app.version="+strconv.Itoa(appEntry.Metadata.VersionMetadata.Version))
-		args = append(args, "--label", LABEL_PREFIX+"git.sha="+appEntry.Metadata.VersionMetadata.GitCommit)
-		args = append(args, "--label", LABEL_PREFIX+"git.message="+appEntry.Metadata.VersionMetadata.GitMessage)
+	labels := genLabels(appEntry)
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", k+"="+labels[k])
 	}
 
 	// Add env args
@@ -287,9 +373,22 @@ func (c ContainerCommand) RunContainer(config *types.SystemConfig, appEntry *typ
 func (c ContainerCommand) GetImages(config *types.SystemConfig, name ImageName) ([]Image, error) {
 	c.Debug().Msgf("Getting images with name %s", name)
 	args := []string{"images", "--format", "json"}
-	if name != "" {
+	if strings.HasSuffix(string(name), "*") {
+		args = append(args, "--filter", "reference="+string(name))
+	} else if name != "" {
 		args = append(args, string(name))
 	}
+	return c.listImages(config, args)
+}
+
+// GetInstanceImages returns the images built by this server instance with names matching the prefix
+func (c ContainerCommand) GetInstanceImages(config *types.SystemConfig, prefix string) ([]Image, error) {
+	c.Debug().Msgf("Getting instance images with prefix %s", prefix)
+	return c.listImages(config, []string{"images", "--format", "json", "--filter", "reference=" + prefix + "*",
+		"--filter", "label=" + INSTANCE_LABEL + "=" + InstanceId()})
+}
+
+func (c ContainerCommand) listImages(config *types.SystemConfig, args []string) ([]Image, error) {
 	cmd := exec.Command(config.ContainerCommand, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -304,7 +403,8 @@ func (c ContainerCommand) GetImages(config *types.SystemConfig, name ImageName)
 	if output[0] == '[' {
 		// Podman format
 		type ImagePodman struct {
-			Id string `json:"Id"`
+			Id    string   `json:"Id"`
+			Names []string `json:"Names"`
 		}
 		result := []ImagePodman{}
 
@@ -315,8 +415,12 @@ func (c ContainerCommand) GetImages(config *types.SystemConfig, name ImageName)
 		}
 
 		for _, i := range result {
+			repository := i.Id
+			if len(i.Names) > 0 {
+				repository = NormalizeImageName(i.Names[0])
+			}
 			resp = append(resp, Image{
-				Repository: i.Id,
+				Repository: repository,
 			})
 		}
 	} else if output[0] == '{' {
@@ -0,0 +1,34 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestParseAppId(t *testing.T) {
+	tests := map[string]string{
+		"clc-app_prd_abc-xyz":        "app_prd_abc",
+		"clc-app_prd_abc-xyz-r1":     "app_prd_abc",
+		"clc-app_dev_abc":            "app_dev_abc",
+		"cli-app_stg_abc-xyz":        "app_stg_abc",
+		"clv-app_pre_abc-1234":       "app_pre_abc",
+		"clc-other":                  "",
+		"nginx":                      "",
+		"localhost/cli-app_prd_x-yz": "",
+	}
+	for name, want := range tests {
+		testutil.AssertEqualsString(t, name, want, string(ParseAppId(name)))
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels := parseLabels("io.clace.app.id=app_prd_1,io.clace.app.version=3,io.clace.git.message=fix, typo")
+	testutil.AssertEqualsString(t, "id", "app_prd_1", labels[LABEL_PREFIX+"app.id"])
+	testutil.AssertEqualsString(t, "version", "3", labels[LABEL_PREFIX+"app.version"])
+	testutil.AssertEqualsInt(t, "empty", 0, len(parseLabels("")))
+	testutil.AssertEqualsString(t, "normalize", "cli-app1", NormalizeImageName("localhost/cli-app1:latest"))
+}
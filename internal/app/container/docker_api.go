@@ -0,0 +1,1179 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	DOCKER_API_HOST = "http://docker" // host name is not used, requests go to the unix socket
+	LOG_TAIL_LINES  = 1000
+	DOCKER_IGNORE   = ".dockerignore"
+
+	REGISTRY_AUTH_NONE  = "e30=" // base64 encoded empty JSON object
+	DOCKER_HUB_REGISTRY = "index.docker.io"
+)
+
+// DockerAPI implements the ContainerRuntime using the Docker Engine API over the unix socket.
+// Podman supports the same API through its compat endpoints
+type DockerAPI struct {
+	*types.Logger
+	socket string
+	client *http.Client
+}
+
+func NewDockerAPI(logger *types.Logger, socket string) *DockerAPI {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &DockerAPI{
+		Logger: logger,
+		socket: socket,
+		client: &http.Client{Transport: transport},
+	}
+}
+
+// call sends the API request. A RuntimeError is returned if the engine returns an error status,
+// the caller has to close the response body otherwise
+func (d *DockerAPI) call(op, method, apiPath string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	return d.callContext(context.Background(), op, method, apiPath, query, body, contentType)
+}
+
+// callContext sends the API request, the request is aborted when the context is cancelled
+func (d *DockerAPI) callContext(ctx context.Context, op, method, apiPath string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	reqUrl := DOCKER_API_HOST + apiPath
+	if len(query) > 0 {
+		reqUrl += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return d.do(op, req)
+}
+
+// callRegistry sends the pull or push API request, with the registry credentials for the image
+func (d *DockerAPI) callRegistry(op, apiPath string, query url.Values, image string) (*http.Response, error) {
+	reqUrl := DOCKER_API_HOST + apiPath
+	if len(query) > 0 {
+		reqUrl += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Registry-Auth", registryAuth(image))
+	return d.do(op, req)
+}
+
+// do sends the request to the engine. A RuntimeError is returned if the engine returns an error status
+func (d *DockerAPI) do(op string, req *http.Request) (*http.Response, error) {
+	d.Trace().Msgf("Docker API %s %s", req.Method, req.URL)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error %s, connecting to %s: %w", op, d.socket, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, readRuntimeError(op, resp)
+	}
+	return resp, nil
+}
+
+// readRuntimeError returns the RuntimeError for the error response from the engine. The response body is closed
+func readRuntimeError(op string, resp *http.Response) error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	errResp := struct {
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(data, &errResp) != nil || errResp.Message == "" {
+		errResp.Message = strings.TrimSpace(string(data))
+	}
+	return &RuntimeError{Op: op, StatusCode: resp.StatusCode, Message: errResp.Message}
+}
+
+// hijack sends the POST request on a new connection to the engine and returns the connection, for the
+// APIs which switch to a raw stream after the response headers, like exec start. The reader has to be
+// used for reading from the connection, it has the data buffered after the response headers
+func (d *DockerAPI) hijack(ctx context.Context, op, apiPath string, query url.Values, input any) (net.Conn, *bufio.Reader, error) {
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	reqUrl := DOCKER_API_HOST + apiPath
+	if len(query) > 0 {
+		reqUrl += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", d.socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error %s, connecting to %s: %w", op, d.socket, err)
+	}
+
+	d.Trace().Msgf("Docker API hijack %s", apiPath)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("error %s, sending request: %w", op, err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("error %s, reading response: %w", op, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		conn.Close()
+		return nil, nil, readRuntimeError(op, resp)
+	}
+	return conn, reader, nil
+}
+
+// callJSON sends the API request and decodes the JSON response into result, if result is not nil
+func (d *DockerAPI) callJSON(op, method, apiPath string, query url.Values, input, result any) error {
+	var body io.Reader
+	contentType := ""
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := d.call(op, method, apiPath, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error %s, decoding response: %w", op, err)
+	}
+	return nil
+}
+
+func nameFilter(key, value string) url.Values {
+	filters, _ := json.Marshal(map[string][]string{key: {value}})
+	return url.Values{"filters": {string(filters)}}
+}
+
+// instanceFilter returns the list filter for the name, limited to the objects with the instance label
+// for this server
+func instanceFilter(key, value string) url.Values {
+	filters, _ := json.Marshal(map[string][]string{key: {value}, "label": {INSTANCE_LABEL + "=" + InstanceId()}})
+	return url.Values{"filters": {string(filters)}}
+}
+
+func (d *DockerAPI) RemoveImage(config *types.SystemConfig, name ImageName) error {
+	d.Debug().Msgf("Removing image %s", name)
+	return d.callJSON("removing image", http.MethodDelete, "/images/"+url.PathEscape(string(name)), nil, nil, nil)
+}
+
+func (d *DockerAPI) BuildImage(config *types.SystemConfig, name ImageName, sourceUrl, containerFile string,
+	containerArgs map[string]string, opts BuildOptions) error {
+	d.Debug().Msgf("Building image %s from %s with %s", name, containerFile, sourceUrl)
+	buildArgs, err := json.Marshal(containerArgs)
+	if err != nil {
+		return err
+	}
+	labels, err := json.Marshal(map[string]string{INSTANCE_LABEL: InstanceId()})
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"t":          {string(name)},
+		"dockerfile": {containerFile},
+		"buildargs":  {string(buildArgs)},
+		"rm":         {"1"},
+		"labels":     {string(labels)},
+	}
+	if len(opts.CacheFrom) > 0 {
+		cacheFrom, err := json.Marshal(opts.CacheFrom)
+		if err != nil {
+			return err
+		}
+		query.Set("cachefrom", string(cacheFrom))
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarBuildContext(sourceUrl, writer))
+	}()
+	defer reader.Close()
+
+	resp, err := d.call("building image", http.MethodPost, "/build", query, reader, "application/x-tar")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The build output is a stream of JSON messages, the error is reported in the stream
+	var output strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error building image, decoding response: %w", err)
+		}
+		output.WriteString(msg.Stream)
+		if opts.Output != nil {
+			_, _ = io.WriteString(opts.Output, msg.Stream)
+			if msg.Error != "" {
+				_, _ = io.WriteString(opts.Output, msg.Error+"\n")
+			}
+		}
+		if msg.Error != "" {
+			return &RuntimeError{Op: "building image", StatusCode: http.StatusInternalServerError,
+				Message: fmt.Sprintf("%s : %s", output.String(), msg.Error)}
+		}
+	}
+	return nil
+}
+
+// tarBuildContext writes the build context directory as a tar stream. Files matching
+// the patterns in .dockerignore are skipped
+func tarBuildContext(dir string, w io.Writer) error {
+	ignore, err := readDockerIgnore(dir)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isIgnored(ignore, rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error creating build context: %w", err)
+	}
+	return tw.Close()
+}
+
+func readDockerIgnore(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, DOCKER_IGNORE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			// Exception rules are not supported, the file is included in the context
+			continue
+		}
+		patterns = append(patterns, strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/"))
+	}
+	return patterns, scanner.Err()
+}
+
+func isIgnored(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matched, _ := filepath.Match(p, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DockerAPI) RemoveContainer(config *types.SystemConfig, name ContainerName) error {
+	d.Debug().Msgf("Removing container %s", name)
+	return d.callJSON("removing container", http.MethodDelete, "/containers/"+url.PathEscape(string(name)), nil, nil, nil)
+}
+
+func (d *DockerAPI) GetContainers(config *types.SystemConfig, name ContainerName, getAll bool) ([]Container, error) {
+	d.Debug().Msgf("Getting containers with name %s, getAll %t", name, getAll)
+	query := url.Values{}
+	if name != "" {
+		query = nameFilter("name", string(name))
+	}
+	if getAll {
+		query.Set("all", "1")
+	}
+
+	type apiPort struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+	}
+	result := []struct {
+		Id     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Image  string            `json:"Image"`
+		State  string            `json:"State"`
+		Status string            `json:"Status"`
+		Ports  []apiPort         `json:"Ports"`
+		Labels map[string]string `json:"Labels"`
+	}{}
+	if err := d.callJSON("listing containers", http.MethodGet, "/containers/json", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	resp := []Container{}
+	for _, c := range result {
+		container := Container{
+			ID:     c.Id,
+			Image:  c.Image,
+			State:  c.State,
+			Status: c.Status,
+			Labels: c.Labels,
+		}
+		if len(c.Names) > 0 {
+			container.Names = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				container.PortString = fmt.Sprintf("%s:%d->%d", p.IP, p.PublicPort, p.PrivatePort)
+				container.Port = p.PublicPort
+				break
+			}
+		}
+		resp = append(resp, container)
+	}
+
+	d.Debug().Msgf("Found containers: %+v", resp)
+	return resp, nil
+}
+
+func (d *DockerAPI) GetContainerLogs(config *types.SystemConfig, name ContainerName) (string, error) {
+	d.Debug().Msgf("Getting container logs %s", name)
+	query := url.Values{
+		"stdout": {"1"},
+		"stderr": {"1"},
+		"tail":   {strconv.Itoa(LOG_TAIL_LINES)},
+	}
+	resp, err := d.call("getting container logs", http.MethodGet, "/containers/"+url.PathEscape(string(name))+"/logs", query, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error getting container %s logs: %w", name, err)
+	}
+	return strings.TrimSuffix(string(demuxLogs(data)), "\n"), nil
+}
+
+// StreamContainerLogs writes the container logs to w. For follow requests, the response is streamed
+// until the context is cancelled or the container exits
+func (d *DockerAPI) StreamContainerLogs(ctx context.Context, config *types.SystemConfig, name ContainerName, opts LogOptions, w io.Writer) error {
+	d.Debug().Msgf("Streaming container logs %s %+v", name, opts)
+	query := url.Values{
+		"stdout": {"1"},
+		"stderr": {"1"},
+	}
+	if opts.Follow {
+		query.Set("follow", "1")
+	}
+	if opts.Since > 0 {
+		query.Set("since", strconv.FormatInt(time.Now().Add(-opts.Since).Unix(), 10))
+	}
+	if opts.Tail > 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	resp, err := d.callContext(ctx, "streaming container logs", http.MethodGet, "/containers/"+url.PathEscape(string(name))+"/logs", query, nil, "")
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := copyLogs(w, resp.Body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("error streaming container %s logs: %w", name, err)
+	}
+	return nil
+}
+
+// ExecContainer runs the command in the container and returns the exit code of the command. The exec start
+// call switches the connection to a raw stream, which is used for the command input and output
+func (d *DockerAPI) ExecContainer(ctx context.Context, config *types.SystemConfig, name ContainerName, opts ExecOptions) (int, error) {
+	d.Debug().Msgf("Running exec in container %s: %v", name, opts.Cmd)
+	createReq := map[string]any{
+		"AttachStdin":  opts.Stdin != nil,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          opts.Tty,
+		"Cmd":          opts.Cmd,
+	}
+	if opts.Tty && opts.Size.Rows > 0 {
+		createReq["ConsoleSize"] = []uint{opts.Size.Rows, opts.Size.Cols}
+	}
+	created := struct {
+		Id string `json:"Id"`
+	}{}
+	if err := d.callJSON("creating exec", http.MethodPost, "/containers/"+url.PathEscape(string(name))+"/exec",
+		nil, createReq, &created); err != nil {
+		return -1, err
+	}
+
+	conn, reader, err := d.hijack(ctx, "starting exec", "/exec/"+created.Id+"/start", nil,
+		map[string]any{"Detach": false, "Tty": opts.Tty})
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	if opts.Tty && opts.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-opts.Resize:
+					query := url.Values{"h": {strconv.FormatUint(uint64(size.Rows), 10)}, "w": {strconv.FormatUint(uint64(size.Cols), 10)}}
+					if err := d.callJSON("resizing exec", http.MethodPost, "/exec/"+created.Id+"/resize", query, nil, nil); err != nil {
+						d.Debug().Err(err).Msgf("error resizing exec %s", created.Id)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	if opts.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(conn, opts.Stdin)
+			// Close the write side, so that the command gets EOF on its input
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				_ = cw.CloseWrite()
+			}
+		}()
+	}
+
+	if opts.Tty {
+		_, err = io.Copy(opts.Stdout, reader)
+	} else {
+		err = copyStreams(opts.Stdout, opts.Stderr, reader)
+	}
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error running exec in container %s: %w", name, err)
+	}
+
+	inspect := struct {
+		ExitCode int `json:"ExitCode"`
+	}{}
+	if err := d.callJSON("inspecting exec", http.MethodGet, "/exec/"+created.Id+"/json", nil, nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// copyLogs is the streaming version of demuxLogs, the frames are written to w as they are read
+func copyLogs(w io.Writer, r io.Reader) error {
+	return copyStreams(w, w, r)
+}
+
+// copyStreams writes the stdout frames from the multiplexed stream to stdout and the stderr frames to stderr.
+// Output which is not multiplexed, from a TTY, is written to stdout
+func copyStreams(stdout, stderr io.Writer, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 8)
+	for {
+		peek, err := reader.Peek(8)
+		if err != nil && len(peek) == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if len(peek) < 8 || peek[0] > 2 || peek[1] != 0 || peek[2] != 0 || peek[3] != 0 {
+			// Not multiplexed, TTY output
+			_, err := io.Copy(stdout, reader)
+			return err
+		}
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:8]))
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, reader, size); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// demuxLogs strips the stream headers from the log output. For containers without a TTY, the
+// output is multiplexed with a 8 byte header (stream type, 3 zero bytes, big endian frame size)
+func demuxLogs(data []byte) []byte {
+	var out bytes.Buffer
+	for len(data) >= 8 {
+		if data[0] > 2 || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+			break // not multiplexed, TTY output
+		}
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		size = min(size, len(data))
+		out.Write(data[:size])
+		data = data[size:]
+	}
+	out.Write(data)
+	return out.Bytes()
+}
+
+func (d *DockerAPI) StopContainer(config *types.SystemConfig, name ContainerName) error {
+	d.Debug().Msgf("Stopping container %s", name)
+	return d.callJSON("stopping container", http.MethodPost, "/containers/"+url.PathEscape(string(name))+"/stop",
+		url.Values{"t": {"1"}}, nil, nil)
+}
+
+func (d *DockerAPI) StartContainer(config *types.SystemConfig, name ContainerName) error {
+	d.Debug().Msgf("Starting container %s", name)
+	return d.callJSON("starting container", http.MethodPost, "/containers/"+url.PathEscape(string(name))+"/start", nil, nil, nil)
+}
+
+type portBinding struct {
+	HostIp   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+type hostConfig struct {
+	PortBindings map[string][]portBinding `json:"PortBindings,omitempty"`
+	Binds        []string                 `json:"Binds,omitempty"`
+	NetworkMode  string                   `json:"NetworkMode,omitempty"`
+	Memory       int64                    `json:"Memory,omitempty"`
+	MemorySwap   int64                    `json:"MemorySwap,omitempty"`
+	NanoCpus     int64                    `json:"NanoCpus,omitempty"`
+	PidsLimit    int64                    `json:"PidsLimit,omitempty"`
+	Privileged   bool                     `json:"Privileged,omitempty"`
+	ReadonlyRoot bool                     `json:"ReadonlyRootfs,omitempty"`
+	SecurityOpt  []string                 `json:"SecurityOpt,omitempty"`
+	Tmpfs        map[string]string        `json:"Tmpfs,omitempty"`
+	AutoRemove   bool                     `json:"AutoRemove,omitempty"`
+}
+
+type endpointConfig struct {
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+type networkingConfig struct {
+	EndpointsConfig map[string]endpointConfig `json:"EndpointsConfig,omitempty"`
+}
+
+type createRequest struct {
+	Image            string              `json:"Image"`
+	Env              []string            `json:"Env,omitempty"`
+	Labels           map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts     map[string]struct{} `json:"ExposedPorts,omitempty"`
+	User             string              `json:"User,omitempty"`
+	WorkingDir       string              `json:"WorkingDir,omitempty"`
+	Cmd              []string            `json:"Cmd,omitempty"`
+	AttachStdout     bool                `json:"AttachStdout,omitempty"`
+	AttachStderr     bool                `json:"AttachStderr,omitempty"`
+	HostConfig       hostConfig          `json:"HostConfig"`
+	NetworkingConfig *networkingConfig   `json:"NetworkingConfig,omitempty"`
+}
+
+func (d *DockerAPI) RunContainer(config *types.SystemConfig, appEntry *types.AppEntry, containerName ContainerName,
+	imageName ImageName, port int64, envMap map[string]string, mountArgs []string,
+	containerOptions map[string]string) error {
+	d.Debug().Msgf("Running container %s from image %s with port %d env %+v mountArgs %+v",
+		containerName, imageName, port, envMap, mountArgs)
+
+	req, err := genCreateRequest(appEntry, imageName, port, envMap, mountArgs, containerOptions)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.createContainer(config, containerName, req); err != nil {
+		return err
+	}
+	return d.StartContainer(config, containerName)
+}
+
+// createContainer creates the container and returns the container id. The image is pulled if not present
+func (d *DockerAPI) createContainer(config *types.SystemConfig, name ContainerName, req *createRequest) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", string(name))
+	}
+	created := struct {
+		Id string `json:"Id"`
+	}{}
+	err := d.callJSON("creating container", http.MethodPost, "/containers/create", query, req, &created)
+	if IsNotFound(err) {
+		// The API does not pull the image on create, unlike the CLI run. Pull the image and retry
+		if pullErr := d.PullImage(config, ImageName(req.Image)); pullErr != nil {
+			return "", pullErr
+		}
+		err = d.callJSON("creating container", http.MethodPost, "/containers/create", query, req, &created)
+	}
+	return created.Id, err
+}
+
+// RunCommand runs the command in a new container and returns the exit code of the command. The container
+// is created, the output is attached and then the container is started. The container is stopped if the
+// context is cancelled
+func (d *DockerAPI) RunCommand(ctx context.Context, config *types.SystemConfig, appEntry *types.AppEntry, opts RunOptions) (int, error) {
+	d.Debug().Msgf("Running command in container %s from image %s: %v", opts.Name, opts.Image, opts.Cmd)
+	req, err := genCreateRequest(appEntry, opts.Image, 0, opts.Env, opts.MountArgs, opts.Options)
+	if err != nil {
+		return -1, err
+	}
+	req.Cmd = opts.Cmd
+	req.AttachStdout = true
+	req.AttachStderr = true
+	req.HostConfig.AutoRemove = opts.Name == ""
+
+	id, err := d.createContainer(config, opts.Name, req)
+	if err != nil {
+		return -1, err
+	}
+
+	conn, reader, err := d.hijack(ctx, "attaching container", "/containers/"+id+"/attach",
+		url.Values{"stream": {"1"}, "stdout": {"1"}, "stderr": {"1"}}, nil)
+	if err != nil {
+		_ = d.RemoveContainer(config, ContainerName(id))
+		return -1, err
+	}
+	defer conn.Close()
+
+	// The wait is started before the start, so that the exit code is available even if the
+	// container is removed on exit
+	type waitResult struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	waitDone := make(chan error, 1)
+	var result waitResult
+	waitResp, err := d.callContext(ctx, "waiting for container", http.MethodPost, "/containers/"+id+"/wait",
+		url.Values{"condition": {"next-exit"}}, nil, "")
+	if err != nil {
+		_ = d.RemoveContainer(config, ContainerName(id))
+		return -1, err
+	}
+	go func() {
+		defer waitResp.Body.Close()
+		waitDone <- json.NewDecoder(waitResp.Body).Decode(&result)
+	}()
+
+	if err := d.StartContainer(config, ContainerName(id)); err != nil {
+		_ = d.RemoveContainer(config, ContainerName(id))
+		return -1, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+		if err := d.StopContainer(config, ContainerName(id)); err != nil {
+			d.Debug().Err(err).Msgf("error stopping container %s", id)
+		}
+	})
+	defer stop()
+
+	err = copyStreams(opts.Stdout, opts.Stderr, reader)
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error running command in container: %w", err)
+	}
+	if err := <-waitDone; err != nil {
+		return -1, fmt.Errorf("error waiting for container, decoding response: %w", err)
+	}
+	return result.StatusCode, nil
+}
+
+// splitImageTag splits the image name into the image and tag. The latest tag is used if the image name
+// does not have a tag. The tag is empty if the image is referenced by digest
+func splitImageTag(name ImageName) (string, string) {
+	image := string(name)
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// PullImage pulls the image from the registry. The latest tag is used if the image name does not have a tag
+func (d *DockerAPI) PullImage(config *types.SystemConfig, name ImageName) error {
+	d.Debug().Msgf("Pulling image %s", name)
+	image, tag := splitImageTag(name)
+	query := url.Values{"fromImage": {image}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+
+	resp, err := d.callRegistry("pulling image", "/images/create", query, image)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readProgress("pulling image", resp.Body)
+}
+
+func (d *DockerAPI) TagImage(config *types.SystemConfig, source, target ImageName) error {
+	d.Debug().Msgf("Tagging image %s as %s", source, target)
+	repo, tag := splitImageTag(target)
+	return d.callJSON("tagging image", http.MethodPost, "/images/"+url.PathEscape(string(source))+"/tag",
+		url.Values{"repo": {repo}, "tag": {tag}}, nil, nil)
+}
+
+func (d *DockerAPI) PushImage(config *types.SystemConfig, name ImageName) error {
+	d.Debug().Msgf("Pushing image %s", name)
+	image, tag := splitImageTag(name)
+	query := url.Values{}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := d.callRegistry("pushing image", "/images/"+url.PathEscape(image)+"/push", query, image)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readProgress("pushing image", resp.Body)
+}
+
+// registryAuth returns the X-Registry-Auth header value for the image. The credentials for the registry
+// host are read from the auths in the docker config file, like ~/.docker/config.json. Credential helpers
+// are not supported. If there are no credentials, an empty auth is returned, which works for registries
+// allowing access without auth
+func registryAuth(image string) string {
+	host := DOCKER_HUB_REGISTRY
+	if first, _, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") &&
+		first != "docker.io" {
+		host = first
+	}
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return REGISTRY_AUTH_NONE
+		}
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return REGISTRY_AUTH_NONE
+	}
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return REGISTRY_AUTH_NONE
+	}
+
+	for key, entry := range config.Auths {
+		// The keys can be a host or a url, like https://index.docker.io/v1/
+		keyHost := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		keyHost, _, _ = strings.Cut(keyHost, "/")
+		if keyHost != host || entry.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return REGISTRY_AUTH_NONE
+		}
+		user, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return REGISTRY_AUTH_NONE
+		}
+		auth, err := json.Marshal(map[string]string{"username": user, "password": password, "serveraddress": key})
+		if err != nil {
+			return REGISTRY_AUTH_NONE
+		}
+		return base64.URLEncoding.EncodeToString(auth)
+	}
+	return REGISTRY_AUTH_NONE
+}
+
+// readProgress reads the pull or push progress, which is a stream of JSON messages. The error is
+// reported in the stream
+func readProgress(op string, body io.Reader) error {
+	decoder := json.NewDecoder(body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error %s, decoding response: %w", op, err)
+		}
+		if msg.Error != "" {
+			return &RuntimeError{Op: op, StatusCode: http.StatusInternalServerError, Message: msg.Error}
+		}
+	}
+}
+
+// genCreateRequest creates the container create request. The mount args and container options are
+// in the CLI format, the options which have an equivalent in the API are supported
+func genCreateRequest(appEntry *types.AppEntry, imageName ImageName, port int64, envMap map[string]string,
+	mountArgs []string, containerOptions map[string]string) (*createRequest, error) {
+	req := &createRequest{
+		Image:  string(imageName),
+		Labels: genLabels(appEntry),
+	}
+
+	if port != 0 {
+		portKey := fmt.Sprintf("%d/tcp", port)
+		req.ExposedPorts = map[string]struct{}{portKey: {}}
+		req.HostConfig.PortBindings = map[string][]portBinding{portKey: {{HostIp: "127.0.0.1"}}}
+	}
+
+	for k, v := range envMap {
+		req.Env = append(req.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	for _, arg := range mountArgs {
+		bind, ok := strings.CutPrefix(arg, "--volume=")
+		if !ok {
+			return nil, fmt.Errorf("unsupported mount arg %s", arg)
+		}
+		req.HostConfig.Binds = append(req.HostConfig.Binds, bind)
+	}
+
+	networkAlias := ""
+	for k, v := range containerOptions {
+		var err error
+		switch k {
+		case "cpus":
+			req.HostConfig.NanoCpus, err = parseCpus(v)
+		case "memory", "m":
+			req.HostConfig.Memory, err = parseMemory(v)
+		case "memory-swap":
+			req.HostConfig.MemorySwap, err = parseMemory(v)
+		case "pids-limit":
+			req.HostConfig.PidsLimit, err = strconv.ParseInt(v, 10, 64)
+		case "security-opt":
+			req.HostConfig.SecurityOpt = append(req.HostConfig.SecurityOpt, v)
+		case "tmpfs":
+			req.HostConfig.Tmpfs = map[string]string{v: ""}
+		case "network", "net":
+			req.HostConfig.NetworkMode = v
+		case "network-alias":
+			networkAlias = v
+		case "user", "u":
+			req.User = v
+		case "workdir", "w":
+			req.WorkingDir = v
+		case "privileged":
+			req.HostConfig.Privileged = v == "" || v == "true"
+		case "read-only":
+			req.HostConfig.ReadonlyRoot = v == "" || v == "true"
+		default:
+			return nil, fmt.Errorf("container option %s is not supported by the %s container runtime, use the %s runtime",
+				k, RUNTIME_API, RUNTIME_CLI)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s for container option %s: %w", v, k, err)
+		}
+	}
+
+	if networkAlias != "" {
+		if req.HostConfig.NetworkMode == "" {
+			return nil, fmt.Errorf("container option network-alias requires the network option")
+		}
+		req.NetworkingConfig = &networkingConfig{EndpointsConfig: map[string]endpointConfig{
+			req.HostConfig.NetworkMode: {Aliases: []string{networkAlias}},
+		}}
+	}
+	return req, nil
+}
+
+// parseMemory parses memory values like 512m and 2g into bytes
+func parseMemory(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "b")
+	multiplier := int64(1)
+	if len(value) > 0 {
+		switch value[len(value)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+func (d *DockerAPI) GetImages(config *types.SystemConfig, name ImageName) ([]Image, error) {
+	d.Debug().Msgf("Getting images with name %s", name)
+	query := url.Values{}
+	if name != "" {
+		query = nameFilter("reference", string(name))
+	}
+	return d.listImages(query)
+}
+
+func (d *DockerAPI) listImages(query url.Values) ([]Image, error) {
+	result := []struct {
+		Id       string   `json:"Id"`
+		RepoTags []string `json:"RepoTags"`
+	}{}
+	if err := d.callJSON("listing images", http.MethodGet, "/images/json", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	resp := []Image{}
+	for _, i := range result {
+		repository := i.Id
+		if len(i.RepoTags) > 0 {
+			repository, _, _ = strings.Cut(NormalizeImageName(i.RepoTags[0]), ":")
+		}
+		resp = append(resp, Image{Repository: repository})
+	}
+
+	d.Debug().Msgf("Found images: %+v", resp)
+	return resp, nil
+}
+
+// GetInstanceImages returns the images built by this server instance with names matching the prefix
+func (d *DockerAPI) GetInstanceImages(config *types.SystemConfig, prefix string) ([]Image, error) {
+	d.Debug().Msgf("Getting instance images with prefix %s", prefix)
+	return d.listImages(instanceFilter("reference", prefix+"*"))
+}
+
+func (d *DockerAPI) VolumeExists(config *types.SystemConfig, name VolumeName) bool {
+	d.Debug().Msgf("Checking volume exists %s", name)
+	err := d.callJSON("inspecting volume", http.MethodGet, "/volumes/"+url.PathEscape(string(name)), nil, nil, nil)
+	if err != nil && !IsNotFound(err) {
+		d.Debug().Msgf("volume exists check failed %s %s", name, err)
+	}
+	d.Debug().Msgf("volume exists %s %t", name, err == nil)
+	return err == nil
+}
+
+func (d *DockerAPI) VolumeCreate(config *types.SystemConfig, name VolumeName) error {
+	d.Debug().Msgf("Creating volume %s", name)
+	return d.callJSON("creating volume", http.MethodPost, "/volumes/create", nil,
+		map[string]any{"Name": string(name), "Labels": map[string]string{INSTANCE_LABEL: InstanceId()}}, nil)
+}
+
+// GetVolumes returns the volumes created by this server instance with names matching the prefix
+func (d *DockerAPI) GetVolumes(config *types.SystemConfig, prefix string) ([]VolumeName, error) {
+	d.Debug().Msgf("Getting volumes with prefix %s", prefix)
+	result := struct {
+		Volumes []struct {
+			Name string `json:"Name"`
+		} `json:"Volumes"`
+	}{}
+	if err := d.callJSON("listing volumes", http.MethodGet, "/volumes", instanceFilter("name", prefix), nil, &result); err != nil {
+		return nil, err
+	}
+
+	ret := []VolumeName{}
+	for _, v := range result.Volumes {
+		if strings.HasPrefix(v.Name, prefix) {
+			ret = append(ret, VolumeName(v.Name))
+		}
+	}
+	return ret, nil
+}
+
+func (d *DockerAPI) RemoveVolume(config *types.SystemConfig, name VolumeName) error {
+	d.Debug().Msgf("Removing volume %s", name)
+	return d.callJSON("removing volume", http.MethodDelete, "/volumes/"+url.PathEscape(string(name)), nil, nil, nil)
+}
+
+func (d *DockerAPI) NetworkExists(config *types.SystemConfig, name NetworkName) bool {
+	d.Debug().Msgf("Checking network exists %s", name)
+	err := d.callJSON("inspecting network", http.MethodGet, "/networks/"+url.PathEscape(string(name)), nil, nil, nil)
+	if err != nil && !IsNotFound(err) {
+		d.Debug().Msgf("network exists check failed %s %s", name, err)
+	}
+	return err == nil
+}
+
+func (d *DockerAPI) NetworkCreate(config *types.SystemConfig, name NetworkName) error {
+	d.Debug().Msgf("Creating network %s", name)
+	return d.callJSON("creating network", http.MethodPost, "/networks/create", nil,
+		map[string]any{"Name": string(name), "Labels": map[string]string{INSTANCE_LABEL: InstanceId()}}, nil)
+}
+
+// GetNetworks returns the networks created by this server instance with names matching the prefix
+func (d *DockerAPI) GetNetworks(config *types.SystemConfig, prefix string) ([]NetworkName, error) {
+	d.Debug().Msgf("Getting networks with prefix %s", prefix)
+	result := []struct {
+		Name string `json:"Name"`
+	}{}
+	if err := d.callJSON("listing networks", http.MethodGet, "/networks", instanceFilter("name", prefix), nil, &result); err != nil {
+		return nil, err
+	}
+
+	ret := []NetworkName{}
+	for _, n := range result {
+		if strings.HasPrefix(n.Name, prefix) {
+			ret = append(ret, NetworkName(n.Name))
+		}
+	}
+	return ret, nil
+}
+
+func (d *DockerAPI) RemoveNetwork(config *types.SystemConfig, name NetworkName) error {
+	d.Debug().Msgf("Removing network %s", name)
+	return d.callJSON("removing network", http.MethodDelete, "/networks/"+url.PathEscape(string(name)), nil, nil, nil)
+}
+
+// GetContainerStats returns the current resource usage of the running containers. The cpu usage is computed from
+// the difference with the previous sample, so the stats call blocks for about a second for each container
+func (d *DockerAPI) GetContainerStats(config *types.SystemConfig, names []ContainerName) ([]ContainerStats, error) {
+	d.Debug().Msgf("Getting container stats for %v", names)
+	type cpuStats struct {
+		CpuUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemCpuUsage uint64 `json:"system_cpu_usage"`
+		OnlineCpus     uint64 `json:"online_cpus"`
+	}
+
+	ret := make([]ContainerStats, 0, len(names))
+	for _, name := range names {
+		result := struct {
+			CpuStats    cpuStats `json:"cpu_stats"`
+			PreCpuStats cpuStats `json:"precpu_stats"`
+			MemoryStats struct {
+				Usage uint64            `json:"usage"`
+				Stats map[string]uint64 `json:"stats"`
+			} `json:"memory_stats"`
+		}{}
+		err := d.callJSON("getting container stats", http.MethodGet, "/containers/"+url.PathEscape(string(name))+"/stats",
+			url.Values{"stream": {"false"}}, nil, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := ContainerStats{Name: string(name)}
+		cpuDelta := float64(result.CpuStats.CpuUsage.TotalUsage) - float64(result.PreCpuStats.CpuUsage.TotalUsage)
+		systemDelta := float64(result.CpuStats.SystemCpuUsage) - float64(result.PreCpuStats.SystemCpuUsage)
+		if cpuDelta > 0 && systemDelta > 0 {
+			stats.CpuPercent = cpuDelta / systemDelta * float64(max(result.CpuStats.OnlineCpus, 1)) * 100
+		}
+
+		// The page cache is not included in the memory usage, same as the docker stats command
+		memory := result.MemoryStats.Usage
+		cache, ok := result.MemoryStats.Stats["inactive_file"] // cgroup v2
+		if !ok {
+			cache = result.MemoryStats.Stats["total_inactive_file"] // cgroup v1
+		}
+		if cache < memory {
+			memory -= cache
+		}
+		stats.MemoryBytes = int64(memory)
+		ret = append(ret, stats)
+	}
+	return ret, nil
+}
@@ -0,0 +1,427 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func startTestEngine(t *testing.T, handler http.Handler) *DockerAPI {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	testutil.AssertNoError(t, err)
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener) //nolint:errcheck
+	t.Cleanup(func() { server.Close() })
+
+	return NewDockerAPI(testutil.TestLogger(), socket)
+}
+
+func TestDockerAPIGetContainers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "all", "1", r.URL.Query().Get("all"))
+		testutil.AssertEqualsString(t, "filters", `{"name":["clc-app1"]}`, r.URL.Query().Get("filters"))
+		w.Write([]byte(`[{"Id":"abc","Names":["/clc-app1"],"Image":"cli-app1","State":"running","Status":"Up 2 minutes",
+			"Ports":[{"PrivatePort":5000,"Type":"tcp"},{"IP":"127.0.0.1","PrivatePort":5000,"PublicPort":55000,"Type":"tcp"}]},
+			{"Id":"def","Names":["/clc-app1-old"],"Image":"cli-app1","State":"exited","Status":"Exited (0)","Ports":[]}]`))
+	})
+	d := startTestEngine(t, mux)
+
+	containers, err := d.GetContainers(nil, "clc-app1", true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "count", 2, len(containers))
+	testutil.AssertEqualsString(t, "name", "clc-app1", containers[0].Names)
+	testutil.AssertEqualsString(t, "state", "running", containers[0].State)
+	testutil.AssertEqualsInt(t, "port", 55000, containers[0].Port)
+	testutil.AssertEqualsInt(t, "port", 0, containers[1].Port)
+}
+
+func TestDockerAPIErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/{name}/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container: ` + r.PathValue("name") + `"}`))
+	})
+	mux.HandleFunc("GET /volumes/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") == "present" {
+			w.Write([]byte(`{"Name":"present"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"no such volume"}`))
+	})
+	d := startTestEngine(t, mux)
+
+	err := d.StartContainer(nil, "missing")
+	testutil.AssertErrorContains(t, err, "No such container: missing")
+	testutil.AssertEqualsBool(t, "not found", true, IsNotFound(err))
+	var runtimeErr *RuntimeError
+	testutil.AssertEqualsBool(t, "runtime error", true, errors.As(err, &runtimeErr))
+	testutil.AssertEqualsString(t, "op", "starting container", runtimeErr.Op)
+
+	testutil.AssertEqualsBool(t, "volume present", true, d.VolumeExists(nil, "present"))
+	testutil.AssertEqualsBool(t, "volume missing", false, d.VolumeExists(nil, "missing"))
+}
+
+func TestDockerAPIRunContainer(t *testing.T) {
+	var created createRequest
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create "+r.URL.Query().Get("name"))
+		testutil.AssertNoError(t, json.NewDecoder(r.Body).Decode(&created))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("POST /containers/{name}/start", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "start "+r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	d := startTestEngine(t, mux)
+
+	appEntry := &types.AppEntry{Id: "app_prd_123"}
+	appEntry.Metadata.VersionMetadata.Version = 3
+	err := d.RunContainer(nil, appEntry, "clc-app1", "cli-app1", 5000, map[string]string{"PORT": "5000"},
+		[]string{"--volume=/data/x:/x:ro"}, map[string]string{"memory": "512m", "cpus": "1.5"})
+	testutil.AssertNoError(t, err)
+
+	testutil.AssertEqualsString(t, "calls", "create clc-app1,start clc-app1", calls[0]+","+calls[1])
+	testutil.AssertEqualsString(t, "image", "cli-app1", created.Image)
+	testutil.AssertEqualsString(t, "env", "PORT=5000", created.Env[0])
+	testutil.AssertEqualsString(t, "label", "3", created.Labels[LABEL_PREFIX+"app.version"])
+	testutil.AssertEqualsString(t, "host ip", "127.0.0.1", created.HostConfig.PortBindings["5000/tcp"][0].HostIp)
+	testutil.AssertEqualsString(t, "bind", "/data/x:/x:ro", created.HostConfig.Binds[0])
+	testutil.AssertEqualsInt(t, "memory", 512*1024*1024, int(created.HostConfig.Memory))
+	testutil.AssertEqualsInt(t, "cpus", 1500000000, int(created.HostConfig.NanoCpus))
+
+	err = d.RunContainer(nil, appEntry, "clc-app1", "cli-app1", 5000, nil, nil, map[string]string{"cap-add": "ALL"})
+	testutil.AssertErrorContains(t, err, "container option cap-add is not supported by the api container runtime")
+
+	// Service container, not published, with a network alias
+	created = createRequest{}
+	err = d.RunContainer(nil, appEntry, "clc-app1-svc-redis-abc", "redis:7", 0, nil, nil,
+		map[string]string{"network": "cln-app1", "network-alias": "redis"})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "ports", 0, len(created.HostConfig.PortBindings))
+	testutil.AssertEqualsString(t, "network", "cln-app1", created.HostConfig.NetworkMode)
+	testutil.AssertEqualsString(t, "alias", "redis", created.NetworkingConfig.EndpointsConfig["cln-app1"].Aliases[0])
+}
+
+func TestDockerAPIPullOnRun(t *testing.T) {
+	pulled := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if pulled == "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such image: redis:7"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("POST /images/create", func(w http.ResponseWriter, r *http.Request) {
+		pulled = r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		w.Write([]byte(`{"status":"Pulling"}` + "\n" + `{"status":"Done"}`))
+	})
+	mux.HandleFunc("POST /containers/{name}/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	d := startTestEngine(t, mux)
+
+	err := d.RunContainer(nil, &types.AppEntry{Id: "app_prd_123"}, "clc-app1-svc-redis-abc", "redis:7", 0, nil, nil, nil)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "pulled", "redis:7", pulled)
+}
+
+func TestDockerAPIBuildImage(t *testing.T) {
+	dir := t.TempDir()
+	testutil.AssertNoError(t, os.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM scratch"), 0644))
+	testutil.AssertNoError(t, os.WriteFile(filepath.Join(dir, "secret.env"), []byte("x"), 0644))
+	testutil.AssertNoError(t, os.WriteFile(filepath.Join(dir, DOCKER_IGNORE), []byte("# comment\n*.env\n"), 0644))
+
+	var files []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /build", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "tag", "cli-app1", r.URL.Query().Get("t"))
+		testutil.AssertEqualsString(t, "build args", `{"A":"1"}`, r.URL.Query().Get("buildargs"))
+		if r.URL.Query().Get("dockerfile") != "Bad" {
+			testutil.AssertEqualsString(t, "cache from", `["cli-app1-old"]`, r.URL.Query().Get("cachefrom"))
+		}
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			testutil.AssertNoError(t, err)
+			files = append(files, header.Name)
+		}
+		if r.URL.Query().Get("dockerfile") == "Bad" {
+			w.Write([]byte(`{"stream":"Step 1/1 : FROM scratch\n"}` + "\n" + `{"error":"build failed"}`))
+			return
+		}
+		w.Write([]byte(`{"stream":"Successfully built abc\n"}`))
+	})
+	d := startTestEngine(t, mux)
+
+	var output bytes.Buffer
+	err := d.BuildImage(nil, "cli-app1", dir, "Containerfile", map[string]string{"A": "1"},
+		BuildOptions{CacheFrom: []ImageName{"cli-app1-old"}, Output: &output})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "output", "Successfully built abc\n", output.String())
+	slices.Sort(files)
+	testutil.AssertEqualsInt(t, "files", 2, len(files))
+	testutil.AssertEqualsString(t, "file", DOCKER_IGNORE, files[0])
+	testutil.AssertEqualsString(t, "file", "Containerfile", files[1])
+
+	output.Reset()
+	err = d.BuildImage(nil, "cli-app1", dir, "Bad", map[string]string{"A": "1"}, BuildOptions{Output: &output})
+	testutil.AssertErrorContains(t, err, "build failed")
+	testutil.AssertEqualsString(t, "output", "Step 1/1 : FROM scratch\nbuild failed\n", output.String())
+}
+
+func TestDockerAPIPushImage(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /images/{name}/tag", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, fmt.Sprintf("tag %s %s:%s", r.PathValue("name"), r.URL.Query().Get("repo"), r.URL.Query().Get("tag")))
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /images/{name}/push", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "auth", REGISTRY_AUTH_NONE, r.Header.Get("X-Registry-Auth"))
+		calls = append(calls, fmt.Sprintf("push %s:%s", r.PathValue("name"), r.URL.Query().Get("tag")))
+		if strings.HasPrefix(r.PathValue("name"), "bad") {
+			w.Write([]byte(`{"status":"Preparing"}` + "\n" + `{"error":"connection refused"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"Pushed"}`))
+	})
+	d := startTestEngine(t, mux)
+
+	testutil.AssertNoError(t, d.TagImage(nil, "cli-app1", "localhost:5000/clace/cli-app1"))
+	testutil.AssertNoError(t, d.PushImage(nil, "localhost:5000/clace/cli-app1"))
+	err := d.PushImage(nil, "bad:5000/cli-app1")
+	testutil.AssertErrorContains(t, err, "connection refused")
+	testutil.AssertEqualsString(t, "calls", "tag cli-app1 localhost:5000/clace/cli-app1:latest,"+
+		"push localhost:5000/clace/cli-app1:latest,push bad:5000/cli-app1:latest", strings.Join(calls, ","))
+}
+
+func TestRegistryAuth(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", configDir)
+	testutil.AssertEqualsString(t, "no config", REGISTRY_AUTH_NONE, registryAuth("localhost:5000/clace/cli-app1"))
+
+	userPass := func(v string) string { return base64.StdEncoding.EncodeToString([]byte(v)) }
+	config := fmt.Sprintf(`{"auths": {"localhost:5000": {"auth": %q}, "https://index.docker.io/v1/": {"auth": %q}}}`,
+		userPass("user1:pass:1"), userPass("hubuser:hubpass"))
+	testutil.AssertNoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0600))
+
+	decode := func(auth string) map[string]string {
+		data, err := base64.URLEncoding.DecodeString(auth)
+		testutil.AssertNoError(t, err)
+		ret := map[string]string{}
+		testutil.AssertNoError(t, json.Unmarshal(data, &ret))
+		return ret
+	}
+	auth := decode(registryAuth("localhost:5000/clace/cli-app1"))
+	testutil.AssertEqualsString(t, "user", "user1", auth["username"])
+	testutil.AssertEqualsString(t, "password", "pass:1", auth["password"])
+	testutil.AssertEqualsString(t, "server", "localhost:5000", auth["serveraddress"])
+	testutil.AssertEqualsString(t, "hub", "hubuser", decode(registryAuth("myorg/app"))["username"])
+	testutil.AssertEqualsString(t, "hub", "hubuser", decode(registryAuth("docker.io/myorg/app"))["username"])
+	testutil.AssertEqualsString(t, "other registry", REGISTRY_AUTH_NONE, registryAuth("ghcr.io/myorg/app"))
+}
+
+func TestDockerAPIExec(t *testing.T) {
+	var createReq map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/{name}/exec", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "name", "clc-app1", r.PathValue("name"))
+		createReq = nil
+		testutil.AssertNoError(t, json.NewDecoder(r.Body).Decode(&createReq))
+		w.Write([]byte(`{"Id":"exec1"}`))
+	})
+	mux.HandleFunc("POST /exec/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "upgrade", "tcp", r.Header.Get("Upgrade"))
+		body, err := io.ReadAll(r.Body)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsString(t, "start", `{"Detach":false,"Tty":false}`, string(body))
+		conn, bufrw, err := http.NewResponseController(w).Hijack()
+		testutil.AssertNoError(t, err)
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+		if createReq["AttachStdin"] == true {
+			// Echo the input as multiplexed stdout
+			input, err := io.ReadAll(bufrw)
+			testutil.AssertNoError(t, err)
+			conn.Write([]byte{1, 0, 0, 0, 0, 0, 0, byte(len(input))})
+			conn.Write(input)
+			return
+		}
+		conn.Write([]byte{1, 0, 0, 0, 0, 0, 0, 4})
+		conn.Write([]byte("out\n"))
+		conn.Write([]byte{2, 0, 0, 0, 0, 0, 0, 4})
+		conn.Write([]byte("err\n"))
+	})
+	mux.HandleFunc("GET /exec/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ExitCode":2,"Running":false}`))
+	})
+	d := startTestEngine(t, mux)
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := d.ExecContainer(context.Background(), nil, "clc-app1", ExecOptions{Cmd: []string{"ls", "/data"}, Stdout: &stdout, Stderr: &stderr})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "exit code", 2, exitCode)
+	testutil.AssertEqualsString(t, "stdout", "out\n", stdout.String())
+	testutil.AssertEqualsString(t, "stderr", "err\n", stderr.String())
+	testutil.AssertEqualsString(t, "cmd", "[ls /data]", fmt.Sprint(createReq["Cmd"]))
+	testutil.AssertEqualsBool(t, "tty", false, createReq["Tty"].(bool))
+
+	stdout.Reset()
+	_, err = d.ExecContainer(context.Background(), nil, "clc-app1", ExecOptions{Cmd: []string{"cat"}, Stdin: strings.NewReader("hello\n"),
+		Stdout: &stdout, Stderr: &stderr})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "stdout", "hello\n", stdout.String())
+}
+
+func TestDockerAPIRunCommand(t *testing.T) {
+	var createReq createRequest
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create "+r.URL.Query().Get("name"))
+		createReq = createRequest{}
+		testutil.AssertNoError(t, json.NewDecoder(r.Body).Decode(&createReq))
+		w.Write([]byte(`{"Id":"run1"}`))
+	})
+	mux.HandleFunc("POST /containers/{id}/attach", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "attach "+r.PathValue("id"))
+		testutil.AssertEqualsString(t, "upgrade", "tcp", r.Header.Get("Upgrade"))
+		testutil.AssertEqualsString(t, "stream", "1", r.URL.Query().Get("stream"))
+		conn, _, err := http.NewResponseController(w).Hijack()
+		testutil.AssertNoError(t, err)
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+		conn.Write([]byte{1, 0, 0, 0, 0, 0, 0, 4})
+		conn.Write([]byte("out\n"))
+		conn.Write([]byte{2, 0, 0, 0, 0, 0, 0, 4})
+		conn.Write([]byte("err\n"))
+	})
+	mux.HandleFunc("POST /containers/{id}/wait", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "wait "+r.URL.Query().Get("condition"))
+		w.Write([]byte(`{"StatusCode":3}`))
+	})
+	mux.HandleFunc("POST /containers/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "start "+r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	d := startTestEngine(t, mux)
+
+	var stdout, stderr bytes.Buffer
+	appEntry := &types.AppEntry{Id: "app_prd_1"}
+	exitCode, err := d.RunCommand(context.Background(), nil, appEntry, RunOptions{Image: "img1", Cmd: []string{"ls", "/data"},
+		Env: map[string]string{"A": "1"}, Options: map[string]string{"memory": "1m"}, Stdout: &stdout, Stderr: &stderr})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "exit code", 3, exitCode)
+	testutil.AssertEqualsString(t, "stdout", "out\n", stdout.String())
+	testutil.AssertEqualsString(t, "stderr", "err\n", stderr.String())
+	testutil.AssertEqualsString(t, "calls", "[create  attach run1 wait next-exit start run1]", fmt.Sprint(calls))
+	testutil.AssertEqualsString(t, "cmd", "[ls /data]", fmt.Sprint(createReq.Cmd))
+	testutil.AssertEqualsString(t, "env", "[A=1]", fmt.Sprint(createReq.Env))
+	testutil.AssertEqualsBool(t, "auto remove", true, createReq.HostConfig.AutoRemove)
+	testutil.AssertEqualsInt(t, "memory", 1024*1024, int(createReq.HostConfig.Memory))
+	testutil.AssertEqualsString(t, "label", "app_prd_1", createReq.Labels[LABEL_PREFIX+"app.id"])
+
+	// Named containers are retained after exit
+	calls = calls[:0]
+	_, err = d.RunCommand(context.Background(), nil, appEntry, RunOptions{Image: "img1", Name: "clc-app-run-1", Cmd: []string{"ls"},
+		Stdout: &stdout, Stderr: &stderr})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "create name", "create clc-app-run-1", calls[0])
+	testutil.AssertEqualsBool(t, "auto remove", false, createReq.HostConfig.AutoRemove)
+}
+
+func TestDemuxLogs(t *testing.T) {
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 6}
+	data = append(data, []byte("hello\n")...)
+	data = append(data, []byte{2, 0, 0, 0, 0, 0, 0, 4}...)
+	data = append(data, []byte("err\n")...)
+	testutil.AssertEqualsString(t, "multiplexed", "hello\nerr\n", string(demuxLogs(data)))
+	testutil.AssertEqualsString(t, "tty", "plain output\n", string(demuxLogs([]byte("plain output\n"))))
+}
+
+func TestDockerAPIStreamLogs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/{name}/logs", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "follow", "1", r.URL.Query().Get("follow"))
+		testutil.AssertEqualsString(t, "tail", "200", r.URL.Query().Get("tail"))
+		since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsBool(t, "since", true, time.Now().Unix()-since >= 600)
+		w.Write([]byte{1, 0, 0, 0, 0, 0, 0, 6})
+		w.Write([]byte("hello\n"))
+		w.Write([]byte{2, 0, 0, 0, 0, 0, 0, 4})
+		w.Write([]byte("err\n"))
+	})
+	d := startTestEngine(t, mux)
+
+	var out bytes.Buffer
+	err := d.StreamContainerLogs(context.Background(), nil, "clc-app1", LogOptions{Follow: true, Since: 10 * time.Minute, Tail: 200}, &out)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "logs", "hello\nerr\n", out.String())
+
+	// TTY output is not multiplexed
+	var tty bytes.Buffer
+	testutil.AssertNoError(t, copyLogs(&tty, strings.NewReader("plain\n")))
+	testutil.AssertEqualsString(t, "tty", "plain\n", tty.String())
+}
+
+func TestDockerAPIContainerStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/{name}/stats", func(w http.ResponseWriter, r *http.Request) {
+		testutil.AssertEqualsString(t, "stream", "false", r.URL.Query().Get("stream"))
+		w.Write([]byte(`{"cpu_stats":{"cpu_usage":{"total_usage":300},"system_cpu_usage":2000,"online_cpus":2},
+			"precpu_stats":{"cpu_usage":{"total_usage":100},"system_cpu_usage":1000},
+			"memory_stats":{"usage":5000,"stats":{"inactive_file":1000}}}`))
+	})
+	d := startTestEngine(t, mux)
+
+	stats, err := d.GetContainerStats(nil, []ContainerName{"clc-app1"})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "name", "clc-app1", stats[0].Name)
+	testutil.AssertEqualsInt(t, "cpu", 40, int(stats[0].CpuPercent))
+	testutil.AssertEqualsInt(t, "memory", 4000, int(stats[0].MemoryBytes))
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := map[string]int64{"100": 100, "1k": 1024, "512m": 512 << 20, "2g": 2 << 30, "2GB": 2 << 30}
+	for input, want := range tests {
+		got, err := parseMemory(input)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsInt(t, input, int(want), int(got))
+	}
+	_, err := parseMemory("abc")
+	testutil.AssertErrorContains(t, err, "invalid syntax")
+}
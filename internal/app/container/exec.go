@@ -0,0 +1,76 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// ExecOptions are the options for running a command in a running container
+type ExecOptions struct {
+	Cmd    []string
+	Tty    bool            // allocate a TTY, supported by the API runtime. The CLI runtime runs the command without a TTY
+	Stdin  io.Reader       // input for the command, nil if the input is not attached
+	Stdout io.Writer       // output of the command
+	Stderr io.Writer       // error output of the command, with a TTY the error output is written to Stdout
+	Size   TermSize        // initial terminal size, used with a TTY
+	Resize <-chan TermSize // terminal size changes, used with a TTY
+}
+
+// TermSize is the size of the terminal
+type TermSize struct {
+	Rows uint
+	Cols uint
+}
+
+// TtySupported returns true if the configured container runtime allocates a TTY for exec. The CLI runtime
+// does not, the container command requires its own input to be a terminal for that
+func TtySupported(config *types.SystemConfig) bool {
+	return config.ContainerRuntime == RUNTIME_API
+}
+
+// ExecContainer runs the command in the container and returns the exit code of the command. The command
+// is killed if the context is cancelled
+func (c ContainerCommand) ExecContainer(ctx context.Context, config *types.SystemConfig, name ContainerName, opts ExecOptions) (int, error) {
+	c.Debug().Msgf("Running exec in container %s: %v", name, opts.Cmd)
+	args := []string{"exec"}
+	if opts.Stdin != nil {
+		args = append(args, "--interactive")
+	}
+	// A TTY is not allocated, the container command requires its own input to be a terminal for that
+	args = append(args, string(name))
+	args = append(args, opts.Cmd...)
+
+	cmd := exec.CommandContext(ctx, config.ContainerCommand, args...)
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	if opts.Stdin != nil {
+		// Using the stdin pipe instead of setting cmd.Stdin, so that the wait for the command to
+		// exit does not block on the input. The copy ends when the caller closes the input
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return -1, err
+		}
+		go func() {
+			_, _ = io.Copy(stdin, opts.Stdin)
+			stdin.Close()
+		}()
+	}
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error running exec in container %s: %w", name, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,535 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+const FAKE_START_PORT = 40000
+
+// FakeContainer is a container in the fake runtime
+type FakeContainer struct {
+	Name     ContainerName
+	Image    ImageName
+	Port     int64 // port within the container
+	Env      map[string]string
+	Mounts   []string
+	Options  map[string]string
+	Labels   map[string]string
+	State    string
+	Logs     string
+	HostPort int // port allocated on the host, set when running
+}
+
+// FakeRuntime is an in-memory ContainerRuntime, used to test container apps without a container daemon.
+// Containers are not actually started, the host port allocated can be served by the test
+type FakeRuntime struct {
+	mu         sync.Mutex
+	images     map[ImageName]bool
+	registry   map[ImageName]bool
+	containers map[ContainerName]*FakeContainer
+	volumes    map[VolumeName]bool
+	networks   map[NetworkName]bool
+	owned      map[string]bool // images, volumes and networks created with the instance label
+	stats      map[ContainerName]ContainerStats
+	nextPort   int
+
+	// BuildError, if set, is returned by BuildImage
+	BuildError error
+	// BuildOpts has the options passed to the last BuildImage call
+	BuildOpts BuildOptions
+	// ExecExitCode is the exit code returned by ExecContainer
+	ExecExitCode int
+	// RunExitCode is the exit code returned by RunCommand
+	RunExitCode int
+	// Calls has the list of operations done, in "op name" format
+	Calls []string
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		images:     map[ImageName]bool{},
+		registry:   map[ImageName]bool{},
+		containers: map[ContainerName]*FakeContainer{},
+		volumes:    map[VolumeName]bool{},
+		networks:   map[NetworkName]bool{},
+		owned:      map[string]bool{},
+		stats:      map[ContainerName]ContainerStats{},
+		nextPort:   FAKE_START_PORT,
+	}
+}
+
+func (f *FakeRuntime) record(op string, name any) {
+	f.Calls = append(f.Calls, fmt.Sprintf("%s %s", op, name))
+}
+
+func notFound(op string, name any) error {
+	return &RuntimeError{Op: op, StatusCode: http.StatusNotFound, Message: fmt.Sprintf("no such object: %s", name)}
+}
+
+func conflict(op string, msg string) error {
+	return &RuntimeError{Op: op, StatusCode: http.StatusConflict, Message: msg}
+}
+
+// GetContainer returns a copy of the container, nil if not present
+func (f *FakeRuntime) GetContainer(name ContainerName) *FakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.containers[name]
+	if !ok {
+		return nil
+	}
+	ret := *c
+	return &ret
+}
+
+// SetContainerState updates the container state, used to simulate a container exit
+func (f *FakeRuntime) SetContainerState(name ContainerName, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.containers[name]; ok {
+		c.State = state
+	}
+}
+
+// AddImage adds an image, used to simulate a pulled image
+func (f *FakeRuntime) AddImage(name ImageName) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[name] = true
+}
+
+// InRegistry returns true if the image has been pushed to the registry
+func (f *FakeRuntime) InRegistry(name ImageName) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.registry[name]
+}
+
+func (f *FakeRuntime) BuildImage(config *types.SystemConfig, name ImageName, sourceUrl, containerFile string,
+	containerArgs map[string]string, opts BuildOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("build", name)
+	f.BuildOpts = opts
+	if opts.Output != nil {
+		fmt.Fprintf(opts.Output, "building %s\n", name)
+	}
+	if f.BuildError != nil {
+		return f.BuildError
+	}
+	f.images[name] = true
+	f.owned[string(name)] = true
+	return nil
+}
+
+func (f *FakeRuntime) TagImage(config *types.SystemConfig, source, target ImageName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("tag", target)
+	if !f.images[source] {
+		return notFound("tagging image", source)
+	}
+	f.images[target] = true
+	return nil
+}
+
+func (f *FakeRuntime) PushImage(config *types.SystemConfig, name ImageName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("push", name)
+	if !f.images[name] {
+		return notFound("pushing image", name)
+	}
+	f.registry[name] = true
+	return nil
+}
+
+func (f *FakeRuntime) PullImage(config *types.SystemConfig, name ImageName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("pull", name)
+	if !f.registry[name] {
+		return notFound("pulling image", name)
+	}
+	f.images[name] = true
+	return nil
+}
+
+func (f *FakeRuntime) RemoveImage(config *types.SystemConfig, name ImageName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("rmi", name)
+	if !f.images[name] {
+		return notFound("removing image", name)
+	}
+	for _, c := range f.containers {
+		if c.Image == name {
+			return conflict("removing image", fmt.Sprintf("image %s is being used by container %s", name, c.Name))
+		}
+	}
+	delete(f.images, name)
+	delete(f.owned, string(name))
+	return nil
+}
+
+func (f *FakeRuntime) GetImages(config *types.SystemConfig, name ImageName) ([]Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := []Image{}
+	for image := range f.images {
+		prefix, isGlob := strings.CutSuffix(string(name), "*")
+		if name == "" || image == name || (isGlob && strings.HasPrefix(string(image), prefix)) {
+			resp = append(resp, Image{Repository: string(image)})
+		}
+	}
+	slices.SortFunc(resp, func(a, b Image) int { return strings.Compare(a.Repository, b.Repository) })
+	return resp, nil
+}
+
+func (f *FakeRuntime) GetInstanceImages(config *types.SystemConfig, prefix string) ([]Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := []Image{}
+	for image := range f.images {
+		if strings.HasPrefix(string(image), prefix) && f.owned[string(image)] {
+			resp = append(resp, Image{Repository: string(image)})
+		}
+	}
+	slices.SortFunc(resp, func(a, b Image) int { return strings.Compare(a.Repository, b.Repository) })
+	return resp, nil
+}
+
+func (f *FakeRuntime) RunContainer(config *types.SystemConfig, appEntry *types.AppEntry, containerName ContainerName,
+	imageName ImageName, port int64, envMap map[string]string, mountArgs []string,
+	containerOptions map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("run", containerName)
+	if !f.images[imageName] {
+		return notFound("running container", imageName)
+	}
+	if _, ok := f.containers[containerName]; ok {
+		return conflict("running container", fmt.Sprintf("container name %s is already in use", containerName))
+	}
+	if network := containerOptions["network"]; network != "" && !f.networks[NetworkName(network)] {
+		return notFound("running container", network)
+	}
+
+	f.nextPort++
+	f.containers[containerName] = &FakeContainer{
+		Name:     containerName,
+		Image:    imageName,
+		Port:     port,
+		Env:      envMap,
+		Mounts:   mountArgs,
+		Options:  containerOptions,
+		Labels:   genLabels(appEntry),
+		State:    "running",
+		HostPort: f.nextPort,
+	}
+	return nil
+}
+
+// RunCommand writes the command line as the output. If a container name is specified, an exited container
+// is added with the output as the logs
+func (f *FakeRuntime) RunCommand(ctx context.Context, config *types.SystemConfig, appEntry *types.AppEntry, opts RunOptions) (int, error) {
+	f.mu.Lock()
+	f.record("run-command", opts.Name)
+	if !f.images[opts.Image] {
+		f.mu.Unlock()
+		return -1, notFound("running command", opts.Image)
+	}
+	output := strings.Join(opts.Cmd, " ") + "\n"
+	if opts.Name != "" {
+		if _, ok := f.containers[opts.Name]; ok {
+			f.mu.Unlock()
+			return -1, conflict("running command", fmt.Sprintf("container name %s is already in use", opts.Name))
+		}
+		f.containers[opts.Name] = &FakeContainer{
+			Name:    opts.Name,
+			Image:   opts.Image,
+			Env:     opts.Env,
+			Mounts:  opts.MountArgs,
+			Options: opts.Options,
+			Labels:  genLabels(appEntry),
+			State:   "exited",
+			Logs:    output,
+		}
+	}
+	exitCode := f.RunExitCode
+	f.mu.Unlock()
+
+	if _, err := io.WriteString(opts.Stdout, output); err != nil {
+		return -1, err
+	}
+	return exitCode, nil
+}
+
+func (f *FakeRuntime) StartContainer(config *types.SystemConfig, name ContainerName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("start", name)
+	c, ok := f.containers[name]
+	if !ok {
+		return notFound("starting container", name)
+	}
+	c.State = "running"
+	return nil
+}
+
+func (f *FakeRuntime) StopContainer(config *types.SystemConfig, name ContainerName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("stop", name)
+	c, ok := f.containers[name]
+	if !ok {
+		return notFound("stopping container", name)
+	}
+	c.State = "exited"
+	return nil
+}
+
+func (f *FakeRuntime) RemoveContainer(config *types.SystemConfig, name ContainerName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("rm", name)
+	c, ok := f.containers[name]
+	if !ok {
+		return notFound("removing container", name)
+	}
+	if c.State == "running" {
+		return conflict("removing container", fmt.Sprintf("container %s is running, stop it before removing", name))
+	}
+	delete(f.containers, name)
+	return nil
+}
+
+// GetContainers matches the containers by name prefix, similar to the name filter in the container engines
+func (f *FakeRuntime) GetContainers(config *types.SystemConfig, name ContainerName, getAll bool) ([]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := []Container{}
+	for _, c := range f.containers {
+		if !strings.HasPrefix(string(c.Name), string(name)) || (!getAll && c.State != "running") {
+			continue
+		}
+		port := 0
+		if c.State == "running" {
+			port = c.HostPort
+		}
+		resp = append(resp, Container{
+			ID:     string(c.Name),
+			Names:  string(c.Name),
+			Image:  string(c.Image),
+			State:  c.State,
+			Status: c.State,
+			Port:   port,
+			Labels: c.Labels,
+		})
+	}
+	slices.SortFunc(resp, func(a, b Container) int { return strings.Compare(a.Names, b.Names) })
+	return resp, nil
+}
+
+func (f *FakeRuntime) GetContainerLogs(config *types.SystemConfig, name ContainerName) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.containers[name]
+	if !ok {
+		return "", notFound("getting container logs", name)
+	}
+	return c.Logs, nil
+}
+
+// StreamContainerLogs writes the container logs, the since option is ignored. For follow requests,
+// it blocks until the context is cancelled
+func (f *FakeRuntime) StreamContainerLogs(ctx context.Context, config *types.SystemConfig, name ContainerName, opts LogOptions, w io.Writer) error {
+	f.mu.Lock()
+	c, ok := f.containers[name]
+	if !ok {
+		f.mu.Unlock()
+		return notFound("streaming container logs", name)
+	}
+	logs := c.Logs
+	f.mu.Unlock()
+
+	if opts.Tail > 0 {
+		lines := strings.SplitAfter(logs, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		logs = strings.Join(lines[max(0, len(lines)-opts.Tail):], "")
+	}
+	if _, err := io.WriteString(w, logs); err != nil {
+		return err
+	}
+	if opts.Follow {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+// SetContainerLogs sets the log output for the container
+func (f *FakeRuntime) SetContainerLogs(name ContainerName, logs string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.containers[name]; ok {
+		c.Logs = logs
+	}
+}
+
+func (f *FakeRuntime) VolumeExists(config *types.SystemConfig, name VolumeName) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.volumes[name]
+}
+
+func (f *FakeRuntime) VolumeCreate(config *types.SystemConfig, name VolumeName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("volume_create", name)
+	if f.volumes[name] {
+		return conflict("creating volume", fmt.Sprintf("volume %s already exists", name))
+	}
+	f.volumes[name] = true
+	f.owned[string(name)] = true
+	return nil
+}
+
+func (f *FakeRuntime) GetVolumes(config *types.SystemConfig, prefix string) ([]VolumeName, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := []VolumeName{}
+	for name := range f.volumes {
+		if strings.HasPrefix(string(name), prefix) && f.owned[string(name)] {
+			ret = append(ret, name)
+		}
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+func (f *FakeRuntime) RemoveVolume(config *types.SystemConfig, name VolumeName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("volume_rm", name)
+	if !f.volumes[name] {
+		return notFound("removing volume", name)
+	}
+	delete(f.volumes, name)
+	delete(f.owned, string(name))
+	return nil
+}
+
+func (f *FakeRuntime) NetworkExists(config *types.SystemConfig, name NetworkName) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.networks[name]
+}
+
+func (f *FakeRuntime) NetworkCreate(config *types.SystemConfig, name NetworkName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("network_create", name)
+	if f.networks[name] {
+		return conflict("creating network", fmt.Sprintf("network %s already exists", name))
+	}
+	f.networks[name] = true
+	f.owned[string(name)] = true
+	return nil
+}
+
+func (f *FakeRuntime) GetNetworks(config *types.SystemConfig, prefix string) ([]NetworkName, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := []NetworkName{}
+	for name := range f.networks {
+		if strings.HasPrefix(string(name), prefix) && f.owned[string(name)] {
+			ret = append(ret, name)
+		}
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+func (f *FakeRuntime) RemoveNetwork(config *types.SystemConfig, name NetworkName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("network_rm", name)
+	if !f.networks[name] {
+		return notFound("removing network", name)
+	}
+	for _, c := range f.containers {
+		if c.Options["network"] == string(name) {
+			return conflict("removing network", fmt.Sprintf("network %s is being used by container %s", name, c.Name))
+		}
+	}
+	delete(f.networks, name)
+	delete(f.owned, string(name))
+	return nil
+}
+
+// SetContainerStats sets the resource usage returned for the container
+func (f *FakeRuntime) SetContainerStats(name ContainerName, cpuPercent float64, memoryBytes int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stats[name] = ContainerStats{Name: string(name), CpuPercent: cpuPercent, MemoryBytes: memoryBytes}
+}
+
+// GetContainerStats returns the stats set for the containers, zero usage if not set. Stopped containers are an error
+func (f *FakeRuntime) GetContainerStats(config *types.SystemConfig, names []ContainerName) ([]ContainerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := make([]ContainerStats, 0, len(names))
+	for _, name := range names {
+		c, ok := f.containers[name]
+		if !ok || c.State != "running" {
+			return nil, notFound("getting container stats", name)
+		}
+		stats, ok := f.stats[name]
+		if !ok {
+			stats = ContainerStats{Name: string(name)}
+		}
+		ret = append(ret, stats)
+	}
+	return ret, nil
+}
+
+// ExecContainer writes the command to stdout, followed by the input if attached. The command
+// is not actually run, ExecExitCode is returned as the exit code
+func (f *FakeRuntime) ExecContainer(ctx context.Context, config *types.SystemConfig, name ContainerName, opts ExecOptions) (int, error) {
+	f.mu.Lock()
+	f.record("exec", name)
+	c, ok := f.containers[name]
+	if !ok {
+		f.mu.Unlock()
+		return -1, notFound("running exec", name)
+	}
+	if c.State != "running" {
+		f.mu.Unlock()
+		return -1, conflict("running exec", fmt.Sprintf("container %s is not running", name))
+	}
+	exitCode := f.ExecExitCode
+	f.mu.Unlock()
+
+	if _, err := fmt.Fprintln(opts.Stdout, strings.Join(opts.Cmd, " ")); err != nil {
+		return -1, err
+	}
+	if opts.Stdin != nil {
+		if _, err := io.Copy(opts.Stdout, opts.Stdin); err != nil {
+			return -1, err
+		}
+	}
+	return exitCode, nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// ResourceLimits are the validated resource limits and security settings for the app containers.
+// Zero values mean no limit
+type ResourceLimits struct {
+	Memory          int64 // in bytes
+	NanoCpus        int64 // cpus in units of 10^-9
+	PidsLimit       int64
+	ReadOnly        bool
+	NoNewPrivileges bool
+	User            string
+}
+
+// resourceOptions are the container options which are replaced by the typed limits
+var resourceOptions = []string{"memory", "m", "memory-swap", "cpus", "pids-limit", "read-only", "user", "u"}
+
+// restrictedOptions are the container options which are rejected if the server configures a max limit,
+// since they can be used to bypass the limits or the container isolation
+var restrictedOptions = []string{"cpu-quota", "cpu-period", "cpuset-cpus", "memory-reservation", "oom-kill-disable",
+	"privileged", "security-opt"}
+
+// IsPodman returns true if the podman CLI is used for running containers
+func IsPodman(config *types.SystemConfig) bool {
+	return config.ContainerRuntime != RUNTIME_API && strings.Contains(path.Base(config.ContainerCommand), "podman")
+}
+
+// ParseResourceLimits validates the limits in the app container config against the maximums in the
+// system config. If the limit is not set in the app config, the value from the container options is used,
+// so that limits set using the options are validated also. If a maximum is configured and the app does not
+// set a limit, the maximum is used as the limit. If any maximum is configured, the container options which can
+// bypass the limits are rejected
+func ParseResourceLimits(containerConfig types.Container, containerOptions map[string]string, config *types.SystemConfig) (ResourceLimits, error) {
+	if hasMaxLimit(config) {
+		for _, k := range restrictedOptions {
+			if _, ok := containerOptions[k]; ok {
+				return ResourceLimits{}, fmt.Errorf("container option %s is not allowed, the server has max limits configured", k)
+			}
+		}
+	}
+
+	ret := ResourceLimits{
+		ReadOnly:        containerConfig.ReadOnly || isTrueOption(containerOptions, "read-only"),
+		NoNewPrivileges: containerConfig.NoNewPrivileges,
+		User:            optionValue(containerConfig.User, containerOptions, "user", "u"),
+	}
+
+	var err error
+	memory := optionValue(containerConfig.Memory, containerOptions, "memory", "m")
+	if memory != "" {
+		if ret.Memory, err = parseMemory(memory); err != nil || ret.Memory < 0 {
+			return ret, fmt.Errorf("invalid container.memory %s, expected a value like 512m or 2g", memory)
+		}
+	}
+	if ret.Memory, err = applyMax("memory", ret.Memory, config.ContainerMaxMemory, parseMemory); err != nil {
+		return ret, err
+	}
+
+	cpus := optionValue(containerConfig.Cpus, containerOptions, "cpus")
+	if cpus != "" {
+		if ret.NanoCpus, err = parseCpus(cpus); err != nil || ret.NanoCpus < 0 {
+			return ret, fmt.Errorf("invalid container.cpus %s, expected a value like 0.5 or 2", cpus)
+		}
+	}
+	if ret.NanoCpus, err = applyMax("cpus", ret.NanoCpus, config.ContainerMaxCpus, parseCpus); err != nil {
+		return ret, err
+	}
+
+	ret.PidsLimit = int64(containerConfig.PidsLimit)
+	if pids, ok := containerOptions["pids-limit"]; ok {
+		// The option is validated even if the typed value is set, an unlimited value is not allowed with a max
+		pidsOption, err := strconv.ParseInt(pids, 10, 64)
+		if err != nil {
+			return ret, fmt.Errorf("invalid pids-limit container option %s", pids)
+		}
+		if pidsOption <= 0 && hasMaxLimit(config) {
+			return ret, fmt.Errorf("container option pids-limit %s is not allowed, the server has max limits configured", pids)
+		}
+		if ret.PidsLimit == 0 {
+			ret.PidsLimit = pidsOption
+		}
+	}
+	if ret.PidsLimit < 0 {
+		return ret, fmt.Errorf("invalid container.pids_limit %d", ret.PidsLimit)
+	}
+	if ret.PidsLimit, err = applyMax("pids_limit", ret.PidsLimit, strconv.Itoa(config.ContainerMaxPids), func(v string) (int64, error) {
+		return strconv.ParseInt(v, 10, 64)
+	}); err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+// hasMaxLimit returns true if any of the max limits is configured in the system config
+func hasMaxLimit(config *types.SystemConfig) bool {
+	return (config.ContainerMaxMemory != "" && config.ContainerMaxMemory != "0") ||
+		(config.ContainerMaxCpus != "" && config.ContainerMaxCpus != "0") || config.ContainerMaxPids > 0
+}
+
+// applyMax checks the value against the max configured in the system config. An unset value is
+// set to the max. Empty or zero max means no max
+func applyMax(name string, value int64, maxStr string, parse func(string) (int64, error)) (int64, error) {
+	if maxStr == "" || maxStr == "0" {
+		return value, nil
+	}
+	maxValue, err := parse(maxStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max value %s for container %s in system config: %w", maxStr, name, err)
+	}
+	if value == 0 {
+		return maxValue, nil
+	}
+	if value > maxValue {
+		return 0, fmt.Errorf("container.%s exceeds the max value %s allowed by the server", name, maxStr)
+	}
+	return value, nil
+}
+
+// Options returns the limits as container options, in the format used by the docker and podman CLI.
+// The existing container options are retained, except the ones which are replaced by the limits
+func (l ResourceLimits) Options(containerOptions map[string]string, isPodman bool) map[string]string {
+	ret := map[string]string{}
+	for k, v := range containerOptions {
+		ret[k] = v
+	}
+	for _, k := range resourceOptions {
+		delete(ret, k)
+	}
+
+	if l.Memory > 0 {
+		ret["memory"] = strconv.FormatInt(l.Memory, 10)
+		// Swap is disabled, so that the memory limit cannot be exceeded by swapping
+		ret["memory-swap"] = ret["memory"]
+	}
+	if l.NanoCpus > 0 {
+		ret["cpus"] = strconv.FormatFloat(float64(l.NanoCpus)/1e9, 'f', -1, 64)
+	}
+	if l.PidsLimit > 0 {
+		ret["pids-limit"] = strconv.FormatInt(l.PidsLimit, 10)
+	}
+	if l.ReadOnly {
+		ret["read-only"] = ""
+		if !isPodman {
+			// Podman mounts tmpfs on /tmp, /run and /var/tmp for read-only containers by default,
+			// docker requires the tmpfs to be added explicitly
+			if _, ok := ret["tmpfs"]; !ok {
+				ret["tmpfs"] = "/tmp"
+			}
+		}
+	}
+	if l.NoNewPrivileges {
+		ret["security-opt"] = "no-new-privileges"
+	}
+	if l.User != "" {
+		ret["user"] = l.User
+	}
+	return ret
+}
+
+// parseCpus parses the cpu count like 0.5 into nano cpus
+func parseCpus(value string) (int64, error) {
+	cpus, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(cpus * 1e9), nil
+}
+
+// optionValue returns the config value if set, otherwise the first container option present
+func optionValue(value string, containerOptions map[string]string, keys ...string) string {
+	if value != "" {
+		return value
+	}
+	for _, k := range keys {
+		if v, ok := containerOptions[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func isTrueOption(containerOptions map[string]string, key string) bool {
+	v, ok := containerOptions[key]
+	return ok && (v == "" || v == "true")
+}
@@ -0,0 +1,96 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestParseResourceLimits(t *testing.T) {
+	config := &types.SystemConfig{}
+	limits, err := ParseResourceLimits(types.Container{Memory: "512m", Cpus: "1.5", PidsLimit: 100, User: "1000"},
+		map[string]string{"memory": "2g", "user": "root"}, config)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "memory", 512<<20, int(limits.Memory))
+	testutil.AssertEqualsInt(t, "cpus", 1500000000, int(limits.NanoCpus))
+	testutil.AssertEqualsInt(t, "pids", 100, int(limits.PidsLimit))
+	testutil.AssertEqualsString(t, "user", "1000", limits.User)
+
+	// Container options are used if the config is not set
+	limits, err = ParseResourceLimits(types.Container{}, map[string]string{"m": "1g", "pids-limit": "50", "read-only": ""}, config)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "memory", 1<<30, int(limits.Memory))
+	testutil.AssertEqualsInt(t, "pids", 50, int(limits.PidsLimit))
+	testutil.AssertEqualsBool(t, "read only", true, limits.ReadOnly)
+
+	_, err = ParseResourceLimits(types.Container{Memory: "lots"}, nil, config)
+	testutil.AssertErrorContains(t, err, "invalid container.memory lots")
+	_, err = ParseResourceLimits(types.Container{Cpus: "x"}, nil, config)
+	testutil.AssertErrorContains(t, err, "invalid container.cpus x")
+
+	// Max values in the system config
+	config = &types.SystemConfig{ContainerMaxMemory: "1g", ContainerMaxCpus: "2", ContainerMaxPids: 200}
+	limits, err = ParseResourceLimits(types.Container{Cpus: "0.5"}, nil, config)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "default to max", 1<<30, int(limits.Memory))
+	testutil.AssertEqualsInt(t, "cpus", 500000000, int(limits.NanoCpus))
+	testutil.AssertEqualsInt(t, "default to max", 200, int(limits.PidsLimit))
+
+	_, err = ParseResourceLimits(types.Container{Memory: "2g"}, nil, config)
+	testutil.AssertErrorContains(t, err, "container.memory exceeds the max value 1g allowed by the server")
+	_, err = ParseResourceLimits(types.Container{}, map[string]string{"cpus": "4"}, config)
+	testutil.AssertErrorContains(t, err, "container.cpus exceeds the max value 2 allowed by the server")
+	_, err = ParseResourceLimits(types.Container{PidsLimit: 500}, nil, config)
+	testutil.AssertErrorContains(t, err, "container.pids_limit exceeds the max value 200")
+
+	// Options which bypass the limits are rejected when a max is configured
+	for _, option := range []string{"cpu-quota", "cpu-period", "cpuset-cpus", "memory-reservation", "oom-kill-disable", "privileged", "security-opt"} {
+		_, err = ParseResourceLimits(types.Container{}, map[string]string{option: "1"}, config)
+		testutil.AssertErrorContains(t, err, "container option "+option+" is not allowed, the server has max limits configured")
+		_, err = ParseResourceLimits(types.Container{}, map[string]string{option: "1"}, &types.SystemConfig{ContainerMaxPids: 10})
+		testutil.AssertErrorContains(t, err, "container option "+option+" is not allowed")
+	}
+	_, err = ParseResourceLimits(types.Container{PidsLimit: 100}, map[string]string{"pids-limit": "-1"}, config)
+	testutil.AssertErrorContains(t, err, "container option pids-limit -1 is not allowed")
+	_, err = ParseResourceLimits(types.Container{PidsLimit: 100}, map[string]string{"pids-limit": "x"}, config)
+	testutil.AssertErrorContains(t, err, "invalid pids-limit container option x")
+
+	// Without a max, the options are allowed
+	limits, err = ParseResourceLimits(types.Container{PidsLimit: 100}, map[string]string{"privileged": "", "pids-limit": "-1"}, &types.SystemConfig{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "typed pids", 100, int(limits.PidsLimit))
+}
+
+func TestResourceLimitOptions(t *testing.T) {
+	limits := ResourceLimits{Memory: 512 << 20, NanoCpus: 1500000000, PidsLimit: 100, ReadOnly: true, NoNewPrivileges: true, User: "1000"}
+	options := limits.Options(map[string]string{"m": "2g", "network": "host"}, false)
+	testutil.AssertEqualsString(t, "memory", "536870912", options["memory"])
+	testutil.AssertEqualsString(t, "swap", "536870912", options["memory-swap"])
+	testutil.AssertEqualsString(t, "cpus", "1.5", options["cpus"])
+	testutil.AssertEqualsString(t, "pids", "100", options["pids-limit"])
+	testutil.AssertEqualsString(t, "tmpfs", "/tmp", options["tmpfs"])
+	testutil.AssertEqualsString(t, "security", "no-new-privileges", options["security-opt"])
+	testutil.AssertEqualsString(t, "user", "1000", options["user"])
+	testutil.AssertEqualsString(t, "other options", "host", options["network"])
+	_, ok := options["m"]
+	testutil.AssertEqualsBool(t, "replaced", false, ok)
+
+	podmanOptions := limits.Options(nil, true)
+	_, ok = podmanOptions["tmpfs"]
+	testutil.AssertEqualsBool(t, "podman tmpfs", false, ok)
+	testutil.AssertEqualsBool(t, "podman", true, IsPodman(&types.SystemConfig{ContainerCommand: "/usr/bin/podman"}))
+	testutil.AssertEqualsBool(t, "podman api", false, IsPodman(&types.SystemConfig{ContainerCommand: "podman", ContainerRuntime: RUNTIME_API}))
+
+	// Options are translated for the api runtime
+	req, err := genCreateRequest(&types.AppEntry{Id: "app_prd_1"}, "img", 0, nil, nil, options)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "memory", 512<<20, int(req.HostConfig.MemorySwap))
+	testutil.AssertEqualsInt(t, "pids", 100, int(req.HostConfig.PidsLimit))
+	testutil.AssertEqualsBool(t, "read only", true, req.HostConfig.ReadonlyRoot)
+	testutil.AssertEqualsString(t, "security", "no-new-privileges", req.HostConfig.SecurityOpt[0])
+	testutil.AssertEqualsString(t, "user", "1000", req.User)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// MAX_PARTIAL_LINE is the max size of a line buffered by the PrefixWriter, longer lines are split
+const MAX_PARTIAL_LINE = 64 * 1024
+
+// PrefixWriter adds a prefix to each line written. Only complete lines are written to the underlying
+// writer, under the shared lock, so that the logs from multiple containers are not mixed within a line
+type PrefixWriter struct {
+	w      io.Writer
+	lock   *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+func NewPrefixWriter(w io.Writer, lock *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, lock: lock, prefix: []byte(prefix)}
+}
+
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	end := bytes.LastIndexByte(p.buf, '\n') + 1
+	if end == 0 {
+		if len(p.buf) < MAX_PARTIAL_LINE {
+			return len(data), nil
+		}
+		p.buf = append(p.buf, '\n')
+		end = len(p.buf)
+	}
+
+	var out bytes.Buffer
+	lines := p.buf[:end]
+	for len(lines) > 0 {
+		next := bytes.IndexByte(lines, '\n') + 1
+		out.Write(p.prefix)
+		out.Write(lines[:next])
+		lines = lines[next:]
+	}
+	p.buf = append(p.buf[:0], p.buf[end:]...)
+
+	if err := p.writeLocked(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush writes the partial line remaining in the buffer, if any
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(append(append([]byte{}, p.prefix...), p.buf...), '\n')
+	p.buf = p.buf[:0]
+	return p.writeLocked(line)
+}
+
+func (p *PrefixWriter) writeLocked(data []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, err := p.w.Write(data)
+	return err
+}
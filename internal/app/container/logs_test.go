@@ -0,0 +1,36 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var lock sync.Mutex
+	w1 := NewPrefixWriter(&out, &lock, "a | ")
+	w2 := NewPrefixWriter(&out, &lock, "b | ")
+
+	_, err := w1.Write([]byte("line1\nparti"))
+	testutil.AssertNoError(t, err)
+	_, err = w2.Write([]byte("other\n"))
+	testutil.AssertNoError(t, err)
+	_, err = w1.Write([]byte("al\nlast"))
+	testutil.AssertNoError(t, err)
+	testutil.AssertNoError(t, w1.Flush())
+	testutil.AssertNoError(t, w2.Flush())
+	testutil.AssertEqualsString(t, "output", "a | line1\nb | other\na | partial\na | last\n", out.String())
+
+	// Long lines without a newline are split
+	out.Reset()
+	_, err = w1.Write([]byte(strings.Repeat("x", MAX_PARTIAL_LINE)))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "split", MAX_PARTIAL_LINE+len("a | \n"), out.Len())
+}
@@ -0,0 +1,73 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+type NetworkName string
+
+// GenNetworkName returns the name of the private network for the app, used by the app container
+// to reach the service containers
+func GenNetworkName(appId types.AppId) NetworkName {
+	return NetworkName(fmt.Sprintf("cln-%s", appId))
+}
+
+func (c ContainerCommand) NetworkExists(config *types.SystemConfig, name NetworkName) bool {
+	c.Debug().Msgf("Checking network exists %s", name)
+	cmd := exec.Command(config.ContainerCommand, "network", "inspect", string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Debug().Msgf("network exists check failed %s %s %s", name, err, output)
+	}
+	return err == nil
+}
+
+func (c ContainerCommand) NetworkCreate(config *types.SystemConfig, name NetworkName) error {
+	c.Debug().Msgf("Creating network %s", name)
+	cmd := exec.Command(config.ContainerCommand, "network", "create", "--label", INSTANCE_LABEL+"="+InstanceId(), string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error creating network %s: %w %s", name, err, output)
+	}
+	return nil
+}
+
+// GetNetworks returns the networks created by this server instance with names matching the prefix
+func (c ContainerCommand) GetNetworks(config *types.SystemConfig, prefix string) ([]NetworkName, error) {
+	c.Debug().Msgf("Getting networks with prefix %s", prefix)
+	cmd := exec.Command(config.ContainerCommand, "network", "ls", "--format", "json", "--filter", "name="+prefix,
+		"--filter", "label="+INSTANCE_LABEL+"="+InstanceId())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error listing networks: %s : %s", output, err)
+	}
+
+	names, err := decodeNames(output)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding network output: %w", err)
+	}
+	ret := []NetworkName{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			ret = append(ret, NetworkName(name))
+		}
+	}
+	return ret, nil
+}
+
+func (c ContainerCommand) RemoveNetwork(config *types.SystemConfig, name NetworkName) error {
+	c.Debug().Msgf("Removing network %s", name)
+	cmd := exec.Command(config.ContainerCommand, "network", "rm", string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error removing network %s: %w %s", name, err, output)
+	}
+	return nil
+}
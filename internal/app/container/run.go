@@ -0,0 +1,79 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os/exec"
+	"slices"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// RunOptions are the options for running a command in a new container
+type RunOptions struct {
+	Image     ImageName
+	Name      ContainerName     // name for the container, the container is removed after the command exits if empty
+	Cmd       []string          // command to run, with the args
+	Env       map[string]string // env values for the command
+	MountArgs []string          // mount args, in the CLI format
+	Options   map[string]string // container options, in the CLI format
+	Stdout    io.Writer         // output of the command
+	Stderr    io.Writer         // error output of the command
+}
+
+// RunCommand runs the command in a new container and returns the exit code of the command. The command
+// is killed if the context is cancelled
+func (c ContainerCommand) RunCommand(ctx context.Context, config *types.SystemConfig, appEntry *types.AppEntry, opts RunOptions) (int, error) {
+	c.Debug().Msgf("Running command in container %s from image %s: %v", opts.Name, opts.Image, opts.Cmd)
+	args := []string{"run"}
+	if opts.Name != "" {
+		args = append(args, "--name", string(opts.Name))
+	} else {
+		args = append(args, "--rm")
+	}
+
+	labels := genLabels(appEntry)
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+
+	// Add env args
+	for k, v := range opts.Env {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// Add container related args
+	for k, v := range opts.Options {
+		if v == "" {
+			args = append(args, fmt.Sprintf("--%s", k))
+		} else {
+			args = append(args, fmt.Sprintf("--%s=%s", k, v))
+		}
+	}
+
+	if len(opts.MountArgs) > 0 {
+		args = append(args, opts.MountArgs...)
+	}
+
+	args = append(args, string(opts.Image))
+	args = append(args, opts.Cmd...)
+
+	cmd := exec.CommandContext(ctx, config.ContainerCommand, args...)
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error running command in container: %w", err)
+	}
+	return 0, nil
+}
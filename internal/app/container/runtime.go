@@ -0,0 +1,168 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	RUNTIME_CLI = "cli" // exec the docker/podman command
+	RUNTIME_API = "api" // Docker Engine API over the unix socket
+)
+
+// ContainerRuntime is the interface used by the container manager to build, run and inspect containers.
+// The CLI runtime execs the docker/podman command, the API runtime uses the Docker Engine API, which is
+// supported by Podman also. The fake runtime is an in-memory implementation used for testing
+type ContainerRuntime interface {
+	BuildImage(config *types.SystemConfig, name ImageName, sourceUrl, containerFile string,
+		containerArgs map[string]string, opts BuildOptions) error
+	RemoveImage(config *types.SystemConfig, name ImageName) error
+	GetImages(config *types.SystemConfig, name ImageName) ([]Image, error)
+	GetInstanceImages(config *types.SystemConfig, prefix string) ([]Image, error)
+	TagImage(config *types.SystemConfig, source, target ImageName) error
+	PushImage(config *types.SystemConfig, name ImageName) error
+	PullImage(config *types.SystemConfig, name ImageName) error
+
+	RunContainer(config *types.SystemConfig, appEntry *types.AppEntry, containerName ContainerName,
+		imageName ImageName, port int64, envMap map[string]string, mountArgs []string,
+		containerOptions map[string]string) error
+	StartContainer(config *types.SystemConfig, name ContainerName) error
+	StopContainer(config *types.SystemConfig, name ContainerName) error
+	RemoveContainer(config *types.SystemConfig, name ContainerName) error
+	GetContainers(config *types.SystemConfig, name ContainerName, getAll bool) ([]Container, error)
+	GetContainerLogs(config *types.SystemConfig, name ContainerName) (string, error)
+	StreamContainerLogs(ctx context.Context, config *types.SystemConfig, name ContainerName, opts LogOptions, w io.Writer) error
+	GetContainerStats(config *types.SystemConfig, names []ContainerName) ([]ContainerStats, error)
+	ExecContainer(ctx context.Context, config *types.SystemConfig, name ContainerName, opts ExecOptions) (int, error)
+	RunCommand(ctx context.Context, config *types.SystemConfig, appEntry *types.AppEntry, opts RunOptions) (int, error)
+
+	VolumeExists(config *types.SystemConfig, name VolumeName) bool
+	VolumeCreate(config *types.SystemConfig, name VolumeName) error
+	GetVolumes(config *types.SystemConfig, prefix string) ([]VolumeName, error)
+	RemoveVolume(config *types.SystemConfig, name VolumeName) error
+
+	NetworkExists(config *types.SystemConfig, name NetworkName) bool
+	NetworkCreate(config *types.SystemConfig, name NetworkName) error
+	GetNetworks(config *types.SystemConfig, prefix string) ([]NetworkName, error)
+	RemoveNetwork(config *types.SystemConfig, name NetworkName) error
+}
+
+var (
+	_ ContainerRuntime = ContainerCommand{}
+	_ ContainerRuntime = (*DockerAPI)(nil)
+	_ ContainerRuntime = (*FakeRuntime)(nil)
+)
+
+// LogOptions are the options for streaming the container logs
+type LogOptions struct {
+	Follow bool          // keep streaming new log lines until the context is cancelled
+	Since  time.Duration // only return logs newer than this duration, all logs if zero
+	Tail   int           // number of lines to return from the end of the logs, all lines if zero
+}
+
+// NewContainerRuntime returns the container runtime configured in the system config
+func NewContainerRuntime(logger *types.Logger, config *types.SystemConfig) (ContainerRuntime, error) {
+	switch config.ContainerRuntime {
+	case "", RUNTIME_CLI:
+		return ContainerCommand{Logger: logger}, nil
+	case RUNTIME_API:
+		if config.ContainerSocket == "" {
+			return nil, fmt.Errorf("container socket not found for api runtime, set container_socket in system config")
+		}
+		return NewDockerAPI(logger, config.ContainerSocket), nil
+	default:
+		return nil, fmt.Errorf("invalid container_runtime %s, expected %s or %s", config.ContainerRuntime, RUNTIME_CLI, RUNTIME_API)
+	}
+}
+
+// RuntimeEnabled returns true if container support is available for the configured runtime
+func RuntimeEnabled(config *types.SystemConfig) bool {
+	if config.ContainerRuntime == RUNTIME_API {
+		return config.ContainerSocket != ""
+	}
+	return config.ContainerCommand != ""
+}
+
+// LookupSocket returns the Docker API socket path. DOCKER_HOST is used if it points to a unix socket,
+// otherwise the default docker socket and the podman sockets are checked
+func LookupSocket() string {
+	if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok {
+		return host
+	}
+
+	candidates := []string{"/var/run/docker.sock"}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, path.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, "/run/podman/podman.sock")
+
+	for _, c := range candidates {
+		if fi, err := os.Stat(c); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return c
+		}
+	}
+	return ""
+}
+
+// RuntimeError is the error returned by the API and fake runtimes, with the HTTP status code
+// returned by the container engine
+type RuntimeError struct {
+	Op         string
+	StatusCode int
+	Message    string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("error %s: %s (status %d)", e.Op, e.Message, e.StatusCode)
+}
+
+// IsNotFound returns true if the error is a runtime error for a missing container, image or volume
+func IsNotFound(err error) bool {
+	var runtimeErr *RuntimeError
+	return errors.As(err, &runtimeErr) && runtimeErr.StatusCode == http.StatusNotFound
+}
+
+// InstanceId returns the id of the server instance, derived from the CL_HOME path. The id is added as the
+// instance label on the containers, images, volumes and networks created by the server, so that the gc does
+// not remove the objects created by other servers using the same container engine
+func InstanceId() string {
+	clHome, err := filepath.Abs(os.Getenv(types.CL_HOME))
+	if err != nil {
+		clHome = os.Getenv(types.CL_HOME)
+	}
+	sum := sha256.Sum256([]byte(clHome))
+	return hex.EncodeToString(sum[:8])
+}
+
+// genLabels returns the labels added to the app containers
+func genLabels(appEntry *types.AppEntry) map[string]string {
+	labels := map[string]string{
+		LABEL_PREFIX + "app.id": string(appEntry.Id),
+		INSTANCE_LABEL:          InstanceId(),
+	}
+	if appEntry.IsDev {
+		labels[LABEL_PREFIX+"dev"] = "true"
+	} else {
+		labels[LABEL_PREFIX+"dev"] = "false"
+		labels[LABEL_PREFIX+"app.version"] = strconv.Itoa(appEntry.Metadata.VersionMetadata.Version)
+		labels[LABEL_PREFIX+"git.sha"] = appEntry.Metadata.VersionMetadata.GitCommit
+		labels[LABEL_PREFIX+"git.message"] = appEntry.Metadata.VersionMetadata.GitMessage
+	}
+	return labels
+}
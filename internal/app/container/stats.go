@@ -0,0 +1,106 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"cmp"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// ContainerStats is the resource usage of a container
+type ContainerStats struct {
+	Name        string
+	CpuPercent  float64 // percent of one cpu, can be above 100 if multiple cpus are used
+	MemoryBytes int64
+}
+
+// GetContainerStats returns the current resource usage of the running containers
+func (c ContainerCommand) GetContainerStats(config *types.SystemConfig, names []ContainerName) ([]ContainerStats, error) {
+	c.Debug().Msgf("Getting container stats for %v", names)
+	if len(names) == 0 {
+		return []ContainerStats{}, nil
+	}
+	args := []string{"stats", "--no-stream", "--format", "json"}
+	for _, name := range names {
+		args = append(args, string(name))
+	}
+	cmd := exec.Command(config.ContainerCommand, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error getting container stats: %s : %s", output, err)
+	}
+	return parseStatsOutput(output)
+}
+
+// parseStatsOutput parses the stats command output. Docker uses CPUPerc and MemUsage, podman uses cpu_percent
+// and mem_usage. The memory usage is in the "used / limit" format
+func parseStatsOutput(output []byte) ([]ContainerStats, error) {
+	type statsEntry struct {
+		Name              string `json:"Name"`
+		CPUPerc           string `json:"CPUPerc"`
+		MemUsage          string `json:"MemUsage"`
+		PodmanCpuPercent  string `json:"cpu_percent"`
+		PodmanMemoryUsage string `json:"mem_usage"`
+	}
+	entries, err := decodeJSONList[statsEntry](output)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding stats output: %w", err)
+	}
+
+	ret := make([]ContainerStats, 0, len(entries))
+	for _, e := range entries {
+		cpu, err := parsePercent(cmp.Or(e.CPUPerc, e.PodmanCpuPercent))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu stats for container %s: %w", e.Name, err)
+		}
+		used, _, _ := strings.Cut(cmp.Or(e.MemUsage, e.PodmanMemoryUsage), "/")
+		memory, err := parseSize(used)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory stats for container %s: %w", e.Name, err)
+		}
+		ret = append(ret, ContainerStats{Name: e.Name, CpuPercent: cpu, MemoryBytes: memory})
+	}
+	return ret, nil
+}
+
+// parsePercent parses values like 12.5%, "--" is treated as zero
+func parsePercent(value string) (float64, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if value == "" || value == "--" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseSize parses the human readable sizes in the stats output, like 3.9MiB (docker) and 1.5MB (podman)
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "--" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"B", 1},
+	}
+	multiplier := 1.0
+	for _, u := range units {
+		if num, ok := strings.CutSuffix(value, u.suffix); ok {
+			value, multiplier = strings.TrimSpace(num), u.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n * multiplier), nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package container
+
+import (
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestParseStatsOutput(t *testing.T) {
+	docker := `{"BlockIO":"0B / 0B","CPUPerc":"12.50%","Container":"c1","MemUsage":"3.5MiB / 7.6GiB","Name":"clc-app1","PIDs":"2"}
+{"BlockIO":"0B / 0B","CPUPerc":"0.00%","Container":"c2","MemUsage":"1GiB / 7.6GiB","Name":"clc-app1-r1","PIDs":"2"}`
+	stats, err := parseStatsOutput([]byte(docker))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "count", 2, len(stats))
+	testutil.AssertEqualsString(t, "name", "clc-app1", stats[0].Name)
+	testutil.AssertEqualsInt(t, "cpu", 125, int(stats[0].CpuPercent*10))
+	testutil.AssertEqualsInt(t, "memory", 3.5*(1<<20), int(stats[0].MemoryBytes))
+	testutil.AssertEqualsInt(t, "memory", 1<<30, int(stats[1].MemoryBytes))
+
+	podman := `[{"id":"abc","name":"clc-app2","cpu_percent":"150.25%","mem_usage":"1.5MB / 16.6GB","pids":"1"}]`
+	stats, err = parseStatsOutput([]byte(podman))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "name", "clc-app2", stats[0].Name)
+	testutil.AssertEqualsInt(t, "cpu", 150, int(stats[0].CpuPercent))
+	testutil.AssertEqualsInt(t, "memory", 1500000, int(stats[0].MemoryBytes))
+
+	_, err = parseStatsOutput([]byte(`{"Name":"c1","CPUPerc":"abc%","MemUsage":"1MiB / 1GiB"}`))
+	testutil.AssertErrorContains(t, err, "invalid cpu stats for container c1")
+}
+
+func TestParseSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"0B": 0, "512B": 512, "2KiB": 2048, "1.5kB": 1500, "10MiB": 10 << 20, "2GB": 2e9, "--": 0, " 4MiB ": 4 << 20,
+	} {
+		size, err := parseSize(value)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsInt(t, value, int(expected), int(size))
+	}
+	_, err := parseSize("abc")
+	if err == nil {
+		t.Fatalf("expected error for invalid size")
+	}
+}
@@ -4,8 +4,10 @@
 package container
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -32,10 +34,84 @@ func (c ContainerCommand) VolumeExists(config *types.SystemConfig, name VolumeNa
 
 func (c ContainerCommand) VolumeCreate(config *types.SystemConfig, name VolumeName) error {
 	c.Debug().Msgf("Creating volume %s", name)
-	cmd := exec.Command(config.ContainerCommand, "volume", "create", string(name))
+	cmd := exec.Command(config.ContainerCommand, "volume", "create", "--label", INSTANCE_LABEL+"="+InstanceId(), string(name))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("error creating volume %s: %w %s", name, err, output)
 	}
 	return nil
 }
+
+// GetVolumes returns the volumes created by this server instance with names matching the prefix
+func (c ContainerCommand) GetVolumes(config *types.SystemConfig, prefix string) ([]VolumeName, error) {
+	c.Debug().Msgf("Getting volumes with prefix %s", prefix)
+	cmd := exec.Command(config.ContainerCommand, "volume", "ls", "--format", "json", "--filter", "name="+prefix,
+		"--filter", "label="+INSTANCE_LABEL+"="+InstanceId())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error listing volumes: %s : %s", output, err)
+	}
+
+	names, err := decodeNames(output)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding volume output: %w", err)
+	}
+
+	ret := []VolumeName{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			ret = append(ret, VolumeName(name))
+		}
+	}
+	return ret, nil
+}
+
+// decodeNames returns the names from the JSON list output of the volume and network ls commands
+func decodeNames(output []byte) ([]string, error) {
+	type entry struct {
+		Name string `json:"Name"` // podman uses lower case name for networks, matched case insensitively
+	}
+	entries, err := decodeJSONList[entry](output)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ret = append(ret, e.Name)
+	}
+	return ret, nil
+}
+
+// decodeJSONList decodes the JSON list output of the container commands. Podman returns a JSON array,
+// Docker returns newline separated JSON objects
+func decodeJSONList[T any](output []byte) ([]T, error) {
+	ret := []T{}
+	output = bytes.TrimSpace(output)
+	if len(output) > 0 && output[0] == '[' {
+		if err := json.Unmarshal(output, &ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for decoder.More() {
+		var e T
+		if err := decoder.Decode(&e); err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+func (c ContainerCommand) RemoveVolume(config *types.SystemConfig, name VolumeName) error {
+	c.Debug().Msgf("Removing volume %s", name)
+	cmd := exec.Command(config.ContainerCommand, "volume", "rm", string(name))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error removing volume %s: %w %s", name, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+)
+
+const BUILD_LOGS_DIR = "build_logs"
+
+// BuildLogFile returns the file in the app run directory which has the image build output for the
+// app version. Dev apps use version zero, the output for the latest build is retained
+func BuildLogFile(appRunPath string, version int) string {
+	return path.Join(appRunPath, BUILD_LOGS_DIR, fmt.Sprintf("v%d.log", version))
+}
+
+// buildImage builds the app image using the container file in buildDir. The build output is saved in
+// the build log file for the app version. For prod apps, the earlier images for the app are used as
+// the build cache source if enabled
+func (m *ContainerManager) buildImage(buildDir string) error {
+	opts := container.BuildOptions{BuildKit: m.containerConfig.BuildKit}
+	if m.containerConfig.BuildCacheFrom && !m.app.IsDev {
+		// The cache metadata is added even if there are no earlier images, so that this image can be the
+		// cache source for the next build
+		opts.InlineCache = true
+		images, err := m.command.GetImages(m.systemConfig, container.GenImageName(m.app.Id, "")+"-*")
+		if err != nil {
+			return fmt.Errorf("error getting images: %w", err)
+		}
+		for _, image := range images {
+			if image.Repository != string(m.GenImageName) {
+				opts.CacheFrom = append(opts.CacheFrom, container.ImageName(image.Repository))
+			}
+		}
+	}
+
+	logFile := BuildLogFile(m.app.AppRunPath, m.app.Metadata.VersionMetadata.Version)
+	if err := os.MkdirAll(path.Dir(logFile), 0700); err != nil {
+		return fmt.Errorf("error creating build logs dir: %w", err)
+	}
+	f, err := os.Create(logFile)
+	if err != nil {
+		return fmt.Errorf("error creating build log file: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "Building image %s at %s, cache from %v\n", m.GenImageName, time.Now().Format(time.RFC3339), opts.CacheFrom)
+	opts.Output = f
+	if err := m.command.BuildImage(m.systemConfig, m.GenImageName, buildDir, m.containerFile, m.cargs, opts); err != nil {
+		fmt.Fprintln(f, "Build failed")
+		return err
+	}
+	fmt.Fprintf(f, "Build completed at %s\n", time.Now().Format(time.RFC3339))
+	return nil
+}
+
+// pushImage pushes the built image to the registry, if a registry is configured. The image is tagged with
+// the registry name for the push, the tag is removed after the push
+func (m *ContainerManager) pushImage() error {
+	if m.systemConfig.ContainerRegistry == "" || m.app.IsDev {
+		return nil
+	}
+	registryImage := container.RegistryImageName(m.systemConfig.ContainerRegistry, m.GenImageName)
+	if err := m.command.TagImage(m.systemConfig, m.GenImageName, registryImage); err != nil {
+		return err
+	}
+	err := m.command.PushImage(m.systemConfig, registryImage)
+	_ = m.command.RemoveImage(m.systemConfig, registryImage)
+	if err != nil {
+		return fmt.Errorf("error pushing image: %w", err)
+	}
+	m.Info().Msgf("Pushed image %s for app %s", registryImage, m.app.Id)
+	return nil
+}
+
+// pullImage pulls the app image from the registry, if a registry is configured. The image is tagged with
+// the app image name. Returns false if the image could not be pulled, the image has to be built then
+func (m *ContainerManager) pullImage() bool {
+	if m.systemConfig.ContainerRegistry == "" || m.app.IsDev {
+		return false
+	}
+	registryImage := container.RegistryImageName(m.systemConfig.ContainerRegistry, m.GenImageName)
+	if err := m.command.PullImage(m.systemConfig, registryImage); err != nil {
+		m.Debug().Msgf("image %s not pulled from registry, building: %s", registryImage, err)
+		return false
+	}
+	err := m.command.TagImage(m.systemConfig, registryImage, m.GenImageName)
+	_ = m.command.RemoveImage(m.systemConfig, registryImage)
+	if err != nil {
+		m.Warn().Msgf("error tagging pulled image %s, building: %s", registryImage, err)
+		return false
+	}
+	m.Info().Msgf("Pulled image %s for app %s", registryImage, m.app.Id)
+	return true
+}
@@ -0,0 +1,49 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// execContainer returns the name of the replica container to run the exec command in. The replica
+// has to be running, the container names are based on the current version of the app
+func (m *ContainerManager) execContainer(index int) (container.ContainerName, error) {
+	if m.lifetime == types.CONTAINER_LIFETIME_COMMAND {
+		return "", fmt.Errorf("exec is not supported for apps with command lifetime containers")
+	}
+
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	if index < 0 || index >= len(m.replicas) {
+		return "", fmt.Errorf("invalid replica %d, app %s has %d replicas", index, m.app.Path, len(m.replicas))
+	}
+	r := m.replicas[index]
+	if r.state != ContainerStateRunning {
+		return "", fmt.Errorf("container %s is not running, state %s", r.name, r.state)
+	}
+	return r.name, nil
+}
+
+// ExecContainerName returns the name of the container to run the exec command in, for the app replica
+// at the index. An error is returned if the app does not use containers or the replica is not running
+func (a *App) ExecContainerName(replicaIndex int) (container.ContainerName, error) {
+	if a.containerManager == nil {
+		return "", fmt.Errorf("app %s does not use containers", a.Path)
+	}
+	return a.containerManager.execContainer(replicaIndex)
+}
+
+// ExecContainer runs the command in the app container and returns the exit code of the command
+func (a *App) ExecContainer(ctx context.Context, name container.ContainerName, opts container.ExecOptions) (int, error) {
+	if a.containerManager == nil {
+		return -1, fmt.Errorf("app %s does not use containers", a.Path)
+	}
+	m := a.containerManager
+	return m.command.ExecContainer(ctx, m.systemConfig, name, opts)
+}
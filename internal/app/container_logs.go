@@ -0,0 +1,100 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// runContainerName returns the name for a command lifetime container. The start time is used as the
+// suffix, so that the names sort in the order of the runs
+func runContainerName(baseName container.ContainerName, start time.Time) container.ContainerName {
+	return container.ContainerName(fmt.Sprintf("%s-run-%d", baseName, start.UnixNano()))
+}
+
+// isRunOf checks whether the container is a command run container for the base name
+func isRunOf(name string, baseName container.ContainerName) bool {
+	suffix, ok := strings.CutPrefix(name, string(baseName)+"-run-")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseInt(suffix, 10, 64)
+	return err == nil
+}
+
+// getRunContainers returns the command run containers for the base name, most recent run first
+func (m *ContainerManager) getRunContainers(baseName container.ContainerName) ([]container.Container, error) {
+	containers, err := m.command.GetContainers(m.systemConfig, baseName+"-run-", true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting run containers: %w", err)
+	}
+	containers = slices.DeleteFunc(containers, func(c container.Container) bool { return !isRunOf(c.Names, baseName) })
+	slices.SortFunc(containers, func(a, b container.Container) int { return strings.Compare(b.Names, a.Names) })
+	return containers, nil
+}
+
+// pruneRunContainers removes the exited command run containers, except the most recent ones as per the
+// run logs retention config. Running containers are not touched
+func (m *ContainerManager) pruneRunContainers(baseName container.ContainerName) {
+	containers, err := m.getRunContainers(baseName)
+	if err != nil {
+		m.Warn().Err(err).Msgf("Error pruning run containers for app %s", m.app.Id)
+		return
+	}
+
+	exited := 0
+	for _, c := range containers {
+		if c.State == "running" {
+			continue
+		}
+		exited++
+		if exited <= m.containerConfig.RunLogsRetain {
+			continue
+		}
+		if err := m.command.RemoveContainer(m.systemConfig, container.ContainerName(c.Names)); err != nil {
+			m.Warn().Err(err).Msgf("Error removing run container %s", c.Names)
+		}
+	}
+}
+
+// isRunContainer checks whether the container is a command run container, for any base name
+func isRunContainer(name string) bool {
+	i := strings.LastIndex(name, "-run-")
+	return i > 0 && isRunOf(name, container.ContainerName(name[:i]))
+}
+
+// LogContainers returns the containers whose logs are available for the app: the running replicas and the
+// retained command run containers, oldest run first. The containers are looked up using the container runtime,
+// the app does not have to be initialized. The service containers are not included
+func LogContainers(runtime container.ContainerRuntime, config *types.SystemConfig, appId types.AppId) ([]container.ContainerName, error) {
+	// The name filter is a prefix match, all the containers for the app have the app id in the name
+	containers, err := runtime.GetContainers(config, container.GenContainerName(appId, ""), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting containers: %w", err)
+	}
+
+	replicas := []container.ContainerName{}
+	runs := []container.ContainerName{}
+	servicePrefix := string(container.GenContainerName(appId, "")) + "-svc-"
+	for _, c := range containers {
+		if c.Labels[container.LABEL_PREFIX+"app.id"] != string(appId) || strings.HasPrefix(c.Names, servicePrefix) {
+			continue
+		}
+		if isRunContainer(c.Names) {
+			runs = append(runs, container.ContainerName(c.Names))
+		} else if c.State == "running" {
+			replicas = append(replicas, container.ContainerName(c.Names))
+		}
+	}
+	slices.Sort(replicas)
+	slices.Sort(runs)
+	return append(replicas, runs...), nil
+}
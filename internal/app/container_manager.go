@@ -10,16 +10,17 @@ import (
 	"encoding/hex"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/claceio/clace/internal/app/appfs"
@@ -36,18 +37,18 @@ const (
 	ContainerStateRunning       ContainerState = "running"
 	ContainerStateIdleShutdown  ContainerState = "idle_shutdown"
 	ContainerStateHealthFailure ContainerState = "health_failure"
+	ContainerStateRetired       ContainerState = "retired" // replaced by a newer app version
 )
 
 type ContainerManager struct {
 	*types.Logger
-	command         container.ContainerCommand
+	command         container.ContainerRuntime
 	app             *App
 	systemConfig    *types.SystemConfig
 	containerFile   string
 	image           string              // image name as specified
 	GenImageName    container.ImageName // generated image name
 	port            int64               // Port number within the container
-	hostPort        int                 // Port number on the host
 	lifetime        string
 	scheme          string
 	health          string
@@ -63,6 +64,23 @@ type ContainerManager struct {
 	stateLock          sync.RWMutex
 	currentState       ContainerState
 
+	// Replica related fields, state of the replicas is guarded by stateLock
+	replicaCount int
+	replicas     []*replica
+	nextReplica  atomic.Uint64 // round robin counter
+
+	// Resource limits, applied to the container options
+	limits container.ResourceLimits
+
+	// Base container name for the current app version, the command lifetime containers are named using this
+	baseName container.ContainerName
+
+	// Service containers, running on the app network along with the app containers
+	services []serviceConfig
+
+	// Ticker for the container stats sampling
+	statsTicker *time.Ticker
+
 	// Health check related fields
 	healthCheckTicker *time.Ticker
 	stripAppPath      bool
@@ -73,7 +91,7 @@ type ContainerManager struct {
 func NewContainerManager(logger *types.Logger, app *App, containerFile string,
 	systemConfig *types.SystemConfig, configPort int64, lifetime, scheme, health, buildDir string, sourceFS appfs.ReadableFS,
 	paramMap map[string]string, containerConfig types.Container, stripAppPath bool,
-	containerVolumes []string, secretsAllowed [][]string, cargs map[string]any) (*ContainerManager, error) {
+	containerVolumes []string, secretsAllowed [][]string, cargs map[string]any, servicesConfig map[string]any) (*ContainerManager, error) {
 
 	image := ""
 	volumes := []string{}
@@ -152,6 +170,54 @@ func NewContainerManager(logger *types.Logger, app *App, containerFile string,
 		cargs_map[k] = val
 	}
 
+	services, err := parseServices(servicesConfig)
+	if err != nil {
+		return nil, err
+	}
+	serviceLimits, err := container.ParseResourceLimits(types.Container{}, nil, systemConfig)
+	if err != nil {
+		return nil, err
+	}
+	for i := range services {
+		services[i].limits = serviceLimits
+		// Evaluate secrets in the service env
+		for k, v := range services[i].env {
+			val, err := app.secretEvalFunc(secretsAllowed, app.AppConfig.Security.DefaultSecretsProvider, v)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating secret for service %s env %s: %w", services[i].name, k, err)
+			}
+			services[i].env[k] = val
+		}
+		if err := services[i].setHash(); err != nil {
+			return nil, err
+		}
+	}
+	if len(services) > 0 {
+		if _, ok := app.Metadata.ContainerOptions["network"]; ok {
+			return nil, fmt.Errorf("network container option cannot be used with services, the app network is used")
+		}
+	}
+
+	command, err := container.NewContainerRuntime(logger, systemConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaCount, err := getReplicaCount(app.Metadata.ContainerOptions)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := container.ParseResourceLimits(containerConfig, app.Metadata.ContainerOptions, systemConfig)
+	if err != nil {
+		return nil, err
+	}
+	switch containerConfig.LoadBalance {
+	case "", types.CONTAINER_LB_ROUND_ROBIN, types.CONTAINER_LB_LEAST_CONN:
+	default:
+		return nil, fmt.Errorf("invalid container.load_balance %s, expected %s or %s", containerConfig.LoadBalance,
+			types.CONTAINER_LB_ROUND_ROBIN, types.CONTAINER_LB_LEAST_CONN)
+	}
+
 	m := &ContainerManager{
 		Logger:          logger,
 		app:             app,
@@ -163,7 +229,7 @@ func NewContainerManager(logger *types.Logger, app *App, containerFile string,
 		scheme:          scheme,
 		buildDir:        buildDir,
 		sourceFS:        sourceFS,
-		command:         container.ContainerCommand{Logger: logger},
+		command:         command,
 		paramMap:        paramMap,
 		volumes:         volumes,
 		containerConfig: containerConfig,
@@ -171,6 +237,9 @@ func NewContainerManager(logger *types.Logger, app *App, containerFile string,
 		currentState:    ContainerStateUnknown,
 		stripAppPath:    stripAppPath,
 		cargs:           cargs_map,
+		replicaCount:    replicaCount,
+		limits:          limits,
+		services:        services,
 	}
 
 	if containerConfig.IdleShutdownSecs > 0 && (!app.IsDev || containerConfig.IdleShutdownDevApps) {
@@ -185,6 +254,11 @@ func NewContainerManager(logger *types.Logger, app *App, containerFile string,
 		m.healthCheckTicker = time.NewTicker(time.Duration(containerConfig.StatusCheckIntervalSecs) * time.Second)
 		go m.healthChecker()
 	}
+	if containerConfig.StatsIntervalSecs > 0 && m.lifetime != types.CONTAINER_LIFETIME_COMMAND {
+		// Start the stats sampling goroutine
+		m.statsTicker = time.NewTicker(time.Duration(containerConfig.StatsIntervalSecs) * time.Second)
+		go m.statsSampler()
+	}
 
 	excludeGlob := []string{}
 	templateFiles, err := fs.Glob(sourceFS, "*.go.html")
@@ -231,70 +305,97 @@ func dedupVolumes(volumes []string) []string {
 	return ret
 }
 
+// idleAppShutdown stops the app containers after the app has not received any requests for the idle
+// shutdown interval. When the app is active, replicas which are not receiving requests are stopped, at least
+// one replica is kept running
 func (m *ContainerManager) idleAppShutdown() {
+	idleLimit := int64(m.containerConfig.IdleShutdownSecs)
 	for range m.idleShutdownTicker.C {
-		idleTimeSecs := time.Now().Unix() - m.app.lastRequestTime.Load()
-		if m.currentState != ContainerStateRunning || idleTimeSecs < int64(m.containerConfig.IdleShutdownSecs) {
-			// Not idle
+		now := time.Now().Unix()
+		idleTimeSecs := now - m.app.lastRequestTime.Load()
+		if m.currentState != ContainerStateRunning {
+			continue
+		}
+
+		if idleTimeSecs < idleLimit {
+			// Not idle, check for idle replicas
 			m.Trace().Msgf("App %s not idle, last request %d seconds ago", m.app.Id, idleTimeSecs)
+			m.stopIdleReplicas(now, idleLimit)
 			continue
 		}
 
 		m.Debug().Msgf("Shutting down idle app %s after %d seconds", m.app.Id, idleTimeSecs)
+		m.stopAllReplicas(ContainerStateIdleShutdown)
+		break
+	}
 
-		fullHash, err := m.getAppHash()
-		if err != nil {
-			m.Error().Err(err).Msgf("Error getting app hash for %s", m.app.Id)
-			break
-		}
+	m.Debug().Msgf("Idle checker stopped for app %s", m.app.Id)
+}
 
-		if m.app.notifyClose != nil {
-			// Notify the server to close the app so that it gets reinitialized on next API call
-			m.app.notifyClose <- m.app.AppPathDomain()
+func (m *ContainerManager) stopIdleReplicas(now, idleLimit int64) {
+	running := m.runningReplicas()
+	if len(running) <= 1 {
+		return
+	}
+	for _, r := range running[1:] {
+		if now-r.lastRequest.Load() < idleLimit || r.restarting.Load() || r.activeConns.Load() > 0 {
+			continue
 		}
 
+		m.Debug().Msgf("Stopping idle replica %s for app %s", r.name, m.app.Id)
 		m.stateLock.Lock()
-		m.currentState = ContainerStateIdleShutdown
-
-		err = m.command.StopContainer(m.systemConfig, container.GenContainerName(m.app.Id, fullHash))
-		if err != nil {
-			m.Error().Err(err).Msgf("Error stopping idle app %s", m.app.Id)
-		}
+		r.state = ContainerStateIdleShutdown
 		m.stateLock.Unlock()
-		break
+		if err := m.command.StopContainer(m.systemConfig, r.name); err != nil {
+			m.Error().Err(err).Msgf("Error stopping idle replica %s", r.name)
+		}
 	}
-
-	m.Debug().Msgf("Idle checker stopped for app %s", m.app.Id)
 }
 
+// healthChecker checks the health of each replica. A replica failing the health check is taken out of the
+// load balancer rotation and restarted. If all the replicas are failing, the app containers are stopped
 func (m *ContainerManager) healthChecker() {
 	for range m.healthCheckTicker.C {
-		err := m.WaitForHealth(m.containerConfig.StatusHealthAttempts)
-		if err == nil {
-			continue
-		}
-		m.Info().Msgf("Health check failed for app %s: %s", m.app.Id, err)
+		m.stateLock.RLock()
+		replicas := slices.Clone(m.replicas)
+		state := m.currentState
+		m.stateLock.RUnlock()
+		if state == ContainerStateRunning {
+			m.checkServices()
+		}
+
+		failed := 0
+		for _, r := range replicas {
+			m.stateLock.RLock()
+			state, hostPort := r.state, r.hostPort
+			m.stateLock.RUnlock()
+			if state == ContainerStateHealthFailure {
+				failed++
+				go m.restartReplica(r) // retry the restart, no-op if a restart is in progress
+				continue
+			} else if state != ContainerStateRunning || r.restarting.Load() {
+				continue
+			}
 
-		fullHash, err := m.getAppHash()
-		if err != nil {
-			m.Error().Err(err).Msgf("Error getting app hash for %s", m.app.Id)
-			break
-		}
+			err := m.waitForReplicaHealth(hostPort, m.containerConfig.StatusHealthAttempts)
+			if err == nil {
+				continue
+			}
+			m.Info().Msgf("Health check failed for app %s replica %s: %s", m.app.Id, r.name, err)
+			failed++
 
-		if m.app.notifyClose != nil {
-			// Notify the server to close the app so that it gets reinitialized on next API call
-			m.app.notifyClose <- m.app.AppPathDomain()
+			m.stateLock.Lock()
+			r.state = ContainerStateHealthFailure
+			m.stateLock.Unlock()
+			if len(replicas) > 1 {
+				go m.restartReplica(r)
+			}
 		}
 
-		m.stateLock.Lock()
-		m.currentState = ContainerStateHealthFailure
-
-		err = m.command.StopContainer(m.systemConfig, container.GenContainerName(m.app.Id, fullHash))
-		if err != nil {
-			m.Error().Err(err).Msgf("Error stopping app %s after health failure", m.app.Id)
+		if failed == len(replicas) {
+			m.stopAllReplicas(ContainerStateHealthFailure)
+			break
 		}
-		m.stateLock.Unlock()
-		break
 	}
 
 	m.Debug().Msgf("Health checker stopped for app %s", m.app.Id)
@@ -309,8 +410,10 @@ func extractVolumes(node *parser.Node) []string {
 	return ret
 }
 
+// GetProxyUrl returns the url for the container. If there are multiple replicas, the replica is selected
+// based on the load balancing config
 func (m *ContainerManager) GetProxyUrl() string {
-	return fmt.Sprintf("%s://127.0.0.1:%d", m.scheme, m.hostPort)
+	return m.replicaUrl(m.selectReplica())
 }
 
 func (m *ContainerManager) GetHealthUrl(appHealthUrl string) string {
@@ -570,10 +673,11 @@ func (m *ContainerManager) DevReload(dryRun bool) error {
 		m.GenImageName = container.GenImageName(m.app.Id, "")
 	}
 	containerName := container.GenContainerName(m.app.Id, "")
+	m.baseName = containerName
 
-	containers, err := m.command.GetContainers(m.systemConfig, containerName, false)
+	containers, err := m.getReplicaContainers(containerName, true)
 	if err != nil {
-		return fmt.Errorf("error getting running containers: %w", err)
+		return err
 	}
 
 	if dryRun {
@@ -583,11 +687,9 @@ func (m *ContainerManager) DevReload(dryRun bool) error {
 		return nil
 	}
 
-	if len(containers) != 0 {
-		err := m.command.StopContainer(m.systemConfig, containerName)
-		if err != nil {
-			return fmt.Errorf("error stopping container: %w", err)
-		}
+	// Remove the existing containers, including replicas from an earlier replica count
+	if err := m.removeReplicas(containers); err != nil {
+		return err
 	}
 
 	if m.image == "" {
@@ -599,7 +701,7 @@ func (m *ContainerManager) DevReload(dryRun bool) error {
 			return err
 		}
 		buildDir := path.Join(m.app.SourceUrl, m.buildDir)
-		err = m.command.BuildImage(m.systemConfig, m.GenImageName, buildDir, m.containerFile, m.cargs)
+		err = m.buildImage(buildDir)
 		if err != nil {
 			return err
 		}
@@ -607,13 +709,15 @@ func (m *ContainerManager) DevReload(dryRun bool) error {
 		// Makes the app independent of changes in the spec files
 	}
 
-	_ = m.command.RemoveContainer(m.systemConfig, containerName)
-
 	if err = m.createVolumes(); err != nil {
 		// Create named volumes for the container
 		return err
 	}
 
+	if err = m.startServices(); err != nil {
+		return err
+	}
+
 	m.stateLock.Lock()
 	defer m.stateLock.Unlock()
 
@@ -626,43 +730,30 @@ func (m *ContainerManager) DevReload(dryRun bool) error {
 		// Command lifetime, service is not started, commands will be run with the image
 		return nil
 	}
-	envMap, _ := m.GetEnvMap()
-	err = m.command.RunContainer(m.systemConfig, m.app.AppEntry, containerName,
-		m.GenImageName, m.port, envMap, m.mountArgs, m.app.Metadata.ContainerOptions)
-	if err != nil {
-		return fmt.Errorf("error running container: %w", err)
-	}
-
-	containers, err = m.command.GetContainers(m.systemConfig, containerName, false)
-	if err != nil {
-		return fmt.Errorf("error getting running containers: %w", err)
-	}
-	if len(containers) == 0 {
-		logs, _ := m.command.GetContainerLogs(m.systemConfig, containerName)
-		return fmt.Errorf("container %s not running. Logs\n %s", containerName, logs)
-	}
-	m.currentState = ContainerStateRunning
-	m.hostPort = containers[0].Port
+	return m.runReplicas(containerName)
+}
 
-	if m.health != "" {
-		err = m.WaitForHealth(m.containerConfig.HealthAttemptsAfterStartup)
-		if err != nil {
-			logs, _ := m.command.GetContainerLogs(m.systemConfig, containerName)
-			return fmt.Errorf("error waiting for health: %w. Logs\n %s", err, logs)
+// WaitForHealth checks the health of all the running replicas
+func (m *ContainerManager) WaitForHealth(attempts int) error {
+	for _, r := range m.runningReplicas() {
+		m.stateLock.RLock()
+		hostPort := r.hostPort
+		m.stateLock.RUnlock()
+		if err := m.waitForReplicaHealth(hostPort, attempts); err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
 
-func (m *ContainerManager) WaitForHealth(attempts int) error {
+func (m *ContainerManager) waitForReplicaHealth(hostPort int, attempts int) error {
 	client := &http.Client{
 		Timeout: time.Duration(m.containerConfig.HealthTimeoutSecs) * time.Second,
 	}
 
 	var err error
 	var resp *http.Response
-	proxyUrl, err := url.Parse(m.GetProxyUrl())
+	proxyUrl, err := url.Parse(fmt.Sprintf("%s://127.0.0.1:%d", m.scheme, hostPort))
 	if err != nil {
 		return err
 	}
@@ -721,6 +812,14 @@ func (m *ContainerManager) getAppHash() (string, error) {
 		return "", fmt.Errorf("error getting cvol hash: %w", err)
 	}
 	fullHashVal := fmt.Sprintf("%s-%s-%s-%s-%s", sourceHash, envHash, coptHash, cargHash, cvolHash)
+	if m.limits != (container.ResourceLimits{}) {
+		// Limits are added only if set, so that the hash is unchanged for apps without limits
+		fullHashVal += fmt.Sprintf("-%+v", m.limits)
+	}
+	if len(m.services) > 0 {
+		// The app container is recreated if the services change, since the service env could be used by the app
+		fullHashVal += "-" + m.servicesHash()
+	}
 	sha := sha256.New()
 	if _, err := sha.Write([]byte(fullHashVal)); err != nil {
 		return "", err
@@ -743,11 +842,12 @@ func (m *ContainerManager) ProdReload(dryRun bool) error {
 	}
 
 	containerName := container.GenContainerName(m.app.Id, fullHash)
+	m.baseName = containerName
 
 	if m.lifetime != types.CONTAINER_LIFETIME_COMMAND {
-		containers, err := m.command.GetContainers(m.systemConfig, containerName, true)
+		containers, err := m.getReplicaContainers(containerName, true)
 		if err != nil {
-			return fmt.Errorf("error getting running containers: %w", err)
+			return err
 		}
 
 		if dryRun {
@@ -757,40 +857,19 @@ func (m *ContainerManager) ProdReload(dryRun bool) error {
 			return nil
 		}
 
-		if len(containers) != 0 {
-			m.stateLock.Lock()
-			defer m.stateLock.Unlock()
-
-			if containers[0].State != "running" {
-				// This does not handle the case where volume list has changed
-				m.Debug().Msgf("container state %s, starting", containers[0].State)
-				err = m.command.StartContainer(m.systemConfig, containerName)
-				if err != nil {
-					return fmt.Errorf("error starting container: %w", err)
-				}
+		if err := m.startServices(); err != nil {
+			return err
+		}
 
-				// Fetch port number after starting the container
-				containers, err = m.command.GetContainers(m.systemConfig, containerName, true)
-				if err != nil {
-					return fmt.Errorf("error getting running containers: %w", err)
-				}
-				m.hostPort = containers[0].Port
+		if len(containers) == m.replicaCount {
+			return m.startExistingReplicas(containerName, containers)
+		}
 
-				if m.health != "" {
-					err = m.WaitForHealth(m.containerConfig.HealthAttemptsAfterStartup)
-					if err != nil {
-						return fmt.Errorf("error waiting for health: %w", err)
-					}
-				}
-			} else {
-				// TODO handle case where image name is specified and param values change, need to restart container in that case
-				m.hostPort = containers[0].Port
-				m.Debug().Msg("container already running")
+		if len(containers) != 0 {
+			// Partial replica set, from an earlier failed start. Recreate the replicas
+			if err := m.removeReplicas(containers); err != nil {
+				return err
 			}
-
-			m.currentState = ContainerStateRunning
-			m.Debug().Msgf("updating port to %d", m.hostPort)
-			return nil
 		}
 	}
 
@@ -802,17 +881,22 @@ func (m *ContainerManager) ProdReload(dryRun bool) error {
 			return fmt.Errorf("error getting images: %w", err)
 		}
 
-		if len(images) == 0 {
+		if len(images) == 0 && !m.pullImage() {
+			// Image not available locally or in the registry, build it
 			sourceDir, err = m.sourceFS.CreateTempSourceDir()
 			if err != nil {
 				return fmt.Errorf("error creating temp source dir: %w", err)
 			}
 			buildDir := path.Join(sourceDir, m.buildDir)
-			buildErr := m.command.BuildImage(m.systemConfig, m.GenImageName, buildDir, m.containerFile, m.cargs)
+			buildErr := m.buildImage(buildDir)
 
 			if buildErr != nil {
 				return fmt.Errorf("error building image: %w", buildErr)
 			}
+			if err = m.pushImage(); err != nil {
+				// The image is available locally, the app can run. Other nodes will build the image
+				m.Warn().Err(err).Msgf("Error pushing image for app %s", m.app.Id)
+			}
 		}
 	}
 
@@ -837,34 +921,51 @@ func (m *ContainerManager) ProdReload(dryRun bool) error {
 	}
 
 	if m.lifetime == types.CONTAINER_LIFETIME_COMMAND {
-		// Command lifetime, service is not started, commands will be run with the image
-		return nil
+		// Command lifetime, service is not started, commands will be run with the image. The
+		// service containers are started, for use by the commands
+		return m.startServices()
 	}
-	envMap, _ := m.GetEnvMap()
+	return m.runReplicas(containerName)
+}
 
-	err = m.command.RunContainer(m.systemConfig, m.app.AppEntry, containerName,
-		m.GenImageName, m.port, envMap, m.mountArgs, m.app.Metadata.ContainerOptions)
-	if err != nil {
-		return fmt.Errorf("error starting container: %w", err)
-	}
+// startExistingReplicas uses the replica containers which are already present, the stopped
+// containers are started
+func (m *ContainerManager) startExistingReplicas(baseName container.ContainerName, containers map[container.ContainerName]container.Container) error {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
 
-	containers, err := m.command.GetContainers(m.systemConfig, containerName, false)
-	if err != nil {
-		return fmt.Errorf("error getting running containers: %w", err)
-	}
-	if len(containers) == 0 {
-		return fmt.Errorf("container not running") // todo add logs
-	}
-	m.currentState = ContainerStateRunning
-	m.hostPort = containers[0].Port
+	replicas := make([]*replica, 0, m.replicaCount)
+	started := []*replica{}
+	for i := range m.replicaCount {
+		name := replicaName(baseName, i)
+		if containers[name].State != "running" {
+			// This does not handle the case where volume list has changed
+			m.Debug().Msgf("container %s state %s, starting", name, containers[name].State)
+			if err := m.command.StartContainer(m.systemConfig, name); err != nil {
+				return fmt.Errorf("error starting container: %w", err)
+			}
+		}
 
-	if m.health != "" {
-		err = m.WaitForHealth(m.containerConfig.HealthAttemptsAfterStartup)
+		// Fetch port number after starting the container
+		r, err := m.getRunningReplica(i, name)
 		if err != nil {
-			return fmt.Errorf("error waiting for health: %w", err)
+			return err
+		}
+		if containers[name].State != "running" {
+			started = append(started, r)
 		}
+		replicas = append(replicas, r)
 	}
 
+	// TODO handle case where image name is specified and param values change, need to restart container in that case
+	m.replicas = replicas
+	m.currentState = ContainerStateRunning
+	for _, r := range started {
+		if err := m.waitForStartup(r); err != nil {
+			return err
+		}
+	}
+	m.Debug().Msgf("using %d existing replicas for app %s", len(replicas), m.app.Id)
 	return nil
 }
 
@@ -877,35 +978,44 @@ func (m *ContainerManager) Close() error {
 	if m.healthCheckTicker != nil {
 		m.healthCheckTicker.Stop()
 	}
+
+	if m.statsTicker != nil {
+		m.statsTicker.Stop()
+	}
 	return nil
 }
 
-func (m *ContainerManager) Run(ctx context.Context, path string, cmdArgs []string, env []string) (*exec.Cmd, error) {
-	args := []string{"run", "--rm"}
+// Run runs the command in a new container from the app image, using the container runtime. The output is
+// written to stdout and stderr, an error is returned if the command exits with a non zero exit code.
+// If run logs retention is enabled, the container is named and retained after exit, older run containers are removed
+func (m *ContainerManager) Run(ctx context.Context, path string, cmdArgs []string, env []string, stdout, stderr io.Writer) error {
 	envMap, _ := m.GetEnvMap()
-
-	// Add env args
-	for k, v := range envMap {
-		args = append(args, "--env", fmt.Sprintf("%s=%s", k, v))
-	}
-
-	// Add container related args
-	for k, v := range m.app.Metadata.ContainerOptions {
-		if v == "" {
-			args = append(args, fmt.Sprintf("--%s", k))
-		} else {
-			args = append(args, fmt.Sprintf("--%s=%s", k, v))
+	for _, e := range env {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			envMap[k] = v
 		}
 	}
 
-	if len(m.mountArgs) > 0 {
-		args = append(args, m.mountArgs...)
+	opts := container.RunOptions{
+		Image:     m.GenImageName,
+		Cmd:       append([]string{path}, cmdArgs...),
+		Env:       envMap,
+		MountArgs: m.mountArgs,
+		Options:   m.runtimeOptions(),
+		Stdout:    stdout,
+		Stderr:    stderr,
+	}
+	if baseName := m.baseName; m.containerConfig.RunLogsRetain > 0 && baseName != "" {
+		opts.Name = runContainerName(baseName, time.Now())
+		go m.pruneRunContainers(baseName)
 	}
 
-	args = append(args, string(m.GenImageName), path)
-	args = append(args, cmdArgs...)
-	m.Debug().Msgf("Running command with args: %v", args)
-
-	cmd := exec.CommandContext(ctx, m.systemConfig.ContainerCommand, args...)
-	return cmd, nil
+	exitCode, err := m.command.RunCommand(ctx, m.systemConfig, m.app.AppEntry, opts)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("command %s exited with status %d", path, exitCode)
+	}
+	return nil
 }
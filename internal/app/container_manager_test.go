@@ -0,0 +1,519 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func newFakeContainerManager(runtime *container.FakeRuntime, image string, volumes []string, replicaCount int) *ContainerManager {
+	logger := testutil.TestLogger()
+	app := &App{
+		Logger:   logger,
+		AppEntry: &types.AppEntry{Id: "app_dev_test", Path: "/test", SourceUrl: ".", IsDev: true},
+	}
+	return &ContainerManager{
+		Logger:       logger,
+		command:      runtime,
+		app:          app,
+		systemConfig: &types.SystemConfig{},
+		image:        image,
+		port:         5000,
+		scheme:       "http",
+		volumes:      volumes,
+		paramMap:     map[string]string{"P1": "v1"},
+		currentState: ContainerStateUnknown,
+		replicaCount: replicaCount,
+	}
+}
+
+func TestContainerManagerDevReload(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", []string{"/data", "cache:/cache"}, 1)
+
+	testutil.AssertNoError(t, m.DevReload(false))
+	containerName := container.GenContainerName("app_dev_test", "")
+	c := runtime.GetContainer(containerName)
+	if c == nil {
+		t.Fatalf("container %s not created", containerName)
+	}
+	testutil.AssertEqualsString(t, "state", "running", c.State)
+	testutil.AssertEqualsString(t, "env", "v1", c.Env["P1"])
+	testutil.AssertEqualsString(t, "env", "/test", c.Env["CL_APP_PATH"])
+	testutil.AssertEqualsInt(t, "mounts", 2, len(c.Mounts))
+	testutil.AssertEqualsString(t, "label", "true", c.Labels[container.LABEL_PREFIX+"dev"])
+	testutil.AssertEqualsInt(t, "host port", c.HostPort, m.replicas[0].hostPort)
+	testutil.AssertEqualsString(t, "state", string(ContainerStateRunning), string(m.currentState))
+	testutil.AssertEqualsBool(t, "volume", true, runtime.VolumeExists(nil, container.GenVolumeName("app_dev_test", "cache")))
+
+	// Reload stops and replaces the running container
+	runtime.Calls = nil
+	testutil.AssertNoError(t, m.DevReload(false))
+	testutil.AssertEqualsString(t, "calls", "stop clc-app_dev_test,rm clc-app_dev_test,run clc-app_dev_test",
+		strings.Join(runtime.Calls, ","))
+}
+
+func TestContainerManagerDevReloadErrors(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	m := newFakeContainerManager(runtime, "missing", nil, 1)
+	err := m.DevReload(false)
+	testutil.AssertErrorContains(t, err, "error running container")
+	testutil.AssertEqualsBool(t, "not found", true, container.IsNotFound(err))
+
+	testutil.AssertNoError(t, m.DevReload(true)) // dry run does not touch the containers
+}
+
+func TestContainerManagerReplicas(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 3)
+	m.app.Metadata.ContainerOptions = map[string]string{types.CONTAINER_OPTION_REPLICAS: "3", "cpus": "1"}
+	limits, err := container.ParseResourceLimits(m.containerConfig, m.app.Metadata.ContainerOptions, m.systemConfig)
+	testutil.AssertNoError(t, err)
+	m.limits = limits
+
+	testutil.AssertNoError(t, m.DevReload(false))
+	testutil.AssertEqualsInt(t, "replicas", 3, len(m.replicas))
+	for i, name := range []string{"clc-app_dev_test", "clc-app_dev_test-r1", "clc-app_dev_test-r2"} {
+		c := runtime.GetContainer(container.ContainerName(name))
+		if c == nil {
+			t.Fatalf("container %s not created", name)
+		}
+		testutil.AssertEqualsInt(t, "port", c.HostPort, m.replicas[i].hostPort)
+		testutil.AssertEqualsString(t, "options", "1", c.Options["cpus"])
+		testutil.AssertEqualsString(t, "options", "", c.Options[types.CONTAINER_OPTION_REPLICAS])
+	}
+
+	// Round robin across replicas
+	urls := []string{}
+	for range 4 {
+		urls = append(urls, m.GetProxyUrl())
+	}
+	testutil.AssertEqualsString(t, "round robin", urls[0], urls[3])
+	testutil.AssertEqualsBool(t, "round robin", true, urls[0] != urls[1] && urls[1] != urls[2])
+
+	// Least connections, the replica with in-flight requests is skipped
+	m.containerConfig.LoadBalance = types.CONTAINER_LB_LEAST_CONN
+	target1, release1, err := m.AcquireProxyUrl()
+	testutil.AssertNoError(t, err)
+	target2, release2, err := m.AcquireProxyUrl()
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "least conn", m.replicaUrl(m.replicas[0]), target1.String())
+	testutil.AssertEqualsString(t, "least conn", m.replicaUrl(m.replicas[1]), target2.String())
+	release1()
+	release2()
+	testutil.AssertEqualsInt(t, "conns", 0, int(m.replicas[0].activeConns.Load()))
+
+	// Failed replica is not used
+	m.replicas[0].state = ContainerStateHealthFailure
+	testutil.AssertEqualsString(t, "skip failed", m.replicaUrl(m.replicas[1]), m.GetProxyUrl())
+
+	// Idle replicas are stopped, the first running replica is retained
+	m.replicas[0].state = ContainerStateRunning
+	m.replicas[1].lastRequest.Store(0)
+	m.replicas[2].lastRequest.Store(0)
+	m.replicas[0].lastRequest.Store(0)
+	m.stopIdleReplicas(1000, 100)
+	testutil.AssertEqualsString(t, "state", string(ContainerStateRunning), string(m.replicas[0].state))
+	testutil.AssertEqualsString(t, "state", string(ContainerStateIdleShutdown), string(m.replicas[1].state))
+	testutil.AssertEqualsString(t, "container", "exited", runtime.GetContainer("clc-app_dev_test-r2").State)
+
+	// Reload with a lower replica count removes the extra replicas
+	m.replicaCount = 1
+	testutil.AssertNoError(t, m.DevReload(false))
+	testutil.AssertEqualsInt(t, "replicas", 1, len(m.replicas))
+	if runtime.GetContainer("clc-app_dev_test-r1") != nil {
+		t.Fatalf("replica container not removed")
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	services, err := parseServices(map[string]any{
+		"redis": map[string]any{"image": "redis:7", "volumes": []any{"/data"}},
+		"db":    map[string]any{"image": "postgres", "env": map[string]any{"POSTGRES_PASSWORD": "pw", "PORT": 5432}},
+	})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "count", 2, len(services))
+	testutil.AssertEqualsString(t, "sorted", "db", services[0].name)
+	testutil.AssertEqualsString(t, "env", "5432", services[0].env["PORT"])
+	testutil.AssertEqualsString(t, "volumes", "/data", strings.Join(services[1].volumes, ","))
+
+	_, err = parseServices(map[string]any{"Redis_1": map[string]any{"image": "redis"}})
+	testutil.AssertErrorContains(t, err, "invalid service name Redis_1")
+	_, err = parseServices(map[string]any{"redis": map[string]any{"volumes": []any{"/data"}}})
+	testutil.AssertErrorContains(t, err, "image is required for service redis")
+	_, err = parseServices(map[string]any{"redis": map[string]any{"image": "redis", "port": 6379}})
+	testutil.AssertErrorContains(t, err, "unknown property port for service redis")
+	_, err = parseServices(map[string]any{"redis": map[string]any{"image": "redis", "volumes": "/data"}})
+	testutil.AssertErrorContains(t, err, "invalid value for property volumes of service redis")
+}
+
+func TestContainerServices(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	runtime.AddImage("redis:7")
+	m := newFakeContainerManager(runtime, "nginx", nil, 1)
+	services, err := parseServices(map[string]any{"redis": map[string]any{"image": "redis:7", "volumes": []any{"/data"}}})
+	testutil.AssertNoError(t, err)
+	testutil.AssertNoError(t, services[0].setHash())
+	m.services = services
+
+	testutil.AssertNoError(t, m.DevReload(false))
+	network := string(container.GenNetworkName("app_dev_test"))
+	testutil.AssertEqualsBool(t, "network", true, runtime.NetworkExists(nil, container.NetworkName(network)))
+	svcName := m.serviceContainerName(services[0])
+	svc := runtime.GetContainer(svcName)
+	if svc == nil {
+		t.Fatalf("service container %s not created", svcName)
+	}
+	testutil.AssertEqualsString(t, "network", network, svc.Options["network"])
+	testutil.AssertEqualsString(t, "alias", "redis", svc.Options["network-alias"])
+	testutil.AssertEqualsString(t, "mount", fmt.Sprintf("--volume=%s:/data",
+		container.GenVolumeName("app_dev_test", "redis:/data")), strings.Join(svc.Mounts, ","))
+	testutil.AssertEqualsString(t, "app network", network, runtime.GetContainer("clc-app_dev_test").Options["network"])
+
+	// Reload reuses the running service container
+	runtime.Calls = nil
+	testutil.AssertNoError(t, m.DevReload(false))
+	testutil.AssertEqualsString(t, "calls", "stop clc-app_dev_test,rm clc-app_dev_test,run clc-app_dev_test",
+		strings.Join(runtime.Calls, ","))
+
+	// Service containers are stopped along with the app and started on the next load
+	m.stopAllReplicas(ContainerStateIdleShutdown)
+	testutil.AssertEqualsString(t, "stopped", "exited", runtime.GetContainer(svcName).State)
+	testutil.AssertNoError(t, m.DevReload(false))
+	testutil.AssertEqualsString(t, "started", "running", runtime.GetContainer(svcName).State)
+
+	// Health check restarts a service which exited
+	runtime.SetContainerState(svcName, "exited")
+	m.checkServices()
+	testutil.AssertEqualsString(t, "restarted", "running", runtime.GetContainer(svcName).State)
+
+	// Changed service config replaces the service container
+	m.services[0].env["MODE"] = "test"
+	testutil.AssertNoError(t, m.services[0].setHash())
+	testutil.AssertNoError(t, m.DevReload(false))
+	if runtime.GetContainer(svcName) != nil {
+		t.Fatalf("old service container %s not removed", svcName)
+	}
+	testutil.AssertEqualsString(t, "env", "test", runtime.GetContainer(m.serviceContainerName(m.services[0])).Env["MODE"])
+
+	// Removed services are cleaned up
+	m.services = nil
+	testutil.AssertNoError(t, m.DevReload(false))
+	containers, err := runtime.GetContainers(nil, container.ContainerName(m.servicePrefix()), true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "services", 0, len(containers))
+}
+
+func TestContainerServicesRetire(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("redis:7")
+	newManager := func(mode string) *ContainerManager {
+		m := newFakeContainerManager(runtime, "nginx", nil, 1)
+		m.app.IsDev = false
+		m.systemConfig.ContainerMaxMemory = "1g"
+		services, err := parseServices(map[string]any{"redis": map[string]any{"image": "redis:7", "env": map[string]any{"MODE": mode}}})
+		testutil.AssertNoError(t, err)
+		services[0].limits, err = container.ParseResourceLimits(types.Container{}, nil, m.systemConfig)
+		testutil.AssertNoError(t, err)
+		testutil.AssertNoError(t, services[0].setHash())
+		m.services = services
+		return m
+	}
+
+	current := newManager("v1")
+	testutil.AssertNoError(t, current.startServices())
+	currentName := current.serviceContainerName(current.services[0])
+	testutil.AssertEqualsString(t, "memory", "1073741824", runtime.GetContainer(currentName).Options["memory"])
+
+	// The service container for the current version is retained till the version is retired
+	next := newManager("v2")
+	testutil.AssertNoError(t, next.startServices())
+	if runtime.GetContainer(currentName) == nil {
+		t.Fatalf("service container %s removed before retire", currentName)
+	}
+
+	current.removeRetiredServices(next)
+	if runtime.GetContainer(currentName) != nil {
+		t.Fatalf("service container %s not removed on retire", currentName)
+	}
+	if runtime.GetContainer(next.serviceContainerName(next.services[0])) == nil {
+		t.Fatalf("service container for new version removed")
+	}
+}
+
+func TestContainerStatsSample(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 2)
+	samples := []*types.ContainerStatsSample{}
+	m.app.statsInsert = func(sample *types.ContainerStatsSample) error {
+		samples = append(samples, sample)
+		return nil
+	}
+	testutil.AssertNoError(t, m.DevReload(false))
+	runtime.SetContainerStats("clc-app_dev_test", 10.5, 100)
+	runtime.SetContainerStats("clc-app_dev_test-r1", 2, 50)
+	m.sampleStats()
+	testutil.AssertEqualsInt(t, "samples", 1, len(samples))
+	testutil.AssertEqualsString(t, "app", "app_dev_test", string(samples[0].AppId))
+	testutil.AssertEqualsInt(t, "containers", 2, samples[0].Containers)
+	testutil.AssertEqualsInt(t, "cpu", 125, int(samples[0].CpuPercent*10))
+	testutil.AssertEqualsInt(t, "memory", 150, int(samples[0].MemoryBytes))
+
+	// Stopped replicas are not included
+	m.replicas[1].state = ContainerStateIdleShutdown
+	m.sampleStats()
+	testutil.AssertEqualsInt(t, "samples", 2, len(samples))
+	testutil.AssertEqualsInt(t, "containers", 1, samples[1].Containers)
+	testutil.AssertEqualsInt(t, "memory", 100, int(samples[1].MemoryBytes))
+}
+
+func TestContainerBuildRegistry(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("cli-app_dev_test-old")
+	runtime.AddImage("cli-app_other-abc")
+	m := newFakeContainerManager(runtime, "", nil, 1)
+	m.app.IsDev = false
+	m.app.AppRunPath = t.TempDir()
+	m.app.Metadata.VersionMetadata.Version = 2
+	m.systemConfig.ContainerRegistry = "localhost:5000/clace/"
+	m.containerConfig.BuildKit = true
+	m.containerConfig.BuildCacheFrom = true
+	m.GenImageName = "cli-app_dev_test-new"
+
+	// Not in the registry, has to be built
+	testutil.AssertEqualsBool(t, "pulled", false, m.pullImage())
+	testutil.AssertNoError(t, m.buildImage("."))
+	testutil.AssertEqualsBool(t, "build kit", true, runtime.BuildOpts.BuildKit)
+	testutil.AssertEqualsBool(t, "inline cache", true, runtime.BuildOpts.InlineCache)
+	testutil.AssertEqualsString(t, "cache from", "[cli-app_dev_test-old]", fmt.Sprint(runtime.BuildOpts.CacheFrom))
+	logs, err := os.ReadFile(BuildLogFile(m.app.AppRunPath, 2))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "build logs", true, strings.Contains(string(logs), "building cli-app_dev_test-new\n"))
+	testutil.AssertEqualsBool(t, "build logs", true, strings.Contains(string(logs), "Build completed"))
+
+	testutil.AssertNoError(t, m.pushImage())
+	testutil.AssertEqualsBool(t, "pushed", true, runtime.InRegistry("localhost:5000/clace/cli-app_dev_test-new"))
+	images, err := runtime.GetImages(nil, "localhost:5000/*")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "registry tag removed", 0, len(images))
+
+	// Image not available locally, as on another node, is pulled from the registry
+	testutil.AssertNoError(t, runtime.RemoveImage(nil, "cli-app_dev_test-new"))
+	testutil.AssertEqualsBool(t, "pulled", true, m.pullImage())
+	images, err = runtime.GetImages(nil, "cli-app_dev_test-new")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "pulled image", 1, len(images))
+
+	// Build failure is recorded in the build logs
+	runtime.BuildError = fmt.Errorf("bad container file")
+	m.app.Metadata.VersionMetadata.Version = 3
+	testutil.AssertErrorContains(t, m.buildImage("."), "bad container file")
+	logs, err = os.ReadFile(BuildLogFile(m.app.AppRunPath, 3))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "build failed", true, strings.Contains(string(logs), "Build failed"))
+}
+
+func TestContainerExec(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 2)
+	m.app.containerManager = m
+	testutil.AssertNoError(t, m.DevReload(false))
+
+	name, err := m.app.ExecContainerName(1)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "name", "clc-app_dev_test-r1", string(name))
+	runtime.ExecExitCode = 3
+	var out bytes.Buffer
+	exitCode, err := m.app.ExecContainer(context.Background(), name, container.ExecOptions{
+		Cmd: []string{"cat"}, Stdin: strings.NewReader("input"), Stdout: &out, Stderr: &out})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "exit code", 3, exitCode)
+	testutil.AssertEqualsString(t, "output", "cat\ninput", out.String())
+
+	_, err = m.app.ExecContainerName(2)
+	testutil.AssertErrorContains(t, err, "invalid replica 2, app /test has 2 replicas")
+	m.replicas[0].state = ContainerStateIdleShutdown
+	_, err = m.app.ExecContainerName(0)
+	testutil.AssertErrorContains(t, err, "container clc-app_dev_test is not running")
+
+	m.lifetime = types.CONTAINER_LIFETIME_COMMAND
+	_, err = m.app.ExecContainerName(0)
+	testutil.AssertErrorContains(t, err, "exec is not supported")
+}
+
+func TestContainerRun(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 1)
+	m.GenImageName = "nginx"
+
+	var out bytes.Buffer
+	testutil.AssertNoError(t, m.Run(context.Background(), "ls", []string{"-l", "/data"}, []string{"A=1"}, &out, &out))
+	testutil.AssertEqualsString(t, "output", "ls -l /data\n", out.String())
+
+	runtime.RunExitCode = 2
+	err := m.Run(context.Background(), "ls", nil, nil, &out, &out)
+	testutil.AssertErrorContains(t, err, "command ls exited with status 2")
+
+	// With run logs retention, the run container is retained
+	runtime.RunExitCode = 0
+	m.baseName = container.GenContainerName(m.app.Id, "")
+	m.containerConfig.RunLogsRetain = 2
+	testutil.AssertNoError(t, m.Run(context.Background(), "ls", nil, []string{"A=1"}, &out, &out))
+	names, err := LogContainers(runtime, nil, m.app.Id)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "run containers", 1, len(names))
+	c := runtime.GetContainer(names[0])
+	testutil.AssertEqualsString(t, "env", "1", c.Env["A"])
+}
+
+func TestReplicaNames(t *testing.T) {
+	base := container.ContainerName("clc-app1")
+	testutil.AssertEqualsString(t, "name", "clc-app1", string(replicaName(base, 0)))
+	testutil.AssertEqualsString(t, "name", "clc-app1-r2", string(replicaName(base, 2)))
+	testutil.AssertEqualsBool(t, "replica", true, isReplicaOf("clc-app1", base))
+	testutil.AssertEqualsBool(t, "replica", true, isReplicaOf("clc-app1-r10", base))
+	testutil.AssertEqualsBool(t, "replica", false, isReplicaOf("clc-app12", base))
+	testutil.AssertEqualsBool(t, "replica", false, isReplicaOf("clc-app1-rx", base))
+
+	count, err := getReplicaCount(map[string]string{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "default", 1, count)
+	_, err = getReplicaCount(map[string]string{types.CONTAINER_OPTION_REPLICAS: "0"})
+	testutil.AssertErrorContains(t, err, "invalid replicas container option 0")
+}
+
+func TestAppRetire(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 2)
+	testutil.AssertNoError(t, m.DevReload(false))
+	oldApp := m.app
+	oldApp.containerManager = m
+	oldApp.AppConfig.Container.DrainTimeoutSecs = 5
+
+	// New app shares the first container, the second one is not used
+	newApp := &App{containerManager: &ContainerManager{replicas: []*replica{{name: "clc-app_dev_test"}}}}
+	oldApp.Metadata.VersionMetadata.Version = 3
+	newApp.AppEntry = &types.AppEntry{}
+	newApp.Metadata.VersionMetadata.PreviousVersion = 3
+
+	oldApp.inflightRequests.Add(1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		oldApp.inflightRequests.Add(-1)
+	}()
+
+	start := time.Now()
+	oldApp.Retire(newApp)
+	testutil.AssertEqualsBool(t, "drained", true, time.Since(start) >= 200*time.Millisecond)
+	testutil.AssertEqualsString(t, "shared", "running", runtime.GetContainer("clc-app_dev_test").State)
+	testutil.AssertEqualsString(t, "stopped", "exited", runtime.GetContainer("clc-app_dev_test-r1").State)
+	testutil.AssertEqualsString(t, "state", string(ContainerStateRetired), string(m.currentState))
+
+	// The containers of the retired previous version are retained by the container gc
+	newApp.initialized = true
+	names := newApp.ContainerNames()
+	testutil.AssertEqualsInt(t, "container names", 3, len(names))
+	testutil.AssertEqualsString(t, "previous", "clc-app_dev_test-r1", string(names[2]))
+
+	// Previous version containers are not known after a restart, all the stopped containers are retained
+	m2 := newFakeContainerManager(runtime, "nginx", nil, 1)
+	testutil.AssertNoError(t, m2.DevReload(false))
+	currentApp := m2.app
+	currentApp.containerManager = m2
+	currentApp.AppEntry = &types.AppEntry{}
+	currentApp.Metadata.VersionMetadata.Version = 4
+	currentApp.Metadata.VersionMetadata.PreviousVersion = 3
+	currentApp.initialized = true
+	testutil.AssertEqualsBool(t, "unknown previous", true, currentApp.ContainerNames() == nil)
+
+	// Previous version containers are carried over by a switch for the same version
+	currentApp.previousContainers = []container.ContainerName{"clc-app_dev_test-r1"}
+	sameApp := &App{containerManager: &ContainerManager{replicas: []*replica{{name: "clc-app_dev_test"}}},
+		AppEntry: &types.AppEntry{}, initialized: true}
+	sameApp.Metadata.VersionMetadata = currentApp.Metadata.VersionMetadata
+	currentApp.Retire(sameApp)
+	names = sameApp.ContainerNames()
+	testutil.AssertEqualsInt(t, "same version names", 2, len(names))
+	testutil.AssertEqualsString(t, "carried over", "clc-app_dev_test-r1", string(names[1]))
+}
+
+func TestProdReloadFailureCleanup(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 2)
+	m.app.IsDev = false
+	m.health = "/"
+	m.GenImageName = "nginx"
+	m.containerConfig.HealthAttemptsAfterStartup = 1
+	m.containerConfig.HealthTimeoutSecs = 1
+
+	// Fake containers do not serve the health url, the new containers are removed
+	err := m.runReplicas("clc-app_prd_test")
+	testutil.AssertErrorContains(t, err, "error waiting for health")
+	containers, err := runtime.GetContainers(nil, "clc-app_prd_test", true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "removed", 0, len(containers))
+	testutil.AssertEqualsInt(t, "replicas", 0, len(m.replicas))
+}
+
+func TestRunContainerLogs(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	runtime.AddImage("nginx")
+	m := newFakeContainerManager(runtime, "nginx", nil, 1)
+	m.baseName = container.GenContainerName(m.app.Id, "")
+	m.containerConfig.RunLogsRetain = 2
+
+	// Simulate four command runs, the last one still running
+	start := time.Now()
+	names := []container.ContainerName{}
+	for i := range 4 {
+		name := runContainerName(m.baseName, start.Add(time.Duration(i)*time.Second))
+		testutil.AssertNoError(t, runtime.RunContainer(nil, m.app.AppEntry, name, "nginx", 0, nil, nil, nil))
+		if i < 3 {
+			runtime.SetContainerState(name, "exited")
+		}
+		runtime.SetContainerLogs(name, fmt.Sprintf("run %d\nline 2\n", i))
+		names = append(names, name)
+	}
+	testutil.AssertEqualsBool(t, "run name", true, isRunOf(string(names[0]), m.baseName))
+	testutil.AssertEqualsBool(t, "run name", false, isRunOf(string(names[0]), "clc-app_dev"))
+	testutil.AssertEqualsBool(t, "run container", true, isRunContainer(string(names[0])))
+	testutil.AssertEqualsBool(t, "run container", false, isRunContainer(string(m.baseName)))
+
+	// The running replica is listed before the runs. Stopped replicas, service containers and containers
+	// for other apps are not included
+	testutil.AssertNoError(t, runtime.RunContainer(nil, m.app.AppEntry, m.baseName, "nginx", 0, nil, nil, nil))
+	testutil.AssertNoError(t, runtime.RunContainer(nil, m.app.AppEntry, m.baseName+"-abc", "nginx", 0, nil, nil, nil))
+	runtime.SetContainerState(m.baseName+"-abc", "exited")
+	testutil.AssertNoError(t, runtime.RunContainer(nil, m.app.AppEntry, m.baseName+"-svc-db", "nginx", 0, nil, nil, nil))
+	testutil.AssertNoError(t, runtime.RunContainer(nil, &types.AppEntry{Id: "app_dev_test2"}, m.baseName+"2", "nginx", 0, nil, nil, nil))
+
+	// The oldest exited run is removed, the running one is not counted
+	m.pruneRunContainers(m.baseName)
+	logNames, err := LogContainers(runtime, nil, m.app.Id)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "log containers", fmt.Sprint(append([]container.ContainerName{m.baseName}, names[1:]...)), fmt.Sprint(logNames))
+
+	var out bytes.Buffer
+	err = runtime.StreamContainerLogs(context.Background(), nil, names[3], container.LogOptions{Tail: 1}, &out)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "logs", "line 2\n", out.String())
+}
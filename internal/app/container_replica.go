@@ -0,0 +1,353 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// replica is one of the containers started for the app. The state and host port are guarded by the
+// container manager state lock
+type replica struct {
+	index       int
+	name        container.ContainerName
+	hostPort    int
+	state       ContainerState
+	activeConns atomic.Int64 // in-flight proxy requests
+	lastRequest atomic.Int64 // unix time of the last request routed to the replica
+	restarting  atomic.Bool
+}
+
+// replicaName returns the container name for the replica. The first replica uses the base name,
+// so that containers started before replicas were configured are reused
+func replicaName(baseName container.ContainerName, index int) container.ContainerName {
+	if index == 0 {
+		return baseName
+	}
+	return container.ContainerName(fmt.Sprintf("%s-r%d", baseName, index))
+}
+
+// isReplicaOf checks whether the container is one of the replicas for the base name
+func isReplicaOf(name string, baseName container.ContainerName) bool {
+	if name == string(baseName) {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(name, string(baseName)+"-r")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// getReplicaCount returns the replica count from the container options, one by default
+func getReplicaCount(containerOptions map[string]string) (int, error) {
+	countStr, ok := containerOptions[types.CONTAINER_OPTION_REPLICAS]
+	if !ok {
+		return 1, nil
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 || count > types.CONTAINER_MAX_REPLICAS {
+		return 0, fmt.Errorf("invalid %s container option %s, expected value between 1 and %d",
+			types.CONTAINER_OPTION_REPLICAS, countStr, types.CONTAINER_MAX_REPLICAS)
+	}
+	return count, nil
+}
+
+// runtimeOptions returns the container options to pass to the container runtime, with the resource limits applied
+func (m *ContainerManager) runtimeOptions() map[string]string {
+	ret := map[string]string{}
+	for k, v := range m.app.Metadata.ContainerOptions {
+		if k != types.CONTAINER_OPTION_REPLICAS {
+			ret[k] = v
+		}
+	}
+	if len(m.services) > 0 {
+		ret["network"] = string(container.GenNetworkName(m.app.Id))
+	}
+	return m.limits.Options(ret, container.IsPodman(m.systemConfig))
+}
+
+// getReplicaContainers returns the existing containers for the replicas of the base name, keyed by name.
+// The container name filter does a partial match, so the names are checked again
+func (m *ContainerManager) getReplicaContainers(baseName container.ContainerName, getAll bool) (map[container.ContainerName]container.Container, error) {
+	containers, err := m.command.GetContainers(m.systemConfig, baseName, getAll)
+	if err != nil {
+		return nil, fmt.Errorf("error getting running containers: %w", err)
+	}
+	ret := map[container.ContainerName]container.Container{}
+	for _, c := range containers {
+		if isReplicaOf(c.Names, baseName) {
+			ret[container.ContainerName(c.Names)] = c
+		}
+	}
+	return ret, nil
+}
+
+// getRunningReplica returns the replica with the host port of the running container
+func (m *ContainerManager) getRunningReplica(index int, name container.ContainerName) (*replica, error) {
+	containers, err := m.getReplicaContainers(name, false)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := containers[name]
+	if !ok {
+		logs, _ := m.command.GetContainerLogs(m.systemConfig, name)
+		return nil, fmt.Errorf("container %s not running. Logs\n %s", name, logs)
+	}
+	r := &replica{index: index, name: name, hostPort: c.Port, state: ContainerStateRunning}
+	r.lastRequest.Store(time.Now().Unix())
+	return r, nil
+}
+
+// removeReplicas stops and removes the existing replica containers
+func (m *ContainerManager) removeReplicas(containers map[container.ContainerName]container.Container) error {
+	for name, c := range containers {
+		if c.State == "running" {
+			if err := m.command.StopContainer(m.systemConfig, name); err != nil {
+				return fmt.Errorf("error stopping container: %w", err)
+			}
+		}
+		_ = m.command.RemoveContainer(m.systemConfig, name)
+	}
+	return nil
+}
+
+// runReplicas runs the replica containers and waits for them to be healthy. The state lock
+// should be held by the caller
+func (m *ContainerManager) runReplicas(baseName container.ContainerName) error {
+	envMap, _ := m.GetEnvMap()
+	options := m.runtimeOptions()
+	err := m.startReplicas(baseName, envMap, options)
+	if err != nil && !m.app.IsDev {
+		// Remove the new containers, the containers for the current app version continue to serve requests.
+		// For dev apps, the failed container is retained for debugging
+		m.currentState = ContainerStateUnknown
+		m.replicas = nil
+		containers, _ := m.getReplicaContainers(baseName, true)
+		if removeErr := m.removeReplicas(containers); removeErr != nil {
+			m.Error().Err(removeErr).Msgf("Error removing failed containers for app %s", m.app.Id)
+		}
+	}
+	return err
+}
+
+func (m *ContainerManager) startReplicas(baseName container.ContainerName, envMap, options map[string]string) error {
+	replicas := make([]*replica, 0, m.replicaCount)
+	for i := range m.replicaCount {
+		name := replicaName(baseName, i)
+		err := m.command.RunContainer(m.systemConfig, m.app.AppEntry, name,
+			m.GenImageName, m.port, envMap, m.mountArgs, options)
+		if err != nil {
+			return fmt.Errorf("error running container: %w", err)
+		}
+
+		r, err := m.getRunningReplica(i, name)
+		if err != nil {
+			return err
+		}
+		replicas = append(replicas, r)
+	}
+
+	m.replicas = replicas
+	m.currentState = ContainerStateRunning
+	for _, r := range replicas {
+		if err := m.waitForStartup(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForStartup waits for the replica to be healthy after the container start
+func (m *ContainerManager) waitForStartup(r *replica) error {
+	if m.health == "" {
+		return nil
+	}
+	if err := m.waitForReplicaHealth(r.hostPort, m.containerConfig.HealthAttemptsAfterStartup); err != nil {
+		logs, _ := m.command.GetContainerLogs(m.systemConfig, r.name)
+		return fmt.Errorf("error waiting for health: %w. Logs\n %s", err, logs)
+	}
+	return nil
+}
+
+// restartReplica restarts a replica which was stopped after health failure or idle shutdown. The
+// replica is added back to the load balancer rotation after it is healthy
+func (m *ContainerManager) restartReplica(r *replica) {
+	if !r.restarting.CompareAndSwap(false, true) {
+		return // restart already in progress
+	}
+	defer r.restarting.Store(false)
+
+	m.Debug().Msgf("Restarting replica %s for app %s", r.name, m.app.Id)
+	_ = m.command.StopContainer(m.systemConfig, r.name)
+	if err := m.command.StartContainer(m.systemConfig, r.name); err != nil {
+		m.Error().Err(err).Msgf("Error restarting replica %s", r.name)
+		return
+	}
+
+	started, err := m.getRunningReplica(r.index, r.name)
+	if err != nil {
+		m.Error().Err(err).Msgf("Error restarting replica %s", r.name)
+		return
+	}
+	if err := m.waitForStartup(started); err != nil {
+		m.Error().Err(err).Msgf("Error restarting replica %s", r.name)
+		return
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if m.currentState != ContainerStateRunning {
+		// App containers were stopped while the replica was restarting
+		_ = m.command.StopContainer(m.systemConfig, r.name)
+		return
+	}
+	r.hostPort = started.hostPort
+	r.state = ContainerStateRunning
+	r.lastRequest.Store(time.Now().Unix())
+}
+
+// selectReplica returns the replica to route the request to, based on the load balancing config. Only
+// running replicas are used. If replicas were stopped after being idle and all the running replicas are
+// handling requests, an idle replica is restarted in the background. Returns nil if no replica is present
+func (m *ContainerManager) selectReplica() *replica {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+
+	count := len(m.replicas)
+	if count == 0 {
+		return nil
+	}
+
+	start := 0
+	if m.containerConfig.LoadBalance != types.CONTAINER_LB_LEAST_CONN {
+		start = int(m.nextReplica.Add(1)-1) % count
+	}
+
+	var selected, idle *replica
+	allBusy := true
+	for i := range count {
+		r := m.replicas[(start+i)%count]
+		if r.state != ContainerStateRunning {
+			if r.state == ContainerStateIdleShutdown && idle == nil {
+				idle = r
+			}
+			continue
+		}
+
+		conns := r.activeConns.Load()
+		if conns == 0 {
+			allBusy = false
+		}
+		if selected == nil || (m.containerConfig.LoadBalance == types.CONTAINER_LB_LEAST_CONN && conns < selected.activeConns.Load()) {
+			selected = r
+		}
+	}
+
+	if idle != nil && allBusy {
+		go m.restartReplica(idle)
+	}
+	if selected == nil {
+		selected = m.replicas[0] // no replica is running, request will fail
+	}
+	selected.lastRequest.Store(time.Now().Unix())
+	return selected
+}
+
+func (m *ContainerManager) replicaUrl(r *replica) string {
+	hostPort := 0
+	if r != nil {
+		hostPort = r.hostPort
+	}
+	return fmt.Sprintf("%s://127.0.0.1:%d", m.scheme, hostPort)
+}
+
+// AcquireProxyUrl returns the url of the replica to proxy the request to. The release function
+// has to be called after the request is done, the count of in-flight requests is used for load balancing
+func (m *ContainerManager) AcquireProxyUrl() (*url.URL, func(), error) {
+	r := m.selectReplica()
+	target, err := url.Parse(m.replicaUrl(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	if r == nil {
+		return target, func() {}, nil
+	}
+
+	r.activeConns.Add(1)
+	return target, func() { r.activeConns.Add(-1) }, nil
+}
+
+// runningReplicas returns the replicas which are in running state
+func (m *ContainerManager) runningReplicas() []*replica {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	ret := []*replica{}
+	for _, r := range m.replicas {
+		if r.state == ContainerStateRunning {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func (m *ContainerManager) replicaNames() []container.ContainerName {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	ret := make([]container.ContainerName, 0, len(m.replicas))
+	for _, r := range m.replicas {
+		ret = append(ret, r.name)
+	}
+	return ret
+}
+
+// stopReplicas stops the replicas of a retired app, except the ones in the keep list. The stopped
+// containers are not removed, they are started again if the app is switched back to this version
+func (m *ContainerManager) stopReplicas(keep map[container.ContainerName]bool) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.currentState = ContainerStateRetired
+	for _, r := range m.replicas {
+		if keep[r.name] || r.state == ContainerStateIdleShutdown {
+			continue
+		}
+		r.state = ContainerStateRetired
+		m.Debug().Msgf("Stopping retired container %s for app %s", r.name, m.app.Id)
+		if err := m.command.StopContainer(m.systemConfig, r.name); err != nil {
+			m.Error().Err(err).Msgf("Error stopping retired container %s", r.name)
+		}
+	}
+}
+
+// stopAllReplicas stops all the replicas and sets the app state. The app is reinitialized on the next
+// request, which starts the containers again
+func (m *ContainerManager) stopAllReplicas(state ContainerState) {
+	if m.app.notifyClose != nil {
+		// Notify the server to close the app so that it gets reinitialized on next API call
+		m.app.notifyClose <- m.app.AppPathDomain()
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.currentState = state
+	for _, r := range m.replicas {
+		if r.state == ContainerStateIdleShutdown {
+			continue // already stopped
+		}
+		r.state = state
+		if err := m.command.StopContainer(m.systemConfig, r.name); err != nil {
+			m.Error().Err(err).Msgf("Error stopping app %s container %s", m.app.Id, r.name)
+		}
+	}
+	m.stopServices()
+}
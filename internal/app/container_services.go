@@ -0,0 +1,289 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/claceio/clace/internal/app/container"
+)
+
+// serviceConfig is the config for a service (sidecar) container, like a database or cache, which runs
+// along with the app container. The services are reachable by name from the app container, on the
+// private network for the app
+type serviceConfig struct {
+	name    string
+	image   string
+	volumes []string
+	env     map[string]string
+	limits  container.ResourceLimits // the server max limits, the app limits and options are not applied to services
+	hash    string                   // hash of the config, a changed config recreates the service container
+}
+
+var serviceNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// parseServices parses the services dict from the container config, the services are sorted by name
+func parseServices(services map[string]any) ([]serviceConfig, error) {
+	ret := make([]serviceConfig, 0, len(services))
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if !serviceNameRegex.MatchString(name) || len(name) > 63 {
+			return nil, fmt.Errorf("invalid service name %s, should be lower case letters, digits and hyphens", name)
+		}
+		config, ok := services[name].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("service %s config should be a dict", name)
+		}
+
+		svc := serviceConfig{name: name, volumes: []string{}, env: map[string]string{}}
+		for k, v := range config {
+			switch k {
+			case "image":
+				svc.image, ok = v.(string)
+			case "volumes":
+				var list []any
+				list, ok = v.([]any)
+				for _, vol := range list {
+					volStr, isStr := vol.(string)
+					if !isStr || strings.HasPrefix(volStr, VOL_PREFIX_SECRET) {
+						return nil, fmt.Errorf("invalid volume %v for service %s", vol, name)
+					}
+					svc.volumes = append(svc.volumes, volStr)
+				}
+			case "env":
+				var envMap map[string]any
+				envMap, ok = v.(map[string]any)
+				for ek, ev := range envMap {
+					svc.env[ek] = fmt.Sprintf("%v", ev)
+				}
+			default:
+				return nil, fmt.Errorf("unknown property %s for service %s, expected image, volumes or env", k, name)
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid value for property %s of service %s", k, name)
+			}
+		}
+		if svc.image == "" {
+			return nil, fmt.Errorf("image is required for service %s", name)
+		}
+		ret = append(ret, svc)
+	}
+	return ret, nil
+}
+
+// setHash sets the config hash for the service, after the secrets in the env are evaluated
+func (s *serviceConfig) setHash() error {
+	envHash, err := getMapHash(s.env)
+	if err != nil {
+		return err
+	}
+	volHash, err := getSliceHash(s.volumes)
+	if err != nil {
+		return err
+	}
+	hashVal := fmt.Sprintf("%s-%s-%s", s.image, volHash, envHash)
+	if s.limits != (container.ResourceLimits{}) {
+		// Limits are added only if set, so that the hash is unchanged for services without limits
+		hashVal += fmt.Sprintf("-%+v", s.limits)
+	}
+	sum := sha256.Sum256([]byte(hashVal))
+	s.hash = hex.EncodeToString(sum[:])[:12]
+	return nil
+}
+
+// servicePrefix returns the container name prefix for the service containers of the app. The service containers
+// are shared by the app versions, so the name does not include the app hash
+func (m *ContainerManager) servicePrefix() string {
+	return fmt.Sprintf("%s-svc-", container.GenContainerName(m.app.Id, ""))
+}
+
+func (m *ContainerManager) serviceContainerName(svc serviceConfig) container.ContainerName {
+	return container.ContainerName(fmt.Sprintf("%s%s-%s", m.servicePrefix(), svc.name, svc.hash))
+}
+
+// startServices starts the service containers, creating the app network if required. Existing service containers
+// are reused if the service config is unchanged. For dev apps, the containers for services which were changed or
+// removed are removed. For prod apps, they are used by the current version until it is retired
+func (m *ContainerManager) startServices() error {
+	if m.app.IsDev {
+		// Dev apps are reloaded in place, there is no other version using the services
+		keep := m.serviceContainerNames()
+		if err := m.removeServiceContainers(func(name container.ContainerName) bool { return !keep[name] }); err != nil {
+			return err
+		}
+	}
+
+	if len(m.services) == 0 {
+		return nil
+	}
+
+	existing, err := m.command.GetContainers(m.systemConfig, container.ContainerName(m.servicePrefix()), true)
+	if err != nil {
+		return fmt.Errorf("error getting service containers: %w", err)
+	}
+	current := map[container.ContainerName]container.Container{}
+	for _, c := range existing {
+		current[container.ContainerName(c.Names)] = c
+	}
+
+	network := container.GenNetworkName(m.app.Id)
+	if !m.command.NetworkExists(m.systemConfig, network) {
+		if err := m.command.NetworkCreate(m.systemConfig, network); err != nil {
+			return err
+		}
+	}
+
+	for _, svc := range m.services {
+		name := m.serviceContainerName(svc)
+		c, ok := current[name]
+		if ok && c.State == "running" {
+			continue
+		}
+		if ok {
+			m.Debug().Msgf("service container %s state %s, starting", name, c.State)
+			if err := m.command.StartContainer(m.systemConfig, name); err != nil {
+				return fmt.Errorf("error starting service %s: %w", svc.name, err)
+			}
+			continue
+		}
+
+		mountArgs, err := m.genServiceMountArgs(svc)
+		if err != nil {
+			return err
+		}
+		options := svc.limits.Options(map[string]string{"network": string(network), "network-alias": svc.name},
+			container.IsPodman(m.systemConfig))
+		m.Info().Msgf("Running service container %s for app %s", name, m.app.Id)
+		err = m.command.RunContainer(m.systemConfig, m.app.AppEntry, name, container.ImageName(svc.image), 0,
+			svc.env, mountArgs, options)
+		if err != nil {
+			return fmt.Errorf("error running service %s: %w", svc.name, err)
+		}
+	}
+	return nil
+}
+
+// serviceContainerNames returns the names of the containers for the configured services
+func (m *ContainerManager) serviceContainerNames() map[container.ContainerName]bool {
+	ret := map[container.ContainerName]bool{}
+	for _, svc := range m.services {
+		ret[m.serviceContainerName(svc)] = true
+	}
+	return ret
+}
+
+// removeServiceContainers stops and removes the service containers of the app for which remove returns true
+func (m *ContainerManager) removeServiceContainers(remove func(name container.ContainerName) bool) error {
+	existing, err := m.command.GetContainers(m.systemConfig, container.ContainerName(m.servicePrefix()), true)
+	if err != nil {
+		return fmt.Errorf("error getting service containers: %w", err)
+	}
+	for _, c := range existing {
+		name := container.ContainerName(c.Names)
+		if !remove(name) {
+			continue
+		}
+		m.Info().Msgf("Removing service container %s for app %s, service config changed", name, m.app.Id)
+		if err := m.removeReplicas(map[container.ContainerName]container.Container{name: c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRetiredServices removes the service containers of a retired app version which are not used by the
+// new version. The removal is done on retire, so that the current version continues to work with its services
+// if the new version fails to initialize
+func (m *ContainerManager) removeRetiredServices(newManager *ContainerManager) {
+	keep := map[container.ContainerName]bool{}
+	if newManager != nil {
+		keep = newManager.serviceContainerNames()
+	}
+	retired := m.serviceContainerNames()
+	if err := m.removeServiceContainers(func(name container.ContainerName) bool { return retired[name] && !keep[name] }); err != nil {
+		m.Error().Err(err).Msgf("Error removing retired service containers for app %s", m.app.Id)
+	}
+}
+
+// genServiceMountArgs creates the named volumes for the service and returns the mount args. Unnamed
+// volumes are named using the service name, so that they are not shared with the app container
+func (m *ContainerManager) genServiceMountArgs(svc serviceConfig) ([]string, error) {
+	args := []string{}
+	for _, vol := range svc.volumes {
+		_, volName, volStr, err := m.parseVolumeString(vol)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing volume %s for service %s: %w", vol, svc.name, err)
+		}
+		if volName == "" {
+			args = append(args, fmt.Sprintf("--volume=%s", volStr)) // bind mount
+			continue
+		}
+
+		dir := volName
+		target := strings.TrimPrefix(volStr, volName+":")
+		if volName == UNNAMED_VOLUME {
+			dir = svc.name + ":" + volStr
+			target = volStr
+		}
+		genVolumeName := container.GenVolumeName(m.app.Id, dir)
+		if !m.command.VolumeExists(m.systemConfig, genVolumeName) {
+			if err := m.command.VolumeCreate(m.systemConfig, genVolumeName); err != nil {
+				return nil, fmt.Errorf("error creating volume %s: %w", genVolumeName, err)
+			}
+		}
+		args = append(args, fmt.Sprintf("--volume=%s:%s", genVolumeName, target))
+	}
+	return args, nil
+}
+
+// stopServices stops the service containers, called when the app containers are stopped
+func (m *ContainerManager) stopServices() {
+	for _, svc := range m.services {
+		name := m.serviceContainerName(svc)
+		if err := m.command.StopContainer(m.systemConfig, name); err != nil {
+			m.Error().Err(err).Msgf("Error stopping service container %s for app %s", name, m.app.Id)
+		}
+	}
+}
+
+// checkServices restarts the service containers which are not running, called from the health checker
+func (m *ContainerManager) checkServices() {
+	if len(m.services) == 0 {
+		return
+	}
+	containers, err := m.command.GetContainers(m.systemConfig, container.ContainerName(m.servicePrefix()), false)
+	if err != nil {
+		m.Error().Err(err).Msgf("Error getting service containers for app %s", m.app.Id)
+		return
+	}
+	running := map[string]bool{}
+	for _, c := range containers {
+		running[c.Names] = true
+	}
+
+	for _, svc := range m.services {
+		name := m.serviceContainerName(svc)
+		if running[string(name)] {
+			continue
+		}
+		m.Info().Msgf("Service container %s for app %s is not running, restarting", name, m.app.Id)
+		if err := m.command.StartContainer(m.systemConfig, name); err != nil {
+			m.Error().Err(err).Msgf("Error restarting service container %s", name)
+		}
+	}
+}
+
+// servicesHash returns the combined hash of the service configs, empty if no services are configured
+func (m *ContainerManager) servicesHash() string {
+	hashes := make([]string, 0, len(m.services))
+	for _, svc := range m.services {
+		hashes = append(hashes, svc.name+":"+svc.hash)
+	}
+	return strings.Join(hashes, ",")
+}
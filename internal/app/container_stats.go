@@ -0,0 +1,55 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// statsSampler samples the container stats once every stats interval, while the app containers are running.
+// The stats call can take a while, so it is done separately from the health checker
+func (m *ContainerManager) statsSampler() {
+	for range m.statsTicker.C {
+		m.stateLock.RLock()
+		state := m.currentState
+		m.stateLock.RUnlock()
+		if state == ContainerStateRunning {
+			m.sampleStats()
+		}
+	}
+}
+
+// sampleStats saves the cpu and memory usage of the running app containers, summed across the replicas and
+// services
+func (m *ContainerManager) sampleStats() {
+	if m.app.statsInsert == nil {
+		return
+	}
+
+	names := []container.ContainerName{}
+	for _, r := range m.runningReplicas() {
+		names = append(names, r.name)
+	}
+	for _, svc := range m.services {
+		names = append(names, m.serviceContainerName(svc))
+	}
+
+	stats, err := m.command.GetContainerStats(m.systemConfig, names)
+	if err != nil {
+		m.Warn().Err(err).Msgf("Error getting container stats for app %s", m.app.Id)
+		return
+	}
+
+	sample := types.ContainerStatsSample{AppId: m.app.Id, CreateTime: time.Now(), Containers: len(stats)}
+	for _, s := range stats {
+		sample.CpuPercent += s.CpuPercent
+		sample.MemoryBytes += s.MemoryBytes
+	}
+	if err := m.app.statsInsert(&sample); err != nil {
+		m.Error().Err(err).Msgf("Error saving container stats for app %s", m.app.Id)
+	}
+}
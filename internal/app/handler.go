@@ -25,9 +25,6 @@ import (
 )
 
 var (
-	REAL_IP_HEADER   = "X-Real-IP"
-	FORWARDED_HEADER = "X-Forwarded-For"
-
 	CONTENT_TYPE_JSON = []string{"application/json"}
 	CONTENT_TYPE_TEXT = []string{"text/plain"}
 
@@ -35,23 +32,18 @@ var (
 	VARY_HEADER_VALUE = []string{"HX-Request"}
 )
 
-func init() {
-	REAL_IP_HEADER = http.CanonicalHeaderKey(REAL_IP_HEADER)
-	FORWARDED_HEADER = http.CanonicalHeaderKey(FORWARDED_HEADER)
-}
-
 func (a *App) earlyHints(w http.ResponseWriter, r *http.Request) {
 	sendHint := false
 	for _, f := range a.sourceFS.StaticFiles() {
 		if strings.HasSuffix(f, ".css") {
 			sendHint = true
 			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=style",
-				path.Join(a.Path, a.sourceFS.HashName(f))))
+				path.Join(a.requestAppPath(r), a.sourceFS.HashName(f))))
 		} else if strings.HasSuffix(f, ".js") {
 			if !strings.HasSuffix(f, "sse.js") {
 				sendHint = true
 				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=script",
-					path.Join(a.Path, a.sourceFS.HashName(f))))
+					path.Join(a.requestAppPath(r), a.sourceFS.HashName(f))))
 			}
 		}
 	}
@@ -86,13 +78,22 @@ var encoderPool = sync.Pool{
 	},
 }
 
-func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Callable, rtype string) http.HandlerFunc {
+// createHandlerFunc creates the handler for HTML and API routes. If csrfCheck is false, the CSRF token is not
+// validated for the route, used for API's which are called by non-browser clients
+func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Callable, rtype string, csrfCheck bool) http.HandlerFunc {
 	hasArgs := false
 	if handler != nil && !strings.HasSuffix(handler.Name(), "_no_args") {
 		hasArgs = true
 	}
 	rtype = strings.ToUpper(rtype)
 	goHandler := func(w http.ResponseWriter, r *http.Request) {
+		if a.AppConfig.Security.CsrfProtection && csrfCheck {
+			if !system.ValidateCsrfToken(r, a.Id) {
+				http.Error(w, "CSRF token validation failed", http.StatusForbidden)
+				return
+			}
+		}
+
 		thread := &starlark.Thread{
 			Name:  a.Path,
 			Print: func(_ *starlark.Thread, msg string) { fmt.Println(msg) },
@@ -117,11 +118,15 @@ func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Call
 
 		var requestData starlark_type.Request
 		if hasArgs || rtype == apptype.HTML_TYPE {
-			appPath := a.Path
+			appPath := a.requestAppPath(r)
 			if appPath == "/" {
 				appPath = ""
 			}
 			pagePath := r.URL.Path
+			if appPath != a.Path && a.Path != "/" {
+				// Canary request, the request path was updated to the stage app path
+				pagePath = appPath + strings.TrimPrefix(pagePath, a.Path)
+			}
 			if pagePath == "/" {
 				pagePath = ""
 			}
@@ -139,6 +144,10 @@ func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Call
 				HtmxVersion: a.codeConfig.Htmx.Version,
 				Headers:     header,
 				RemoteIP:    getRemoteIP(r),
+				CspNonce:    system.GetContextValue(r.Context(), types.CSP_NONCE),
+			}
+			if rtype == apptype.HTML_TYPE && a.AppConfig.Security.CsrfProtection {
+				requestData.CsrfToken = system.GetCsrfToken(w, r, a.Id, a.requestAppPath(r))
 			}
 
 			chiContext := chi.RouteContext(r.Context())
@@ -337,7 +346,7 @@ func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Call
 		var err error
 		if isHtmxRequest && fragment != "" {
 			a.Trace().Msgf("Rendering block %s", fragment)
-			err = a.executeTemplate(w, fullHtml, fragment, requestData)
+			err = a.executeTemplate(w, r, fullHtml, fragment, requestData)
 		} else {
 			referrer := types.GetHTTPHeader(header, "Referer")
 			isUpdateRequest := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
@@ -349,7 +358,7 @@ func (a *App) createHandlerFunc(fullHtml, fragment string, handler starlark.Call
 				return
 			} else {
 				a.Trace().Msgf("Rendering page %s", fullHtml)
-				err = a.executeTemplate(w, fullHtml, "", requestData)
+				err = a.executeTemplate(w, r, fullHtml, "", requestData)
 			}
 		}
 
@@ -491,7 +500,7 @@ func (a *App) handleResponse(retStruct *starlarkstruct.Struct, r *http.Request,
 		return true, nil
 	}
 	w.WriteHeader(int(code))
-	err = a.executeTemplate(w, "", templateBlock, requestData)
+	err = a.executeTemplate(w, r, "", templateBlock, requestData)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return true, nil
@@ -499,28 +508,13 @@ func (a *App) handleResponse(retStruct *starlarkstruct.Struct, r *http.Request,
 	return true, nil
 }
 
+// getRemoteIP returns the client IP. The server sets the IP in the context after applying the
+// trusted proxies config, the request remote address is used if that is not set
 func getRemoteIP(r *http.Request) string {
-	header := r.Header
-	remoteIP := types.GetHTTPHeader(header, REAL_IP_HEADER)
-	if remoteIP == "" {
-		remoteIP = types.GetHTTPHeader(header, FORWARDED_HEADER)
-	}
-
-	if remoteIP != "" {
+	if remoteIP := system.GetContextValue(r.Context(), types.REMOTE_IP); remoteIP != "" {
 		return remoteIP
 	}
-
-	if r.RemoteAddr != "" {
-		var ok bool
-		remoteIP, _, ok = strings.Cut(r.RemoteAddr, "]")
-		if ok {
-			// IPv6
-			remoteIP = remoteIP[1:]
-		} else {
-			remoteIP, _, _ = strings.Cut(r.RemoteAddr, ":")
-		}
-	}
-	return remoteIP
+	return system.GetRemoteIP(r, nil)
 }
 
 func (a *App) handleStreamResponse(w http.ResponseWriter, r *http.Request, rtype string, fragment string, streamResponse map[string]any) {
@@ -565,7 +559,7 @@ func (a *App) handleStreamResponse(w http.ResponseWriter, r *http.Request, rtype
 				return
 			}
 		} else if rtype == apptype.HTML_TYPE {
-			err := a.executeTemplate(w, "", fragment, v)
+			err := a.executeTemplate(w, r, "", fragment, v)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -327,7 +327,7 @@ func (a *App) pluginHook(modulePath, accountName, functionName string, pluginInf
 
 					if !isRead {
 						// Write API, check if stage/preview has write access
-						if strings.HasPrefix(string(a.Id), types.ID_PREFIX_APP_STAGE) && !a.Settings.StageWriteAccess {
+						if strings.HasPrefix(string(a.Id), types.ID_PREFIX_APP_STAGE) && !a.Settings.StageWriteAccess && !isCanaryRequest(GetContext(thread)) {
 							return nil, fmt.Errorf("stage app %s is not permitted to call %s.%s args %v. Stage app does not have access to write operations", a.Path, modulePath, functionName, p.Arguments)
 						}
 
@@ -351,6 +351,10 @@ func (a *App) pluginHook(modulePath, accountName, functionName string, pluginInf
 			}
 		}
 
+		if err := a.checkPluginRateLimit(GetContext(thread), modulePath, functionName); err != nil {
+			return nil, err
+		}
+
 		// Get the plugin from the app config
 		plugin, err := a.plugins.GetPlugin(pluginInfo, accountName)
 		if err != nil {
@@ -0,0 +1,214 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	RATE_LIMIT_KEY_USER = "user"
+	RATE_LIMIT_KEY_IP   = "ip"
+	RATE_LIMIT_KEY_APP  = "app"
+
+	// rejections for a key are reported as an audit event at most once per interval
+	rateLimitReportInterval = time.Minute
+)
+
+type tokenBucket struct {
+	tokens       float64
+	lastRefill   time.Time
+	rejected     int // rejections not yet reported
+	lastReported time.Time
+}
+
+// RateLimiter is a token bucket rate limiter, with one bucket per key
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	maxKeys int
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter creates a rate limiter. Returns nil if rate is not positive, which means no limit
+func NewRateLimiter(rate float64, burst int, maxKeys int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow consumes a token for the key. If no token is available, it returns false with the
+// duration after which the next token will be available
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if l.maxKeys > 0 && len(l.buckets) >= l.maxKeys {
+			l.evict(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, lastRefill: now}
+		l.buckets[key] = bucket
+	} else {
+		l.refill(bucket, now)
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	bucket.rejected++
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Rejections returns the number of unreported rejections for the key, if the report interval
+// has passed since the last report. Zero is returned if no report is due
+func (l *RateLimiter) Rejections(key string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok || bucket.rejected == 0 || now.Sub(bucket.lastReported) < rateLimitReportInterval {
+		return 0
+	}
+
+	count := bucket.rejected
+	bucket.rejected = 0
+	bucket.lastReported = now
+	return count
+}
+
+func (l *RateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.lastRefill = now
+	}
+}
+
+// evict removes the buckets which have refilled completely, those are equivalent to a new bucket.
+// If all buckets are in use, the map is reset
+func (l *RateLimiter) evict(now time.Time) {
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst && bucket.rejected == 0 {
+			delete(l.buckets, key)
+		}
+	}
+
+	if len(l.buckets) >= l.maxKeys {
+		l.buckets = map[string]*tokenBucket{}
+	}
+}
+
+// initRateLimiters creates the rate limiters based on the app config
+func (a *App) initRateLimiters() {
+	rateConfig := a.AppConfig.RateLimit
+	a.requestLimiter = NewRateLimiter(rateConfig.RequestsPerSec, rateConfig.RequestBurst, rateConfig.MaxKeys)
+	a.pluginLimiter = NewRateLimiter(rateConfig.PluginCallsPerSec, rateConfig.PluginCallBurst, rateConfig.MaxKeys)
+}
+
+// rateLimitKey returns the key to use for rate limiting the request
+func (a *App) rateLimitKey(r *http.Request) string {
+	switch a.AppConfig.RateLimit.KeyBy {
+	case RATE_LIMIT_KEY_APP:
+		return ""
+	case RATE_LIMIT_KEY_IP:
+		return getRemoteIP(r)
+	default:
+		userId := system.GetContextUserId(r.Context())
+		if userId == "" || userId == types.ANONYMOUS_USER {
+			return getRemoteIP(r)
+		}
+		return userId
+	}
+}
+
+// checkRequestRateLimit checks the request limit. If the limit is exceeded, a 429 response is
+// written and false is returned
+func (a *App) checkRequestRateLimit(w http.ResponseWriter, r *http.Request, key string) bool {
+	if a.requestLimiter == nil {
+		return true
+	}
+
+	now := time.Now()
+	allowed, wait := a.requestLimiter.Allow(key, now)
+	if allowed {
+		return true
+	}
+
+	a.auditRateLimit(a.requestLimiter, system.GetContextRequestId(r.Context()), system.GetContextUserId(r.Context()), key, "request", now)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSecs(wait)))
+	http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
+	return false
+}
+
+// checkPluginRateLimit checks the plugin call limit for the key set in the request context
+func (a *App) checkPluginRateLimit(ctx context.Context, modulePath, functionName string) error {
+	if a.pluginLimiter == nil {
+		return nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	key := system.GetContextValue(ctx, types.RATE_LIMIT_KEY)
+	now := time.Now()
+	allowed, wait := a.pluginLimiter.Allow(key, now)
+	if allowed {
+		return nil
+	}
+
+	a.auditRateLimit(a.pluginLimiter, system.GetContextRequestId(ctx), system.GetContextUserId(ctx), key, "plugin", now)
+	return fmt.Errorf("rate limit exceeded for plugin call %s.%s, retry after %d seconds", modulePath, functionName, retryAfterSecs(wait))
+}
+
+// auditRateLimit inserts an audit event with the count of rejections for the key, at most once per report interval
+func (a *App) auditRateLimit(limiter *RateLimiter, requestId, userId, key, limitType string, now time.Time) {
+	count := limiter.Rejections(key, now)
+	if count == 0 || a.auditInsert == nil {
+		return
+	}
+
+	event := types.AuditEvent{
+		RequestId:  requestId,
+		CreateTime: now,
+		UserId:     userId,
+		AppId:      a.Id,
+		EventType:  types.EventTypeSystem,
+		Operation:  "rate_limit",
+		Target:     key,
+		Status:     string(types.EventStatusFailure),
+		Detail:     fmt.Sprintf("%s rate limit exceeded for key \"%s\", %d requests rejected", limitType, key, count),
+	}
+	if err := a.auditInsert(&event); err != nil {
+		a.Error().Err(err).Msg("error inserting rate limit audit event")
+	}
+}
+
+func retryAfterSecs(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
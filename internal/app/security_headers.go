@@ -0,0 +1,114 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+const CSP_NONCE_PLACEHOLDER = "{nonce}"
+
+// securityHeaders are the headers set by addSecurityHeaders. For proxied responses, the value set
+// by the upstream takes precedence over the app config
+var securityHeaders = []string{
+	"Strict-Transport-Security",
+	"X-Frame-Options",
+	"Referrer-Policy",
+	"X-Content-Type-Options",
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+}
+
+// securityHeadersKey is the context key for the security headers to be added to the proxied response
+type securityHeadersKey struct{}
+
+// addSecurityHeaders adds the security headers as per the app config. If the CSP config uses
+// a nonce, a new nonce is generated and saved in the request context
+func (a *App) addSecurityHeaders(w http.ResponseWriter, r *http.Request) *http.Request {
+	headers := a.AppConfig.Headers
+	header := w.Header()
+	if headers.HSTS != "" && r.TLS != nil {
+		header.Set("Strict-Transport-Security", headers.HSTS)
+	}
+	if headers.FrameOptions != "" {
+		header.Set("X-Frame-Options", headers.FrameOptions)
+	}
+	if headers.ReferrerPolicy != "" {
+		header.Set("Referrer-Policy", headers.ReferrerPolicy)
+	}
+	if headers.ContentTypeOptions != "" {
+		header.Set("X-Content-Type-Options", headers.ContentTypeOptions)
+	}
+
+	if headers.CSP == "" {
+		return r
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if headers.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	if !strings.Contains(headers.CSP, CSP_NONCE_PLACEHOLDER) {
+		header.Set(cspHeader, headers.CSP)
+		return r
+	}
+
+	nonce, err := genNonce()
+	if err != nil {
+		a.Error().Err(err).Msg("error generating CSP nonce")
+		// Set the policy with the placeholder, scripts using the nonce will be blocked
+		header.Set(cspHeader, headers.CSP)
+		return r
+	}
+	header.Set(cspHeader, strings.ReplaceAll(headers.CSP, CSP_NONCE_PLACEHOLDER, nonce))
+	return r.WithContext(context.WithValue(r.Context(), types.CSP_NONCE, nonce))
+}
+
+// deferSecurityHeaders removes the security headers from the response and saves them in the request
+// context. They are added to the proxied response by addUpstreamSecurityHeaders, unless the upstream
+// has set the same header
+func deferSecurityHeaders(w http.ResponseWriter, r *http.Request) *http.Request {
+	header := w.Header()
+	deferred := http.Header{}
+	for _, name := range securityHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			deferred[name] = values
+			header.Del(name)
+		}
+	}
+	if len(deferred) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), securityHeadersKey{}, deferred))
+}
+
+// addUpstreamSecurityHeaders adds the security headers saved by deferSecurityHeaders to the proxied
+// response, skipping the headers already set by the upstream
+func addUpstreamSecurityHeaders(res *http.Response) error {
+	deferred, ok := res.Request.Context().Value(securityHeadersKey{}).(http.Header)
+	if !ok {
+		return nil
+	}
+	for name, values := range deferred {
+		if res.Header.Get(name) == "" {
+			res.Header[name] = values
+		}
+	}
+	return nil
+}
+
+func genNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -5,6 +5,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -556,7 +557,7 @@ func (a *App) addAction(count int, val starlark.Value, router *chi.Mux) (err err
 	}
 	action, err := action.NewAction(a.Logger, a.sourceFS, a.IsDev, name, description, path, run, suggest,
 		slices.Collect(maps.Values(a.paramInfo)), a.paramValuesStr, a.paramDict, a.Path, a.appStyle.GetStyleType(),
-		containerProxyUrl, hidden, showValidate, a.auditInsert, a.containerManager, a.jsLibs)
+		containerProxyUrl, hidden, showValidate, a.auditInsert, a.containerManager, a.jsLibs, a.AppConfig.Security.CsrfProtection)
 	if err != nil {
 		return fmt.Errorf("error creating action %s: %w", name, err)
 	}
@@ -672,7 +673,7 @@ func (a *App) addRoute(count int, router *chi.Mux, routeVal starlark.Value, defa
 		}
 	}
 
-	handlerFunc := a.createHandlerFunc(htmlFile, blockStr, handler, apptype.HTML_TYPE)
+	handlerFunc := a.createHandlerFunc(htmlFile, blockStr, handler, apptype.HTML_TYPE, true)
 	if err = a.handleFragments(router, pathStr, count, htmlFile, blockStr, pageDef, handler); err != nil {
 		return rootWildcard, err
 	}
@@ -734,6 +735,9 @@ func getProxyConfig(count int, proxyDef *starlarkstruct.Struct) (starlark.HasAtt
 	return configAttr, nil
 }
 
+// proxyTargetKey is the context key for the container replica url the request is proxied to
+type proxyTargetKey struct{}
+
 func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruct.Struct) (bool, error) {
 	var err error
 	var pathStr string
@@ -776,12 +780,14 @@ func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruc
 		return rootWildcard, err
 	}
 
+	containerProxy := false
 	if urlStr == apptype.CONTAINER_URL {
 		// proxying to container url
 		if a.containerManager == nil {
 			return rootWildcard, fmt.Errorf("container manager not initialized")
 		}
 
+		containerProxy = true
 		urlStr = a.containerManager.GetProxyUrl()
 	}
 
@@ -800,10 +806,18 @@ func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruc
 	customTransport.IdleConnTimeout = time.Duration(a.AppConfig.Proxy.IdleConnTimeoutSecs) * time.Second
 	customTransport.DisableCompression = a.AppConfig.Proxy.DisableCompression
 	proxy.Transport = customTransport
+	proxy.ModifyResponse = addUpstreamSecurityHeaders
 
 	defaultDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
 		defaultDirector(req)
+		targetHost := urlParsed.Host
+		if target, ok := req.Context().Value(proxyTargetKey{}).(*url.URL); ok {
+			// Container replica selected by the load balancer
+			req.URL.Host = target.Host
+			targetHost = target.Host
+		}
+
 		// To support WebSockets, we need to ensure that the `Connection`, `Upgrade`
 		// and `Host` headers are forwarded as-is and not modified.
 		if req.Header.Get("Upgrade") == "websocket" {
@@ -812,7 +826,7 @@ func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruc
 		} else if !preserveHost {
 			// Set the Host header to target url for non-WebSocket requests, unless
 			// disabled in proxy config
-			req.Host = urlParsed.Host
+			req.Host = targetHost
 		}
 	}
 
@@ -824,20 +838,23 @@ func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruc
 				if strings.HasPrefix(string(a.Id), types.ID_PREFIX_APP_PREVIEW) && !a.Settings.PreviewWriteAccess {
 					http.Error(w, "Preview app does not have access to proxy write APIs", http.StatusInternalServerError)
 					return
-				} else if strings.HasPrefix(string(a.Id), types.ID_PREFIX_APP_STAGE) && !a.Settings.StageWriteAccess {
+				} else if strings.HasPrefix(string(a.Id), types.ID_PREFIX_APP_STAGE) && !a.Settings.StageWriteAccess && !isCanaryRequest(r.Context()) {
 					http.Error(w, "Stage app does not have access to proxy write APIs", http.StatusInternalServerError)
 					return
 				}
 			}
 
+			// The upstream security headers take precedence over the app config
+			r = deferSecurityHeaders(w, r)
+
 			r.Header.Set("X-Forwarded-Host", strings.SplitN(r.Host, ":", 1)[0])
 			if r.TLS != nil {
 				r.Header.Set("X-Forwarded-Proto", "https")
 			} else {
 				r.Header.Set("X-Forwarded-Proto", "http")
 			}
-			if a.Path != "" && a.Path != "/" {
-				r.Header.Set("X-Forwarded-Prefix", a.Path)
+			if appPath := a.requestAppPath(r); appPath != "" && appPath != "/" {
+				r.Header.Set("X-Forwarded-Prefix", appPath)
 			}
 
 			// Set the response headers
@@ -855,6 +872,16 @@ func (a *App) addProxyConfig(count int, router *chi.Mux, proxyDef *starlarkstruc
 				w.Header().Set(key, valueStr)
 			}
 
+			if containerProxy {
+				target, release, err := a.containerManager.AcquireProxyUrl()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				defer release()
+				r = r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, target))
+			}
+
 			// use the reverse proxy to handle the request
 			p.ServeHTTP(w, r)
 		})
@@ -881,6 +908,11 @@ func (a *App) addAPIRoute(basePath string, router *chi.Mux, apiDef *starlarkstru
 		return err
 	}
 
+	var csrfCheck bool
+	if csrfCheck, err = apptype.GetBoolAttr(apiDef, "csrf"); err != nil {
+		return err
+	}
+
 	var ok bool
 	handler := defaultHandler // Use app level default handler, which could also be nil
 	handlerAttr, _ := apiDef.Attr("handler")
@@ -890,7 +922,7 @@ func (a *App) addAPIRoute(basePath string, router *chi.Mux, apiDef *starlarkstru
 		}
 	}
 
-	handlerFunc := a.createHandlerFunc("", "", handler, rtype)
+	handlerFunc := a.createHandlerFunc("", "", handler, rtype, csrfCheck)
 
 	fullPath := pathStr
 	if basePath != "" {
@@ -959,7 +991,7 @@ func (a *App) handleFragments(router *chi.Mux, pagePath string, pageCount int, h
 				return fmt.Errorf("handler for page %d fragment %d is not a function", pageCount, count)
 			}
 		}
-		handlerFunc := a.createHandlerFunc(htmlFile, blockStr, fragmentCallback, apptype.HTML_TYPE)
+		handlerFunc := a.createHandlerFunc(htmlFile, blockStr, fragmentCallback, apptype.HTML_TYPE, true)
 
 		fragmentPath := path.Join(pagePath, pathStr)
 		a.Trace().Msgf("Adding fragment route %s <%s>", methodStr, fragmentPath)
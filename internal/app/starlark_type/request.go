@@ -28,6 +28,8 @@ type Request struct {
 	HtmxVersion string
 	Headers     http.Header
 	RemoteIP    string
+	CsrfToken   string
+	CspNonce    string
 	UrlParams   map[string]string
 	Form        url.Values
 	Query       url.Values
@@ -61,6 +63,10 @@ func (r Request) Attr(name string) (starlark.Value, error) {
 		return MarshalStarlark(r.Headers)
 	case "RemoteIP":
 		return starlark.String(r.RemoteIP), nil
+	case "CsrfToken":
+		return starlark.String(r.CsrfToken), nil
+	case "CspNonce":
+		return starlark.String(r.CspNonce), nil
 	case "UrlParams":
 		return MarshalStarlark(r.UrlParams)
 	case "Form":
@@ -77,7 +83,7 @@ func (r Request) Attr(name string) (starlark.Value, error) {
 }
 
 func (r Request) AttrNames() []string {
-	return []string{"AppName", "AppPath", "AppUrl", "PagePath", "PageUrl", "Method", "IsDev", "IsPartial", "PushEvents", "HtmxVersion", "Headers", "RemoteIP", "UrlParams", "Form", "Query", "PostForm", "Data"}
+	return []string{"AppName", "AppPath", "AppUrl", "PagePath", "PageUrl", "Method", "IsDev", "IsPartial", "PushEvents", "HtmxVersion", "Headers", "RemoteIP", "CsrfToken", "CspNonce", "UrlParams", "Form", "Query", "PostForm", "Data"}
 }
 
 func (r Request) String() string {
@@ -4,14 +4,17 @@
 package app_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/claceio/clace/internal/app/apptype"
 	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
 )
 
 func TestAppLoadError(t *testing.T) {
@@ -715,3 +718,174 @@ app = ace.app("testApp", routes = [ace.api("/t1", t1, type=ace.TEXT), ace.api("/
 	testutil.AssertEqualsInt(t, "code", 200, response.Code)
 	testutil.AssertEqualsString(t, "body", "$SHELL", response.Body.String())
 }
+
+func TestRateLimit(t *testing.T) {
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+app = ace.app("testApp", custom_layout=True, routes = [ace.html("/")])
+
+def handler(req):
+	return {"key": "myvalue"}
+		`,
+		"index.go.html": `Template got {{ .Data.key }}.`,
+	}
+	a, _, err := CreateTestAppConfig(logger, fileData, types.AppConfig{
+		RateLimit: types.RateLimit{RequestsPerSec: 0.01, RequestBurst: 2, KeyBy: "ip"},
+	})
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/test", nil)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+		a.ServeHTTP(response, request)
+		return response
+	}
+
+	testutil.AssertEqualsInt(t, "code", 200, serve("10.0.0.1:1234").Code)
+	testutil.AssertEqualsInt(t, "code", 200, serve("10.0.0.1:1234").Code)
+	response := serve("10.0.0.1:1234")
+	testutil.AssertEqualsInt(t, "code", 429, response.Code)
+	testutil.AssertEqualsString(t, "retry after", "100", response.Header().Get("Retry-After"))
+
+	// Different remote ip has its own bucket
+	testutil.AssertEqualsInt(t, "code", 200, serve("10.0.0.2:1234").Code)
+}
+
+func TestCsrf(t *testing.T) {
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+app = ace.app("testApp", custom_layout=True, routes = [ace.html("/", fragments=[ace.fragment("frag", method="POST")]),
+	ace.api("/api", method="POST"), ace.api("/noapi", method="POST", csrf=False)])
+
+def handler(req):
+	return {"key": "myvalue"}
+		`,
+		"index.go.html": `Token {{ .CsrfToken }}. {{ csrfField .CsrfToken }} {{ block "frag" . }}frag {{ .Data.key }}{{ end }}`,
+	}
+	a, _, err := CreateTestAppConfig(logger, fileData, types.AppConfig{
+		Security: types.Security{CsrfProtection: true},
+	})
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+
+	request := httptest.NewRequest("GET", "/test", nil)
+	response := httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	cookies := response.Result().Cookies()
+	testutil.AssertEqualsInt(t, "cookies", 1, len(cookies))
+	token := cookies[0].Value
+	testutil.AssertStringContains(t, response.Body.String(), "Token "+token+".")
+	testutil.AssertStringContains(t, response.Body.String(), `<input type="hidden" name="_csrf" value="`+token+`" />`)
+
+	post := func(path, headerToken, cookieToken string, header map[string]string) int {
+		request := httptest.NewRequest("POST", path, nil)
+		if headerToken != "" {
+			request.Header.Set("X-CSRF-Token", headerToken)
+		}
+		if cookieToken != "" {
+			request.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: cookieToken})
+		}
+		for k, v := range header {
+			request.Header.Set(k, v)
+		}
+		response := httptest.NewRecorder()
+		a.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	testutil.AssertEqualsInt(t, "no token", 403, post("/test/frag", "", token, nil))
+	testutil.AssertEqualsInt(t, "token mismatch", 403, post("/test/frag", "abc", token, nil))
+	testutil.AssertEqualsInt(t, "no cookie", 403, post("/test/frag", token, "", nil))
+	testutil.AssertEqualsInt(t, "valid token", 200, post("/test/frag", token, token, nil))
+	testutil.AssertEqualsInt(t, "same origin", 200, post("/test/frag", "", "", map[string]string{"Sec-Fetch-Site": "same-origin"}))
+	testutil.AssertEqualsInt(t, "cross site", 403, post("/test/frag", "", "", map[string]string{"Sec-Fetch-Site": "cross-site"}))
+	testutil.AssertEqualsInt(t, "api no token", 403, post("/test/api", "", "", nil))
+	testutil.AssertEqualsInt(t, "api bearer", 403, post("/test/api", "", "", map[string]string{"Authorization": "Bearer abc"}))
+	testutil.AssertEqualsInt(t, "api opt out", 200, post("/test/noapi", "", "", nil))
+	testutil.AssertEqualsInt(t, "html bearer", 403, post("/test/frag", "", "", map[string]string{"Authorization": "Bearer abc"}))
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+app = ace.app("testApp", custom_layout=True, routes = [ace.html("/")])
+
+def handler(req):
+	return {"key": "myvalue"}
+		`,
+		"index.go.html": `<script nonce="{{ .CspNonce }}"></script>`,
+	}
+	a, _, err := CreateTestAppConfig(logger, fileData, types.AppConfig{
+		Headers: types.SecurityHeaders{
+			HSTS:           "max-age=100",
+			FrameOptions:   "DENY",
+			ReferrerPolicy: "no-referrer",
+			CSP:            "script-src 'nonce-{nonce}'",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+
+	request := httptest.NewRequest("GET", "/test", nil)
+	response := httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	testutil.AssertEqualsString(t, "hsts", "", response.Header().Get("Strict-Transport-Security")) // not https
+	testutil.AssertEqualsString(t, "frame", "DENY", response.Header().Get("X-Frame-Options"))
+	testutil.AssertEqualsString(t, "referrer", "no-referrer", response.Header().Get("Referrer-Policy"))
+
+	csp := response.Header().Get("Content-Security-Policy")
+	nonce := strings.TrimSuffix(strings.TrimPrefix(csp, "script-src 'nonce-"), "'")
+	if nonce == "" || nonce == "{nonce}" {
+		t.Fatalf("nonce not set in CSP: %s", csp)
+	}
+	testutil.AssertEqualsString(t, "body", `<script nonce="`+nonce+`"></script>`, response.Body.String())
+
+	// Static files get the headers also
+	request = httptest.NewRequest("GET", "/test/static/file.txt", nil)
+	response = httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsString(t, "frame", "DENY", response.Header().Get("X-Frame-Options"))
+}
+
+func TestVerify(t *testing.T) {
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+def handler(req):
+	return {"key": "myvalue"}
+
+def fail(req):
+	return ace.response({"key": "myvalue"}, "data", code=500)
+
+app = ace.app("testApp", custom_layout=True, routes = [ace.html("/"), ace.api("/health"), ace.html("/fail", handler=fail)])
+		`,
+		"index.go.html": `Template got {{ block "data" . }}{{ .Data.key }}{{ end }}.`,
+	}
+
+	verify := func(route string) error {
+		a, _, err := CreateTestAppConfig(logger, fileData, types.AppConfig{
+			Verify: types.Verify{Enabled: true, Route: route, Attempts: 1},
+		})
+		if err != nil {
+			t.Fatalf("Error %s", err)
+		}
+		return a.Verify(context.Background())
+	}
+
+	testutil.AssertNoError(t, verify(""))
+	testutil.AssertNoError(t, verify("/"))
+	testutil.AssertNoError(t, verify("/health"))
+	testutil.AssertErrorContains(t, verify("/fail"), "verify route /test/fail returned status 500")
+	testutil.AssertErrorContains(t, verify("/missing"), "verify route /test/missing returned status 404")
+}
@@ -4,6 +4,7 @@
 package app_test
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -94,6 +95,54 @@ def handler(req):
 	testutil.AssertEqualsString(t, "body", `value`, ret["key8"].(map[string]any)["key"].(string))
 }
 
+func TestPluginStageWriteCanary(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "test contents")
+	}))
+
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+load ("http.in", "http")
+app = ace.app("testApp", custom_layout=True, routes = [ace.api("/")],
+    permissions=[
+	ace.permission("http.in", "post", type=ace.WRITE),
+	])
+
+def handler(req):
+	resp = http.post("` + testServer.URL + `")
+	return {"key": resp.value.body()}
+`,
+	}
+
+	isRead := false
+	a, _, err := CreateTestAppPluginId(logger, fileData, []string{"http.in"},
+		[]types.Permission{
+			{Plugin: "http.in", Method: "post", IsRead: &isRead},
+		}, nil, "app_stg_testapp", types.AppSettings{})
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	a.MainApp = "app_prd_testapp"
+
+	// Write calls are blocked for the stage app
+	request := httptest.NewRequest("GET", "/test", nil)
+	response := httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsInt(t, "code", 500, response.Code)
+	testutil.AssertStringContains(t, response.Body.String(), "Stage app does not have access to write operations")
+
+	// Canary requests for the prod app are allowed
+	request = httptest.NewRequest("GET", "/test", nil)
+	request = request.WithContext(context.WithValue(request.Context(), types.CANARY_PROD_PATH, "/prod"))
+	response = httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	ret := make(map[string]any)
+	json.NewDecoder(response.Body).Decode(&ret)
+	testutil.AssertEqualsString(t, "body", "test contents", ret["key"].(string))
+}
+
 func TestSecretsConfig(t *testing.T) {
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "test contents")
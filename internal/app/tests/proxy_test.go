@@ -4,6 +4,7 @@
 package app_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -390,6 +391,15 @@ permissions=[
 	testutil.AssertEqualsInt(t, "code", 500, response.Code)
 	testutil.AssertEqualsString(t, "body", "Stage app does not have access to proxy write APIs\n", response.Body.String())
 
+	// Canary requests for the prod app are allowed
+	request = httptest.NewRequest("POST", "/test/abc", nil)
+	request = request.WithContext(context.WithValue(request.Context(), types.CANARY_PROD_PATH, "/prod"))
+	response = httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	testutil.AssertEqualsString(t, "body", "test contents", response.Body.String())
+
 	// Enable write access
 	a.Settings.StageWriteAccess = true
 
@@ -653,3 +663,45 @@ permissions=[
 	testutil.AssertEqualsString(t, "header", "NEWVAL", response.Header().Get("NEWH"))
 	testutil.AssertEqualsString(t, "header", "aa/abc/defbb", response.Header().Get("NEWTEMP"))
 }
+
+func TestProxySecurityHeaders(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "origin")
+		io.WriteString(w, "test contents")
+	}))
+
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": fmt.Sprintf(`
+load("proxy.in", "proxy")
+
+app = ace.app("testApp", routes = [ace.proxy("/", proxy.config("%s"))],
+permissions=[
+	ace.permission("proxy.in", "config"),
+]
+)`, testServer.URL),
+	}
+
+	a, _, err := CreateTestAppPlugin(logger, fileData, []string{"proxy.in"},
+		[]types.Permission{
+			{Plugin: "proxy.in", Method: "config"},
+		}, map[string]types.PluginSettings{})
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	a.AppConfig.Headers = types.SecurityHeaders{
+		ReferrerPolicy:     "no-referrer",
+		ContentTypeOptions: "nosniff",
+	}
+
+	request := httptest.NewRequest("GET", "/test/abc", nil)
+	response := httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	testutil.AssertEqualsString(t, "body", "test contents", response.Body.String())
+	// The upstream header is used, the app config is used for headers not set by the upstream
+	testutil.AssertEqualsInt(t, "referrer count", 1, len(response.Header().Values("Referrer-Policy")))
+	testutil.AssertEqualsString(t, "referrer", "origin", response.Header().Get("Referrer-Policy"))
+	testutil.AssertEqualsString(t, "content type options", "nosniff", response.Header().Get("X-Content-Type-Options"))
+}
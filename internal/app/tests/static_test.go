@@ -4,10 +4,12 @@
 package app_test
 
 import (
+	"context"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
 )
 
 func TestStaticLoad(t *testing.T) {
@@ -326,3 +328,38 @@ def handler(req):
 	_, _, err := CreateTestApp(logger, fileData)
 	testutil.AssertErrorContains(t, err, "static_only app cannot have HTML routes")
 }
+
+func TestStaticCanary(t *testing.T) {
+	logger := testutil.TestLogger()
+	fileData := map[string]string{
+		"app.star": `
+app = ace.app("testApp", custom_layout=True, routes = [ace.html("/")])
+
+def handler(req):
+	return {"key": "myvalue"}`,
+		"index.go.html": `{{.AppPath}} {{.PagePath}} {{static "file1"}}`,
+		"static/file1":  `file1data`,
+	}
+
+	a, _, err := CreateTestAppInt(logger, "/test_cl_stage", fileData, false, nil, nil, nil, "app_stg_testapp", types.AppSettings{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+
+	// Direct request to the stage app
+	request := httptest.NewRequest("GET", "/test_cl_stage", nil)
+	response := httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	want := `/test_cl_stage /test_cl_stage /test_cl_stage/static/file1-ca9e40772ef9119c13100a8258bc38a665a0a1976bf81c96e69a353b6605f5a7`
+	testutil.AssertStringMatch(t, "body", want, response.Body.String())
+
+	// Canary request for the prod app served by the stage app, urls use the prod path
+	request = httptest.NewRequest("GET", "/test_cl_stage", nil)
+	request = request.WithContext(context.WithValue(request.Context(), types.CANARY_PROD_PATH, "/test"))
+	response = httptest.NewRecorder()
+	a.ServeHTTP(response, request)
+	testutil.AssertEqualsInt(t, "code", 200, response.Code)
+	want = `/test /test /test/static/file1-ca9e40772ef9119c13100a8258bc38a665a0a1976bf81c96e69a353b6605f5a7`
+	testutil.AssertStringMatch(t, "body", want, response.Body.String())
+}
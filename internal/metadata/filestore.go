@@ -11,6 +11,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"slices"
@@ -200,6 +201,22 @@ func (f *FileStore) GetFileBySha(ctx context.Context, tx types.Transaction, sha
 	return content, compressionType, nil
 }
 
+// GetFileContent returns the uncompressed contents of the file with the given sha
+func (f *FileStore) GetFileContent(ctx context.Context, tx types.Transaction, sha string) ([]byte, error) {
+	fileBytes, compressionType, err := f.GetFileBySha(ctx, tx, sha)
+	if err != nil {
+		return nil, err
+	}
+	if compressionType == "" {
+		return fileBytes, nil
+	}
+	if compressionType != appfs.COMPRESSION_TYPE {
+		return nil, fmt.Errorf("unsupported compression type: %s", compressionType)
+	}
+
+	return io.ReadAll(brotli.NewReader(bytes.NewReader(fileBytes)))
+}
+
 func (f *FileStore) getFileInfoTx() (map[string]DbFileInfo, error) {
 	var tx types.Transaction
 	if f.initTx.IsInitialized() {
@@ -361,6 +378,20 @@ func (f *FileStore) GetAppVersion(ctx context.Context, tx types.Transaction, ver
 	return &v, nil
 }
 
+// DeleteAppVersions deletes the specified versions of the app, with their file entries. The file
+// contents are not deleted, DeleteUnusedFiles should be called to clean up unreferenced files
+func (f *FileStore) DeleteAppVersions(ctx context.Context, tx types.Transaction, versions []int) error {
+	for _, version := range versions {
+		if _, err := tx.ExecContext(ctx, system.RebindQuery(f.metadata.dbType, `delete from app_files where appid = ? and version = ?`), f.appId, version); err != nil {
+			return fmt.Errorf("error deleting app files: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, system.RebindQuery(f.metadata.dbType, `delete from app_versions where appid = ? and version = ?`), f.appId, version); err != nil {
+			return fmt.Errorf("error deleting app version: %w", err)
+		}
+	}
+	return nil
+}
+
 func (f *FileStore) GetAppFiles(ctx context.Context, tx types.Transaction) ([]types.AppFile, error) {
 	files, err := f.getFileInfo(ctx, tx)
 	if err != nil {
@@ -21,7 +21,7 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-const CURRENT_DB_VERSION = 5
+const CURRENT_DB_VERSION = 6
 
 // Metadata is the metadata persistence layer
 type Metadata struct {
@@ -213,6 +213,20 @@ func (m *Metadata) VersionUpgrade(config *types.ServerConfig) error {
 		}
 	}
 
+	if version < 6 {
+		m.Info().Msg("Upgrading to version 6")
+		if _, err := tx.ExecContext(ctx, `create table sessions(id text, user_id text, provider text, remote_ip text, create_time `+system.MapDataType(m.dbType, "datetime")+", last_seen "+system.MapDataType(m.dbType, "datetime")+", PRIMARY KEY(id))"); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `create index sessions_user_idx on sessions(user_id)`); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `update version set version=6, last_upgraded=`+system.FuncNow(m.dbType)); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -317,15 +331,33 @@ func (m *Metadata) DeleteApp(ctx context.Context, tx types.Transaction, id types
 		return fmt.Errorf("error deleting apps : %w", err)
 	}
 
-	// Clean up unused files. This can be done more aggressively, when older versions are deleted.
-	// Currently done only when an app is deleted. This cleanup is across apps, not just the deleted app.
-	if _, err := tx.ExecContext(ctx, system.RebindQuery(m.dbType, `delete from files where sha not in (select distinct sha from app_files)`)); err != nil {
+	// Clean up unused files. This cleanup is across apps, not just the deleted app.
+	if _, _, err := m.DeleteUnusedFiles(ctx, tx); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// DeleteUnusedFiles deletes the file contents which are not referenced by any app version.
+// Returns the number of files deleted and the stored size of the deleted files
+func (m *Metadata) DeleteUnusedFiles(ctx context.Context, tx types.Transaction) (int, int64, error) {
+	row := tx.QueryRowContext(ctx, `select count(*), coalesce(sum(length(content)), 0) from files where sha not in (select distinct sha from app_files)`)
+	var count int
+	var size int64
+	if err := row.Scan(&count, &size); err != nil {
+		return 0, 0, fmt.Errorf("error querying unused files: %w", err)
+	}
+	if count == 0 {
+		return 0, 0, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from files where sha not in (select distinct sha from app_files)`); err != nil {
+		return 0, 0, fmt.Errorf("error deleting unused files: %w", err)
+	}
+	return count, size, nil
+}
+
 func (m *Metadata) GetAppsForDomain(domain string) ([]string, error) {
 	stmt, err := m.db.Prepare(system.RebindQuery(m.dbType, `select path from apps where domain = ?`))
 	if err != nil {
@@ -619,10 +651,111 @@ func (m *Metadata) UpdateSyncStatus(ctx context.Context, tx types.Transaction, i
 	return nil
 }
 
+// CreateSession adds a server side entry for a new SSO session
+func (m *Metadata) CreateSession(ctx context.Context, session *types.SessionEntry) error {
+	_, err := m.db.ExecContext(ctx, system.RebindQuery(m.dbType, `INSERT into sessions(id, user_id, provider, remote_ip, create_time, last_seen) values(?, ?, ?, ?, `+
+		system.FuncNow(m.dbType)+", "+system.FuncNow(m.dbType)+")"), session.Id, session.UserId, session.Provider, session.RemoteIP)
+	if err != nil {
+		return fmt.Errorf("error inserting session: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns the session entry for the given id, nil if the session is not found (revoked or expired)
+func (m *Metadata) GetSession(ctx context.Context, id string) (*types.SessionEntry, error) {
+	row := m.db.QueryRowContext(ctx, system.RebindQuery(m.dbType, `select id, user_id, provider, remote_ip, create_time, last_seen from sessions where id = ?`), id)
+	var session types.SessionEntry
+	err := row.Scan(&session.Id, &session.UserId, &session.Provider, &session.RemoteIP, &session.CreateTime, &session.LastSeen)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error querying session: %w", err)
+	}
+	return &session, nil
+}
+
+// UpdateSessionLastSeen updates the last seen time and remote ip for the session
+func (m *Metadata) UpdateSessionLastSeen(ctx context.Context, id string, remoteIP string) error {
+	_, err := m.db.ExecContext(ctx, system.RebindQuery(m.dbType, `UPDATE sessions set last_seen = `+system.FuncNow(m.dbType)+`, remote_ip = ? where id = ?`), remoteIP, id)
+	if err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return nil
+}
+
+// GetSessions returns the sessions for the given user, all sessions if user is empty
+func (m *Metadata) GetSessions(ctx context.Context, userId string) ([]*types.SessionEntry, error) {
+	query := `select id, user_id, provider, remote_ip, create_time, last_seen from sessions`
+	args := []any{}
+	if userId != "" {
+		query += ` where user_id = ?`
+		args = append(args, userId)
+	}
+	query += ` order by last_seen desc`
+
+	rows, err := m.db.QueryContext(ctx, system.RebindQuery(m.dbType, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*types.SessionEntry, 0)
+	for rows.Next() {
+		var session types.SessionEntry
+		if err := rows.Scan(&session.Id, &session.UserId, &session.Provider, &session.RemoteIP, &session.CreateTime, &session.LastSeen); err != nil {
+			return nil, fmt.Errorf("error querying sessions: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes the session with the given id
+func (m *Metadata) DeleteSession(ctx context.Context, id string) error {
+	_, err := m.db.ExecContext(ctx, system.RebindQuery(m.dbType, `delete from sessions where id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes the sessions which are older than maxAge seconds or which have
+// been idle for more than idleTimeout seconds. Zero values disable the corresponding check
+func (m *Metadata) DeleteExpiredSessions(ctx context.Context, maxAge, idleTimeout int) error {
+	conditions := []string{}
+	if maxAge > 0 {
+		conditions = append(conditions, "create_time < "+m.timeBefore(maxAge))
+	}
+	if idleTimeout > 0 {
+		conditions = append(conditions, "last_seen < "+m.timeBefore(idleTimeout))
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	_, err := m.db.ExecContext(ctx, `delete from sessions where `+strings.Join(conditions, " or "))
+	if err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return nil
+}
+
+// timeBefore returns the db expression for the current time minus the given seconds
+func (m *Metadata) timeBefore(seconds int) string {
+	if m.dbType == system.DB_TYPE_POSTGRES {
+		return fmt.Sprintf("now() - interval '%d seconds'", seconds)
+	}
+	return fmt.Sprintf("datetime('now', '-%d seconds')", seconds)
+}
+
 // BeginTransaction starts a new Transaction
 func (m *Metadata) BeginTransaction(ctx context.Context) (types.Transaction, error) {
 	tx, err := m.db.BeginTx(ctx, nil)
-	return types.Transaction{Tx: tx}, err
+	return types.Transaction{Tx: tx, Promoted: map[types.AppPathDomain]int{}}, err
 }
 
 // CommitTransaction commits a transaction
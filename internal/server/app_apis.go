@@ -10,11 +10,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/claceio/clace/internal/app"
@@ -155,7 +157,7 @@ func (s *Server) CreateAppTx(ctx context.Context, currentTx types.Transaction, a
 	appEntry.Metadata.AppConfig = appRequest.AppConfig
 	appEntry.UserID = system.GetContextUserId(ctx)
 
-	auditResult, err := s.createApp(ctx, currentTx, &appEntry, approve, dryRun, appRequest.GitBranch, appRequest.GitCommit, appRequest.GitAuthName, appRequest, repoCache)
+	auditResult, err := s.createApp(ctx, currentTx, &appEntry, approve, dryRun, appRequest.GitBranch, appRequest.GitTag, appRequest.GitCommit, appRequest.GitAuthName, appRequest, repoCache)
 	if err != nil {
 		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
 	}
@@ -164,7 +166,7 @@ func (s *Server) CreateAppTx(ctx context.Context, currentTx types.Transaction, a
 }
 
 func (s *Server) createApp(ctx context.Context, tx types.Transaction,
-	appEntry *types.AppEntry, approve, dryRun bool, branch, commit, gitAuth string, applyInfo *types.CreateAppRequest, repoCache *RepoCache) (*types.AppCreateResponse, error) {
+	appEntry *types.AppEntry, approve, dryRun bool, branch, tag, commit, gitAuth string, applyInfo *types.CreateAppRequest, repoCache *RepoCache) (*types.AppCreateResponse, error) {
 	if system.IsGit(appEntry.SourceUrl) {
 		if appEntry.IsDev {
 			return nil, fmt.Errorf("cannot create dev mode app from git source. For dev mode, manually checkout the git repo and create app from the local path")
@@ -235,9 +237,9 @@ func (s *Server) createApp(ctx context.Context, tx types.Transaction,
 
 	if system.IsGit(workEntry.SourceUrl) {
 		// Checkout the git repo locally and load into database
-		if err := s.loadSourceFromGit(ctx, tx, workEntry, branch, commit, gitAuth, repoCache); err != nil {
+		if err := s.loadSourceFromGit(ctx, tx, workEntry, branch, tag, commit, gitAuth, repoCache); err != nil {
 			return nil, fmt.Errorf("failed to load source %s from git: %w. Wrong org/repo name can show as auth error."+
-				" Use --git-auth for private repos, --branch to change branch", workEntry.SourceUrl, err)
+				" Use --git-auth for private repos, --branch to change branch, --tag to use a tag", workEntry.SourceUrl, err)
 		}
 	} else if !workEntry.IsDev {
 		// App is loaded from disk (not git) and not in dev mode, load files into DB
@@ -349,7 +351,7 @@ func (s *Server) setupApp(appEntry *types.AppEntry, tx types.Transaction) (*app.
 		})
 	return app.NewApp(sourceFS, workFS, &appLogger, appEntry, &s.config.System,
 		s.config.Plugins, s.config.AppConfig, s.notifyClose, s.secretsManager.AppEvalTemplate,
-		s.InsertAuditEvent, s.config)
+		s.InsertAuditEvent, s.InsertContainerStats, s.config)
 }
 
 func (s *Server) GetAppApi(ctx context.Context, appPath string) (*types.AppGetResponse, error) {
@@ -382,12 +384,7 @@ func (s *Server) GetApp(pathDomain types.AppPathDomain, init bool) (*app.App, er
 	application, err := s.apps.GetApp(pathDomain)
 	if err != nil {
 		// App not found in cache, get from DB
-		appEntry, err := s.db.GetApp(pathDomain)
-		if err != nil {
-			return nil, err
-		}
-
-		application, err = s.setupApp(appEntry, types.Transaction{})
+		application, err = s.loadApp(pathDomain)
 		if err != nil {
 			return nil, err
 		}
@@ -406,6 +403,15 @@ func (s *Server) GetApp(pathDomain types.AppPathDomain, init bool) (*app.App, er
 	return application, nil
 }
 
+// loadApp creates the app from the app entry in the DB, the app is not initialized
+func (s *Server) loadApp(pathDomain types.AppPathDomain) (*app.App, error) {
+	appEntry, err := s.db.GetApp(pathDomain)
+	if err != nil {
+		return nil, err
+	}
+	return s.setupApp(appEntry, types.Transaction{})
+}
+
 func (s *Server) DeleteApps(ctx context.Context, appPathGlob string, dryRun bool) (*types.AppDeleteResponse, error) {
 	filteredApps, err := s.FilterApps(appPathGlob, false)
 	if err != nil {
@@ -449,6 +455,23 @@ func (s *Server) DeleteApps(ctx context.Context, appPathGlob string, dryRun bool
 
 func (s *Server) authenticateAndServeApp(w http.ResponseWriter, r *http.Request, app *app.App) {
 	var err error
+	if app.Settings.Disabled {
+		// App was disabled by an apply prune
+		http.Error(w, "503 App is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	remoteIP := system.GetRemoteIP(r, s.trustedProxies)
+	if !app.IPAllowed(remoteIP) {
+		// IP rules are checked before authentication, applies for apps with no auth also
+		s.Debug().Msgf("Request from %s denied by IP rules for app %s", remoteIP, app.Id)
+		if contextShared := r.Context().Value(types.SHARED); contextShared != nil {
+			contextShared.(*ContextShared).AppId = string(app.Id)
+		}
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
 	appAuth := app.Settings.AuthnType
 	if appAuth == "" || appAuth == types.AppAuthnDefault {
 		appAuth = types.AppAuthnType(s.config.Security.AppDefaultAuthType)
@@ -501,22 +524,28 @@ func (s *Server) authenticateAndServeApp(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
+	// For canary, the stage app is served for some of the users
+	serveApp, r := s.canaryRoute(w, r, app, userId)
+
 	// Create a new context with the user ID
 	s.Trace().Msgf("Authenticated user %s", userId)
 	ctx := context.WithValue(r.Context(), types.USER_ID, userId)
-	ctx = context.WithValue(ctx, types.APP_ID, string(app.Id))
+	ctx = context.WithValue(ctx, types.APP_ID, string(serveApp.Id))
+	ctx = context.WithValue(ctx, types.REMOTE_IP, remoteIP)
 
 	contextShared := ctx.Value(types.SHARED)
 	if contextShared != nil {
 		// allow audit middleware to access the user id
 		cs := contextShared.(*ContextShared)
 		cs.UserId = userId
-		cs.AppId = string(app.Id)
+		cs.AppId = string(serveApp.Id)
+		cs.Canary = app.Settings.Canary.Percent > 0
+		cs.Version = serveApp.Metadata.VersionMetadata.Version
 	}
 	r = r.WithContext(ctx)
 
 	// Authentication successful, serve the app
-	app.ServeHTTP(w, r)
+	serveApp.ServeHTTP(w, r)
 }
 
 // verifyClientCerts verifies the client certificate, whether it is signed by one
@@ -635,24 +664,50 @@ func (s *Server) auditApp(ctx context.Context, tx types.Transaction, app *app.Ap
 }
 
 func (s *Server) CompleteTransaction(ctx context.Context, tx types.Transaction, entries []types.AppPathDomain, dryRun bool, op string) error {
+	_, err := s.completeTransaction(ctx, tx, entries, dryRun, op)
+	return err
+}
+
+// completeTransaction commits the transaction and updates the in memory cache. Prod apps promoted in
+// the transaction are then verified, the verification results are returned
+func (s *Server) completeTransaction(ctx context.Context, tx types.Transaction, entries []types.AppPathDomain, dryRun bool, op string) ([]types.VerifyResult, error) {
+	verifyResults := make([]types.VerifyResult, 0)
 	if dryRun {
-		return nil
+		return verifyResults, nil
 	}
 
 	if tx.Tx != nil { // Used when called in a context where the transaction is handled by the caller
 		if err := tx.Commit(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// Update the in memory cache
 	if entries != nil {
-		if err := s.apps.ClearAppsAudit(ctx, entries, op); err != nil {
-			return err
+		failedResults, err := s.switchApps(ctx, entries, op)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range failedResults {
+			// The new version failed to start and was reverted, it is not verified
+			verifyResults = append(verifyResults, result)
+			delete(tx.Promoted, result.AppPathDomain)
 		}
 	}
 
-	return nil
+	for _, appPathDomain := range slices.SortedFunc(maps.Keys(tx.Promoted), func(a, b types.AppPathDomain) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		verifyResult, err := s.verifyApp(ctx, appPathDomain, op, tx.Promoted[appPathDomain])
+		if err != nil {
+			return nil, err
+		}
+		if verifyResult != nil {
+			verifyResults = append(verifyResults, *verifyResult)
+		}
+	}
+	clear(tx.Promoted)
+	return verifyResults, nil
 }
 
 func (s *Server) getStageApp(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry) (*types.AppEntry, error) {
@@ -752,11 +807,22 @@ func (s *Server) loadGitKey(gitAuth string) (*gitAuthEntry, error) {
 	}, nil
 }
 
-func (s *Server) loadSourceFromGit(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, branch, commit, gitAuth string, repoCache *RepoCache) error {
+func (s *Server) loadSourceFromGit(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, branch, tag, commit, gitAuth string, repoCache *RepoCache) error {
 	gitAuth = cmp.Or(gitAuth, appEntry.Settings.GitAuthName)
-	branch = cmp.Or(branch, appEntry.Metadata.VersionMetadata.GitBranch, "main")
 
-	repo, folder, message, hash, err := repoCache.CheckoutRepo(appEntry.SourceUrl, branch, commit, gitAuth)
+	resolvedTag := ""
+	if commit == "" && tag != "" {
+		// Tag is specified, checkout the matching tag
+		var err error
+		if resolvedTag, _, err = repoCache.ResolveTag(appEntry.SourceUrl, tag, gitAuth); err != nil {
+			return err
+		}
+		branch = ""
+	} else {
+		branch = cmp.Or(branch, appEntry.Metadata.VersionMetadata.GitBranch, "main")
+	}
+
+	repo, folder, message, hash, err := repoCache.CheckoutRepo(appEntry.SourceUrl, branch, resolvedTag, commit, gitAuth)
 	if err != nil {
 		return err
 	}
@@ -765,15 +831,21 @@ func (s *Server) loadSourceFromGit(ctx context.Context, tx types.Transaction, ap
 	// This function will persist it into the app_version metadata
 	appEntry.Metadata.VersionMetadata.GitCommit = hash
 	appEntry.Metadata.VersionMetadata.GitMessage = message
+	appEntry.Metadata.VersionMetadata.GitTag = resolvedTag
 	if commit != "" {
 		appEntry.Metadata.VersionMetadata.GitBranch = ""
+		appEntry.Metadata.VersionMetadata.GitTagPattern = ""
+	} else if tag != "" {
+		appEntry.Metadata.VersionMetadata.GitBranch = ""
+		appEntry.Metadata.VersionMetadata.GitTagPattern = tag
 	} else {
 		appEntry.Metadata.VersionMetadata.GitBranch = branch
+		appEntry.Metadata.VersionMetadata.GitTagPattern = ""
 	}
 	appEntry.Settings.GitAuthName = gitAuth
 
 	s.Info().Msgf("Cloned git repo %s %s:%s folder %s to %s, commit %s: %s", repo,
-		appEntry.Metadata.VersionMetadata.GitBranch, appEntry.Metadata.VersionMetadata.GitCommit, folder, repo, hash, message)
+		cmp.Or(resolvedTag, appEntry.Metadata.VersionMetadata.GitBranch), appEntry.Metadata.VersionMetadata.GitCommit, folder, repo, hash, message)
 	checkoutFolder := repo
 	if folder != "" {
 		checkoutFolder = path.Join(repo, folder)
@@ -802,6 +874,8 @@ func (s *Server) loadSourceFromGit(ctx context.Context, tx types.Transaction, ap
 func (s *Server) loadSourceFromDisk(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry) error {
 	s.Info().Msgf("Loading app sources from %s", appEntry.SourceUrl)
 	appEntry.Metadata.VersionMetadata.GitBranch = ""
+	appEntry.Metadata.VersionMetadata.GitTagPattern = ""
+	appEntry.Metadata.VersionMetadata.GitTag = ""
 	appEntry.Metadata.VersionMetadata.GitCommit = ""
 	appEntry.Settings.GitAuthName = ""
 	appEntry.Metadata.VersionMetadata.GitMessage = ""
@@ -948,7 +1022,7 @@ func (s *Server) PreviewApp(ctx context.Context, mainAppPath, commitId string, a
 	}
 
 	// Checkout the git repo locally and load into database
-	if err := s.loadSourceFromGit(ctx, tx, &previewAppEntry, "", commitId, previewAppEntry.Settings.GitAuthName, repoCache); err != nil {
+	if err := s.loadSourceFromGit(ctx, tx, &previewAppEntry, "", "", commitId, previewAppEntry.Settings.GitAuthName, repoCache); err != nil {
 		return nil, fmt.Errorf("failed to load source %s from git: %w", previewAppEntry.SourceUrl, err)
 	}
 
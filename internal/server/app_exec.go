@@ -0,0 +1,118 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+// ExecApp returns the function which runs the command in the app container, over the connection switched to
+// the exec protocol. The app is initialized if required, so that the container for the current version of
+// the app is used. If interactive is set, the input from the client is passed to the command
+func (s *Server) ExecApp(ctx context.Context, appPath string, replica int, interactive bool, opts container.ExecOptions) (upgradeResponse, error) {
+	appPathDomain, err := parseAppPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+	application, err := s.GetApp(appPathDomain, true)
+	if err != nil {
+		return nil, err
+	}
+	name, err := application.ExecContainerName(replica)
+	if err != nil {
+		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+	}
+
+	// The client switches its terminal to raw mode only if the TTY is allocated
+	opts.Tty = opts.Tty && container.TtySupported(&s.config.System)
+	return func(conn io.ReadWriter) (string, error) {
+		return execSession(ctx, application, name, interactive, opts, conn)
+	}, nil
+}
+
+// execSession runs the exec command. The start frame is sent first, with whether a TTY is allocated. The client
+// sends the input and terminal resize frames, the output frames are sent back, followed by the exit code. The
+// command is cancelled if the client disconnects
+func execSession(ctx context.Context, application *app.App, name container.ContainerName, interactive bool,
+	opts container.ExecOptions, conn io.ReadWriter) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := system.WriteExecFrame(conn, system.ExecStart, []byte(strconv.FormatBool(opts.Tty))); err != nil {
+		return fmt.Sprintf("container %s, cmd %v", name, opts.Cmd), err
+	}
+
+	var lock sync.Mutex
+	opts.Stdout = &system.ExecFrameWriter{W: conn, Type: system.ExecStdout, Lock: &lock}
+	opts.Stderr = &system.ExecFrameWriter{W: conn, Type: system.ExecStderr, Lock: &lock}
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinReader.Close()
+	if interactive {
+		opts.Stdin = stdinReader
+	}
+	resize := make(chan container.TermSize, 1)
+	opts.Resize = resize
+
+	go func() {
+		defer stdinWriter.Close()
+		for {
+			frameType, data, err := system.ReadExecFrame(conn)
+			if err != nil {
+				// Client disconnected, or the session is done
+				cancel()
+				return
+			}
+			switch frameType {
+			case system.ExecStdin:
+				if interactive {
+					_, _ = stdinWriter.Write(data)
+				}
+			case system.ExecStdinClose:
+				stdinWriter.Close()
+			case system.ExecResize:
+				if size, ok := parseTermSize(string(data)); ok {
+					select {
+					case resize <- size:
+					default: // resize pending, drop the update
+					}
+				}
+			}
+		}
+	}()
+
+	exitCode, err := application.ExecContainer(ctx, name, opts)
+	lock.Lock()
+	defer lock.Unlock()
+	if err != nil {
+		_ = system.WriteExecFrame(conn, system.ExecError, []byte(err.Error()))
+		return fmt.Sprintf("container %s, cmd %v", name, opts.Cmd), err
+	}
+	_ = system.WriteExecFrame(conn, system.ExecExit, []byte(strconv.Itoa(exitCode)))
+	return fmt.Sprintf("container %s, cmd %v, exit code %d", name, opts.Cmd, exitCode), nil
+}
+
+// parseTermSize parses the terminal size in "rows cols" format
+func parseTermSize(value string) (container.TermSize, bool) {
+	rowsStr, colsStr, ok := strings.Cut(value, " ")
+	if !ok {
+		return container.TermSize{}, false
+	}
+	rows, rowsErr := strconv.ParseUint(rowsStr, 10, 16)
+	cols, colsErr := strconv.ParseUint(colsStr, 10, 16)
+	if rowsErr != nil || colsErr != nil {
+		return container.TermSize{}, false
+	}
+	return container.TermSize{Rows: uint(rows), Cols: uint(cols)}, true
+}
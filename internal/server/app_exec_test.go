@@ -0,0 +1,71 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestUpgradeConnection(t *testing.T) {
+	detail := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo the input frames as output frames, the input size is returned as the exit code
+		d, err := upgradeConnection(w, r, func(conn io.ReadWriter) (string, error) {
+			total := 0
+			for {
+				frameType, data, err := system.ReadExecFrame(conn)
+				if err != nil {
+					return "", err
+				}
+				if frameType == system.ExecStdinClose {
+					break
+				}
+				total += len(data)
+				if err := system.WriteExecFrame(conn, system.ExecStdout, data); err != nil {
+					return "", err
+				}
+			}
+			return "echo", system.WriteExecFrame(conn, system.ExecExit, []byte(strconv.Itoa(total)))
+		})
+		testutil.AssertNoError(t, err)
+		detail <- d
+	}))
+	defer ts.Close()
+
+	client := system.NewHttpClient(ts.URL, "admin", "", false)
+	conn, err := client.Upgrade("/_clace/app_exec", url.Values{"appPath": {"/test"}}, system.EXEC_PROTOCOL)
+	testutil.AssertNoError(t, err)
+	defer conn.Close()
+
+	testutil.AssertNoError(t, system.WriteExecFrame(conn, system.ExecStdin, []byte("hello")))
+	testutil.AssertNoError(t, system.WriteExecFrame(conn, system.ExecStdinClose, nil))
+	frameType, data, err := system.ReadExecFrame(conn)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(system.ExecStdout), int(frameType))
+	testutil.AssertEqualsString(t, "output", "hello", string(data))
+	frameType, data, err = system.ReadExecFrame(conn)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(system.ExecExit), int(frameType))
+	testutil.AssertEqualsString(t, "exit code", "5", string(data))
+	testutil.AssertEqualsString(t, "detail", "echo", <-detail)
+}
+
+func TestParseTermSize(t *testing.T) {
+	size, ok := parseTermSize("24 80")
+	testutil.AssertEqualsBool(t, "ok", true, ok)
+	testutil.AssertEqualsInt(t, "rows", 24, int(size.Rows))
+	testutil.AssertEqualsInt(t, "cols", 80, int(size.Cols))
+	for _, invalid := range []string{"", "24", "24 x", "-1 80", "24 80 1"} {
+		_, ok = parseTermSize(invalid)
+		testutil.AssertEqualsBool(t, invalid, false, ok)
+	}
+}
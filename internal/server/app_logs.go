@@ -0,0 +1,169 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// logTarget is an app container whose logs are streamed
+type logTarget struct {
+	appPathDomain types.AppPathDomain
+	name          container.ContainerName
+}
+
+// GetAppLogs returns the function which streams the container logs for the app. If linked is set, the logs
+// for the stage and preview apps of the main app are included. The containers are looked up using the
+// container runtime, the apps are not initialized, so no containers are started for reading the logs
+func (s *Server) GetAppLogs(ctx context.Context, appPath string, linked bool, opts container.LogOptions) (func(w io.Writer) error, error) {
+	appPathDomain, err := parseAppPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+	if !container.RuntimeEnabled(&s.config.System) {
+		return nil, types.CreateRequestError(
+			fmt.Sprintf("no containers found for app %s, container support is not enabled on the server", appPath), http.StatusBadRequest)
+	}
+	runtime, err := container.NewContainerRuntime(s.Logger, &s.config.System)
+	if err != nil {
+		return nil, err
+	}
+
+	appEntries, err := s.getLogApps(ctx, appPathDomain, linked)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []logTarget{}
+	for _, appEntry := range appEntries {
+		names, err := app.LogContainers(runtime, &s.config.System, appEntry.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			targets = append(targets, logTarget{appPathDomain: appEntry.AppPathDomain(), name: name})
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, types.CreateRequestError(fmt.Sprintf("no containers found for app %s", appPath), http.StatusBadRequest)
+	}
+
+	return func(w io.Writer) error {
+		return streamLogs(ctx, runtime, &s.config.System, targets, opts, w)
+	}, nil
+}
+
+// GetBuildLogs returns the function which writes the image build output for the app. The build output
+// for the current version of the app is used if version is zero
+func (s *Server) GetBuildLogs(ctx context.Context, appPath string, version int) (func(w io.Writer) error, error) {
+	appPathDomain, err := parseAppPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+	appEntry, err := s.db.GetApp(appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = appEntry.Metadata.VersionMetadata.Version
+	}
+
+	appRunPath := fmt.Sprintf(os.ExpandEnv("$CL_HOME/run/app/%s"), appEntry.Id)
+	logFile := app.BuildLogFile(appRunPath, version)
+	if _, err := os.Stat(logFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil, types.CreateRequestError(fmt.Sprintf("no build logs found for app %s version %d", appPath, version), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+
+	return func(w io.Writer) error {
+		f, err := os.Open(logFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}, nil
+}
+
+// getLogApps returns the apps whose logs are streamed, the app and optionally its linked apps
+func (s *Server) getLogApps(ctx context.Context, appPathDomain types.AppPathDomain, linked bool) ([]*types.AppEntry, error) {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*types.AppEntry{appEntry}
+	if !linked {
+		return ret, nil
+	}
+	if appEntry.MainApp != "" {
+		return nil, types.CreateRequestError("linked logs are supported for main apps only", http.StatusBadRequest)
+	}
+	linkedApps, err := s.db.GetLinkedApps(ctx, tx, appEntry.Id)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(linkedApps, func(a, b *types.AppEntry) int { return strings.Compare(a.Path, b.Path) })
+	return append(ret, linkedApps...), nil
+}
+
+// streamLogs writes the logs for the containers to w. If there are multiple containers, each line is prefixed
+// with the app path and container name. Without follow, the logs are written one container after the other.
+// With follow, the logs are streamed concurrently until the context is cancelled
+func streamLogs(ctx context.Context, runtime container.ContainerRuntime, config *types.SystemConfig,
+	targets []logTarget, opts container.LogOptions, w io.Writer) error {
+	if len(targets) == 1 {
+		return runtime.StreamContainerLogs(ctx, config, targets[0].name, opts, w)
+	}
+
+	var lock sync.Mutex
+	stream := func(target logTarget) error {
+		prefixWriter := container.NewPrefixWriter(w, &lock, fmt.Sprintf("%s %s | ", target.appPathDomain, target.name))
+		err := runtime.StreamContainerLogs(ctx, config, target.name, opts, prefixWriter)
+		return errors.Join(err, prefixWriter.Flush())
+	}
+
+	if !opts.Follow {
+		for _, target := range targets {
+			if err := stream(target); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = stream(target)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -16,7 +16,7 @@ import (
 )
 
 func (s *Server) ReloadApp(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, stageAppEntry *types.AppEntry,
-	approve, dryRun, promote bool, branch, commit, gitAuth string, repoCache *RepoCache, forceReload bool) (*types.AppReloadResult, error) {
+	approve, dryRun, promote bool, branch, tag, commit, gitAuth string, repoCache *RepoCache, forceReload bool) (*types.AppReloadResult, error) {
 	prodAppEntry := appEntry
 	var err error
 	if !appEntry.IsDev {
@@ -31,7 +31,7 @@ func (s *Server) ReloadApp(ctx context.Context, tx types.Transaction, appEntry *
 	}
 
 	reloaded := true
-	if reloaded, err = s.loadAppCode(ctx, tx, appEntry, branch, commit, gitAuth, repoCache, forceReload); err != nil {
+	if reloaded, err = s.loadAppCode(ctx, tx, appEntry, branch, tag, commit, gitAuth, repoCache, forceReload); err != nil {
 		return nil, err
 	}
 	if !reloaded {
@@ -118,7 +118,7 @@ func (s *Server) ReloadApp(ctx context.Context, tx types.Transaction, appEntry *
 }
 
 func (s *Server) ReloadApps(ctx context.Context, appPathGlob string, approve, dryRun, promote bool,
-	branch, commit, gitAuth string, forceReload bool) (*types.AppReloadResponse, error) {
+	branch, tag, commit, gitAuth string, forceReload bool) (*types.AppReloadResponse, error) {
 	filteredApps, err := s.FilterApps(appPathGlob, false)
 	if err != nil {
 		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
@@ -148,7 +148,7 @@ func (s *Server) ReloadApps(ctx context.Context, appPathGlob string, approve, dr
 			return nil, err
 		}
 		ret, err := s.ReloadApp(ctx, tx, appEntry, nil, approve, dryRun, promote,
-			branch, commit, gitAuth, repoCache, forceReload)
+			branch, tag, commit, gitAuth, repoCache, forceReload)
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +177,7 @@ func (s *Server) ReloadApps(ctx context.Context, appPathGlob string, approve, dr
 	return ret, nil
 }
 
-func (s *Server) loadAppCode(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, branch, commit, gitAuth string, repoCache *RepoCache, forceReload bool) (bool, error) {
+func (s *Server) loadAppCode(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, branch, tag, commit, gitAuth string, repoCache *RepoCache, forceReload bool) (bool, error) {
 	s.Debug().Msgf("Reloading app code %v", appEntry)
 
 	if system.IsGit(appEntry.SourceUrl) {
@@ -188,10 +188,25 @@ func (s *Server) loadAppCode(ctx context.Context, tx types.Transaction, appEntry
 			return false, nil
 		}
 
-		branch = cmp.Or(branch, appEntry.Metadata.VersionMetadata.GitBranch, "main")
-		newSha, err := repoCache.GetSha(appEntry.SourceUrl, branch, gitAuth)
-		if err != nil {
-			return false, fmt.Errorf("error getting git commit sha for %s: %w", appEntry.SourceUrl, err)
+		if tag == "" && branch == "" && commit == "" {
+			// Keep tracking the tag pattern, if the app was loaded from a tag
+			tag = appEntry.Metadata.VersionMetadata.GitTagPattern
+		}
+
+		var newSha string
+		var err error
+		if tag != "" && commit == "" {
+			if _, newSha, err = repoCache.ResolveTag(appEntry.SourceUrl, tag, gitAuth); err != nil {
+				return false, fmt.Errorf("error resolving git tag %s for %s: %w", tag, appEntry.SourceUrl, err)
+			}
+			if tag != appEntry.Metadata.VersionMetadata.GitTagPattern {
+				currentSha = "" // tracking changed, reload to update the metadata
+			}
+		} else {
+			branch = cmp.Or(branch, appEntry.Metadata.VersionMetadata.GitBranch, "main")
+			if newSha, err = repoCache.GetSha(appEntry.SourceUrl, branch, gitAuth); err != nil {
+				return false, fmt.Errorf("error getting git commit sha for %s: %w", appEntry.SourceUrl, err)
+			}
 		}
 		if !forceReload && currentSha != "" && newSha == currentSha && (commit == "" || commit == currentSha) {
 			// If no commit is specified, and the current version is the same as the latest commit, skip reload
@@ -200,7 +215,7 @@ func (s *Server) loadAppCode(ctx context.Context, tx types.Transaction, appEntry
 		}
 
 		// Checkout the git repo locally and load into database
-		if err := s.loadSourceFromGit(ctx, tx, appEntry, branch, commit, gitAuth, repoCache); err != nil {
+		if err := s.loadSourceFromGit(ctx, tx, appEntry, branch, tag, commit, gitAuth, repoCache); err != nil {
 			return false, err
 		}
 	} else {
@@ -358,13 +373,16 @@ func (s *Server) PromoteApps(ctx context.Context, appPathGlob string, dryRun boo
 		result = append(result, appInfo.AppPathDomain)
 	}
 
-	if err = s.CompleteTransaction(ctx, tx, result, dryRun, "promote"); err != nil {
+	verifyResults, err := s.completeTransaction(ctx, tx, result, dryRun, "promote")
+	if err != nil {
 		return nil, err
 	}
 
 	return &types.AppPromoteResponse{
 		DryRun:         dryRun,
-		PromoteResults: result}, nil
+		PromoteResults: result,
+		VerifyResults:  verifyResults,
+	}, nil
 }
 
 func (s *Server) promoteApp(ctx context.Context, tx types.Transaction, stagingApp *types.AppEntry, prodApp *types.AppEntry) error {
@@ -374,6 +392,7 @@ func (s *Server) promoteApp(ctx context.Context, tx types.Transaction, stagingAp
 	newVersion := stagingApp.Metadata.VersionMetadata.Version
 
 	existingProdVersion, _ := prodFileStore.GetAppVersion(ctx, tx, newVersion)
+	tx.RecordPromote(prodApp.AppPathDomain(), prevVersion) // verified after the transaction is committed
 	prodApp.Metadata = stagingApp.Metadata
 	if prevVersion != newVersion {
 		prodApp.Metadata.VersionMetadata.PreviousVersion = prevVersion
@@ -392,6 +411,14 @@ func (s *Server) promoteApp(ctx context.Context, tx types.Transaction, stagingAp
 	if err := s.db.UpdateAppMetadata(ctx, tx, prodApp); err != nil {
 		return err
 	}
+
+	if prodApp.Settings.Canary.Percent > 0 {
+		// The canary version is now the prod version, end the canary
+		prodApp.Settings.Canary = types.CanaryConfig{}
+		if err := s.db.UpdateAppSettings(ctx, tx, prodApp); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -435,8 +462,12 @@ func (s *Server) UpdateAppSettings(ctx context.Context, appPathGlob string, dryR
 		return nil, err
 	}
 
-	s.apps.ClearAppsAudit(ctx, results, "update_settings") // Delete instead of update to avoid having to initialize all the linked apps
-	// Apps will get reloaded on the next request
+	if err := s.apps.AuditAppUpdate(ctx, results, "update_settings"); err != nil {
+		return nil, err
+	}
+	// Settings do not change the app version. Apps are reloaded on the next request, the apps with running
+	// containers are switched in the background, to avoid having to initialize all the linked apps in the request
+	s.apps.SwitchAppsBackground(results)
 	return ret, nil
 }
 
@@ -486,6 +517,18 @@ func (s *Server) updateAppSettings(ctx context.Context, tx types.Transaction, ap
 			}
 		}
 
+		if updateAppRequest.AllowIPs != types.StringValueUndefined {
+			linkedApp.Settings.AllowIPs = parseIPList(string(updateAppRequest.AllowIPs))
+		}
+
+		if updateAppRequest.DenyIPs != types.StringValueUndefined {
+			linkedApp.Settings.DenyIPs = parseIPList(string(updateAppRequest.DenyIPs))
+		}
+
+		if _, err := system.NewIPFilter(linkedApp.Settings.AllowIPs, linkedApp.Settings.DenyIPs); err != nil {
+			return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+		}
+
 		if err := s.db.UpdateAppSettings(ctx, tx, linkedApp); err != nil {
 			return nil, err
 		}
@@ -496,6 +539,20 @@ func (s *Server) updateAppSettings(ctx context.Context, tx types.Transaction, ap
 	return ret, nil
 }
 
+// parseIPList parses a comma separated list of CIDR ranges, "-" clears the list
+func parseIPList(value string) []string {
+	ret := []string{}
+	if value == "-" {
+		return ret
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
 func (s *Server) accountLinkHandler(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, args map[string]any) (any, types.AppPathDomain, error) {
 	if appEntry.Metadata.Accounts == nil {
 		appEntry.Metadata.Accounts = []types.AccountLink{}
@@ -29,21 +29,22 @@ const (
 	APP = "app"
 )
 
-func (s *Server) loadApplyInfo(fileName string, data []byte, branch string) ([]*types.CreateAppRequest, error) {
+func (s *Server) loadApplyInfo(fileName string, data []byte, branch, environment string,
+	readFile func(string) ([]byte, error)) ([]*types.CreateAppRequest, error) {
 	appDefs := make([]*starlarkstruct.Struct, 0)
 
 	createAppBuiltin := func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		var path, source starlark.String
 		var dev starlark.Bool
 		var params *starlark.Dict = starlark.NewDict(0)
-		var auth, gitAuth, gitBranch, gitCommit, appSpec starlark.String
+		var auth, gitAuth, gitBranch, gitTag, gitCommit, appSpec starlark.String
 		var appConfig = starlark.NewDict(0)
 		var containerOpts = starlark.NewDict(0)
 		var containerArgs = starlark.NewDict(0)
 		var containerVols = &starlark.List{}
 
 		if err := starlark.UnpackArgs(APP, args, kwargs, "path", &path, "source", &source, "dev?", &dev,
-			"auth?", &auth, "git_auth?", &gitAuth, "git_branch?", &gitBranch, "git_commit?", &gitCommit,
+			"auth?", &auth, "git_auth?", &gitAuth, "git_branch?", &gitBranch, "git_tag?", &gitTag, "git_commit?", &gitCommit,
 			"params?", &params, "spec?", &appSpec, "app_config", &appConfig,
 			"container_opts?", &containerOpts, "container_args?", &containerArgs, "container_vols?", &containerVols,
 		); err != nil {
@@ -57,6 +58,7 @@ func (s *Server) loadApplyInfo(fileName string, data []byte, branch string) ([]*
 			"auth":           auth,
 			"git_auth":       gitAuth,
 			"git_branch":     gitBranch,
+			"git_tag":        gitTag,
 			"git_commit":     gitCommit,
 			"params":         params,
 			"spec":           appSpec,
@@ -72,8 +74,17 @@ func (s *Server) loadApplyInfo(fileName string, data []byte, branch string) ([]*
 	}
 
 	builtins := starlark.StringDict{
-		APP:            starlark.NewBuiltin(APP, createAppBuiltin),
-		apptype.CONFIG: starlark.NewBuiltin(apptype.CONFIG, apptype.CreateConfigBuiltin(s.config.NodeConfig, s.config.System.AllowedEnv)),
+		APP:               starlark.NewBuiltin(APP, createAppBuiltin),
+		apptype.CONFIG:    starlark.NewBuiltin(apptype.CONFIG, apptype.CreateConfigBuiltin(s.config.NodeConfig, s.config.System.AllowedEnv)),
+		APPLY_ENV:         starlark.NewBuiltin(APPLY_ENV, createApplyEnvBuiltin(s.config.System.AllowedEnv)),
+		APPLY_SECRET:      starlark.NewBuiltin(APPLY_SECRET, applySecretBuiltin),
+		APPLY_ENVIRONMENT: starlark.String(environment),
+	}
+
+	// Top level if and for statements are allowed, so that one apply file can define apps for multiple environments
+	options := syntax.FileOptions{TopLevelControl: true}
+	exec := func(thread *starlark.Thread, name string, src []byte) (starlark.StringDict, error) {
+		return starlark.ExecFileOptions(&options, thread, name, src, builtins)
 	}
 
 	thread := &starlark.Thread{
@@ -81,10 +92,10 @@ func (s *Server) loadApplyInfo(fileName string, data []byte, branch string) ([]*
 		Print: func(_ *starlark.Thread, msg string) { s.Info().Msg(msg) },
 	}
 
+	thread.Load = createApplyLoader(readFile, exec)
 	thread.SetLocal(types.TL_BRANCH, branch)
 
-	options := syntax.FileOptions{}
-	_, err := starlark.ExecFileOptions(&options, thread, fileName, data, builtins)
+	_, err := exec(thread, fileName, data)
 	if err != nil {
 		if evalErr, ok := err.(*starlark.EvalError); ok {
 			s.Error().Err(evalErr).Msgf("Error loading app definitions: %s", evalErr.Backtrace())
@@ -133,6 +144,10 @@ func appDefToApplyInfo(appDef *starlarkstruct.Struct) (*types.CreateAppRequest,
 	if err != nil {
 		return nil, err
 	}
+	gitTag, err := apptype.GetStringAttr(appDef, "git_tag")
+	if err != nil {
+		return nil, err
+	}
 	gitCommit, err := apptype.GetStringAttr(appDef, "git_commit")
 	if err != nil {
 		return nil, err
@@ -188,6 +203,7 @@ func appDefToApplyInfo(appDef *starlarkstruct.Struct) (*types.CreateAppRequest,
 		AppAuthn:         types.AppAuthnType(auth),
 		GitAuthName:      gitAuth,
 		GitBranch:        gitBranch,
+		GitTag:           gitTag,
 		GitCommit:        gitCommit,
 		Spec:             types.AppSpec(spec),
 		AppConfig:        appConfigStr,
@@ -203,7 +219,7 @@ func (s *Server) setupSource(applyPath, branch, commit, gitAuth string, repoCach
 	}
 
 	branch = cmp.Or(branch, "main")
-	repo, applyFile, _, _, err := repoCache.CheckoutRepo(applyPath, branch, commit, gitAuth)
+	repo, applyFile, _, _, err := repoCache.CheckoutRepo(applyPath, branch, "", commit, gitAuth)
 	if err != nil {
 		return "", "", err
 	}
@@ -218,7 +234,12 @@ func (s *Server) setupSource(applyPath, branch, commit, gitAuth string, repoCach
 }
 
 func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath string, appPathGlob string, approve, dryRun, promote bool,
-	reload types.AppReloadOption, branch, commit, gitAuth string, clobber, forceReload bool, lastRunCommitId string, repoCache *RepoCache) (*types.AppApplyResponse, []types.AppPathDomain, error) {
+	reload types.AppReloadOption, branch, commit, gitAuth string, clobber, forceReload bool, prune types.ApplyPruneOption,
+	environment, lastRunCommitId string, repoCache *RepoCache) (*types.AppApplyResponse, []types.AppPathDomain, error) {
+	if err := validatePruneOption(prune); err != nil {
+		return nil, nil, err
+	}
+
 	var tx types.Transaction
 	var err error
 	if inputTx.Tx == nil {
@@ -289,7 +310,7 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 			return nil, nil, fmt.Errorf("error reading file %s: %w", f, err)
 		}
 
-		fileConfig, err := s.loadApplyInfo(f, fileBytes, branch)
+		fileConfig, err := s.loadApplyInfo(f, fileBytes, branch, environment, sourceFS.ReadFile)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -362,6 +383,7 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 	}
 
 	createResults := make([]types.AppCreateResponse, 0, len(newApps))
+	diffs := make([]types.AppDiff, 0, len(filteredApps))
 	for _, newApp := range newApps {
 		s.Trace().Msgf("Applying create app %s", newApp)
 		applyInfo := applyConfig[newApp]
@@ -369,13 +391,32 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 		if err != nil {
 			return nil, nil, err
 		}
+		if _, err := s.updateApplySource(ctx, tx, newApp, applyPath, true); err != nil {
+			return nil, nil, err
+		}
+		appEntry, err := s.db.GetAppTx(ctx, tx, newApp)
+		if err != nil {
+			return nil, nil, err
+		}
+		diffs = append(diffs, types.AppDiff{
+			AppPathDomain: newApp,
+			Action:        types.AppDiffCreate,
+			Changes:       diffAppState(appState{}, getAppState(appEntry)),
+		})
 
 		createResults = append(createResults, *res)
 	}
 
+	enabledApps := make([]types.AppPathDomain, 0)
 	for _, updateApp := range updatedApps {
 		s.Trace().Msgf("Applying update app %s", updateApp)
 		applyInfo := applyConfig[updateApp]
+		enabled, err := s.updateApplySource(ctx, tx, updateApp, applyPath, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		enabledApps = append(enabledApps, enabled...)
+
 		applyResult, err := s.applyAppUpdate(ctx, tx, updateApp, applyInfo, approve, dryRun,
 			promote, reload, clobber, repoCache, forceReload)
 		if err != nil {
@@ -383,6 +424,13 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 		}
 
 		updateResults = append(updateResults, applyResult.Updated...)
+		if len(applyResult.Changes) > 0 {
+			diffs = append(diffs, types.AppDiff{
+				AppPathDomain: updateApp,
+				Action:        types.AppDiffUpdate,
+				Changes:       applyResult.Changes,
+			})
+		}
 		if applyResult.Promoted {
 			promoteResults = append(promoteResults, updateApp)
 		}
@@ -393,8 +441,27 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 		}
 	}
 
+	pruneResults := make([]types.AppPathDomain, 0)
+	prunedApps := make([]types.AppPathDomain, 0)
+	if prune != types.ApplyPruneNone {
+		pruneResults, prunedApps, err = s.pruneApps(ctx, tx, applyPath, appPathGlob, applyConfig, allApps, prune)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pruneAction := types.AppDiffDelete
+		if prune == types.ApplyPruneDisable {
+			pruneAction = types.AppDiffDisable
+		}
+		for _, prunedApp := range pruneResults {
+			diffs = append(diffs, types.AppDiff{AppPathDomain: prunedApp, Action: pruneAction, Changes: []types.FieldDiff{}})
+		}
+	}
+
 	// Get list of all updated apps
 	allUpdatedApps := []types.AppPathDomain{}
+	allUpdatedApps = append(allUpdatedApps, enabledApps...)
+	allUpdatedApps = append(allUpdatedApps, prunedApps...)
 	allUpdatedApps = append(allUpdatedApps, updateResults...)
 	allUpdatedApps = append(allUpdatedApps, reloadResults...)
 	allUpdatedApps = append(allUpdatedApps, promoteResults...)
@@ -428,11 +495,131 @@ func (s *Server) Apply(ctx context.Context, inputTx types.Transaction, applyPath
 		ReloadResults:  reloadResults,
 		SkippedResults: skippedResults,
 		FilteredApps:   filteredApps,
+		PruneMode:      prune,
+		PruneResults:   pruneResults,
+		Diffs:          diffs,
 	}
 
 	return ret, allUpdatedApps, nil
 }
 
+func validatePruneOption(prune types.ApplyPruneOption) error {
+	switch prune {
+	case types.ApplyPruneNone, types.ApplyPruneDelete, types.ApplyPruneDisable:
+		return nil
+	default:
+		return types.CreateRequestError(fmt.Sprintf("invalid prune option %s, expected delete or disable", prune), http.StatusBadRequest)
+	}
+}
+
+// updateApplySource records the apply path as the source for the apps created by the apply, only those apps
+// are pruned. Existing apps are not adopted, apps created by the apply path are re-enabled if they had been
+// disabled by an earlier prune. The apply path is recorded for all applied apps, used for the drift check.
+// The paths of the apps which were enabled are returned
+func (s *Server) updateApplySource(ctx context.Context, tx types.Transaction, appPathDomain types.AppPathDomain, applyPath string, created bool) ([]types.AppPathDomain, error) {
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	if created || appEntry.Settings.ApplyPath != applyPath {
+		if created {
+			appEntry.Settings.ApplySource = applyPath
+		}
+		appEntry.Settings.ApplyPath = applyPath
+		if err := s.db.UpdateAppSettings(ctx, tx, appEntry); err != nil {
+			return nil, err
+		}
+	}
+
+	if created {
+		return nil, nil
+	}
+
+	if appEntry.Settings.ApplySource != applyPath || !appEntry.Settings.Disabled {
+		return nil, nil
+	}
+	return s.setAppDisabled(ctx, tx, appEntry, false)
+}
+
+// setAppDisabled updates the disabled setting for the app and its linked apps. The paths of the
+// updated apps are returned
+func (s *Server) setAppDisabled(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, disabled bool) ([]types.AppPathDomain, error) {
+	linkedApps, err := s.db.GetLinkedApps(ctx, tx, appEntry.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := make([]types.AppPathDomain, 0, len(linkedApps)+1)
+	for _, entry := range append([]*types.AppEntry{appEntry}, linkedApps...) {
+		entry.Settings.Disabled = disabled
+		if err := s.db.UpdateAppSettings(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+		updated = append(updated, entry.AppPathDomain())
+	}
+	return updated, nil
+}
+
+// pruneApps deletes or disables the apps which were created from the apply path but are no longer present
+// in the apply config. Only apps matching the app path glob are pruned. The pruned main apps are returned,
+// along with the list of all apps (including linked apps) which need to be cleared from the app cache
+func (s *Server) pruneApps(ctx context.Context, tx types.Transaction, applyPath, appPathGlob string,
+	applyConfig map[types.AppPathDomain]*types.CreateAppRequest, allApps []types.AppInfo, prune types.ApplyPruneOption) ([]types.AppPathDomain, []types.AppPathDomain, error) {
+	pruneResults := make([]types.AppPathDomain, 0)
+	clearApps := make([]types.AppPathDomain, 0)
+	for _, appInfo := range allApps {
+		if appInfo.MainApp != "" {
+			continue // linked apps are pruned along with the main app
+		}
+		if _, ok := applyConfig[appInfo.AppPathDomain]; ok {
+			continue
+		}
+		match, err := MatchGlob(appPathGlob, appInfo.AppPathDomain)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !match {
+			continue
+		}
+
+		appEntry, err := s.db.GetAppTx(ctx, tx, appInfo.AppPathDomain)
+		if err != nil {
+			return nil, nil, err
+		}
+		if appEntry.Settings.ApplySource != applyPath {
+			continue
+		}
+
+		switch prune {
+		case types.ApplyPruneDelete:
+			s.Info().Msgf("Pruning app %s, deleting", appInfo.AppPathDomain)
+			if err := s.db.DeleteApp(ctx, tx, appEntry.Id); err != nil {
+				return nil, nil, err
+			}
+			clearApps = append(clearApps, appInfo.AppPathDomain)
+			for _, linkedApp := range allApps {
+				if linkedApp.MainApp == appEntry.Id {
+					clearApps = append(clearApps, linkedApp.AppPathDomain)
+				}
+			}
+		case types.ApplyPruneDisable:
+			if appEntry.Settings.Disabled {
+				continue // already disabled
+			}
+			s.Info().Msgf("Pruning app %s, disabling", appInfo.AppPathDomain)
+			updated, err := s.setAppDisabled(ctx, tx, appEntry, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			clearApps = append(clearApps, updated...)
+		}
+		pruneResults = append(pruneResults, appInfo.AppPathDomain)
+	}
+
+	return pruneResults, clearApps, nil
+}
+
 func convertToMapString(input map[string]any, convertToml bool) (map[string]string, error) {
 	ret := make(map[string]string)
 	for k, v := range input {
@@ -475,6 +662,7 @@ func (s *Server) applyAppUpdate(ctx context.Context, tx types.Transaction, appPa
 		}
 	}
 
+	beforeState := getAppState(liveApp)
 	oldInfoStr := string(liveApp.Metadata.VersionMetadata.ApplyInfo)
 	var oldInfo *types.CreateAppRequest
 	if len(oldInfoStr) > 0 {
@@ -522,6 +710,12 @@ func (s *Server) applyAppUpdate(ctx context.Context, tx types.Transaction, appPa
 	if gitBranchChanged {
 		liveApp.Metadata.VersionMetadata.GitBranch = newInfo.GitBranch
 	}
+	gitTagChanged := checkPropertyChanged(oldInfo, func(info *types.CreateAppRequest) any {
+		return info.GitTag
+	}, newInfo.GitTag, liveApp.Metadata.VersionMetadata.GitTagPattern, clobber)
+	if gitTagChanged {
+		liveApp.Metadata.VersionMetadata.GitTagPattern = newInfo.GitTag
+	}
 	gitCommitChanged := false
 	if newInfo.GitCommit != "" {
 		gitCommitChanged = checkPropertyChanged(oldInfo, func(info *types.CreateAppRequest) any {
@@ -562,7 +756,7 @@ func (s *Server) applyAppUpdate(ctx context.Context, tx types.Transaction, appPa
 	}
 	appConfigChanged := mergeMap(oldAppConfig, newInfo.AppConfig, liveApp.Metadata.AppConfig, clobber)
 
-	updated := specChanged || gitBranchChanged || gitCommitChanged || paramsChanged ||
+	updated := specChanged || gitBranchChanged || gitTagChanged || gitCommitChanged || paramsChanged ||
 		contConfigChanged || contArgsChanged || contVolsChanged || appConfigChanged
 	updatedApps := make([]types.AppPathDomain, 0)
 	if updated {
@@ -585,7 +779,7 @@ func (s *Server) applyAppUpdate(ctx context.Context, tx types.Transaction, appPa
 	if reloadApp {
 		// Reload does the version increment and promotion
 		reloadResult, err := s.ReloadApp(ctx, tx, prodApp, liveApp, approve, dryRun, promote,
-			newInfo.GitBranch, newInfo.GitCommit, newInfo.GitAuthName, repoCache, forceReload)
+			newInfo.GitBranch, newInfo.GitTag, newInfo.GitCommit, newInfo.GitAuthName, repoCache, forceReload)
 		if err != nil {
 			return nil, err
 		}
@@ -613,6 +807,7 @@ func (s *Server) applyAppUpdate(ctx context.Context, tx types.Transaction, appPa
 
 	ret.Updated = updatedApps
 	ret.Promoted = promoteApp
+	ret.Changes = diffAppState(beforeState, getAppState(liveApp))
 	return ret, nil
 }
 
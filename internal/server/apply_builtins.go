@@ -0,0 +1,120 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+	"go.starlark.net/starlark"
+)
+
+const (
+	APPLY_ENV         = "env"
+	APPLY_SECRET      = "secret"
+	APPLY_ENVIRONMENT = "environment"
+	APPLY_LIB_SUFFIX  = ".star"
+)
+
+// createApplyEnvBuiltin returns the env builtin for apply files. Only the env variables listed in
+// the allowed_env system config can be read
+func createApplyEnvBuiltin(allowedEnv []string) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name, defaultValue starlark.String
+		if err := starlark.UnpackArgs(APPLY_ENV, args, kwargs, "name", &name, "default?", &defaultValue); err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(allowedEnv, string(name)) {
+			return nil, fmt.Errorf("env %s is not in the allowed_env list", string(name))
+		}
+
+		value, ok := os.LookupEnv(string(name))
+		if !ok {
+			return defaultValue, nil
+		}
+		return starlark.String(value), nil
+	}
+}
+
+// applySecretBuiltin returns a secret reference template. The secret value is not read during
+// the apply, the reference is resolved through the secret manager when the app uses the value
+func applySecretBuiltin(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var provider starlark.String
+	if err := starlark.UnpackArgs(APPLY_SECRET, nil, kwargs, "provider?", &provider); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: at least one key is required", APPLY_SECRET)
+	}
+
+	keys := make([]string, 0, len(args))
+	for i, arg := range args {
+		key, ok := arg.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("%s: key %d must be a string, got %s", APPLY_SECRET, i+1, arg.Type())
+		}
+		keys = append(keys, strconv.Quote(string(key)))
+	}
+
+	if provider != "" {
+		return starlark.String(fmt.Sprintf("{{secret_from %s %s}}", strconv.Quote(string(provider)), strings.Join(keys, " "))), nil
+	}
+	return starlark.String(fmt.Sprintf("{{secret %s}}", strings.Join(keys, " "))), nil
+}
+
+// applyLoadEntry is the cached result of loading a shared library
+type applyLoadEntry struct {
+	globals starlark.StringDict
+	err     error
+}
+
+// createApplyLoader returns the load handler for apply files. Libraries are loaded from the
+// apply source, the module path is relative to the source root. Each library is executed once
+// per apply file
+func createApplyLoader(readFile func(string) ([]byte, error),
+	exec func(*starlark.Thread, string, []byte) (starlark.StringDict, error)) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	cache := map[string]*applyLoadEntry{}
+
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		if !strings.HasSuffix(module, APPLY_LIB_SUFFIX) {
+			return nil, fmt.Errorf("load %s: only %s files can be loaded", module, APPLY_LIB_SUFFIX)
+		}
+		modulePath := path.Clean(module)
+		if path.IsAbs(modulePath) || modulePath == ".." || strings.HasPrefix(modulePath, "../") {
+			return nil, fmt.Errorf("load %s: path should be relative to the apply source", module)
+		}
+
+		entry, ok := cache[modulePath]
+		if ok {
+			if entry == nil {
+				return nil, fmt.Errorf("load %s: cycle in load graph", module)
+			}
+			return entry.globals, entry.err
+		}
+
+		cache[modulePath] = nil // mark as in progress, for cycle detection
+		data, err := readFile(modulePath)
+		if err != nil {
+			err = fmt.Errorf("load %s: %w", module, err)
+			cache[modulePath] = &applyLoadEntry{err: err}
+			return nil, err
+		}
+
+		loadThread := &starlark.Thread{
+			Name:  modulePath,
+			Print: thread.Print,
+			Load:  thread.Load,
+		}
+		loadThread.SetLocal(types.TL_BRANCH, thread.Local(types.TL_BRANCH))
+		globals, err := exec(loadThread, modulePath, data)
+		cache[modulePath] = &applyLoadEntry{globals: globals, err: err}
+		return globals, err
+	}
+}
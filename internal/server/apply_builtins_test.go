@@ -0,0 +1,100 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+func execApplyTest(t *testing.T, files map[string]string, main string) (starlark.StringDict, error) {
+	t.Helper()
+	t.Setenv("CL_TEST_ENV", "testvalue")
+	builtins := starlark.StringDict{
+		APPLY_ENV:         starlark.NewBuiltin(APPLY_ENV, createApplyEnvBuiltin([]string{"CL_TEST_ENV", "CL_TEST_MISSING"})),
+		APPLY_SECRET:      starlark.NewBuiltin(APPLY_SECRET, applySecretBuiltin),
+		APPLY_ENVIRONMENT: starlark.String("staging"),
+	}
+	options := syntax.FileOptions{TopLevelControl: true}
+	exec := func(thread *starlark.Thread, name string, src []byte) (starlark.StringDict, error) {
+		return starlark.ExecFileOptions(&options, thread, name, src, builtins)
+	}
+	readFile := func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("file %s not found", name)
+		}
+		return []byte(data), nil
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	thread.Load = createApplyLoader(readFile, exec)
+	return exec(thread, "main.ace", []byte(main))
+}
+
+func TestApplyBuiltins(t *testing.T) {
+	globals, err := execApplyTest(t, nil, `
+e1 = env("CL_TEST_ENV")
+e2 = env("CL_TEST_MISSING", "def")
+s1 = secret("KEY1")
+s2 = secret("a", "b", provider="vault")
+envs = []
+for e in ["dev", "staging"]:
+    if e == environment:
+        envs.append(e)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqualsString(t, "env", "testvalue", string(globals["e1"].(starlark.String)))
+	testutil.AssertEqualsString(t, "env default", "def", string(globals["e2"].(starlark.String)))
+	testutil.AssertEqualsString(t, "secret", `{{secret "KEY1"}}`, string(globals["s1"].(starlark.String)))
+	testutil.AssertEqualsString(t, "secret from", `{{secret_from "vault" "a" "b"}}`, string(globals["s2"].(starlark.String)))
+	testutil.AssertEqualsString(t, "environment", `["staging"]`, globals["envs"].String())
+
+	_, err = execApplyTest(t, nil, `env("HOME")`)
+	testutil.AssertErrorContains(t, err, "env HOME is not in the allowed_env list")
+
+	_, err = execApplyTest(t, nil, `secret()`)
+	testutil.AssertErrorContains(t, err, "at least one key is required")
+}
+
+func TestApplyLoad(t *testing.T) {
+	files := map[string]string{
+		"lib/common.star": `
+load("lib/base.star", "base")
+def app_path(name):
+    return base + name
+`,
+		"lib/base.star":   `base = "/" + environment + "/"`,
+		"lib/cycle1.star": `load("lib/cycle2.star", "x")`,
+		"lib/cycle2.star": `load("lib/cycle1.star", "x")`,
+	}
+
+	globals, err := execApplyTest(t, files, `
+load("lib/common.star", "app_path")
+load("./lib/base.star", "base")
+path = app_path("app1")
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqualsString(t, "path", "/staging/app1", string(globals["path"].(starlark.String)))
+
+	_, err = execApplyTest(t, files, `load("lib/cycle1.star", "x")`)
+	testutil.AssertErrorContains(t, err, "cycle in load graph")
+
+	_, err = execApplyTest(t, files, `load("../lib/base.star", "base")`)
+	testutil.AssertErrorContains(t, err, "path should be relative to the apply source")
+
+	_, err = execApplyTest(t, files, `load("lib/base.ace", "base")`)
+	testutil.AssertErrorContains(t, err, "only .star files can be loaded")
+
+	_, err = execApplyTest(t, files, `load("lib/missing.star", "base")`)
+	testutil.AssertErrorContains(t, err, "file lib/missing.star not found")
+}
@@ -0,0 +1,97 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+// appState is the snapshot of the app properties which are managed by apply, used to
+// generate the field level diff for the apply response
+type appState struct {
+	auth             string
+	spec             string
+	gitBranch        string
+	gitTag           string
+	gitCommit        string
+	params           map[string]string
+	containerOptions map[string]string
+	containerArgs    map[string]string
+	containerVolumes []string
+	appConfig        map[string]string
+}
+
+// getAppState returns a snapshot of the app properties. The maps are copied since apply
+// updates them in place
+func getAppState(appEntry *types.AppEntry) appState {
+	return appState{
+		auth:             string(appEntry.Settings.AuthnType),
+		spec:             string(appEntry.Metadata.Spec),
+		gitBranch:        appEntry.Metadata.VersionMetadata.GitBranch,
+		gitTag:           appEntry.Metadata.VersionMetadata.GitTagPattern,
+		gitCommit:        appEntry.Metadata.VersionMetadata.GitCommit,
+		params:           maps.Clone(appEntry.Metadata.ParamValues),
+		containerOptions: maps.Clone(appEntry.Metadata.ContainerOptions),
+		containerArgs:    maps.Clone(appEntry.Metadata.ContainerArgs),
+		containerVolumes: slices.Clone(appEntry.Metadata.ContainerVolumes),
+		appConfig:        maps.Clone(appEntry.Metadata.AppConfig),
+	}
+}
+
+// diffAppState returns the list of changes from old to new
+func diffAppState(old, new appState) []types.FieldDiff {
+	diffs := make([]types.FieldDiff, 0)
+	diffs = appendValueDiff(diffs, "auth", old.auth, new.auth)
+	diffs = appendValueDiff(diffs, "spec", old.spec, new.spec)
+	diffs = appendValueDiff(diffs, "git_branch", old.gitBranch, new.gitBranch)
+	diffs = appendValueDiff(diffs, "git_tag", old.gitTag, new.gitTag)
+	diffs = appendValueDiff(diffs, "commit", old.gitCommit, new.gitCommit)
+	diffs = appendMapDiff(diffs, "params", old.params, new.params)
+	diffs = appendMapDiff(diffs, "container_opts", old.containerOptions, new.containerOptions)
+	diffs = appendMapDiff(diffs, "container_args", old.containerArgs, new.containerArgs)
+	diffs = appendSliceDiff(diffs, "container_vols", old.containerVolumes, new.containerVolumes)
+	diffs = appendMapDiff(diffs, "app_config", old.appConfig, new.appConfig)
+	return diffs
+}
+
+func appendValueDiff(diffs []types.FieldDiff, field, old, new string) []types.FieldDiff {
+	if old == new {
+		return diffs
+	}
+	return append(diffs, types.FieldDiff{Field: field, Old: old, New: new})
+}
+
+// appendMapDiff adds the diff for each changed key, in sorted key order
+func appendMapDiff(diffs []types.FieldDiff, field string, old, new map[string]string) []types.FieldDiff {
+	keys := slices.Collect(maps.Keys(old))
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		diffs = appendValueDiff(diffs, field+"."+k, old[k], new[k])
+	}
+	return diffs
+}
+
+// appendSliceDiff adds the diff for the values removed and added, order changes are ignored
+func appendSliceDiff(diffs []types.FieldDiff, field string, old, new []string) []types.FieldDiff {
+	for _, v := range old {
+		if !slices.Contains(new, v) {
+			diffs = append(diffs, types.FieldDiff{Field: field, Old: v})
+		}
+	}
+	for _, v := range new {
+		if !slices.Contains(old, v) {
+			diffs = append(diffs, types.FieldDiff{Field: field, New: v})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,64 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestDiffAppState(t *testing.T) {
+	entry := &types.AppEntry{}
+	entry.Settings.AuthnType = types.AppAuthnDefault
+	entry.Metadata.Spec = "python-flask"
+	entry.Metadata.VersionMetadata.GitCommit = "abc"
+	entry.Metadata.ParamValues = map[string]string{"p1": "1", "p2": "2"}
+	entry.Metadata.ContainerOptions = map[string]string{"co1": "1"}
+	entry.Metadata.ContainerArgs = map[string]string{}
+	entry.Metadata.ContainerVolumes = []string{"v1", "v2"}
+	entry.Metadata.AppConfig = map[string]string{}
+
+	before := getAppState(entry)
+
+	// Updates are done in place, the snapshot should not change
+	entry.Metadata.VersionMetadata.GitCommit = "def"
+	entry.Metadata.ParamValues["p1"] = "10"
+	delete(entry.Metadata.ParamValues, "p2")
+	entry.Metadata.ParamValues["p3"] = "3"
+	entry.Metadata.ContainerVolumes = []string{"v2", "v3"}
+	entry.Metadata.AppConfig["ac1"] = "x"
+
+	diffs := diffAppState(before, getAppState(entry))
+	got := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		got = append(got, fmt.Sprintf("%s:%s->%s", d.Field, d.Old, d.New))
+	}
+
+	want := []string{
+		"commit:abc->def",
+		"params.p1:1->10",
+		"params.p2:2->",
+		"params.p3:->3",
+		"container_vols:v1->",
+		"container_vols:->v3",
+		"app_config.ac1:->x",
+	}
+	testutil.AssertEqualsInt(t, "diff count", len(want), len(got))
+	for i := range want {
+		testutil.AssertEqualsString(t, "diff", want[i], got[i])
+	}
+
+	// Diff for new app
+	diffs = diffAppState(appState{}, before)
+	testutil.AssertEqualsInt(t, "create diff count", 8, len(diffs))
+	testutil.AssertEqualsString(t, "create auth", "auth", diffs[0].Field)
+	testutil.AssertEqualsString(t, "create auth new", string(types.AppAuthnDefault), diffs[0].New)
+
+	// No changes
+	diffs = diffAppState(before, before)
+	testutil.AssertEqualsInt(t, "no diff", 0, len(diffs))
+}
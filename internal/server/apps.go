@@ -6,6 +6,8 @@ package server
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +28,8 @@ type AppStore struct {
 
 	mu     sync.RWMutex
 	appMap map[types.AppPathDomain]*app.App
+
+	switchMu sync.Mutex // serializes the blue/green app switches
 }
 
 func NewAppStore(logger *types.Logger, server *Server) *AppStore {
@@ -159,6 +163,17 @@ func (a *AppStore) GetApp(pathDomain types.AppPathDomain) (*app.App, error) {
 	return app, nil
 }
 
+// CachedApps returns the apps currently in the app cache
+func (a *AppStore) CachedApps() []*app.App {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	ret := make([]*app.App, 0, len(a.appMap))
+	for _, app := range a.appMap {
+		ret = append(ret, app)
+	}
+	return ret
+}
+
 func (a *AppStore) AddApp(app *app.App) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -216,22 +231,158 @@ func (a *AppStore) ClearApps(pathDomains []types.AppPathDomain) {
 	}
 }
 
-// ClearApps removes the specified apps from the in memory App cache
-// Also clears the app info cache for all apps (so that it is reloaded on next request)
-// This does not notify other servers of the app update (intended for use from the listener)
-func (a *AppStore) ClearAppsNoNotify(pathDomains []types.AppPathDomain) {
+// SwitchFailure is the failure to switch an app to its new version. The current version of the app
+// continues to serve requests
+type SwitchFailure struct {
+	FromVersion int // the version which continues to serve requests
+	ToVersion   int // the version which failed to initialize
+	Err         error
+}
+
+// SwitchError is returned by SwitchApps if the new version of any of the apps failed to initialize
+type SwitchError struct {
+	Failed map[types.AppPathDomain]SwitchFailure
+}
+
+func (e *SwitchError) Error() string {
+	errs := make([]string, 0, len(e.Failed))
+	for _, pd := range slices.SortedFunc(maps.Keys(e.Failed), func(a, b types.AppPathDomain) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		failure := e.Failed[pd]
+		errs = append(errs, fmt.Sprintf("error initializing version %d of app %s, version %d continues to serve requests: %s",
+			failure.ToVersion, pd, failure.FromVersion, failure.Err))
+	}
+	return strings.Join(errs, "; ")
+}
+
+// SwitchApps removes the specified apps from the in memory App cache, like ClearApps. For apps with
+// running containers, a blue/green switch is done: the new app is initialized while the current app continues
+// to serve requests. The new app then replaces the current app in the cache and the current app is retired in
+// the background, its containers are stopped after the in-flight requests are drained. If the new app fails
+// to initialize, the current app continues to serve requests and a SwitchError is returned
+func (a *AppStore) SwitchApps(pathDomains []types.AppPathDomain) error {
+	if len(pathDomains) == 0 {
+		return nil
+	}
+
+	switchErr := a.switchContainerApps(a.clearSwitchApps(pathDomains))
+	err := a.server.db.NotifyAppUpdate(pathDomains)
+	if err != nil {
+		a.Error().Err(err).Msg("error sending app update notification")
+	}
+	return switchErr
+}
+
+// SwitchAppsBackground does the switch like SwitchApps, but the apps with running containers are switched
+// in the background. Used for changes which do not update the app version, like settings updates
+func (a *AppStore) SwitchAppsBackground(pathDomains []types.AppPathDomain) {
+	if len(pathDomains) == 0 {
+		return
+	}
+
+	switchList := a.clearSwitchApps(pathDomains)
+	err := a.server.db.NotifyAppUpdate(pathDomains)
+	if err != nil {
+		a.Error().Err(err).Msg("error sending app update notification")
+	}
+	go a.switchAppsBackground(switchList)
+}
+
+// SwitchAppsNoNotify does the switch like SwitchAppsBackground, but does not notify other servers of the
+// app update (intended for use from the listener)
+func (a *AppStore) SwitchAppsNoNotify(pathDomains []types.AppPathDomain) {
+	go a.switchAppsBackground(a.clearSwitchApps(pathDomains))
+}
+
+func (a *AppStore) switchAppsBackground(pathDomains []types.AppPathDomain) {
+	if err := a.switchContainerApps(pathDomains); err != nil {
+		a.Error().Err(err).Msg("error switching apps")
+	}
+}
+
+// clearSwitchApps removes the apps which do not have running containers from the in memory App cache, they
+// are reloaded on the next request. The apps with running containers are returned, they are switched by
+// switchContainerApps
+func (a *AppStore) clearSwitchApps(pathDomains []types.AppPathDomain) []types.AppPathDomain {
+	switchList := []types.AppPathDomain{}
 	a.mu.Lock()
 	defer a.mu.Unlock()
-
 	for _, pd := range pathDomains {
-		a.clearApp(pd)
+		if current, ok := a.appMap[pd]; ok && current.HasContainers() {
+			switchList = append(switchList, pd)
+		} else {
+			a.clearApp(pd)
+		}
 	}
 	a.resetAllAppCache()
+	return switchList
 }
 
-// ClearApps removes the specified apps from the in memory App cache and creates an audit entry.
-// Also clears the app info cache for all apps (so that it is reloaded on next request)
+// switchContainerApps does the blue/green switch for the apps. Switches are serialized, the current app is
+// looked up again since it could have been replaced by an earlier switch
+func (a *AppStore) switchContainerApps(pathDomains []types.AppPathDomain) error {
+	if len(pathDomains) == 0 {
+		return nil
+	}
+
+	a.switchMu.Lock()
+	defer a.switchMu.Unlock()
+
+	failed := map[types.AppPathDomain]SwitchFailure{}
+	for _, pd := range pathDomains {
+		a.mu.RLock()
+		current, ok := a.appMap[pd]
+		a.mu.RUnlock()
+		if !ok {
+			continue // cleared since, the app is loaded on the next request
+		}
+
+		newApp, err := a.server.loadApp(pd)
+		if err != nil {
+			// App could have been deleted
+			a.mu.Lock()
+			a.clearApp(pd)
+			a.resetAllAppCache()
+			a.mu.Unlock()
+			continue
+		}
+		if err := newApp.Initialize(types.DryRunFalse); err != nil {
+			a.Error().Err(err).Msgf("Error initializing new version of app %s, current version continues to serve requests", pd)
+			_ = newApp.Close()
+			failed[pd] = SwitchFailure{
+				FromVersion: current.Metadata.VersionMetadata.Version,
+				ToVersion:   newApp.Metadata.VersionMetadata.Version,
+				Err:         err,
+			}
+			continue
+		}
+
+		a.mu.Lock()
+		a.appMap[pd] = newApp
+		a.resetAllAppCache()
+		a.mu.Unlock()
+		a.Info().Msgf("Switched app %s to new version", pd)
+		go current.Retire(newApp)
+	}
+
+	if len(failed) > 0 {
+		return &SwitchError{Failed: failed}
+	}
+	return nil
+}
+
+// ClearAppsAudit creates an audit entry for the apps and switches them to the version in the database,
+// see SwitchApps. Also clears the app info cache for all apps (so that it is reloaded on next request)
 func (a *AppStore) ClearAppsAudit(ctx context.Context, pathDomains []types.AppPathDomain, op string) error {
+	if err := a.AuditAppUpdate(ctx, pathDomains, op); err != nil {
+		return err
+	}
+	return a.SwitchApps(pathDomains)
+}
+
+// AuditAppUpdate creates an audit entry for each of the updated apps
+func (a *AppStore) AuditAppUpdate(ctx context.Context, pathDomains []types.AppPathDomain, op string) error {
 	if len(pathDomains) == 0 {
 		return nil
 	}
@@ -264,8 +415,6 @@ func (a *AppStore) ClearAppsAudit(ctx context.Context, pathDomains []types.AppPa
 			return err
 		}
 	}
-
-	a.ClearApps(pathDomains)
 	return nil
 }
 
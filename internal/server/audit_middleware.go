@@ -42,10 +42,11 @@ func (s *Server) initAuditDB(connectString string) error {
 
 	cleanupTicker := time.NewTicker(1 * time.Hour)
 	go s.auditCleanupLoop(cleanupTicker)
+	go s.canaryStatsLoop(time.NewTicker(CANARY_STATS_FLUSH_INTERVAL))
 	return nil
 }
 
-const CURRENT_AUDIT_DB_VERSION = 1
+const CURRENT_AUDIT_DB_VERSION = 3
 
 func (s *Server) versionUpgradeAuditDB() error {
 	version := 0
@@ -92,6 +93,36 @@ func (s *Server) versionUpgradeAuditDB() error {
 		}
 	}
 
+	if version < 2 {
+		s.Info().Msg("Upgrading audit DB to version 2")
+
+		if _, err := tx.Exec(`create table IF NOT EXISTS container_stats (app_id text, create_time bigint, ` +
+			`cpu_percent double precision, memory_bytes bigint, containers int)`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`create index IF NOT EXISTS idx_app_container_stats ON container_stats (app_id, create_time DESC)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `update audit_version set version = 2, last_upgraded = `+system.FuncNow(s.auditDbType)); err != nil {
+			return err
+		}
+	}
+
+	if version < 3 {
+		s.Info().Msg("Upgrading audit DB to version 3")
+
+		if _, err := tx.Exec(`create table IF NOT EXISTS canary_stats (app_id text, version int, create_time bigint, ` +
+			`requests bigint, errors bigint)`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`create index IF NOT EXISTS idx_app_canary_stats ON canary_stats (app_id, version, create_time DESC)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `update audit_version set version = 3, last_upgraded = `+system.FuncNow(s.auditDbType)); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -125,6 +156,14 @@ func (s *Server) cleanupEvents() error {
 		return cmp.Or(err1, err2)
 	}
 	s.Info().Msgf("audit cleanup: http deleted %d, non-http deleted %d", httpDeleted, nonHttpDeleted)
+
+	statsCleanupTime := time.Now().Add(-time.Duration(s.config.System.ContainerStatsRetainDays) * 24 * time.Hour).UnixNano()
+	if _, err := s.auditDB.Exec(system.RebindQuery(s.auditDbType, `delete from container_stats where create_time < ?`), statsCleanupTime); err != nil {
+		return err
+	}
+	if _, err := s.auditDB.Exec(system.RebindQuery(s.auditDbType, `delete from canary_stats where create_time < ?`), httpCleanupTime); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -151,6 +190,8 @@ type ContextShared struct {
 	Operation string
 	Target    string
 	DryRun    bool
+	Canary    bool // request to an app with canary enabled, requests are counted for the version stats
+	Version   int  // version of the app serving the request, set for canary requests
 }
 
 func updateTargetInContext(r *http.Request, target string, dryRun bool) {
@@ -196,6 +237,10 @@ func (server *Server) handleStatus(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapper, r)
 		duration := time.Since(startTime)
 
+		if contextShared.Canary {
+			server.countCanaryRequest(types.AppId(contextShared.AppId), contextShared.Version, wrapper.Status())
+		}
+
 		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
 			// Don't create audit events for get requests
 			return
@@ -0,0 +1,283 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	CANARY_COOKIE_PREFIX = "clace_canary_"
+	CANARY_COOKIE_AGE    = 30 * 24 * 60 * 60 // 30 days
+	CANARY_BUCKETS       = 100
+)
+
+// CANARY_STATS_FLUSH_INTERVAL is how often the request counts for canary apps are saved to the audit db
+const CANARY_STATS_FLUSH_INTERVAL = time.Minute
+
+// canaryStatsKey is the app version for which canary requests are counted
+type canaryStatsKey struct {
+	appId   types.AppId
+	version int
+}
+
+// canaryCounts is the count of requests and server errors for an app version
+type canaryCounts struct {
+	requests int
+	errors   int
+}
+
+// SetCanary updates the canary config for a prod app. Percent zero disables the canary.
+func (s *Server) SetCanary(ctx context.Context, appPath string, percent int, sticky types.CanarySticky, dryRun bool) (*types.AppCanaryResponse, error) {
+	if percent < 0 || percent > 100 {
+		return nil, types.CreateRequestError("percent should be between 0 and 100", http.StatusBadRequest)
+	}
+	sticky = cmp.Or(sticky, types.CanaryStickyCookie)
+	if sticky != types.CanaryStickyCookie && sticky != types.CanaryStickyUser {
+		return nil, types.CreateRequestError(fmt.Sprintf("invalid sticky option %s, expected cookie or user", sticky), http.StatusBadRequest)
+	}
+
+	appPathDomain, err := parseAppPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+	if appEntry.IsDev || appEntry.MainApp != "" {
+		return nil, types.CreateRequestError("canary is supported for prod apps only", http.StatusBadRequest)
+	}
+
+	if percent == 0 {
+		appEntry.Settings.Canary = types.CanaryConfig{}
+	} else {
+		if appEntry.Settings.Canary.Percent == 0 {
+			// New canary, stats are from now
+			appEntry.Settings.Canary.StartTime = time.Now()
+		}
+		appEntry.Settings.Canary.Percent = percent
+		appEntry.Settings.Canary.Sticky = sticky
+	}
+
+	if err := s.db.UpdateAppSettings(ctx, tx, appEntry); err != nil {
+		return nil, err
+	}
+
+	ret, err := s.getCanaryStatus(ctx, tx, appEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.CompleteTransaction(ctx, tx, []types.AppPathDomain{appPathDomain}, dryRun, "canary"); err != nil {
+		return nil, err
+	}
+
+	ret.DryRun = dryRun
+	return ret, nil
+}
+
+// GetCanaryStatus returns the canary config and the per version request stats for a prod app
+func (s *Server) GetCanaryStatus(ctx context.Context, appPath string) (*types.AppCanaryResponse, error) {
+	appPathDomain, err := parseAppPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+	if appEntry.IsDev || appEntry.MainApp != "" {
+		return nil, types.CreateRequestError("canary is supported for prod apps only", http.StatusBadRequest)
+	}
+
+	return s.getCanaryStatus(ctx, tx, appEntry)
+}
+
+func (s *Server) getCanaryStatus(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry) (*types.AppCanaryResponse, error) {
+	stageEntry, err := s.getStageApp(ctx, tx, appEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &types.AppCanaryResponse{
+		AppPathDomain: appEntry.AppPathDomain(),
+		Canary:        appEntry.Settings.Canary,
+		Prod: types.CanaryVersionStats{
+			AppPathDomain: appEntry.AppPathDomain(),
+			Version:       appEntry.Metadata.VersionMetadata.Version,
+		},
+		Stage: types.CanaryVersionStats{
+			AppPathDomain: stageEntry.AppPathDomain(),
+			Version:       stageEntry.Metadata.VersionMetadata.Version,
+		},
+	}
+
+	if appEntry.Settings.Canary.Percent == 0 {
+		return ret, nil
+	}
+
+	since := appEntry.Settings.Canary.StartTime
+	if ret.Prod.Requests, ret.Prod.Errors, err = s.getRequestStats(ctx, appEntry.Id, ret.Prod.Version, since); err != nil {
+		return nil, err
+	}
+	if ret.Stage.Requests, ret.Stage.Errors, err = s.getRequestStats(ctx, stageEntry.Id, ret.Stage.Version, since); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// getRequestStats returns the count of http requests and the count of requests which failed with a server
+// error for the app version. The saved counts are added to the counts not yet saved on this server
+func (s *Server) getRequestStats(ctx context.Context, appId types.AppId, version int, since time.Time) (int, int, error) {
+	row := s.auditDB.QueryRowContext(ctx, system.RebindQuery(s.auditDbType,
+		`select coalesce(sum(requests), 0), coalesce(sum(errors), 0) from canary_stats `+
+			`where app_id = ? and version = ? and create_time >= ?`),
+		appId, version, since.UnixNano())
+
+	var requests, errors int
+	if err := row.Scan(&requests, &errors); err != nil {
+		return 0, 0, fmt.Errorf("error querying request stats: %w", err)
+	}
+
+	s.canaryStatsLock.Lock()
+	defer s.canaryStatsLock.Unlock()
+	pending := s.canaryStats[canaryStatsKey{appId, version}]
+	return requests + pending.requests, errors + pending.errors, nil
+}
+
+// countCanaryRequest adds the request to the counts for the app version. The counts are saved to the
+// audit db periodically, by the canary stats loop
+func (s *Server) countCanaryRequest(appId types.AppId, version int, statusCode int) {
+	s.canaryStatsLock.Lock()
+	defer s.canaryStatsLock.Unlock()
+	if s.canaryStats == nil {
+		s.canaryStats = map[canaryStatsKey]canaryCounts{}
+	}
+	key := canaryStatsKey{appId, version}
+	counts := s.canaryStats[key]
+	counts.requests++
+	if statusCode >= 500 {
+		counts.errors++
+	}
+	s.canaryStats[key] = counts
+}
+
+// flushCanaryStats saves the request counts for the canary apps to the audit db, one row per app version
+func (s *Server) flushCanaryStats() error {
+	s.canaryStatsLock.Lock()
+	stats := s.canaryStats
+	s.canaryStats = nil
+	s.canaryStatsLock.Unlock()
+
+	now := time.Now().UnixNano()
+	for key, counts := range stats {
+		if _, err := s.auditDB.Exec(system.RebindQuery(s.auditDbType,
+			`insert into canary_stats (app_id, version, create_time, requests, errors) values (?, ?, ?, ?, ?)`),
+			key.appId, key.version, now, counts.requests, counts.errors); err != nil {
+			return fmt.Errorf("error inserting canary stats: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) canaryStatsLoop(ticker *time.Ticker) {
+	for range ticker.C {
+		if err := s.flushCanaryStats(); err != nil {
+			s.Error().Err(err).Msg("error saving canary stats")
+		}
+	}
+}
+
+// canaryBucket returns the bucket (0-99) for the request. Users in buckets below the canary percent
+// are served the stage app. With user stickiness, the bucket is a hash of the user id, otherwise a
+// random bucket is assigned and saved in a cookie
+func canaryBucket(w http.ResponseWriter, r *http.Request, prodApp *app.App, userId string) int {
+	canary := prodApp.Settings.Canary
+	if canary.Sticky == types.CanaryStickyUser && userId != "" && userId != types.ANONYMOUS_USER {
+		h := fnv.New32a()
+		h.Write([]byte(string(prodApp.Id) + ":" + userId))
+		return int(h.Sum32() % CANARY_BUCKETS)
+	}
+
+	cookieName := CANARY_COOKIE_PREFIX + string(prodApp.Id)
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		if bucket, err := strconv.Atoi(cookie.Value); err == nil && bucket >= 0 && bucket < CANARY_BUCKETS {
+			return bucket
+		}
+	}
+
+	bucket := rand.IntN(CANARY_BUCKETS)
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    strconv.Itoa(bucket),
+		Path:     prodApp.Path,
+		MaxAge:   CANARY_COOKIE_AGE,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return bucket
+}
+
+// stageRequest returns the request with the path updated from the prod app path to the stage app path.
+// The prod path is added to the context, the stage app uses it for the urls it generates
+func stageRequest(r *http.Request, prodPath, stagePath string) *http.Request {
+	rest := r.URL.Path
+	if prodPath != "/" {
+		rest = strings.TrimPrefix(r.URL.Path, prodPath)
+	}
+
+	r2 := r.Clone(context.WithValue(r.Context(), types.CANARY_PROD_PATH, prodPath))
+	r2.URL.Path = stagePath + rest
+	r2.URL.RawPath = ""
+	return r2
+}
+
+// canaryRoute returns the app to serve the request and the updated request. If the user is
+// in the canary, the stage app is returned with the request path updated to the stage path
+func (s *Server) canaryRoute(w http.ResponseWriter, r *http.Request, prodApp *app.App, userId string) (*app.App, *http.Request) {
+	if prodApp.Settings.Canary.Percent <= 0 || prodApp.IsDev || prodApp.MainApp != "" {
+		return prodApp, r
+	}
+
+	if canaryBucket(w, r, prodApp, userId) >= prodApp.Settings.Canary.Percent {
+		return prodApp, r
+	}
+
+	stagePathDomain := types.AppPathDomain{Domain: prodApp.Domain, Path: prodApp.Path + types.STAGE_SUFFIX}
+	stageApp, err := s.GetApp(stagePathDomain, true)
+	if err != nil {
+		s.Error().Err(err).Msgf("Error getting stage app %s for canary, serving prod", stagePathDomain)
+		return prodApp, r
+	}
+
+	return stageApp, stageRequest(r, prodApp.Path, stageApp.Path)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestStageRequest(t *testing.T) {
+	tests := []struct {
+		prodPath, stagePath, reqPath, want string
+	}{
+		{"/app", "/app_cl_stage", "/app", "/app_cl_stage"},
+		{"/app", "/app_cl_stage", "/app/", "/app_cl_stage/"},
+		{"/app", "/app_cl_stage", "/app/a/b", "/app_cl_stage/a/b"},
+		{"/", "/_cl_stage", "/", "/_cl_stage/"},
+		{"/", "/_cl_stage", "/a/b", "/_cl_stage/a/b"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.reqPath+"?x=1", nil)
+		got := stageRequest(r, test.prodPath, test.stagePath)
+		testutil.AssertEqualsString(t, test.reqPath, test.want, got.URL.Path)
+		testutil.AssertEqualsString(t, "query", "x=1", got.URL.RawQuery)
+		testutil.AssertEqualsString(t, "orig", test.reqPath, r.URL.Path)
+		testutil.AssertEqualsString(t, "prod path", test.prodPath, system.GetContextValue(got.Context(), types.CANARY_PROD_PATH))
+	}
+}
+
+func TestCanaryBucket(t *testing.T) {
+	prodApp := &app.App{AppEntry: &types.AppEntry{Id: "app_prd_123", Path: "/app"}}
+	prodApp.Settings.Canary = types.CanaryConfig{Percent: 10, Sticky: types.CanaryStickyCookie}
+
+	// New user gets a cookie
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/app", nil)
+	bucket := canaryBucket(w, r, prodApp, "user1")
+	cookies := w.Result().Cookies()
+	testutil.AssertEqualsInt(t, "cookies", 1, len(cookies))
+	testutil.AssertEqualsString(t, "cookie name", CANARY_COOKIE_PREFIX+"app_prd_123", cookies[0].Name)
+	testutil.AssertEqualsString(t, "cookie value", strconv.Itoa(bucket), cookies[0].Value)
+
+	// Existing cookie is used
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/app", nil)
+	r.AddCookie(&http.Cookie{Name: CANARY_COOKIE_PREFIX + "app_prd_123", Value: "42"})
+	testutil.AssertEqualsInt(t, "cookie bucket", 42, canaryBucket(w, r, prodApp, "user1"))
+	testutil.AssertEqualsInt(t, "no new cookie", 0, len(w.Result().Cookies()))
+
+	// User hash is stable and does not set a cookie
+	prodApp.Settings.Canary.Sticky = types.CanaryStickyUser
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/app", nil)
+	b1 := canaryBucket(w, r, prodApp, "user1")
+	b2 := canaryBucket(w, r, prodApp, "user1")
+	testutil.AssertEqualsInt(t, "user bucket", b1, b2)
+	testutil.AssertEqualsInt(t, "no user cookie", 0, len(w.Result().Cookies()))
+
+	// Anonymous user falls back to cookie
+	w = httptest.NewRecorder()
+	canaryBucket(w, r, prodApp, types.ANONYMOUS_USER)
+	testutil.AssertEqualsInt(t, "anonymous cookie", 1, len(w.Result().Cookies()))
+}
+
+func TestCanaryStats(t *testing.T) {
+	s := &Server{Logger: testutil.TestLogger(), config: &types.ServerConfig{}}
+	var err error
+	s.auditDB, s.auditDbType, err = system.InitDBConnection("sqlite:"+path.Join(t.TempDir(), "audit.db"), "audit", system.DB_SQLITE_POSTGRES)
+	testutil.AssertNoError(t, err)
+	defer s.auditDB.Close()
+	testutil.AssertNoError(t, s.versionUpgradeAuditDB())
+
+	ctx := context.Background()
+	since := time.Now().Add(-time.Minute)
+	s.countCanaryRequest("app_prd_1", 2, 200)
+	s.countCanaryRequest("app_prd_1", 2, 0)
+	s.countCanaryRequest("app_stg_1", 3, 502)
+	s.countCanaryRequest("app_stg_1", 4, 200)
+
+	// Counts not yet saved are included
+	requests, errors, err := s.getRequestStats(ctx, "app_prd_1", 2, since)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "requests", 2, requests)
+	testutil.AssertEqualsInt(t, "errors", 0, errors)
+
+	testutil.AssertNoError(t, s.flushCanaryStats())
+	s.countCanaryRequest("app_stg_1", 3, 200)
+	requests, errors, err = s.getRequestStats(ctx, "app_stg_1", 3, since)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "stage requests", 2, requests)
+	testutil.AssertEqualsInt(t, "stage errors", 1, errors)
+
+	testutil.AssertNoError(t, s.flushCanaryStats())
+	requests, errors, err = s.getRequestStats(ctx, "app_stg_1", 3, since)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "saved requests", 2, requests)
+	testutil.AssertEqualsInt(t, "saved errors", 1, errors)
+
+	// Stats are per version and from the canary start time
+	requests, _, err = s.getRequestStats(ctx, "app_stg_1", 4, since)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "other version", 1, requests)
+	requests, _, err = s.getRequestStats(ctx, "app_stg_1", 3, time.Now().Add(time.Minute))
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "later start", 0, requests)
+
+	var rows int
+	testutil.AssertNoError(t, s.auditDB.QueryRow(`select count(*) from audit`).Scan(&rows))
+	testutil.AssertEqualsInt(t, "no audit rows", 0, rows)
+}
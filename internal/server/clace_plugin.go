@@ -5,6 +5,7 @@ package server
 
 import (
 	"cmp"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -111,7 +112,7 @@ func (c *clacePlugin) listAppsImpl(thread *starlark.Thread, _ *starlark.Builtin,
 	}
 
 	userId := system.GetRequestUserId(thread)
-	ret := starlark.List{}
+	listed := []types.AppInfo{}
 	for _, app := range apps {
 		if permCheck && !c.verifyHasAccess(userId, app.Auth) {
 			continue
@@ -153,7 +154,21 @@ func (c *clacePlugin) listAppsImpl(thread *starlark.Thread, _ *starlark.Builtin,
 				continue
 			}
 		}
+		listed = append(listed, app)
+	}
+
+	// Container usage for the last day, the stats are not set for apps without samples
+	appIds := make([]types.AppId, 0, len(listed))
+	for _, app := range listed {
+		appIds = append(appIds, app.Id)
+	}
+	containerStats, err := c.server.queryContainerStats(context.Background(), time.Now().Add(-24*time.Hour), appIds)
+	if err != nil {
+		return nil, err
+	}
 
+	ret := starlark.List{}
+	for _, app := range listed {
 		v := starlark.Dict{}
 		v.SetKey(starlark.String("name"), starlark.String(app.Name))
 		v.SetKey(starlark.String("url"), starlark.String(getAppUrl(app, c.server)))
@@ -203,6 +218,17 @@ func (c *clacePlugin) listAppsImpl(thread *starlark.Thread, _ *starlark.Builtin,
 		v.SetKey(starlark.String("version_mismatch"), starlark.Bool(versionMismatchMap[app.Id]))
 		v.SetKey(starlark.String("git_sha"), starlark.String(app.GitSha))
 		v.SetKey(starlark.String("git_message"), starlark.String(app.GitMessage))
+		if stats, ok := containerStats[app.Id]; ok {
+			statsDict := starlark.Dict{}
+			statsDict.SetKey(starlark.String("containers"), starlark.MakeInt(stats.Containers))
+			statsDict.SetKey(starlark.String("cpu_percent"), starlark.Float(stats.CpuPercent))
+			statsDict.SetKey(starlark.String("memory_bytes"), starlark.MakeInt64(stats.MemoryBytes))
+			statsDict.SetKey(starlark.String("peak_cpu_percent"), starlark.Float(stats.PeakCpuPercent))
+			statsDict.SetKey(starlark.String("peak_memory_bytes"), starlark.MakeInt64(stats.PeakMemoryBytes))
+			v.SetKey(starlark.String("container_stats"), &statsDict)
+		} else {
+			v.SetKey(starlark.String("container_stats"), starlark.None)
+		}
 
 		ret.Append(&v)
 	}
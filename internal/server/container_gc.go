@@ -0,0 +1,247 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/types"
+)
+
+// gcAppInfo has the info for an app which is used to decide which of its containers are retained
+type gcAppInfo struct {
+	isDev      bool
+	containers map[string]bool // containers for the active and previous versions, nil if these are not known
+}
+
+// ContainerGC removes the containers, images and networks which are no longer used by any app. Only the objects
+// created by this server instance are considered, along with the images pulled from the registry for the apps
+// on this server. The containers for the active and previous versions of each app, including the stage and
+// preview apps, are retained, along with their images. All the stopped containers of an app are retained if
+// the containers for its previous version are not known, which is the case until the app is switched to a new
+// version in the current server run. Running containers, the service containers and the retained command run
+// containers are not removed. Networks are removed only after the app is deleted. The volumes for deleted apps
+// are reported, they are removed only if removeVolumes is set. In dry run mode, the response has the entries
+// which would be removed
+func (s *Server) ContainerGC(ctx context.Context, dryRun, removeVolumes bool) (*types.ContainerGCResponse, error) {
+	if !container.RuntimeEnabled(&s.config.System) {
+		return nil, types.CreateRequestError("container support is not enabled on the server", http.StatusBadRequest)
+	}
+	runtime, err := container.NewContainerRuntime(s.Logger, &s.config.System)
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := s.getGCAppInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	liveImages := map[string]bool{}
+	for _, app := range s.apps.CachedApps() {
+		if image := app.ContainerImage(); image != "" {
+			liveImages[string(image)] = true
+		}
+	}
+
+	return containerGC(runtime, &s.config.System, apps, liveImages, dryRun, removeVolumes)
+}
+
+// getGCAppInfo returns the info for all the apps, including the stage and preview apps. The container names
+// are available only for the apps loaded in the app cache whose previous version containers are known, all
+// the containers are retained for the other apps
+func (s *Server) getGCAppInfo(ctx context.Context) (map[types.AppId]gcAppInfo, error) {
+	apps, err := s.db.GetAllApps(true)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ret := map[types.AppId]gcAppInfo{}
+	for _, appInfo := range apps {
+		appEntry, err := s.db.GetAppTx(ctx, tx, appInfo.AppPathDomain)
+		if err != nil {
+			return nil, err
+		}
+		ret[appEntry.Id] = gcAppInfo{isDev: appEntry.IsDev}
+	}
+
+	for _, app := range s.apps.CachedApps() {
+		info, ok := ret[app.Id]
+		names := app.ContainerNames()
+		if !ok || names == nil {
+			continue
+		}
+		info.containers = map[string]bool{}
+		for _, name := range names {
+			info.containers[string(name)] = true
+		}
+		ret[app.Id] = info
+	}
+	return ret, nil
+}
+
+// containerGC removes the unused containers, then the images not used by the retained containers and
+// the live apps, then the volumes and networks for deleted apps. Removal errors are added to the response
+func containerGC(runtime container.ContainerRuntime, config *types.SystemConfig, apps map[types.AppId]gcAppInfo,
+	liveImages map[string]bool, dryRun, removeVolumes bool) (*types.ContainerGCResponse, error) {
+	ret := &types.ContainerGCResponse{DryRun: dryRun, RemoveVolumes: removeVolumes, Containers: []string{}, Images: []string{}, Volumes: []string{}, Networks: []string{}, Errors: []string{}}
+	addError := func(err error) {
+		ret.Errors = append(ret.Errors, err.Error())
+	}
+
+	containers, err := runtime.GetContainers(config, "clc-", true)
+	if err != nil {
+		return nil, err
+	}
+	keepImages := map[string]bool{}
+	for _, c := range containers {
+		appId := container.ParseAppId(c.Names)
+		if appId == "" || c.Labels[container.INSTANCE_LABEL] != container.InstanceId() {
+			continue // not a clace app container, or created by another server instance
+		}
+		if !removeContainer(c, apps) {
+			keepImages[container.NormalizeImageName(c.Image)] = true
+			continue
+		}
+
+		ret.Containers = append(ret.Containers, c.Names)
+		if dryRun {
+			continue
+		}
+		if c.State == "running" {
+			if err := runtime.StopContainer(config, container.ContainerName(c.Names)); err != nil {
+				addError(err)
+				continue
+			}
+		}
+		if err := runtime.RemoveContainer(config, container.ContainerName(c.Names)); err != nil {
+			addError(err)
+		}
+	}
+
+	images, err := runtime.GetInstanceImages(config, "cli-")
+	if err != nil {
+		return nil, err
+	}
+	// Images pulled from the registry have the instance label of the server which built them. These are
+	// matched by name, for the apps present on this server
+	allImages, err := runtime.GetImages(config, "cli-*")
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range allImages {
+		if _, ok := apps[container.ParseAppId(image.Repository)]; ok && !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+	for _, image := range images {
+		appId := container.ParseAppId(image.Repository)
+		if appId == "" || keepImages[image.Repository] || liveImages[image.Repository] || apps[appId].isDev {
+			continue
+		}
+
+		ret.Images = append(ret.Images, image.Repository)
+		if dryRun {
+			continue
+		}
+		if err := runtime.RemoveImage(config, container.ImageName(image.Repository)); err != nil {
+			addError(err)
+		}
+	}
+
+	volumes, err := runtime.GetVolumes(config, "clv-")
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		appId := container.ParseAppId(string(volume))
+		if _, ok := apps[appId]; ok || appId == "" {
+			continue // volumes are retained while the app is present
+		}
+
+		ret.Volumes = append(ret.Volumes, string(volume))
+		if dryRun || !removeVolumes {
+			continue // volumes have the app data, they are removed only if explicitly requested
+		}
+		if err := runtime.RemoveVolume(config, volume); err != nil {
+			addError(err)
+		}
+	}
+
+	networks, err := runtime.GetNetworks(config, "cln-")
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		appId := container.ParseAppId(string(network))
+		if _, ok := apps[appId]; ok || appId == "" {
+			continue // the app network is retained while the app is present
+		}
+
+		ret.Networks = append(ret.Networks, string(network))
+		if dryRun {
+			continue
+		}
+		if err := runtime.RemoveNetwork(config, network); err != nil {
+			addError(err)
+		}
+	}
+	return ret, nil
+}
+
+// removeContainer checks whether the app container is no longer used. Containers for deleted apps are removed.
+// Stopped containers for prod apps are removed unless they are used by the active or previous app version. The
+// container name has the content hash, a container is shared by all the versions with the same hash
+func removeContainer(c container.Container, apps map[types.AppId]gcAppInfo) bool {
+	app, ok := apps[container.ParseAppId(c.Names)]
+	if !ok {
+		return true
+	}
+	if app.isDev || app.containers == nil || c.State == "running" || strings.Contains(c.Names, "-run-") ||
+		strings.Contains(c.Names, "-svc-") {
+		// Command run containers are removed as per the run_logs_retain config. Service containers are shared
+		// by the app versions, they are replaced by the container manager when the service config changes
+		return false
+	}
+	return !app.containers[c.Names]
+}
+
+// runContainerGC is called from the sync runner, the garbage collection is run once every
+// container_gc_mins interval
+func (s *Server) runContainerGC(ctx context.Context) {
+	if s.config.System.ContainerGCMins <= 0 || !container.RuntimeEnabled(&s.config.System) ||
+		time.Since(s.lastContainerGC) < time.Duration(s.config.System.ContainerGCMins)*time.Minute {
+		return
+	}
+	s.lastContainerGC = time.Now()
+
+	// Volumes are never removed by the background gc
+	ret, err := s.ContainerGC(ctx, false, false)
+	if err != nil {
+		s.Error().Err(err).Msg("Error running container gc")
+		return
+	}
+	if len(ret.Containers) > 0 || len(ret.Images) > 0 || len(ret.Networks) > 0 {
+		s.Info().Msgf("container gc: removed %d containers, %d images, %d networks",
+			len(ret.Containers), len(ret.Images), len(ret.Networks))
+	}
+	if len(ret.Volumes) > 0 {
+		s.Info().Msgf("container gc: %d volumes for deleted apps, use container gc --volumes to remove: %s",
+			len(ret.Volumes), strings.Join(ret.Volumes, ", "))
+	}
+	for _, e := range ret.Errors {
+		s.Warn().Msgf("container gc: %s", e)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/claceio/clace/internal/app/container"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestContainerGC(t *testing.T) {
+	runtime := container.NewFakeRuntime()
+	run := func(appEntry *types.AppEntry, name container.ContainerName, image container.ImageName, state string) {
+		if strings.HasPrefix(string(image), "cli-") {
+			testutil.AssertNoError(t, runtime.BuildImage(nil, image, "", "", nil, container.BuildOptions{}))
+		} else {
+			runtime.AddImage(image)
+		}
+		testutil.AssertNoError(t, runtime.RunContainer(nil, appEntry, name, image, 5000, nil, nil, nil))
+		runtime.SetContainerState(name, state)
+	}
+	version := func(id types.AppId, v int) *types.AppEntry {
+		entry := &types.AppEntry{Id: id}
+		entry.Metadata.VersionMetadata.Version = v
+		return entry
+	}
+
+	run(version("app_prd_1", 5), "clc-app_prd_1-h5", "cli-app_prd_1-h5", "exited")       // active version
+	run(version("app_prd_1", 2), "clc-app_prd_1-h4", "cli-app_prd_1-h4", "exited")       // previous version, container from an older version with the same hash
+	run(version("app_prd_1", 3), "clc-app_prd_1-h3", "cli-app_prd_1-h3", "exited")       // old version
+	run(version("app_prd_1", 2), "clc-app_prd_1-h2", "cli-app_prd_1-h2", "running")      // old version, still running
+	run(version("app_prd_1", 1), "clc-app_prd_1-h1-run-1", "cli-app_prd_1-h1", "exited") // command run container
+	run(version("app_prd_1", 1), "clc-app_prd_1-svc-db-abc", "postgres", "exited")       // service container
+	run(&types.AppEntry{Id: "app_dev_2", IsDev: true}, "clc-app_dev_2", "cli-app_dev_2", "exited")
+	run(version("app_prd_3", 1), "clc-app_prd_3-h1", "cli-app_prd_3-h1", "exited")                                // app not loaded
+	run(version("app_prd_9", 1), "clc-app_prd_9-h1", "cli-app_prd_9-h1", "running")                               // deleted app
+	testutil.AssertNoError(t, runtime.BuildImage(nil, "cli-app_prd_1-h0", "", "", nil, container.BuildOptions{})) // image without container
+	testutil.AssertNoError(t, runtime.BuildImage(nil, "cli-app_prd_1-live", "", "", nil, container.BuildOptions{}))
+	runtime.AddImage("cli-app_prd_7-h1")     // image from another server instance, without the instance label
+	runtime.AddImage("cli-app_prd_1-pulled") // image pulled from the registry, without the instance label
+	runtime.AddImage("nginx")
+	testutil.AssertNoError(t, runtime.VolumeCreate(nil, container.GenVolumeName("app_prd_1", "data")))
+	testutil.AssertNoError(t, runtime.VolumeCreate(nil, container.GenVolumeName("app_prd_9", "data")))
+	testutil.AssertNoError(t, runtime.NetworkCreate(nil, container.GenNetworkName("app_prd_1")))
+	testutil.AssertNoError(t, runtime.NetworkCreate(nil, container.GenNetworkName("app_prd_9")))
+
+	apps := map[types.AppId]gcAppInfo{
+		"app_prd_1": {containers: map[string]bool{"clc-app_prd_1-h5": true, "clc-app_prd_1-h4": true}},
+		"app_dev_2": {isDev: true},
+		"app_prd_3": {}, // not loaded, or the previous version containers are not known
+	}
+	liveImages := map[string]bool{"cli-app_prd_1-live": true}
+
+	ret, err := containerGC(runtime, nil, apps, liveImages, true, true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "containers", "clc-app_prd_1-h3,clc-app_prd_9-h1", strings.Join(ret.Containers, ","))
+	testutil.AssertEqualsString(t, "images", "cli-app_prd_1-h0,cli-app_prd_1-h3,cli-app_prd_9-h1,cli-app_prd_1-pulled", strings.Join(ret.Images, ","))
+	testutil.AssertEqualsString(t, "volumes", string(container.GenVolumeName("app_prd_9", "data")), strings.Join(ret.Volumes, ","))
+	testutil.AssertEqualsString(t, "networks", "cln-app_prd_9", strings.Join(ret.Networks, ","))
+	if runtime.GetContainer("clc-app_prd_1-h3") == nil {
+		t.Fatalf("dry run removed container")
+	}
+
+	ret, err = containerGC(runtime, nil, apps, liveImages, false, false)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "errors", 0, len(ret.Errors))
+	if runtime.GetContainer("clc-app_prd_1-h3") != nil || runtime.GetContainer("clc-app_prd_9-h1") != nil {
+		t.Fatalf("containers not removed")
+	}
+	for _, name := range []container.ContainerName{"clc-app_prd_1-h5", "clc-app_prd_1-h4", "clc-app_prd_1-svc-db-abc", "clc-app_prd_3-h1"} {
+		if runtime.GetContainer(name) == nil {
+			t.Fatalf("container %s removed", name)
+		}
+	}
+	images, err := runtime.GetImages(nil, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "images retained", 10, len(images))
+	networks, err := runtime.GetNetworks(nil, "cln-")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "networks retained", 1, len(networks))
+
+	// Volumes are reported, but removed only when requested
+	testutil.AssertEqualsInt(t, "volumes reported", 1, len(ret.Volumes))
+	volumes, err := runtime.GetVolumes(nil, "clv-")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "volumes retained", 2, len(volumes))
+
+	ret, err = containerGC(runtime, nil, apps, liveImages, false, true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "containers", 0, len(ret.Containers)+len(ret.Images)+len(ret.Networks))
+	testutil.AssertEqualsInt(t, "volumes removed", 1, len(ret.Volumes))
+	volumes, err = runtime.GetVolumes(nil, "clv-")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "volumes retained", 1, len(volumes))
+
+	// Nothing more to remove
+	ret, err = containerGC(runtime, nil, apps, liveImages, false, true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "containers", 0, len(ret.Containers)+len(ret.Images)+len(ret.Volumes)+len(ret.Networks))
+}
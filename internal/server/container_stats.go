@@ -0,0 +1,110 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+// InsertContainerStats saves the container resource usage sample for an app, called by the app stats sampler
+func (s *Server) InsertContainerStats(sample *types.ContainerStatsSample) error {
+	_, err := s.auditDB.Exec(system.RebindQuery(s.auditDbType, `insert into container_stats (app_id, create_time, cpu_percent, memory_bytes, containers) `+
+		`values (?, ?, ?, ?, ?)`),
+		sample.AppId, sample.CreateTime.UnixNano(), sample.CpuPercent, sample.MemoryBytes, sample.Containers)
+	return err
+}
+
+// GetAppStats returns the container resource usage for the apps matching the glob, for the samples newer
+// than the since duration. Apps without any samples, like apps not using containers, are not included
+func (s *Server) GetAppStats(ctx context.Context, appPathGlob string, includeInternal bool, since time.Duration) (*types.AppStatsResponse, error) {
+	apps, err := s.FilterApps(appPathGlob, includeInternal)
+	if err != nil {
+		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+	}
+
+	appIds := make([]types.AppId, 0, len(apps))
+	for _, appInfo := range apps {
+		appIds = append(appIds, appInfo.Id)
+	}
+	stats, err := s.queryContainerStats(ctx, time.Now().Add(-since), appIds)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &types.AppStatsResponse{Stats: []types.AppStats{}}
+	for _, appInfo := range apps {
+		appStats, ok := stats[appInfo.Id]
+		if !ok {
+			continue
+		}
+		appStats.AppPathDomain = appInfo.AppPathDomain
+		ret.Stats = append(ret.Stats, *appStats)
+	}
+	return ret, nil
+}
+
+// queryContainerStats returns the stats for the specified apps having samples newer than the start time, keyed by app id
+func (s *Server) queryContainerStats(ctx context.Context, startTime time.Time, appIds []types.AppId) (map[types.AppId]*types.AppStats, error) {
+	ret := map[types.AppId]*types.AppStats{}
+	if len(appIds) == 0 {
+		return ret, nil
+	}
+
+	condition := "create_time >= ? and app_id in (" + strings.Repeat("?, ", len(appIds)-1) + "?)"
+	params := []any{startTime.UnixNano()}
+	for _, appId := range appIds {
+		params = append(params, string(appId))
+	}
+	rows, err := s.auditDB.QueryContext(ctx, system.RebindQuery(s.auditDbType,
+		`select app_id, max(cpu_percent), max(memory_bytes), count(*) from container_stats where `+condition+` group by app_id`), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stats := &types.AppStats{}
+		if err := rows.Scan(&stats.Id, &stats.PeakCpuPercent, &stats.PeakMemoryBytes, &stats.Samples); err != nil {
+			return nil, err
+		}
+		ret[stats.Id] = stats
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The current values are from the latest sample for each app
+	latestRows, err := s.auditDB.QueryContext(ctx, system.RebindQuery(s.auditDbType,
+		`select s.app_id, s.create_time, s.cpu_percent, s.memory_bytes, s.containers from container_stats s `+
+			`join (select app_id, max(create_time) as max_time from container_stats where `+condition+` group by app_id) m `+
+			`on s.app_id = m.app_id and s.create_time = m.max_time`), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer latestRows.Close()
+
+	for latestRows.Next() {
+		var appId types.AppId
+		var createTime int64
+		var cpuPercent float64
+		var memoryBytes int64
+		var containers int
+		if err := latestRows.Scan(&appId, &createTime, &cpuPercent, &memoryBytes, &containers); err != nil {
+			return nil, err
+		}
+		if stats, ok := ret[appId]; ok {
+			stats.LastSampleTime = time.Unix(0, createTime).UTC()
+			stats.CpuPercent = cpuPercent
+			stats.MemoryBytes = memoryBytes
+			stats.Containers = containers
+		}
+	}
+	return ret, latestRows.Err()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestContainerStats(t *testing.T) {
+	s := &Server{Logger: testutil.TestLogger(), config: &types.ServerConfig{}}
+	var err error
+	s.auditDB, s.auditDbType, err = system.InitDBConnection("sqlite:"+path.Join(t.TempDir(), "audit.db"), "audit", system.DB_SQLITE_POSTGRES)
+	testutil.AssertNoError(t, err)
+	defer s.auditDB.Close()
+	testutil.AssertNoError(t, s.versionUpgradeAuditDB())
+
+	now := time.Now()
+	for _, sample := range []types.ContainerStatsSample{
+		{AppId: "app_prd_1", CreateTime: now.Add(-3 * time.Hour), CpuPercent: 90, MemoryBytes: 900}, // outside the window
+		{AppId: "app_prd_1", CreateTime: now.Add(-30 * time.Minute), CpuPercent: 50, MemoryBytes: 500, Containers: 2},
+		{AppId: "app_prd_1", CreateTime: now.Add(-time.Minute), CpuPercent: 10, MemoryBytes: 700, Containers: 3},
+		{AppId: "app_prd_2", CreateTime: now.Add(-2 * time.Minute), CpuPercent: 1.5, MemoryBytes: 100, Containers: 1},
+	} {
+		testutil.AssertNoError(t, s.InsertContainerStats(&sample))
+	}
+
+	stats, err := s.queryContainerStats(context.Background(), now.Add(-time.Hour), []types.AppId{"app_prd_1", "app_prd_2", "app_prd_3"})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "apps", 2, len(stats))
+	app1 := stats["app_prd_1"]
+	testutil.AssertEqualsInt(t, "samples", 2, app1.Samples)
+	testutil.AssertEqualsInt(t, "containers", 3, app1.Containers)
+	testutil.AssertEqualsInt(t, "cpu", 10, int(app1.CpuPercent))
+	testutil.AssertEqualsInt(t, "memory", 700, int(app1.MemoryBytes))
+	testutil.AssertEqualsInt(t, "peak cpu", 50, int(app1.PeakCpuPercent))
+	testutil.AssertEqualsInt(t, "peak memory", 700, int(app1.PeakMemoryBytes))
+	testutil.AssertEqualsString(t, "last sample", now.Add(-time.Minute).UTC().Format(time.RFC3339Nano),
+		app1.LastSampleTime.Format(time.RFC3339Nano))
+	testutil.AssertEqualsInt(t, "memory", 100, int(stats["app_prd_2"].MemoryBytes))
+
+	// Only the requested apps are queried
+	stats, err = s.queryContainerStats(context.Background(), now.Add(-time.Hour), []types.AppId{"app_prd_2"})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "apps", 1, len(stats))
+	testutil.AssertEqualsInt(t, "memory", 100, int(stats["app_prd_2"].MemoryBytes))
+	stats, err = s.queryContainerStats(context.Background(), now.Add(-time.Hour), nil)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "apps", 0, len(stats))
+}
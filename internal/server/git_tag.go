@@ -0,0 +1,138 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+const (
+	GIT_TAG_LATEST = "latest" // latest semver tag
+	PEELED_SUFFIX  = "^{}"
+)
+
+type semVersion struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseSemver parses tags like v1.2.3, 1.2 and v1.2.3-rc1. Build metadata is ignored
+func parseSemver(tag string) (semVersion, bool) {
+	v := strings.TrimPrefix(tag, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ := strings.Cut(v, "-")
+
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return semVersion{}, false
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semVersion{}, false
+		}
+		nums[i] = n
+	}
+	return semVersion{major: nums[0], minor: nums[1], patch: nums[2], pre: pre}, true
+}
+
+func compareSemver(a, b semVersion) int {
+	if c := cmp.Or(cmp.Compare(a.major, b.major), cmp.Compare(a.minor, b.minor), cmp.Compare(a.patch, b.patch)); c != 0 {
+		return c
+	}
+	switch {
+	case a.pre == b.pre:
+		return 0
+	case a.pre == "":
+		return 1 // release is higher than pre-release
+	case b.pre == "":
+		return -1
+	}
+	return strings.Compare(a.pre, b.pre)
+}
+
+func isTagPattern(tag string) bool {
+	return tag == GIT_TAG_LATEST || strings.ContainsAny(tag, "*?[")
+}
+
+// selectTag returns the tag to checkout from the available tags. A plain tag name has to match exactly.
+// For a glob pattern like v1.* or for "latest", the highest semver tag matching the pattern is returned.
+// Pre-release tags are used only when specified exactly
+func selectTag(tags []string, pattern string) (string, error) {
+	if !isTagPattern(pattern) {
+		for _, tag := range tags {
+			if tag == pattern {
+				return tag, nil
+			}
+		}
+		return "", fmt.Errorf("tag %s not found", pattern)
+	}
+
+	bestTag := ""
+	var best semVersion
+	for _, tag := range tags {
+		if pattern != GIT_TAG_LATEST {
+			if matched, err := path.Match(pattern, tag); err != nil {
+				return "", fmt.Errorf("invalid tag pattern %s: %w", pattern, err)
+			} else if !matched {
+				continue
+			}
+		}
+
+		v, ok := parseSemver(tag)
+		if !ok || v.pre != "" {
+			continue
+		}
+		if bestTag == "" || compareSemver(v, best) > 0 {
+			bestTag, best = tag, v
+		}
+	}
+
+	if bestTag == "" {
+		return "", fmt.Errorf("no semver tag found matching %s", pattern)
+	}
+	return bestTag, nil
+}
+
+// listTags returns the tags in the remote repo, mapped to the commit sha. For annotated tags,
+// the peeled commit sha is used
+func listTags(repoURL string, auth transport.AuthMethod) (map[string]string, error) {
+	remoteCfg := &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repoURL},
+	}
+	remote := git.NewRemote(memory.NewStorage(), remoteCfg)
+
+	refs, err := remote.List(&git.ListOptions{
+		Auth:          auth,
+		PeelingOption: git.AppendPeeled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list remote refs: %w", err)
+	}
+
+	tags := map[string]string{}
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		name := ref.Name().Short()
+		if peeled, ok := strings.CutSuffix(name, PEELED_SUFFIX); ok {
+			tags[peeled] = ref.Hash().String() // commit for the annotated tag
+		} else if _, ok := tags[name]; !ok {
+			tags[name] = ref.Hash().String()
+		}
+	}
+	return tags, nil
+}
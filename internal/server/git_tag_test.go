@@ -0,0 +1,110 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestSelectTag(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.2.0", "v1.10.1", "v1.11.0-rc1", "v2.0.0", "v2.1", "release-1", "1.5.0"}
+
+	tests := []struct {
+		pattern, want, err string
+	}{
+		{"v1.2.0", "v1.2.0", ""},
+		{"v1.11.0-rc1", "v1.11.0-rc1", ""},
+		{"release-1", "release-1", ""},
+		{"v3.0.0", "", "tag v3.0.0 not found"},
+		{"v1.*", "v1.10.1", ""},
+		{"v2.*", "v2.1", ""},
+		{"v*", "v2.1", ""},
+		{"latest", "v2.1", ""},
+		{"release-*", "", "no semver tag found matching release-*"},
+		{"v[", "", "invalid tag pattern v["},
+	}
+
+	for _, test := range tests {
+		got, err := selectTag(tags, test.pattern)
+		if test.err != "" {
+			testutil.AssertErrorContains(t, err, test.err)
+			continue
+		}
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsString(t, test.pattern, test.want, got)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.0.0", "v1.0.0", 0},
+		{"v1.0", "1.0.0", 0},
+		{"v1.0.1", "v1.0.0", 1},
+		{"v1.9.0", "v1.10.0", -1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.0.0-rc1", "v1.0.0", -1},
+		{"v1.0.0-rc2", "v1.0.0-rc1", 1},
+		{"v1.0.0+build1", "v1.0.0", 0},
+	}
+
+	for _, test := range tests {
+		a, ok := parseSemver(test.a)
+		testutil.AssertEqualsBool(t, test.a, true, ok)
+		b, ok := parseSemver(test.b)
+		testutil.AssertEqualsBool(t, test.b, true, ok)
+		testutil.AssertEqualsInt(t, test.a+" "+test.b, test.want, compareSemver(a, b))
+	}
+
+	for _, invalid := range []string{"main", "v1.x", "1.2.3.4", "v"} {
+		_, ok := parseSemver(invalid)
+		testutil.AssertEqualsBool(t, invalid, false, ok)
+	}
+}
+
+func TestListTags(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	testutil.AssertNoError(t, err)
+	w, err := repo.Worktree()
+	testutil.AssertNoError(t, err)
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit := func(content string) string {
+		testutil.AssertNoError(t, os.WriteFile(filepath.Join(dir, "app.star"), []byte(content), 0644))
+		_, err := w.Add("app.star")
+		testutil.AssertNoError(t, err)
+		hash, err := w.Commit(content, &git.CommitOptions{Author: sig})
+		testutil.AssertNoError(t, err)
+		return hash.String()
+	}
+
+	c1 := commit("one")
+	head, err := repo.Head()
+	testutil.AssertNoError(t, err)
+	_, err = repo.CreateTag("v1.0.0", head.Hash(), nil) // lightweight tag
+	testutil.AssertNoError(t, err)
+
+	c2 := commit("two")
+	head, err = repo.Head()
+	testutil.AssertNoError(t, err)
+	_, err = repo.CreateTag("v1.1.0", head.Hash(), &git.CreateTagOptions{Tagger: sig, Message: "release"}) // annotated tag
+	testutil.AssertNoError(t, err)
+	commit("three")
+
+	tags, err := listTags(dir, nil)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "tags", 2, len(tags))
+	testutil.AssertEqualsString(t, "lightweight", c1, tags["v1.0.0"])
+	testutil.AssertEqualsString(t, "annotated", c2, tags["v1.1.0"])
+}
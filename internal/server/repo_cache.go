@@ -6,7 +6,9 @@ package server
 import (
 	"cmp"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -20,6 +22,7 @@ import (
 type Repo struct {
 	url    string
 	branch string
+	tag    string
 	commit string
 	auth   string
 }
@@ -35,6 +38,7 @@ type RepoCache struct {
 	rootDir  string
 	cache    map[Repo]CacheDir
 	shaCache map[Repo]string // Cache for commit hashes
+	tagCache map[Repo]string // Cache for resolved tag names
 }
 
 func NewRepoCache(server *Server) (*RepoCache, error) {
@@ -47,6 +51,7 @@ func NewRepoCache(server *Server) (*RepoCache, error) {
 		rootDir:  tmpDir,
 		cache:    make(map[Repo]CacheDir),
 		shaCache: make(map[Repo]string),
+		tagCache: make(map[Repo]string),
 	}, nil
 }
 
@@ -64,7 +69,7 @@ func (r *RepoCache) GetSha(sourceUrl, branch, gitAuth string) (string, error) {
 	}
 
 	// Check if we have the commit in cache
-	if sha, ok := r.shaCache[Repo{repo, branch, "", gitAuth}]; ok {
+	if sha, ok := r.shaCache[Repo{repo, branch, "", "", gitAuth}]; ok {
 		return sha, nil
 	}
 
@@ -78,10 +83,50 @@ func (r *RepoCache) GetSha(sourceUrl, branch, gitAuth string) (string, error) {
 	}
 
 	sha, err := latestCommitSHA(repo, branch, auth)
-	r.shaCache[Repo{repo, branch, "", gitAuth}] = sha
+	r.shaCache[Repo{repo, branch, "", "", gitAuth}] = sha
 	return sha, nil
 }
 
+// ResolveTag returns the tag matching the tag name or pattern and its commit sha
+func (r *RepoCache) ResolveTag(sourceUrl, tagPattern, gitAuth string) (string, string, error) {
+	gitAuth = cmp.Or(gitAuth, r.server.config.Security.DefaultGitAuth)
+	authEntry, err := r.server.loadGitKey(gitAuth)
+	if err != nil {
+		return "", "", err
+	}
+
+	repo, _, err := parseGithubUrl(sourceUrl, authEntry.usingSSH)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := Repo{repo, "", tagPattern, "", gitAuth}
+	if tag, ok := r.tagCache[key]; ok {
+		return tag, r.shaCache[key], nil
+	}
+
+	var auth transport.AuthMethod
+	if gitAuth != "" {
+		auth, err = r.createAuthMethod(gitAuth)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	tags, err := listTags(repo, auth)
+	if err != nil {
+		return "", "", err
+	}
+	tag, err := selectTag(slices.Collect(maps.Keys(tags)), tagPattern)
+	if err != nil {
+		return "", "", err
+	}
+
+	r.tagCache[key] = tag
+	r.shaCache[key] = tags[tag]
+	return tag, tags[tag], nil
+}
+
 func (r *RepoCache) createAuthMethod(gitAuth string) (transport.AuthMethod, error) {
 	authEntry, err := r.server.loadGitKey(gitAuth)
 	if err != nil {
@@ -124,7 +169,9 @@ func latestCommitSHA(repoURL, branch string, auth transport.AuthMethod) (string,
 	return "", fmt.Errorf("branch %q not found", branch)
 }
 
-func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (string, string, string, string, error) {
+// CheckoutRepo checks out the repo at the specified commit. If commit is not specified, the tag is checked
+// out if specified, otherwise the head of the branch is checked out
+func (r *RepoCache) CheckoutRepo(sourceUrl, branch, tag, commit, gitAuth string) (string, string, string, string, error) {
 	gitAuth = cmp.Or(gitAuth, r.server.config.Security.DefaultGitAuth)
 	authEntry, err := r.server.loadGitKey(gitAuth)
 	if err != nil {
@@ -137,7 +184,7 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 		return "", "", "", "", err
 	}
 
-	dir, ok := r.cache[Repo{repo, branch, commit, gitAuth}]
+	dir, ok := r.cache[Repo{repo, branch, tag, commit, gitAuth}]
 	if ok {
 		return dir.dir, folder, dir.commitMessage, dir.hash, nil
 	}
@@ -146,9 +193,13 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 		URL: repo,
 	}
 
+	refName := plumbing.NewBranchReferenceName(branch)
+	if tag != "" {
+		refName = plumbing.NewTagReferenceName(tag)
+	}
 	if commit == "" {
-		// No commit id specified, checkout specified branch
-		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		// No commit id specified, checkout specified tag or branch
+		cloneOptions.ReferenceName = refName
 		cloneOptions.SingleBranch = true
 		cloneOptions.Depth = 1
 	}
@@ -171,7 +222,7 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 	r.server.Info().Msgf("Cloning git repo %s to %s", repo, targetPath)
 	gitRepo, err := git.PlainClone(targetPath, false, &cloneOptions)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("error checking out branch %s: %w", branch, err)
+		return "", "", "", "", fmt.Errorf("error checking out %s: %w", refName.Short(), err)
 	}
 
 	w, err := gitRepo.Worktree()
@@ -184,7 +235,7 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 		r.server.Info().Msgf("Checking out commit %s", commit)
 		options.Hash = plumbing.NewHash(commit)
 	} else {
-		options.Branch = plumbing.NewBranchReferenceName(branch)
+		options.Branch = refName
 	}
 
 	/* Sparse checkout seems to not be reliable with go-git
@@ -193,7 +244,7 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 	}
 	*/
 	if err := w.Checkout(&options); err != nil {
-		return "", "", "", "", fmt.Errorf("error checking out branch %s commit %s: %w", branch, commit, err)
+		return "", "", "", "", fmt.Errorf("error checking out %s commit %s: %w", refName.Short(), commit, err)
 	}
 
 	ref, err := gitRepo.Head()
@@ -206,7 +257,7 @@ func (r *RepoCache) CheckoutRepo(sourceUrl, branch, commit, gitAuth string) (str
 	}
 
 	// Save the repo in cache
-	r.cache[Repo{repo, branch, commit, gitAuth}] = CacheDir{
+	r.cache[Repo{repo, branch, tag, commit, gitAuth}] = CacheDir{
 		dir:           targetPath,
 		commitMessage: newCommit.Message,
 		hash:          newCommit.Hash.String(),
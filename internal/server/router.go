@@ -4,9 +4,9 @@
 package server
 
 import (
+	"cmp"
 	"crypto/hmac"
 	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/app/container"
 	"github.com/claceio/clace/internal/system"
 	"github.com/claceio/clace/internal/types"
 	"github.com/go-chi/chi"
@@ -303,6 +304,38 @@ func (h *Handler) apiHandler(w http.ResponseWriter, r *http.Request, enableBasic
 		return
 	}
 
+	if upgrade, ok := resp.(upgradeResponse); ok {
+		// The connection is switched to a raw stream. A start event is inserted before the switch, so that
+		// the session is audited even if the server stops while the session is in progress. The event for
+		// the session is inserted after the session ends
+		startEvent := event
+		startEvent.Operation += "_start"
+		if err := h.server.InsertAuditEvent(&startEvent); err != nil {
+			h.Error().Err(err).Msg("error inserting audit event")
+		}
+		detail, err := upgradeConnection(w, r, upgrade)
+		event.Detail = detail
+		if err != nil {
+			event.Status = string(types.EventStatusFailure)
+			h.Error().Err(err).Msg("error in upgraded connection")
+		}
+		return
+	}
+
+	if stream, ok := resp.(streamResponse); ok {
+		// Streaming responses can be long running, like logs with follow, disable the write timeout
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		if err := stream(&flushWriter{w: w, rc: rc}); err != nil {
+			// Response status is already sent, add the error to the response body
+			event.Status = string(types.EventStatusFailure)
+			h.Error().Err(err).Msg("error streaming response")
+			fmt.Fprintf(w, "error: %s\n", err)
+		}
+		return
+	}
+
 	if resp == nil {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -317,6 +350,50 @@ func (h *Handler) apiHandler(w http.ResponseWriter, r *http.Request, enableBasic
 	}
 }
 
+// streamResponse is returned by the API functions which write the response directly, like the log streaming API
+type streamResponse func(w io.Writer) error
+
+// upgradeResponse is returned by the API functions which switch the connection to the protocol requested
+// in the Upgrade header, like the app exec API. The function returns the detail for the audit event
+type upgradeResponse func(conn io.ReadWriter) (string, error)
+
+// upgradeConnection hijacks the connection, sends the protocol switch response and calls the upgrade
+// function with the connection. The connection is closed after the function returns
+func upgradeConnection(w http.ResponseWriter, r *http.Request, upgrade upgradeResponse) (string, error) {
+	conn, bufrw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return "", fmt.Errorf("error switching protocol: %w", err)
+	}
+	defer conn.Close()
+	// Sessions can be long running, clear the server read and write timeouts
+	_ = conn.SetDeadline(time.Time{})
+
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", http.StatusSwitchingProtocols,
+		http.StatusText(http.StatusSwitchingProtocols), r.Header.Get("Upgrade")); err != nil {
+		return "", err
+	}
+	// Data sent by the client after the request could be buffered in the reader
+	return upgrade(struct {
+		io.Reader
+		io.Writer
+	}{bufrw.Reader, conn})
+}
+
+// flushWriter flushes the response after every write, so that the streamed data is sent to the client immediately
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(data []byte) (int, error) {
+	n, err := f.w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	_ = f.rc.Flush()
+	return n, nil
+}
+
 // webhookHandler does the bearer token auth check and calls the webhook api
 func (h *Handler) webhookHandler(w http.ResponseWriter, r *http.Request, webhookType types.WebhookType) {
 	appPath := r.URL.Query().Get("appPath")
@@ -367,37 +444,9 @@ func (h *Handler) webhookHandler(w http.ResponseWriter, r *http.Request, webhook
 	}
 
 	// Authenticate the request
-	authHeader := r.Header.Get("Authorization")
-	if authHeader != "" {
-		// Using Authentication header, bearer token
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Authorization header with bearer token is required", http.StatusUnauthorized)
-			return
-		}
-		authHeader = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-		if authHeader == "" {
-			http.Error(w, "Bearer token is required", http.StatusUnauthorized)
-			return
-		}
-
-		if subtle.ConstantTimeCompare([]byte(appToken), []byte(authHeader)) != 1 {
-			http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
-			return
-		}
-	} else {
-		// Using signature auth
-		// https://docs.github.com/en/webhooks/webhook-events-and-payloads#delivery-headers
-		signature := r.Header.Get("X-Hub-Signature-256")
-		if signature == "" {
-			http.Error(w, "No auth header and no signature found", http.StatusUnauthorized)
-			return
-		}
-
-		err = validateSignature(appToken, signature, body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	if err := checkWebhookAuth(r, appToken, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
 	}
 
 	h.Trace().Str("method", r.Method).Str("url", r.URL.String()).Msg("API Received request")
@@ -420,7 +469,10 @@ func (h *Handler) webhookHandler(w http.ResponseWriter, r *http.Request, webhook
 			http.Error(w, "Could not find branch info in request payload, ref key should be present", http.StatusBadGateway)
 			return
 		}
-		if strings.HasPrefix(branchStr, "refs/heads/") {
+		if tagStr, ok := strings.CutPrefix(branchStr, "refs/tags/"); ok && app.Metadata.VersionMetadata.GitTagPattern != "" {
+			// App is tracking a tag pattern, the reload picks up the matching tag
+			h.Info().Msgf("Webhook call for reload, tag %s pushed, app tracks %s", tagStr, app.Metadata.VersionMetadata.GitTagPattern)
+		} else if strings.HasPrefix(branchStr, "refs/heads/") {
 			branchStr = branchStr[len("refs/heads/"):]
 			if branchStr != app.Metadata.VersionMetadata.GitBranch {
 				h.Info().Msgf("Ignoring webhook call for reload, branch mismatch, found %s, expected %s", branchStr, app.Metadata.VersionMetadata.GitBranch)
@@ -435,7 +487,7 @@ func (h *Handler) webhookHandler(w http.ResponseWriter, r *http.Request, webhook
 	}
 
 	if reload {
-		resp, err = h.server.ReloadApps(r.Context(), appPath, false, false, promote, "", "", "", true)
+		resp, err = h.server.ReloadApps(r.Context(), appPath, false, false, promote, "", "", "", "", true)
 	} else {
 		// promote operation
 		resp, err = h.server.PromoteApps(r.Context(), appPath, false)
@@ -701,7 +753,7 @@ func (h *Handler) reloadApps(r *http.Request) (any, error) {
 	updateOperationInContext(r, genOperationName("reload_apps", promote, approve))
 
 	ret, err := h.server.ReloadApps(r.Context(), appPathGlob, approve, dryRun, promote,
-		r.URL.Query().Get("branch"), r.URL.Query().Get("commit"), r.URL.Query().Get("gitAuth"), forceReload)
+		r.URL.Query().Get("branch"), r.URL.Query().Get("tag"), r.URL.Query().Get("commit"), r.URL.Query().Get("gitAuth"), forceReload)
 	if err != nil {
 		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
 	}
@@ -865,6 +917,46 @@ func (h *Handler) versionFiles(r *http.Request) (any, error) {
 	return ret, nil
 }
 
+func (h *Handler) versionDiff(r *http.Request) (any, error) {
+	appPath := r.URL.Query().Get("appPath")
+	if appPath == "" {
+		return nil, types.CreateRequestError("appPath is required", http.StatusBadRequest)
+	}
+	fromVersion := r.URL.Query().Get("from")
+	toVersion := r.URL.Query().Get("to")
+	if fromVersion == "" || toVersion == "" {
+		return nil, types.CreateRequestError("from and to versions are required", http.StatusBadRequest)
+	}
+	updateTargetInContext(r, appPath, false)
+	updateOperationInContext(r, genOperationName("version_diff", false, false))
+
+	return h.server.VersionDiff(r.Context(), appPath, fromVersion, toVersion)
+}
+
+func (h *Handler) versionGC(r *http.Request) (any, error) {
+	dryRun, err := parseBoolArg(r.URL.Query().Get(DRY_RUN_ARG), false)
+	if err != nil {
+		return nil, err
+	}
+	updateTargetInContext(r, "*", dryRun)
+
+	return h.server.VersionGC(r.Context(), dryRun)
+}
+
+func (h *Handler) containerGC(r *http.Request) (any, error) {
+	dryRun, err := parseBoolArg(r.URL.Query().Get(DRY_RUN_ARG), false)
+	if err != nil {
+		return nil, err
+	}
+	removeVolumes, err := parseBoolArg(r.URL.Query().Get("volumes"), false)
+	if err != nil {
+		return nil, err
+	}
+	updateTargetInContext(r, "*", dryRun)
+
+	return h.server.ContainerGC(r.Context(), dryRun, removeVolumes)
+}
+
 func (h *Handler) versionSwitch(r *http.Request) (any, error) {
 	appPath := r.URL.Query().Get("appPath")
 	if appPath == "" {
@@ -901,6 +993,150 @@ func (h *Handler) tokenList(r *http.Request) (any, error) {
 	return ret, nil
 }
 
+func (h *Handler) appLogs(r *http.Request) (any, error) {
+	query := r.URL.Query()
+	appPath := query.Get("appPath")
+	if appPath == "" {
+		return nil, types.CreateRequestError("appPath is required", http.StatusBadRequest)
+	}
+	updateTargetInContext(r, appPath, false)
+
+	follow, err := parseBoolArg(query.Get("follow"), false)
+	if err != nil {
+		return nil, err
+	}
+	linked, err := parseBoolArg(query.Get("linked"), false)
+	if err != nil {
+		return nil, err
+	}
+	build, err := parseBoolArg(query.Get("build"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	if build {
+		if follow || linked {
+			return nil, types.CreateRequestError("follow and linked are not supported for build logs", http.StatusBadRequest)
+		}
+		version := 0
+		if versionStr := query.Get("version"); versionStr != "" {
+			if version, err = strconv.Atoi(versionStr); err != nil || version <= 0 {
+				return nil, types.CreateRequestError(fmt.Sprintf("invalid version %s", versionStr), http.StatusBadRequest)
+			}
+		}
+		stream, err := h.server.GetBuildLogs(r.Context(), appPath, version)
+		if err != nil {
+			return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+		}
+		return streamResponse(stream), nil
+	}
+
+	opts := container.LogOptions{Follow: follow}
+	if since := query.Get("since"); since != "" {
+		if opts.Since, err = time.ParseDuration(since); err != nil || opts.Since < 0 {
+			return nil, types.CreateRequestError(fmt.Sprintf("invalid since value %s, expected a duration like 10m", since), http.StatusBadRequest)
+		}
+	}
+	if tail := query.Get("tail"); tail != "" {
+		if opts.Tail, err = strconv.Atoi(tail); err != nil || opts.Tail < 0 {
+			return nil, types.CreateRequestError(fmt.Sprintf("invalid tail value %s, expected a line count", tail), http.StatusBadRequest)
+		}
+	}
+
+	stream, err := h.server.GetAppLogs(r.Context(), appPath, linked, opts)
+	if err != nil {
+		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+	}
+	return streamResponse(stream), nil
+}
+
+func (h *Handler) appExec(r *http.Request) (any, error) {
+	query := r.URL.Query()
+	appPath := query.Get("appPath")
+	if appPath == "" {
+		return nil, types.CreateRequestError("appPath is required", http.StatusBadRequest)
+	}
+	updateTargetInContext(r, appPath, false)
+	if !strings.EqualFold(r.Header.Get("Upgrade"), system.EXEC_PROTOCOL) {
+		return nil, types.CreateRequestError(fmt.Sprintf("Upgrade header with %s protocol is required", system.EXEC_PROTOCOL), http.StatusBadRequest)
+	}
+
+	opts := container.ExecOptions{Cmd: query["cmd"]}
+	if len(opts.Cmd) == 0 {
+		return nil, types.CreateRequestError("cmd is required", http.StatusBadRequest)
+	}
+	var err error
+	if opts.Tty, err = parseBoolArg(query.Get("tty"), false); err != nil {
+		return nil, err
+	}
+	interactive, err := parseBoolArg(query.Get("interactive"), false)
+	if err != nil {
+		return nil, err
+	}
+	replica := 0
+	if replicaStr := query.Get("replica"); replicaStr != "" {
+		if replica, err = strconv.Atoi(replicaStr); err != nil || replica < 0 {
+			return nil, types.CreateRequestError(fmt.Sprintf("invalid replica %s", replicaStr), http.StatusBadRequest)
+		}
+	}
+	if size := query.Get("size"); size != "" {
+		var ok bool
+		if opts.Size, ok = parseTermSize(size); !ok {
+			return nil, types.CreateRequestError(fmt.Sprintf("invalid size %s, expected \"rows cols\"", size), http.StatusBadRequest)
+		}
+	}
+
+	return h.server.ExecApp(r.Context(), appPath, replica, interactive, opts)
+}
+
+func (h *Handler) appStats(r *http.Request) (any, error) {
+	query := r.URL.Query()
+	appPathGlob := query.Get("appPathGlob")
+	updateTargetInContext(r, appPathGlob, false)
+
+	internal, err := parseBoolArg(query.Get("internal"), false)
+	if err != nil {
+		return nil, err
+	}
+	since := 24 * time.Hour
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		if since, err = time.ParseDuration(sinceStr); err != nil || since <= 0 {
+			return nil, types.CreateRequestError(fmt.Sprintf("invalid since value %s, expected a duration like 1h", sinceStr), http.StatusBadRequest)
+		}
+	}
+
+	return h.server.GetAppStats(r.Context(), appPathGlob, internal, since)
+}
+
+func (h *Handler) getCanary(r *http.Request) (any, error) {
+	appPath := r.URL.Query().Get("appPath")
+	if appPath == "" {
+		return nil, types.CreateRequestError("appPath is required", http.StatusBadRequest)
+	}
+
+	return h.server.GetCanaryStatus(r.Context(), appPath)
+}
+
+func (h *Handler) setCanary(r *http.Request) (any, error) {
+	appPath := r.URL.Query().Get("appPath")
+	if appPath == "" {
+		return nil, types.CreateRequestError("appPath is required", http.StatusBadRequest)
+	}
+
+	dryRun, err := parseBoolArg(r.URL.Query().Get(DRY_RUN_ARG), false)
+	if err != nil {
+		return nil, err
+	}
+	updateTargetInContext(r, appPath, dryRun)
+
+	percent, err := strconv.Atoi(r.URL.Query().Get("percent"))
+	if err != nil {
+		return nil, types.CreateRequestError("invalid percent: "+err.Error(), http.StatusBadRequest)
+	}
+
+	return h.server.SetCanary(r.Context(), appPath, percent, types.CanarySticky(r.URL.Query().Get("sticky")), dryRun)
+}
+
 func (h *Handler) tokenCreate(r *http.Request) (any, error) {
 	appPath := r.URL.Query().Get("appPath")
 	if appPath == "" {
@@ -989,7 +1225,7 @@ func (h *Handler) apply(r *http.Request) (any, error) {
 	ret, _, err := h.server.Apply(r.Context(), types.Transaction{}, applyPath, appPathGlob, approve, dryRun, promote,
 		types.AppReloadOption(r.URL.Query().Get("reload")),
 		r.URL.Query().Get("branch"), r.URL.Query().Get("commit"), r.URL.Query().Get("gitAuth"),
-		clobber, forceReload, "", nil)
+		clobber, forceReload, types.ApplyPruneOption(r.URL.Query().Get("prune")), r.URL.Query().Get("env"), "", nil)
 	if err != nil {
 		return nil, types.CreateRequestError(err.Error(), http.StatusInternalServerError)
 	}
@@ -1073,6 +1309,37 @@ func (h *Handler) listSyncEntries(r *http.Request) (any, error) {
 	return results, nil
 }
 
+func (h *Handler) checkSyncDrift(r *http.Request) (any, error) {
+	audit, err := parseBoolArg(r.URL.Query().Get("audit"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := h.server.CheckDrift(r.Context(), r.URL.Query().Get("path"), audit)
+	if err != nil {
+		return nil, types.CreateRequestError(err.Error(), http.StatusBadRequest)
+	}
+
+	return results, nil
+}
+
+func (h *Handler) listSessions(r *http.Request) (any, error) {
+	return h.server.ListSessions(r.Context(), r.URL.Query().Get("user"))
+}
+
+func (h *Handler) revokeSessions(r *http.Request) (any, error) {
+	userId := r.URL.Query().Get("user")
+	sessionId := r.URL.Query().Get("id")
+	dryRun, err := parseBoolArg(r.URL.Query().Get(DRY_RUN_ARG), false)
+	if err != nil {
+		return nil, err
+	}
+
+	updateTargetInContext(r, cmp.Or(userId, sessionId), dryRun)
+	updateOperationInContext(r, "session_revoke")
+	return h.server.RevokeSessions(r.Context(), userId, sessionId, dryRun)
+}
+
 // serveInternal returns a handler for the internal APIs for app admin and management
 func (h *Handler) serveInternal(enableBasicAuth bool) http.Handler {
 	// These API's are mounted at /_clace
@@ -1153,11 +1420,51 @@ func (h *Handler) serveInternal(enableBasicAuth bool) http.Handler {
 		h.apiHandler(w, r, enableBasicAuth, "list_files", h.versionFiles)
 	}))
 
+	// API to diff two versions of an app
+	r.Get("/version/diff", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "version_diff", h.versionDiff)
+	}))
+
+	// API to delete old versions and unused files
+	r.Post("/version/gc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "version_gc", h.versionGC)
+	}))
+
+	// API to remove the containers, images and volumes no longer used by apps
+	r.Post("/container/gc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "container_gc", h.containerGC)
+	}))
+
 	// API to switch version for an app
 	r.Post("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h.apiHandler(w, r, enableBasicAuth, "version_switch", h.versionSwitch)
 	}))
 
+	// API to stream the app container logs
+	r.Get("/app_logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "app_logs", h.appLogs)
+	}))
+
+	// API to run a command in the app container, the connection is switched to the exec protocol
+	r.Post("/app_exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "app_exec", h.appExec)
+	}))
+
+	// API to get the container resource usage for apps
+	r.Get("/app_stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "app_stats", h.appStats)
+	}))
+
+	// API to get canary status
+	r.Get("/app_canary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "get_canary", h.getCanary)
+	}))
+
+	// API to update canary config
+	r.Post("/app_canary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "set_canary", h.setCanary)
+	}))
+
 	// Token list
 	r.Get("/app_webhook_token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h.apiHandler(w, r, enableBasicAuth, "list_webhooks", h.tokenList)
@@ -1198,6 +1505,21 @@ func (h *Handler) serveInternal(enableBasicAuth bool) http.Handler {
 		h.apiHandler(w, r, enableBasicAuth, "list_sync", h.listSyncEntries)
 	}))
 
+	// API to check drift between the apps and the applied config
+	r.Get("/sync/drift", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "sync_drift", h.checkSyncDrift)
+	}))
+
+	// API to list SSO sessions
+	r.Get("/session", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "list_sessions", h.listSessions)
+	}))
+
+	// API to revoke SSO sessions
+	r.Delete("/session", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.apiHandler(w, r, enableBasicAuth, "session_revoke", h.revokeSessions)
+	}))
+
 	return r
 }
 
@@ -1223,6 +1545,11 @@ func (h *Handler) serveWebhooks() http.Handler {
 		h.webhookHandler(w, r, types.WebhookPromote)
 	}))
 
+	// Run sync job
+	r.Post("/sync", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.syncWebhookHandler(w, r)
+	}))
+
 	return r
 }
 
@@ -24,6 +24,7 @@ import (
 
 	"github.com/caddyserver/certmagic"
 	"github.com/claceio/clace/internal/app"
+	"github.com/claceio/clace/internal/app/container"
 	"github.com/claceio/clace/internal/metadata"
 	"github.com/claceio/clace/internal/passwd"
 	"github.com/claceio/clace/internal/server/list_apps"
@@ -120,22 +121,31 @@ func (s *Server) GetAppSpec(name types.AppSpec) types.SpecFiles {
 // Server is the instance of the Clace Server
 type Server struct {
 	*types.Logger
-	config         *types.ServerConfig
-	db             *metadata.Metadata
-	httpServer     *http.Server
-	httpsServer    *http.Server
-	udsServer      *http.Server
-	handler        *Handler
-	apps           *AppStore
-	authHandler    *AdminBasicAuth
-	ssoAuth        *SSOAuth
-	notifyClose    chan types.AppPathDomain
-	secretsManager *system.SecretManager
-	listAppsApp    *app.App
-	mu             sync.RWMutex
-	auditDB        *sql.DB
-	auditDbType    system.DBType
-	syncTimer      *time.Ticker
+	config          *types.ServerConfig
+	db              *metadata.Metadata
+	httpServer      *http.Server
+	httpsServer     *http.Server
+	udsServer       *http.Server
+	handler         *Handler
+	apps            *AppStore
+	authHandler     *AdminBasicAuth
+	ssoAuth         *SSOAuth
+	notifyClose     chan types.AppPathDomain
+	secretsManager  *system.SecretManager
+	listAppsApp     *app.App
+	mu              sync.RWMutex
+	auditDB         *sql.DB
+	auditDbType     system.DBType
+	syncTimer       *time.Ticker
+	lastDriftCheck  time.Time              // accessed from the sync runner only
+	driftStates     map[types.AppId]string // drift state of the apps at the last check, accessed from the sync runner only
+	lastVersionGC   time.Time              // accessed from the sync runner only
+	lastContainerGC time.Time              // accessed from the sync runner only
+	trustedProxies  []*net.IPNet
+	webhookSyncLock sync.Mutex
+	canaryStatsLock sync.Mutex
+	canaryStats     map[canaryStatsKey]canaryCounts // request counts for canary apps, not yet saved to the audit db
+	webhookSyncs    map[string]bool                 // sync ids with a webhook run in progress, true if a rerun is pending
 }
 
 // NewServer creates a new instance of the Clace Server
@@ -160,6 +170,10 @@ func NewServer(config *types.ServerConfig) (*Server, error) {
 	server.apps = NewAppStore(l, server)
 	server.authHandler = NewAdminBasicAuth(l, config)
 	server.notifyClose = make(chan types.AppPathDomain)
+	server.trustedProxies, err = system.ParseCIDRs(config.Security.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing security.trusted_proxies: %w", err)
+	}
 
 	// Setup secrets manager
 	server.secretsManager, err = system.NewSecretManager(context.Background(), config.Secret, config.AppConfig.Security.DefaultSecretsProvider)
@@ -174,7 +188,7 @@ func NewServer(config *types.ServerConfig) (*Server, error) {
 	}
 
 	// Setup SSO auth
-	server.ssoAuth = NewSSOAuth(l, config)
+	server.ssoAuth = NewSSOAuth(l, config, db, server.trustedProxies)
 	if err = server.ssoAuth.Setup(); err != nil {
 		return nil, err
 	}
@@ -199,6 +213,12 @@ func NewServer(config *types.ServerConfig) (*Server, error) {
 		// if command is empty string, that means either containers are disabled in config or no container command found
 	}
 	server.Trace().Str("cmd", config.System.ContainerCommand).Msg("Container management command")
+	if config.System.ContainerRuntime == container.RUNTIME_API && config.System.ContainerSocket == "" {
+		config.System.ContainerSocket = container.LookupSocket()
+		if config.System.ContainerSocket == "" {
+			server.Warn().Msg("No container socket found for api container runtime, container apps are disabled")
+		}
+	}
 	go server.handleAppClose()
 
 	initClacePlugin(server)
@@ -216,7 +236,9 @@ func (s *Server) appNotifyFunction(updatePayload types.AppUpdatePayload) {
 	}
 	s.Debug().Str("server_id", string(updatePayload.ServerId)).Msgf(
 		"Received app update notification from %s for %s", updatePayload.ServerId, updatePayload.AppPathDomains)
-	s.apps.ClearAppsNoNotify(updatePayload.AppPathDomains)
+	// Container apps are switched after the new version is started, like on the server which did the update.
+	// The switch is done in the background, so that the listener is not blocked
+	s.apps.SwitchAppsNoNotify(updatePayload.AppPathDomains)
 }
 
 // updateConfigSecrets updates the secrets in the server config using the evalSecret function
@@ -686,7 +708,7 @@ func (s *Server) GetListAppsApp() (*app.App, error) {
 	appLogger := types.Logger{Logger: &subLogger}
 	s.listAppsApp, err = app.NewApp(sourceFS, nil, &appLogger, &appEntry, &s.config.System,
 		s.config.Plugins, s.config.AppConfig, s.notifyClose, s.secretsManager.AppEvalTemplate,
-		s.InsertAuditEvent, s.config)
+		s.InsertAuditEvent, s.InsertContainerStats, s.config)
 	if err != nil {
 		return nil, err
 	}
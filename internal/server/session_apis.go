@@ -0,0 +1,78 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+func (s *Server) checkSessionStore() error {
+	if !s.config.Security.SessionStore {
+		return types.CreateRequestError("session store is not enabled, set security.session_store to true in server config", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// ListSessions returns the active SSO sessions, for the given user if userId is specified
+func (s *Server) ListSessions(ctx context.Context, userId string) (*types.SessionListResponse, error) {
+	if err := s.checkSessionStore(); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.DeleteExpiredSessions(ctx, s.config.Security.SessionMaxAge, s.config.Security.SessionIdleTimeout); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.db.GetSessions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &types.SessionListResponse{Sessions: sessions}, nil
+}
+
+// RevokeSessions revokes the SSO sessions for the user, or the session with the given id.
+// Revoked sessions are rejected on the next request, the user has to login again
+func (s *Server) RevokeSessions(ctx context.Context, userId, sessionId string, dryRun bool) (*types.SessionRevokeResponse, error) {
+	if err := s.checkSessionStore(); err != nil {
+		return nil, err
+	}
+	if userId == "" && sessionId == "" {
+		return nil, types.CreateRequestError("user or session id is required", http.StatusBadRequest)
+	}
+
+	sessions, err := s.db.GetSessions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := types.SessionRevokeResponse{
+		DryRun:  dryRun,
+		Revoked: make([]string, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		if sessionId != "" && session.Id != sessionId {
+			continue
+		}
+		ret.Revoked = append(ret.Revoked, session.Id)
+	}
+
+	if sessionId != "" && len(ret.Revoked) == 0 {
+		return nil, types.CreateRequestError(fmt.Sprintf("session not found: %s", sessionId), http.StatusNotFound)
+	}
+
+	if dryRun {
+		return &ret, nil
+	}
+
+	for _, id := range ret.Revoked {
+		if err := s.db.DeleteSession(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/metadata"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth"
+)
+
+func testSessionServer(t *testing.T) *Server {
+	t.Helper()
+	config := &types.ServerConfig{}
+	config.Metadata.DBConnection = "sqlite:" + path.Join(t.TempDir(), "metadata.db")
+	config.Metadata.AutoUpgrade = true
+	config.Security.SessionStore = true
+
+	logger := testutil.TestLogger()
+	db, err := metadata.NewMetadata(logger, config)
+	testutil.AssertNoError(t, err)
+	return &Server{Logger: logger, config: config, db: db}
+}
+
+func TestSessionStore(t *testing.T) {
+	s := testSessionServer(t)
+	ssoAuth := NewSSOAuth(s.Logger, s.config, s.db, nil)
+	ctx := context.Background()
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.1.1.1:1234"
+	sessionId, err := ssoAuth.createSession(request, "github", goth.User{Email: "a@example.com", UserID: "1"})
+	testutil.AssertNoError(t, err)
+	_, err = ssoAuth.createSession(request, "github", goth.User{NickName: "bob", UserID: "2"})
+	testutil.AssertNoError(t, err)
+
+	entry, err := s.db.GetSession(ctx, sessionId)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "user", "a@example.com", entry.UserId)
+	testutil.AssertEqualsString(t, "provider", "github", entry.Provider)
+	testutil.AssertEqualsString(t, "remote ip", "10.1.1.1", entry.RemoteIP)
+
+	entry, err = s.db.GetSession(ctx, "unknown")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "unknown session", true, entry == nil)
+
+	session := sessions.NewSession(nil, SESSION_COOKIE)
+	valid, err := ssoAuth.checkSession(request, session)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "no session id", false, valid)
+
+	session.Values[SESSION_ID_KEY] = sessionId
+	valid, err = ssoAuth.checkSession(request, session)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "valid session", true, valid)
+
+	all, err := s.db.GetSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "sessions", 2, len(all))
+	user, err := s.db.GetSessions(ctx, "bob")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "user sessions", 1, len(user))
+
+	// Sessions within the max age and idle timeout are retained
+	testutil.AssertNoError(t, s.db.DeleteExpiredSessions(ctx, 3600, 3600))
+	all, err = s.db.GetSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "sessions not expired", 2, len(all))
+
+	// sqlite timestamps have second precision
+	time.Sleep(2 * time.Second)
+	testutil.AssertNoError(t, s.db.DeleteExpiredSessions(ctx, 0, 0))
+	all, err = s.db.GetSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "expiry disabled", 2, len(all))
+
+	testutil.AssertNoError(t, s.db.UpdateSessionLastSeen(ctx, sessionId, "10.1.1.2"))
+	testutil.AssertNoError(t, s.db.DeleteExpiredSessions(ctx, 0, 1))
+	all, err = s.db.GetSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "idle expired", 1, len(all))
+	testutil.AssertEqualsString(t, "remote ip", "10.1.1.2", all[0].RemoteIP)
+
+	testutil.AssertNoError(t, s.db.DeleteExpiredSessions(ctx, 1, 0))
+	valid, err = ssoAuth.checkSession(request, session)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "max age expired", false, valid)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	s := testSessionServer(t)
+	ctx := context.Background()
+	for _, entry := range []types.SessionEntry{
+		{Id: "s1", UserId: "a@example.com", Provider: "github"},
+		{Id: "s2", UserId: "a@example.com", Provider: "google"},
+		{Id: "s3", UserId: "b@example.com", Provider: "github"},
+	} {
+		testutil.AssertNoError(t, s.db.CreateSession(ctx, &entry))
+	}
+
+	list, err := s.ListSessions(ctx, "a@example.com")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "user sessions", 2, len(list.Sessions))
+
+	_, err = s.RevokeSessions(ctx, "", "", false)
+	testutil.AssertErrorContains(t, err, "user or session id is required")
+	_, err = s.RevokeSessions(ctx, "", "unknown", false)
+	testutil.AssertErrorContains(t, err, "session not found: unknown")
+
+	revoked, err := s.RevokeSessions(ctx, "a@example.com", "", true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "dry run revoked", 2, len(revoked.Revoked))
+	list, err = s.ListSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "dry run sessions", 3, len(list.Sessions))
+
+	revoked, err = s.RevokeSessions(ctx, "", "s3", false)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "session revoked", 1, len(revoked.Revoked))
+	testutil.AssertEqualsString(t, "session id", "s3", revoked.Revoked[0])
+	entry, err := s.db.GetSession(ctx, "s3")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsBool(t, "revoked session", true, entry == nil)
+
+	revoked, err = s.RevokeSessions(ctx, "a@example.com", "", false)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "user revoked", 2, len(revoked.Revoked))
+	list, err = s.ListSessions(ctx, "")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "remaining sessions", 0, len(list.Sessions))
+
+	s.config.Security.SessionStore = false
+	_, err = s.ListSessions(ctx, "")
+	testutil.AssertErrorContains(t, err, "session store is not enabled")
+}
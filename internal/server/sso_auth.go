@@ -5,10 +5,15 @@ package server
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/claceio/clace/internal/metadata"
+	"github.com/claceio/clace/internal/system"
 	"github.com/claceio/clace/internal/types"
 	"github.com/go-chi/chi"
 	"github.com/gorilla/sessions"
@@ -37,19 +42,28 @@ const (
 	USER_NICKNAME_KEY       = "nickname"
 	PROVIDER_NAME_KEY       = "provider_name"
 	REDIRECT_URL            = "redirect"
+	SESSION_ID_KEY          = "session_id"
+	LAST_SEEN_KEY           = "last_seen"
 )
 
+// SESSION_UPDATE_INTERVAL is the minimum interval between last seen updates for the server side session
+const SESSION_UPDATE_INTERVAL = time.Minute
+
 type SSOAuth struct {
 	*types.Logger
 	config          *types.ServerConfig
+	db              *metadata.Metadata
+	trustedProxies  []*net.IPNet
 	cookieStore     *sessions.CookieStore
 	providerConfigs map[string]*types.AuthConfig
 }
 
-func NewSSOAuth(logger *types.Logger, config *types.ServerConfig) *SSOAuth {
+func NewSSOAuth(logger *types.Logger, config *types.ServerConfig, db *metadata.Metadata, trustedProxies []*net.IPNet) *SSOAuth {
 	return &SSOAuth{
-		Logger: logger,
-		config: config,
+		Logger:         logger,
+		config:         config,
+		db:             db,
+		trustedProxies: trustedProxies,
 	}
 }
 
@@ -195,6 +209,15 @@ func (s *SSOAuth) RegisterRoutes(mux *chi.Mux) {
 		session.Values[USER_EMAIL_KEY] = user.Email
 		session.Values[USER_NICKNAME_KEY] = user.NickName
 		session.Values[PROVIDER_NAME_KEY] = providerName
+		session.Values[LAST_SEEN_KEY] = time.Now().Unix()
+		if s.config.Security.SessionStore {
+			sessionId, err := s.createSession(r, providerName, user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			session.Values[SESSION_ID_KEY] = sessionId
+		}
 		session.Save(r, w)
 
 		// Redirect to the original page, or default to the home page if not specified
@@ -221,6 +244,12 @@ func (s *SSOAuth) RegisterRoutes(mux *chi.Mux) {
 		}
 		// Set user as unauthenticated in session
 		session.Values[AUTH_KEY] = false
+		if sessionId, ok := session.Values[SESSION_ID_KEY].(string); ok && sessionId != "" {
+			if err := s.db.DeleteSession(r.Context(), sessionId); err != nil {
+				s.Warn().Err(err).Msg("error deleting session")
+			}
+			delete(session.Values, SESSION_ID_KEY)
+		}
 		session.Save(r, w)
 
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -302,17 +331,8 @@ func (s *SSOAuth) CheckAuth(w http.ResponseWriter, r *http.Request, appProvider
 		return "", err
 	}
 	if auth, ok := session.Values[AUTH_KEY].(bool); !ok || !auth {
-		// Store the target URL before redirecting to login
-		if updateRedirect {
-			session.Values[REDIRECT_URL] = r.RequestURI
-			session.Save(r, w)
-		}
 		s.Warn().Err(err).Msg("no auth, redirecting to login")
-		if r.Header.Get("HX-Request") == "true" {
-			w.Header().Set("HX-Redirect", types.INTERNAL_URL_PREFIX+"/auth/"+appProvider)
-		} else {
-			http.Redirect(w, r, types.INTERNAL_URL_PREFIX+"/auth/"+appProvider, http.StatusTemporaryRedirect)
-		}
+		s.redirectToLogin(w, r, session, appProvider, updateRedirect)
 		return "", nil
 	}
 
@@ -327,21 +347,124 @@ func (s *SSOAuth) CheckAuth(w http.ResponseWriter, r *http.Request, appProvider
 		return "", nil
 	}
 
-	userId, ok := session.Values[USER_EMAIL_KEY].(string)
-	if !ok || userId == "" {
-		userId, ok = session.Values[USER_NICKNAME_KEY].(string)
-		if !ok || userId == "" {
-			userId, ok = session.Values[USER_ID_KEY].(string)
-			if !ok || userId == "" {
-				s.Warn().Msg("no user id in session")
-				return "", fmt.Errorf("no user id in session")
-			}
+	now := time.Now()
+	if idleTimeout := s.config.Security.SessionIdleTimeout; idleTimeout > 0 {
+		lastSeen, ok := session.Values[LAST_SEEN_KEY].(int64)
+		if !ok || now.Sub(time.Unix(lastSeen, 0)) > time.Duration(idleTimeout)*time.Second {
+			s.Warn().Msg("session idle timeout, redirecting to login")
+			session.Values[AUTH_KEY] = false
+			s.redirectToLogin(w, r, session, appProvider, updateRedirect)
+			return "", nil
 		}
 	}
 
+	if s.config.Security.SessionStore {
+		valid, err := s.checkSession(r, session)
+		if err != nil {
+			return "", err
+		}
+		if !valid {
+			s.Warn().Msg("session revoked, redirecting to login")
+			session.Values[AUTH_KEY] = false
+			delete(session.Values, SESSION_ID_KEY)
+			s.redirectToLogin(w, r, session, appProvider, updateRedirect)
+			return "", nil
+		}
+	}
+
+	userId := getSessionUser(session)
+	if userId == "" {
+		s.Warn().Msg("no user id in session")
+		return "", fmt.Errorf("no user id in session")
+	}
+
 	// Clear the redirect target after successful authentication
 	delete(session.Values, REDIRECT_URL)
+	session.Values[LAST_SEEN_KEY] = now.Unix()
 	session.Save(r, w)
 
 	return appProvider + ":" + userId, nil
 }
+
+// redirectToLogin redirects the request to the login page for the provider. The session is
+// saved, with the current url as the redirect target if updateRedirect is set
+func (s *SSOAuth) redirectToLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, appProvider string, updateRedirect bool) {
+	if updateRedirect {
+		// Store the target URL before redirecting to login
+		session.Values[REDIRECT_URL] = r.RequestURI
+	}
+	session.Save(r, w)
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", types.INTERNAL_URL_PREFIX+"/auth/"+appProvider)
+	} else {
+		http.Redirect(w, r, types.INTERNAL_URL_PREFIX+"/auth/"+appProvider, http.StatusTemporaryRedirect)
+	}
+}
+
+// getSessionUser returns the user id from the session, the email is used if available
+func getSessionUser(session *sessions.Session) string {
+	for _, key := range []string{USER_EMAIL_KEY, USER_NICKNAME_KEY, USER_ID_KEY} {
+		if userId, ok := session.Values[key].(string); ok && userId != "" {
+			return userId
+		}
+	}
+	return ""
+}
+
+// createSession adds a server side entry for the new session and returns the session id
+func (s *SSOAuth) createSession(r *http.Request, providerName string, user goth.User) (string, error) {
+	// Cleanup old sessions before adding the new one
+	if err := s.db.DeleteExpiredSessions(r.Context(), s.config.Security.SessionMaxAge, s.config.Security.SessionIdleTimeout); err != nil {
+		s.Warn().Err(err).Msg("error deleting expired sessions")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	sessionId := base64.RawURLEncoding.EncodeToString(buf)
+
+	userId := user.Email
+	if userId == "" {
+		userId = user.NickName
+	}
+	if userId == "" {
+		userId = user.UserID
+	}
+
+	entry := types.SessionEntry{
+		Id:       sessionId,
+		UserId:   userId,
+		Provider: providerName,
+		RemoteIP: system.GetRemoteIP(r, s.trustedProxies),
+	}
+	if err := s.db.CreateSession(r.Context(), &entry); err != nil {
+		return "", err
+	}
+	return sessionId, nil
+}
+
+// checkSession checks whether the server side session is still valid. The last seen time is
+// updated, at most once every SESSION_UPDATE_INTERVAL
+func (s *SSOAuth) checkSession(r *http.Request, session *sessions.Session) (bool, error) {
+	sessionId, ok := session.Values[SESSION_ID_KEY].(string)
+	if !ok || sessionId == "" {
+		// Session created before the session store was enabled
+		return false, nil
+	}
+
+	entry, err := s.db.GetSession(r.Context(), sessionId)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	if time.Since(entry.LastSeen) > SESSION_UPDATE_INTERVAL {
+		if err := s.db.UpdateSessionLastSeen(r.Context(), sessionId, system.GetRemoteIP(r, s.trustedProxies)); err != nil {
+			s.Warn().Err(err).Msg("error updating session last seen")
+		}
+	}
+	return true, nil
+}
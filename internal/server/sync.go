@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -24,6 +25,10 @@ func (s *Server) CreateSyncEntry(ctx context.Context, path string, scheduled, dr
 	}
 	defer tx.Rollback()
 
+	if err := validatePruneOption(sync.Prune); err != nil {
+		return nil, err
+	}
+
 	genId, err := ksuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -32,6 +37,9 @@ func (s *Server) CreateSyncEntry(ctx context.Context, path string, scheduled, dr
 
 	if !scheduled {
 		// Webhook sync entry
+		if !system.IsGit(path) {
+			return nil, types.CreateRequestError("webhook sync requires a git path", http.StatusBadRequest)
+		}
 		secret, err := passwd.GeneratePassword()
 		if err != nil {
 			return nil, err
@@ -63,10 +71,15 @@ func (s *Server) CreateSyncEntry(ctx context.Context, path string, scheduled, dr
 		return nil, errors.New(syncStatus.Error)
 	}
 
+	webhookUrl := ""
+	if !scheduled {
+		webhookUrl = s.getSyncWebhookUrl(syncEntry.Id)
+	}
+
 	ret := types.SyncCreateResponse{
 		Id:                syncEntry.Id,
 		DryRun:            dryRun,
-		WebhookUrl:        "", // TODO
+		WebhookUrl:        webhookUrl,
 		WebhookSecret:     syncEntry.Metadata.WebhookSecret,
 		ScheduleFrequency: syncEntry.Metadata.ScheduleFrequency,
 		SyncJobStatus:     *syncStatus,
@@ -145,7 +158,9 @@ func (s *Server) ListSyncEntries(ctx context.Context) (*types.SyncListResponse,
 	}
 
 	for _, e := range entries {
-		e.Metadata.WebhookUrl = "" // TODO: Set the actual webhook URL
+		if !e.IsScheduled {
+			e.Metadata.WebhookUrl = s.getSyncWebhookUrl(e.Id)
+		}
 	}
 
 	ret := types.SyncListResponse{
@@ -154,6 +169,22 @@ func (s *Server) ListSyncEntries(ctx context.Context) (*types.SyncListResponse,
 	return &ret, nil
 }
 
+func (s *Server) GetSyncEntry(ctx context.Context, id string) (*types.SyncEntry, error) {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return s.db.GetSyncEntry(ctx, tx, id)
+}
+
+// RunSyncWebhook runs the sync job for a webhook push event. The sync job runs in its own transaction
+func (s *Server) RunSyncWebhook(ctx context.Context, entry *types.SyncEntry) (*types.SyncJobStatus, error) {
+	status, _, err := s.runSyncJob(ctx, types.Transaction{}, entry, false, true, nil)
+	return status, err
+}
+
 func (s *Server) syncRunner() {
 	s.Info().Msg("Starting sync runner loop")
 	for range s.syncTimer.C {
@@ -162,6 +193,8 @@ func (s *Server) syncRunner() {
 			s.Error().Err(err).Msg("Error running sync")
 			break
 		}
+		s.runVersionGC(context.Background())
+		s.runContainerGC(context.Background())
 	}
 	s.Warn().Msg("Sync runner stopped")
 }
@@ -207,6 +240,7 @@ func (s *Server) runSyncJobs() error {
 		}
 	}
 
+	s.runDriftCheck(ctx, scheduleEntries)
 	return nil
 }
 
@@ -242,7 +276,7 @@ func (s *Server) runSyncJob(ctx context.Context, inputTx types.Transaction, entr
 	}
 
 	applyInfo, updatedApps, applyErr := s.Apply(ctx, tx, entry.Path, "all", entry.Metadata.Approve, dryRun, entry.Metadata.Promote, types.AppReloadOption(entry.Metadata.Reload),
-		entry.Metadata.GitBranch, "", entry.Metadata.GitAuth, entry.Metadata.Clobber, entry.Metadata.ForceReload, lastRunCommitId, repoCache)
+		entry.Metadata.GitBranch, "", entry.Metadata.GitAuth, entry.Metadata.Clobber, entry.Metadata.ForceReload, entry.Metadata.Prune, entry.Metadata.Environment, lastRunCommitId, repoCache)
 
 	status := types.SyncJobStatus{
 		LastExecutionTime: time.Now(),
@@ -303,7 +337,7 @@ func (s *Server) runSyncJob(ctx context.Context, inputTx types.Transaction, entr
 				app := appMap[appPath]
 				var reloadResult *types.AppReloadResult
 				reloadResult, reloadErr = s.ReloadApp(ctx, tx, app, nil, entry.Metadata.Approve, false, entry.Metadata.Promote,
-					app.Metadata.VersionMetadata.GitBranch, "", app.Settings.GitAuthName, repoCache, entry.Metadata.ForceReload)
+					app.Metadata.VersionMetadata.GitBranch, app.Metadata.VersionMetadata.GitTagPattern, "", app.Settings.GitAuthName, repoCache, entry.Metadata.ForceReload)
 				if reloadErr != nil {
 					s.Error().Err(reloadErr).Msgf("Error reloading app %s sync job %s", appPath, entry.Id)
 					status.Error = reloadErr.Error()
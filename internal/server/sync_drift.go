@@ -0,0 +1,234 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	DRIFT_OPERATION = "sync_drift"
+)
+
+// getApplyInfoState returns the app state as per the applied declarative config
+func getApplyInfoState(info *types.CreateAppRequest) appState {
+	return appState{
+		auth:             string(cmp.Or(info.AppAuthn, types.AppAuthnDefault)),
+		spec:             string(info.Spec),
+		gitBranch:        info.GitBranch,
+		gitTag:           info.GitTag,
+		gitCommit:        info.GitCommit,
+		params:           info.ParamValues,
+		containerOptions: info.ContainerOptions,
+		containerArgs:    info.ContainerArgs,
+		containerVolumes: info.ContainerVolumes,
+		appConfig:        info.AppConfig,
+	}
+}
+
+// getAppDrift returns the changes done to the app after it was last applied. Changes are done through
+// update-param/update-metadata and are not overwritten by apply unless clobber is used. Apps which
+// are not created through apply have no drift
+func (s *Server) getAppDrift(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry) (*types.AppDrift, error) {
+	liveApp := appEntry
+	if !appEntry.IsDev {
+		// Apply updates the stage app, compare against that
+		var err error
+		liveApp, err = s.getStageApp(ctx, tx, appEntry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(liveApp.Metadata.VersionMetadata.ApplyInfo) == 0 {
+		return nil, nil
+	}
+
+	var info types.CreateAppRequest
+	if err := json.Unmarshal(liveApp.Metadata.VersionMetadata.ApplyInfo, &info); err != nil {
+		return nil, fmt.Errorf("error unmarshalling stored app info for %s: %w", appEntry.AppPathDomain(), err)
+	}
+
+	liveState := getAppState(liveApp)
+	liveState.auth = string(appEntry.Settings.AuthnType) // settings are updated on the main app
+	configState := getApplyInfoState(&info)
+	if info.GitBranch == "" {
+		// Branch defaults to the one used during create
+		configState.gitBranch = liveState.gitBranch
+	}
+	if info.GitCommit == "" {
+		// No commit specified, the app follows the branch
+		configState.gitCommit = liveState.gitCommit
+	}
+
+	changes := diffAppState(configState, liveState)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return &types.AppDrift{
+		AppPathDomain: appEntry.AppPathDomain(),
+		ApplySource:   getApplyPath(appEntry),
+		Changes:       changes,
+	}, nil
+}
+
+// getApplyPath returns the apply file path last applied to the app. Apps applied before the path was
+// recorded have only the apply source set, if they were created by the apply
+func getApplyPath(appEntry *types.AppEntry) string {
+	return cmp.Or(appEntry.Settings.ApplyPath, appEntry.Settings.ApplySource)
+}
+
+// CheckDrift returns the drift between the live apps and the applied config, for the apps applied
+// from the apply file at path. If path is empty, all apps which have an applied config are checked.
+// If audit is set, an audit event is recorded for each drifted app
+func (s *Server) CheckDrift(ctx context.Context, path string, audit bool) (*types.SyncDriftResponse, error) {
+	return s.checkDrift(ctx, path, func(appEntry *types.AppEntry, drift *types.AppDrift) error {
+		if !audit || drift == nil {
+			return nil
+		}
+		return s.insertDriftEvent(ctx, appEntry, drift)
+	})
+}
+
+// checkDrift checks the drift for the apps applied from the apply file at path. The drift handler is called
+// for each checked app, with a nil drift if the app has not drifted
+func (s *Server) checkDrift(ctx context.Context, path string, driftHandler func(*types.AppEntry, *types.AppDrift) error) (*types.SyncDriftResponse, error) {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	apps, err := s.db.GetAllApps(false)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &types.SyncDriftResponse{
+		Path:   path,
+		Drifts: make([]*types.AppDrift, 0),
+	}
+	for _, appInfo := range apps {
+		appEntry, err := s.db.GetAppTx(ctx, tx, appInfo.AppPathDomain)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" && getApplyPath(appEntry) != path {
+			continue
+		}
+
+		drift, err := s.getAppDrift(ctx, tx, appEntry)
+		if err != nil {
+			return nil, err
+		}
+		if err := driftHandler(appEntry, drift); err != nil {
+			return nil, err
+		}
+		if drift != nil {
+			ret.Drifts = append(ret.Drifts, drift)
+		}
+	}
+
+	slices.SortFunc(ret.Drifts, func(a, b *types.AppDrift) int {
+		return cmp.Compare(a.AppPathDomain.String(), b.AppPathDomain.String())
+	})
+	return ret, nil
+}
+
+// getDriftState returns a summary of the drifted values, used to check whether the drift has changed
+// since the last check. Empty string is returned if the app has not drifted
+func getDriftState(drift *types.AppDrift) string {
+	if drift == nil {
+		return ""
+	}
+	var state strings.Builder
+	for _, change := range drift.Changes {
+		fmt.Fprintf(&state, "%s:%q:%q;", change.Field, change.Old, change.New)
+	}
+	return state.String()
+}
+
+// insertDriftEvent records an audit event for the app drift. A nil drift means the earlier drift was resolved
+func (s *Server) insertDriftEvent(ctx context.Context, appEntry *types.AppEntry, drift *types.AppDrift) error {
+	detail := fmt.Sprintf("drift resolved for %s", getApplyPath(appEntry))
+	if drift != nil {
+		fields := make([]string, 0, len(drift.Changes))
+		for _, change := range drift.Changes {
+			if !slices.Contains(fields, change.Field) {
+				fields = append(fields, change.Field)
+			}
+		}
+		detail = fmt.Sprintf("drifted from %s: %s", drift.ApplySource, strings.Join(fields, ", "))
+	}
+
+	event := types.AuditEvent{
+		RequestId:  system.GetContextRequestId(ctx),
+		CreateTime: time.Now(),
+		UserId:     system.GetContextUserId(ctx),
+		AppId:      appEntry.Id,
+		EventType:  types.EventTypeSystem,
+		Operation:  DRIFT_OPERATION,
+		Target:     appEntry.AppPathDomain().String(),
+		Status:     string(types.EventStatusSuccess),
+		Detail:     detail,
+	}
+	return s.InsertAuditEvent(&event)
+}
+
+// runDriftCheck is called from the sync runner. The drift is checked for the apps managed by each sync
+// entry. Audit events are recorded only when the drift for an app changes, including when it is resolved
+func (s *Server) runDriftCheck(ctx context.Context, entries []*types.SyncEntry) {
+	if s.config.System.DriftCheckMins <= 0 ||
+		time.Since(s.lastDriftCheck) < time.Duration(s.config.System.DriftCheckMins)*time.Minute {
+		return
+	}
+	s.lastDriftCheck = time.Now()
+	if s.driftStates == nil {
+		s.driftStates = map[types.AppId]string{}
+	}
+
+	checked := map[string]bool{}
+	for _, entry := range entries {
+		if checked[entry.Path] {
+			continue
+		}
+		checked[entry.Path] = true
+
+		driftResponse, err := s.checkDrift(ctx, entry.Path, s.auditDriftChange)
+		if err != nil {
+			s.Error().Err(err).Msgf("Error checking drift for %s", entry.Path)
+			continue
+		}
+		if len(driftResponse.Drifts) > 0 {
+			s.Info().Msgf("Found %d drifted apps for %s", len(driftResponse.Drifts), entry.Path)
+		}
+	}
+}
+
+// auditDriftChange records an audit event if the drift for the app has changed since the last check
+func (s *Server) auditDriftChange(appEntry *types.AppEntry, drift *types.AppDrift) error {
+	state := getDriftState(drift)
+	if s.driftStates[appEntry.Id] == state {
+		return nil
+	}
+	if err := s.insertDriftEvent(context.Background(), appEntry, drift); err != nil {
+		return err
+	}
+	if state == "" {
+		delete(s.driftStates, appEntry.Id)
+	} else {
+		s.driftStates[appEntry.Id] = state
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestGetAppDrift(t *testing.T) {
+	s := &Server{}
+	entry := &types.AppEntry{Path: "/test", IsDev: true}
+	entry.Settings.AuthnType = types.AppAuthnDefault
+	entry.Settings.ApplySource = "/tmp/apply.ace"
+	entry.Metadata.VersionMetadata.GitBranch = "main"
+	entry.Metadata.VersionMetadata.GitCommit = "abc"
+	entry.Metadata.ParamValues = map[string]string{"p1": "1"}
+
+	// Not created through apply
+	drift, err := s.getAppDrift(context.Background(), types.Transaction{}, entry)
+	testutil.AssertNoError(t, err)
+	if drift != nil {
+		t.Fatalf("expected no drift, got %v", drift)
+	}
+
+	info := types.CreateAppRequest{Path: "/test", ParamValues: map[string]string{"p1": "1"}}
+	entry.Metadata.VersionMetadata.ApplyInfo, err = json.Marshal(info)
+	testutil.AssertNoError(t, err)
+
+	// Branch and commit are not set in the config, no drift
+	drift, err = s.getAppDrift(context.Background(), types.Transaction{}, entry)
+	testutil.AssertNoError(t, err)
+	if drift != nil {
+		t.Fatalf("expected no drift, got %v", drift)
+	}
+
+	entry.Metadata.ParamValues["p1"] = "2"
+	entry.Metadata.ParamValues["p2"] = "x"
+	entry.Settings.AuthnType = types.AppAuthnNone
+	drift, err = s.getAppDrift(context.Background(), types.Transaction{}, entry)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsString(t, "source", "/tmp/apply.ace", drift.ApplySource)
+	testutil.AssertEqualsInt(t, "changes", 3, len(drift.Changes))
+	testutil.AssertEqualsString(t, "auth", "auth", drift.Changes[0].Field)
+	testutil.AssertEqualsString(t, "auth live", string(types.AppAuthnNone), drift.Changes[0].New)
+	testutil.AssertEqualsString(t, "p1", "params.p1", drift.Changes[1].Field)
+	testutil.AssertEqualsString(t, "p1 applied", "1", drift.Changes[1].Old)
+	testutil.AssertEqualsString(t, "p1 live", "2", drift.Changes[1].New)
+	testutil.AssertEqualsString(t, "p2", "params.p2", drift.Changes[2].Field)
+	testutil.AssertEqualsString(t, "p2 applied", "", drift.Changes[2].Old)
+}
+
+func TestAuditDriftChange(t *testing.T) {
+	s := &Server{Logger: testutil.TestLogger(), config: &types.ServerConfig{}, driftStates: map[types.AppId]string{}}
+	var err error
+	s.auditDB, s.auditDbType, err = system.InitDBConnection("sqlite:"+path.Join(t.TempDir(), "audit.db"), "audit", system.DB_SQLITE_POSTGRES)
+	testutil.AssertNoError(t, err)
+	defer s.auditDB.Close()
+	testutil.AssertNoError(t, s.versionUpgradeAuditDB())
+
+	events := func() []string {
+		rows, err := s.auditDB.Query(`select detail from audit where operation = ? order by create_time`, DRIFT_OPERATION)
+		testutil.AssertNoError(t, err)
+		defer rows.Close()
+		ret := []string{}
+		for rows.Next() {
+			var detail string
+			testutil.AssertNoError(t, rows.Scan(&detail))
+			ret = append(ret, detail)
+		}
+		return ret
+	}
+
+	entry := &types.AppEntry{Id: "app_prd_1", Path: "/test"}
+	entry.Settings.ApplySource = "/tmp/apply.ace"
+	drift := &types.AppDrift{ApplySource: "/tmp/apply.ace", Changes: []types.FieldDiff{{Field: "params.p1", Old: "1", New: "2"}}}
+
+	testutil.AssertNoError(t, s.auditDriftChange(entry, nil))
+	testutil.AssertEqualsInt(t, "no drift", 0, len(events()))
+	testutil.AssertNoError(t, s.auditDriftChange(entry, drift))
+	testutil.AssertNoError(t, s.auditDriftChange(entry, drift))
+	testutil.AssertEqualsInt(t, "unchanged drift", 1, len(events()))
+
+	drift.Changes[0].New = "3"
+	testutil.AssertNoError(t, s.auditDriftChange(entry, drift))
+	testutil.AssertNoError(t, s.auditDriftChange(entry, nil))
+	testutil.AssertNoError(t, s.auditDriftChange(entry, nil))
+	got := events()
+	testutil.AssertEqualsInt(t, "changed drift", 3, len(got))
+	testutil.AssertEqualsString(t, "drifted", "drifted from /tmp/apply.ace: params.p1", got[1])
+	testutil.AssertEqualsString(t, "resolved", "drift resolved for /tmp/apply.ace", got[2])
+}
+
+func TestCheckDrift(t *testing.T) {
+	s := testSessionServer(t)
+	ctx := context.Background()
+
+	// App updated by apply, not created by it: no apply source is set
+	entry := &types.AppEntry{Id: "app_dev_1", Path: "/test", IsDev: true, SourceUrl: "/tmp/app"}
+	entry.Settings.AuthnType = types.AppAuthnDefault
+	entry.Settings.ApplyPath = "/tmp/apply.ace"
+	entry.Metadata.ParamValues = map[string]string{"p1": "2"}
+	info := types.CreateAppRequest{Path: "/test", ParamValues: map[string]string{"p1": "1"}}
+	var err error
+	entry.Metadata.VersionMetadata.ApplyInfo, err = json.Marshal(info)
+	testutil.AssertNoError(t, err)
+
+	// App not managed by apply
+	other := &types.AppEntry{Id: "app_dev_2", Path: "/other", IsDev: true, SourceUrl: "/tmp/app"}
+	other.Metadata.ParamValues = map[string]string{"p1": "2"}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	testutil.AssertNoError(t, err)
+	testutil.AssertNoError(t, s.db.CreateApp(ctx, tx, entry))
+	testutil.AssertNoError(t, s.db.CreateApp(ctx, tx, other))
+	testutil.AssertNoError(t, tx.Commit())
+
+	checked := 0
+	response, err := s.checkDrift(ctx, "", func(*types.AppEntry, *types.AppDrift) error {
+		checked++
+		return nil
+	})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "checked", 2, checked)
+	testutil.AssertEqualsInt(t, "drifts", 1, len(response.Drifts))
+	testutil.AssertEqualsString(t, "app", "/test", response.Drifts[0].AppPathDomain.Path)
+	testutil.AssertEqualsString(t, "source", "/tmp/apply.ace", response.Drifts[0].ApplySource)
+
+	response, err = s.checkDrift(ctx, "/tmp/apply.ace", func(*types.AppEntry, *types.AppDrift) error { return nil })
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "path drifts", 1, len(response.Drifts))
+
+	response, err = s.checkDrift(ctx, "/tmp/other.ace", func(*types.AppEntry, *types.AppDrift) error { return nil })
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "other path drifts", 0, len(response.Drifts))
+}
@@ -0,0 +1,264 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+// webhookPush is the push event info parsed from the webhook payload
+type webhookPush struct {
+	IsPush bool   // false for non push events (ping, tags, merge requests etc)
+	Branch string // the branch which was pushed to
+	Commit string // the commit id after the push, if available
+}
+
+// getSyncWebhookUrl returns the webhook url for the sync entry
+func (s *Server) getSyncWebhookUrl(id string) string {
+	return fmt.Sprintf("%s%s/%s?id=%s", s.getServerUri(), types.WEBHOOK_URL_PREFIX, types.WebhookSync, url.QueryEscape(id))
+}
+
+// checkWebhookAuth authenticates the webhook request. Bearer token auth, GitHub and Gitea style
+// HMAC signatures and the GitLab token header are supported
+func checkWebhookAuth(r *http.Request, token string, body []byte) error {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		// Using Authentication header, bearer token
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return errors.New("Authorization header with bearer token is required")
+		}
+		authHeader = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		if authHeader == "" {
+			return errors.New("Bearer token is required")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(authHeader)) != 1 {
+			return errors.New("Invalid bearer token")
+		}
+		return nil
+	}
+
+	// https://docs.github.com/en/webhooks/webhook-events-and-payloads#delivery-headers
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		return validateSignature(token, signature, body)
+	}
+
+	// Gitea sends the hex signature without the sha256= prefix
+	if signature := r.Header.Get("X-Gitea-Signature"); signature != "" {
+		if !validatePayload(token, signature, body) {
+			return errors.New("invalid payload, signature match failed")
+		}
+		return nil
+	}
+
+	// GitLab sends the secret token as is
+	if gitlabToken := r.Header.Get("X-Gitlab-Token"); gitlabToken != "" {
+		if !hmac.Equal([]byte(token), []byte(gitlabToken)) {
+			return errors.New("invalid gitlab token")
+		}
+		return nil
+	}
+
+	return errors.New("No auth header and no signature found")
+}
+
+// parseWebhookPush parses the push event from GitHub, GitLab and Gitea webhook payloads. If there
+// is no event header, the payload is treated as a push event if it has a ref key
+func parseWebhookPush(r *http.Request, body []byte) (*webhookPush, error) {
+	eventType := ""
+	pushEvent := ""
+	if event := r.Header.Get("X-GitHub-Event"); event != "" {
+		eventType, pushEvent = event, "push"
+	} else if event := r.Header.Get("X-Gitea-Event"); event != "" {
+		eventType, pushEvent = event, "push"
+	} else if event := r.Header.Get("X-Gitlab-Event"); event != "" {
+		eventType, pushEvent = event, "Push Hook"
+	}
+
+	if eventType != "" && eventType != pushEvent {
+		return &webhookPush{IsPush: false}, nil
+	}
+
+	payload := struct {
+		Ref   string `json:"ref"`
+		After string `json:"after"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("error parsing request, expected JSON: %w", err)
+	}
+
+	if payload.Ref == "" {
+		if eventType == "" {
+			return nil, errors.New("could not find branch info in request payload, ref key should be present")
+		}
+		return nil, errors.New("push event payload does not have ref key")
+	}
+	if !strings.HasPrefix(payload.Ref, "refs/heads/") {
+		// Tag push, not a branch push
+		return &webhookPush{IsPush: false}, nil
+	}
+
+	return &webhookPush{
+		IsPush: true,
+		Branch: strings.TrimPrefix(payload.Ref, "refs/heads/"),
+		Commit: payload.After,
+	}, nil
+}
+
+// syncWebhookHandler handles the webhook call for a sync entry. Push events for the sync branch queue the
+// sync job, 202 is returned without waiting for the job. Other events are ignored
+func (h *Handler) syncWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required for sync webhook call", http.StatusBadRequest)
+		return
+	}
+
+	syncEntry, err := h.server.GetSyncEntry(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if syncEntry.IsScheduled || syncEntry.Metadata.WebhookSecret == "" {
+		http.Error(w, "webhook is not enabled for sync entry", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request body: %s", err), http.StatusUnauthorized)
+		return
+	}
+
+	if err := checkWebhookAuth(r, syncEntry.Metadata.WebhookSecret, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	push, err := parseWebhookPush(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !push.IsPush {
+		h.Debug().Msgf("Ignoring non push webhook event for sync %s", id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if syncEntry.Metadata.GitBranch != "" && push.Branch != syncEntry.Metadata.GitBranch {
+		h.Info().Msgf("Ignoring webhook call for sync %s, branch mismatch, found %s, expected %s", id, push.Branch, syncEntry.Metadata.GitBranch)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if push.Commit != "" && push.Commit == syncEntry.Status.CommitId {
+		h.Info().Msgf("Ignoring webhook call for sync %s, commit %s already applied", id, push.Commit)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if syncEntry.Status.FailureCount >= h.server.config.System.MaxSyncFailureCount {
+		http.Error(w, fmt.Sprintf("sync %s is disabled after %d failures, use sync run to enable it", id, syncEntry.Status.FailureCount), http.StatusConflict)
+		return
+	}
+
+	h.Trace().Str("method", r.Method).Str("url", r.URL.String()).Msg("API Received request")
+	event := types.AuditEvent{
+		RequestId: system.GetContextRequestId(r.Context()),
+		UserId:    system.GetContextUserId(r.Context()),
+		AppId:     system.GetContextAppId(r.Context()),
+		EventType: types.EventTypeSystem,
+		Operation: fmt.Sprintf("webhook_%s", types.WebhookSync),
+		Target:    id,
+	}
+	h.server.queueWebhookSync(syncEntry, event)
+	h.Info().Msgf("Queued webhook sync %s, path: %s, branch %s", id, syncEntry.Path, push.Branch)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "queued"}); err != nil {
+		h.Error().Err(err).Msg("error encoding response")
+	}
+}
+
+// queueWebhookSync runs the sync job for the webhook call in the background. If a webhook sync is
+// already running for the entry, one more run is done after the current run completes, so that
+// the latest push is applied
+func (s *Server) queueWebhookSync(entry *types.SyncEntry, event types.AuditEvent) {
+	s.webhookSyncLock.Lock()
+	defer s.webhookSyncLock.Unlock()
+	if s.webhookSyncs == nil {
+		s.webhookSyncs = map[string]bool{}
+	}
+	if _, running := s.webhookSyncs[entry.Id]; running {
+		s.webhookSyncs[entry.Id] = true
+		return
+	}
+	s.webhookSyncs[entry.Id] = false
+
+	go func() {
+		id := entry.Id
+		for entry != nil {
+			s.runWebhookSync(entry, event)
+			entry = s.nextWebhookSync(id)
+		}
+	}()
+}
+
+// nextWebhookSync returns the entry to run again if there was another webhook call during the run, nil
+// otherwise. The entry is reloaded, since the status is updated by the earlier run
+func (s *Server) nextWebhookSync(id string) *types.SyncEntry {
+	s.webhookSyncLock.Lock()
+	defer s.webhookSyncLock.Unlock()
+	if !s.webhookSyncs[id] {
+		delete(s.webhookSyncs, id)
+		return nil
+	}
+	s.webhookSyncs[id] = false
+
+	entry, err := s.GetSyncEntry(context.Background(), id)
+	if err != nil {
+		s.Error().Err(err).Msgf("error getting sync entry %s for webhook rerun", id)
+	} else if entry.Status.FailureCount >= s.config.System.MaxSyncFailureCount {
+		s.Warn().Msgf("Sync %s is disabled, skipping webhook rerun", id)
+	} else {
+		return entry
+	}
+	delete(s.webhookSyncs, id)
+	return nil
+}
+
+// runWebhookSync runs the sync job and adds the audit event with the result
+func (s *Server) runWebhookSync(entry *types.SyncEntry, event types.AuditEvent) {
+	status, err := s.RunSyncWebhook(context.Background(), entry)
+	if err == nil && status.Error != "" {
+		err = errors.New(status.Error)
+	}
+	s.Info().Msgf("Webhook sync %s completed, path: %s, err %s", entry.Id, entry.Path, err)
+
+	event.CreateTime = time.Now()
+	event.Status = string(types.EventStatusSuccess)
+	if err != nil {
+		event.Status = string(types.EventStatusFailure)
+		event.Detail = err.Error()
+		s.Error().Err(err).Msg("error in sync webhook call")
+	}
+	if err := s.InsertAuditEvent(&event); err != nil {
+		s.Error().Err(err).Msg("error inserting audit event")
+	}
+}
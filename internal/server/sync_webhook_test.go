@@ -0,0 +1,109 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestParseWebhookPush(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		event       string
+		body        string
+		wantPush    bool
+		wantBranch  string
+		wantCommit  string
+		errContains string
+	}{
+		{"github push", "X-GitHub-Event", "push", `{"ref": "refs/heads/main", "after": "abc"}`, true, "main", "abc", ""},
+		{"github ping", "X-GitHub-Event", "ping", `{"zen": "test"}`, false, "", "", ""},
+		{"github tag", "X-GitHub-Event", "push", `{"ref": "refs/tags/v1.0.0"}`, false, "", "", ""},
+		{"gitlab push", "X-Gitlab-Event", "Push Hook", `{"ref": "refs/heads/dev", "after": "def"}`, true, "dev", "def", ""},
+		{"gitlab tag", "X-Gitlab-Event", "Tag Push Hook", `{"ref": "refs/tags/v1"}`, false, "", "", ""},
+		{"gitea push", "X-Gitea-Event", "push", `{"ref": "refs/heads/feature/x"}`, true, "feature/x", "", ""},
+		{"no event", "", "", `{"ref": "refs/heads/main"}`, true, "main", "", ""},
+		{"no event no ref", "", "", `{}`, false, "", "", "ref key should be present"},
+		{"invalid json", "X-GitHub-Event", "push", `abc`, false, "", "", "expected JSON"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.event)
+		}
+		push, err := parseWebhookPush(r, []byte(tt.body))
+		if tt.errContains != "" {
+			testutil.AssertErrorContains(t, err, tt.errContains)
+			continue
+		}
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualsBool(t, tt.name, tt.wantPush, push.IsPush)
+		testutil.AssertEqualsString(t, tt.name, tt.wantBranch, push.Branch)
+		testutil.AssertEqualsString(t, tt.name, tt.wantCommit, push.Commit)
+	}
+}
+
+func TestCheckWebhookAuth(t *testing.T) {
+	secret := "cl_tkn_abc"
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	signature := hashPayload(secret, body)
+
+	tests := []struct {
+		name        string
+		header      string
+		value       string
+		errContains string
+	}{
+		{"bearer", "Authorization", "Bearer " + secret, ""},
+		{"bearer invalid", "Authorization", "Bearer abc", "Invalid bearer token"},
+		{"github", "X-Hub-Signature-256", "sha256=" + signature, ""},
+		{"github invalid", "X-Hub-Signature-256", "sha256=" + strings.Repeat("0", len(signature)), "signature match failed"},
+		{"gitea", "X-Gitea-Signature", signature, ""},
+		{"gitea invalid", "X-Gitea-Signature", "abc", "signature match failed"},
+		{"gitlab", "X-Gitlab-Token", secret, ""},
+		{"gitlab invalid", "X-Gitlab-Token", "abc", "invalid gitlab token"},
+		{"no auth", "", "", "No auth header"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		err := checkWebhookAuth(r, secret, body)
+		if tt.errContains != "" {
+			testutil.AssertErrorContains(t, err, tt.errContains)
+		} else {
+			testutil.AssertNoError(t, err)
+		}
+	}
+}
+
+func TestQueueWebhookSync(t *testing.T) {
+	s := testSessionServer(t)
+	s.webhookSyncs = map[string]bool{"cl_syn_1": false}
+
+	// Run in progress, the call is queued for a rerun
+	s.queueWebhookSync(&types.SyncEntry{Id: "cl_syn_1"}, types.AuditEvent{})
+	s.queueWebhookSync(&types.SyncEntry{Id: "cl_syn_1"}, types.AuditEvent{})
+	testutil.AssertEqualsBool(t, "rerun pending", true, s.webhookSyncs["cl_syn_1"])
+
+	// Entry not found for the rerun, the run state is cleared
+	entry := s.nextWebhookSync("cl_syn_1")
+	testutil.AssertEqualsBool(t, "no rerun", true, entry == nil)
+	_, running := s.webhookSyncs["cl_syn_1"]
+	testutil.AssertEqualsBool(t, "running", false, running)
+
+	s.webhookSyncs["cl_syn_2"] = false
+	entry = s.nextWebhookSync("cl_syn_2")
+	testutil.AssertEqualsBool(t, "no rerun", true, entry == nil)
+	testutil.AssertEqualsInt(t, "runs", 0, len(s.webhookSyncs))
+}
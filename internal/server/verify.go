@@ -0,0 +1,180 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+// verifyApp runs the verification for the prod app after a promote or version switch, if verify is
+// enabled in the app config. On failure, the app is switched back to the previous version. Returns nil
+// if verification is not enabled. The outcome is recorded as an audit event.
+func (s *Server) verifyApp(ctx context.Context, appPathDomain types.AppPathDomain, op string, previousVersion int) (*types.VerifyResult, error) {
+	prodApp, err := s.GetApp(appPathDomain, true)
+	if err != nil {
+		return nil, err
+	}
+	if !prodApp.AppConfig.Verify.Enabled {
+		return nil, nil
+	}
+
+	ret := &types.VerifyResult{
+		AppPathDomain: appPathDomain,
+		Version:       prodApp.Metadata.VersionMetadata.Version,
+		Success:       true,
+	}
+
+	event := types.AuditEvent{
+		RequestId:  system.GetContextRequestId(ctx),
+		CreateTime: time.Now(),
+		UserId:     system.GetContextUserId(ctx),
+		AppId:      prodApp.Id,
+		EventType:  types.EventTypeSystem,
+		Operation:  op + "_verify",
+		Target:     appPathDomain.String(),
+		Status:     string(types.EventStatusSuccess),
+		Detail:     fmt.Sprintf("version %d verified", ret.Version),
+	}
+
+	defer func() {
+		if err := s.InsertAuditEvent(&event); err != nil {
+			s.Error().Err(err).Msg("error inserting audit event")
+		}
+	}()
+
+	verifyErr := prodApp.Verify(ctx)
+	if verifyErr == nil {
+		return ret, nil
+	}
+
+	s.Warn().Err(verifyErr).Msgf("Verification failed for %s version %d", appPathDomain, ret.Version)
+	ret.Success = false
+	ret.Error = verifyErr.Error()
+	event.Status = string(types.EventStatusFailure)
+
+	if previousVersion == 0 || previousVersion == ret.Version {
+		event.Detail = fmt.Sprintf("version %d verification failed, no version to revert to: %s", ret.Version, verifyErr)
+		return ret, nil
+	}
+
+	revertResult, err := s.versionSwitch(ctx, appPathDomain, false, strconv.Itoa(previousVersion))
+	if err == nil && revertResult.VerifyResult != nil {
+		// The previous version failed to start, the verified version continues to serve requests
+		err = errors.New(revertResult.VerifyResult.Error)
+	}
+	if err != nil {
+		ret.Error = fmt.Sprintf("%s, revert to version %d failed: %s", verifyErr, previousVersion, err)
+		event.Detail = fmt.Sprintf("version %d verification failed: %s", ret.Version, ret.Error)
+		return ret, nil
+	}
+
+	ret.RevertedTo = previousVersion
+	event.Detail = fmt.Sprintf("version %d verification failed, reverted to version %d: %s", ret.Version, previousVersion, verifyErr)
+	return ret, nil
+}
+
+// switchApps creates the audit entries for the updated apps and switches them to the version committed in
+// the database, see AppStore.SwitchApps. If the new version of an app fails to start, it is handled like
+// a failed verify: the app is reverted to the version which continues to serve requests. The results for
+// the failed apps are returned
+func (s *Server) switchApps(ctx context.Context, pathDomains []types.AppPathDomain, op string) ([]types.VerifyResult, error) {
+	err := s.apps.ClearAppsAudit(ctx, pathDomains, op)
+	var switchErr *SwitchError
+	if err == nil || !errors.As(err, &switchErr) {
+		return nil, err
+	}
+
+	results := make([]types.VerifyResult, 0, len(switchErr.Failed))
+	for _, appPathDomain := range slices.SortedFunc(maps.Keys(switchErr.Failed), func(a, b types.AppPathDomain) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		results = append(results, s.revertFailedSwitch(ctx, appPathDomain, op, switchErr.Failed[appPathDomain]))
+	}
+	return results, nil
+}
+
+// revertFailedSwitch reverts the app to the version which is serving requests, after the switch to the new
+// version failed. The outcome is recorded as an audit event
+func (s *Server) revertFailedSwitch(ctx context.Context, appPathDomain types.AppPathDomain, op string, failure SwitchFailure) types.VerifyResult {
+	ret := types.VerifyResult{
+		AppPathDomain: appPathDomain,
+		Version:       failure.ToVersion,
+		Error:         failure.Err.Error(),
+	}
+
+	event := types.AuditEvent{
+		RequestId:  system.GetContextRequestId(ctx),
+		CreateTime: time.Now(),
+		UserId:     system.GetContextUserId(ctx),
+		EventType:  types.EventTypeSystem,
+		Operation:  op + "_switch",
+		Target:     appPathDomain.String(),
+		Status:     string(types.EventStatusFailure),
+	}
+
+	defer func() {
+		if err := s.InsertAuditEvent(&event); err != nil {
+			s.Error().Err(err).Msg("error inserting audit event")
+		}
+	}()
+
+	if failure.FromVersion == failure.ToVersion {
+		event.Detail = fmt.Sprintf("version %d failed to start, no version to revert to: %s", failure.ToVersion, failure.Err)
+		return ret
+	}
+
+	appId, err := s.revertVersion(ctx, appPathDomain, failure)
+	event.AppId = appId
+	if err != nil {
+		ret.Error = fmt.Sprintf("%s, revert to version %d failed: %s", failure.Err, failure.FromVersion, err)
+		event.Detail = fmt.Sprintf("version %d failed to start: %s", failure.ToVersion, ret.Error)
+		return ret
+	}
+
+	ret.RevertedTo = failure.FromVersion
+	event.Detail = fmt.Sprintf("version %d failed to start, reverted to version %d: %s", failure.ToVersion, failure.FromVersion, failure.Err)
+	return ret
+}
+
+// revertVersion updates the app metadata to the version which is serving requests, after the switch to the
+// new version failed. The app id is returned
+func (s *Server) revertVersion(ctx context.Context, appPathDomain types.AppPathDomain, failure SwitchFailure) (types.AppId, error) {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return "", err
+	}
+	if appEntry.Metadata.VersionMetadata.Version != failure.ToVersion {
+		return appEntry.Id, fmt.Errorf("app version has changed to %d", appEntry.Metadata.VersionMetadata.Version)
+	}
+
+	if _, err := s.setAppVersion(ctx, tx, appEntry, failure.FromVersion); err != nil {
+		return appEntry.Id, err
+	}
+	if err := tx.Commit(); err != nil {
+		return appEntry.Id, err
+	}
+
+	// The current app is running the reverted version, its containers are reused by the switch. Other
+	// servers are notified of the revert. If the switch fails, the current app continues to serve requests
+	if err := s.apps.ClearAppsAudit(ctx, []types.AppPathDomain{appPathDomain}, "version_revert"); err != nil {
+		s.Warn().Err(err).Msgf("Error switching app %s after revert", appPathDomain)
+	}
+	return appEntry.Id, nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func testVerifyServer(t *testing.T) *Server {
+	t.Helper()
+	clHome := t.TempDir()
+	t.Setenv("CL_HOME", clHome)
+	config, err := system.NewServerConfigEmbedded()
+	testutil.AssertNoError(t, err)
+	config.Log.Level = "WARN"
+	config.System.ContainerCommand = ""
+	config.AppConfig.Verify = types.Verify{Enabled: true, Route: "/verify", Attempts: 1}
+
+	s, err := NewServer(config)
+	testutil.AssertNoError(t, err)
+	t.Cleanup(func() {
+		s.syncTimer.Stop()
+	})
+	return s
+}
+
+func writeVerifyApp(t *testing.T, dir string, verifyRoute bool) {
+	t.Helper()
+	routes := `ace.html("/")`
+	if verifyRoute {
+		routes += `, ace.api("/verify")`
+	}
+	testutil.AssertNoError(t, os.WriteFile(path.Join(dir, "app.star"), []byte(`
+def handler(req):
+	return {"key": "myvalue"}
+
+app = ace.app("testApp", custom_layout=True, routes = [`+routes+`])
+`), 0600))
+	testutil.AssertNoError(t, os.WriteFile(path.Join(dir, "index.go.html"), []byte(`Template got {{ .Data.key }}.`), 0600))
+}
+
+func TestVerifyPromote(t *testing.T) {
+	s := testVerifyServer(t)
+	ctx := context.Background()
+	appDir := t.TempDir()
+	appPath := types.AppPathDomain{Path: "/verifytest"}
+	writeVerifyApp(t, appDir, true)
+
+	_, err := s.CreateApp(ctx, appPath.Path, true, false, &types.CreateAppRequest{SourceUrl: appDir, AppAuthn: "none"})
+	testutil.AssertNoError(t, err)
+	prodVersion := func() int {
+		entry, err := s.db.GetApp(appPath)
+		testutil.AssertNoError(t, err)
+		return entry.Metadata.VersionMetadata.Version
+	}
+	initialVersion := prodVersion()
+
+	// Promote done by reload is verified
+	_, err = s.ReloadApps(ctx, appPath.Path, true, false, true, "", "", "", "", true)
+	testutil.AssertNoError(t, err)
+	verifiedVersion := prodVersion()
+	testutil.AssertEqualsBool(t, "version updated", true, verifiedVersion > initialVersion)
+
+	// Verification fails for the new version, the prod app is reverted to the previous version
+	writeVerifyApp(t, appDir, false)
+	_, err = s.ReloadApps(ctx, appPath.Path, true, false, true, "", "", "", "", true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "reverted version", verifiedVersion, prodVersion())
+
+	// Promote returns the verify results, the stage app still has the failing version
+	ret, err := s.PromoteApps(ctx, appPath.Path, false)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "verify results", 1, len(ret.VerifyResults))
+	testutil.AssertEqualsBool(t, "verify failed", false, ret.VerifyResults[0].Success)
+	testutil.AssertEqualsInt(t, "reverted to", verifiedVersion, ret.VerifyResults[0].RevertedTo)
+	testutil.AssertStringContains(t, ret.VerifyResults[0].Error, "verify route /verifytest/verify returned status 404")
+	testutil.AssertEqualsInt(t, "reverted version", verifiedVersion, prodVersion())
+
+	// Dry run promote is not verified
+	ret, err = s.PromoteApps(ctx, appPath.Path, true)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "dry run verify results", 0, len(ret.VerifyResults))
+
+	// Verification succeeds after the route is added back
+	writeVerifyApp(t, appDir, true)
+	_, err = s.ReloadApps(ctx, appPath.Path, true, false, false, "", "", "", "", true)
+	testutil.AssertNoError(t, err)
+	ret, err = s.PromoteApps(ctx, appPath.Path, false)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "verify results", 1, len(ret.VerifyResults))
+	testutil.AssertEqualsBool(t, "verify success", true, ret.VerifyResults[0].Success)
+	testutil.AssertEqualsBool(t, "version promoted", true, prodVersion() > verifiedVersion)
+}
+
+func TestRevertFailedSwitch(t *testing.T) {
+	s := testVerifyServer(t)
+	ctx := context.Background()
+	appDir := t.TempDir()
+	appPath := types.AppPathDomain{Path: "/switchtest"}
+	writeVerifyApp(t, appDir, true)
+
+	_, err := s.CreateApp(ctx, appPath.Path, true, false, &types.CreateAppRequest{SourceUrl: appDir, AppAuthn: "none"})
+	testutil.AssertNoError(t, err)
+	prodVersion := func() int {
+		entry, err := s.db.GetApp(appPath)
+		testutil.AssertNoError(t, err)
+		return entry.Metadata.VersionMetadata.Version
+	}
+	initialVersion := prodVersion()
+	_, err = s.ReloadApps(ctx, appPath.Path, true, false, true, "", "", "", "", true)
+	testutil.AssertNoError(t, err)
+	newVersion := prodVersion()
+	testutil.AssertEqualsBool(t, "version updated", true, newVersion > initialVersion)
+
+	// Same version failed to start, nothing to revert
+	result := s.revertFailedSwitch(ctx, appPath, "update_settings", SwitchFailure{FromVersion: newVersion, ToVersion: newVersion, Err: errors.New("start failed")})
+	testutil.AssertEqualsBool(t, "failed", false, result.Success)
+	testutil.AssertEqualsInt(t, "not reverted", 0, result.RevertedTo)
+	testutil.AssertEqualsInt(t, "version", newVersion, prodVersion())
+
+	// The database version does not match the failed version, not reverted
+	result = s.revertFailedSwitch(ctx, appPath, "reload", SwitchFailure{FromVersion: initialVersion, ToVersion: newVersion + 1, Err: errors.New("start failed")})
+	testutil.AssertEqualsInt(t, "not reverted", 0, result.RevertedTo)
+	testutil.AssertStringContains(t, result.Error, "revert to version")
+	testutil.AssertEqualsInt(t, "version", newVersion, prodVersion())
+
+	// New version failed to start, the app is reverted to the version serving requests
+	result = s.revertFailedSwitch(ctx, appPath, "reload", SwitchFailure{FromVersion: initialVersion, ToVersion: newVersion, Err: errors.New("start failed")})
+	testutil.AssertEqualsBool(t, "failed", false, result.Success)
+	testutil.AssertEqualsInt(t, "failed version", newVersion, result.Version)
+	testutil.AssertEqualsInt(t, "reverted to", initialVersion, result.RevertedTo)
+	testutil.AssertEqualsString(t, "error", "start failed", result.Error)
+	testutil.AssertEqualsInt(t, "reverted version", initialVersion, prodVersion())
+
+	entry, err := s.db.GetApp(appPath)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "previous version", newVersion, entry.Metadata.VersionMetadata.PreviousVersion)
+
+	switchErr := &SwitchError{Failed: map[types.AppPathDomain]SwitchFailure{
+		appPath: {FromVersion: initialVersion, ToVersion: newVersion, Err: errors.New("start failed")},
+	}}
+	testutil.AssertEqualsString(t, "switch error",
+		fmt.Sprintf("error initializing version %d of app /switchtest, version %d continues to serve requests: start failed", newVersion, initialVersion),
+		switchErr.Error())
+}
@@ -89,12 +89,29 @@ func (s *Server) VersionFiles(ctx context.Context, mainAppPath, version string)
 	return &types.AppVersionFilesResponse{Files: files}, nil
 }
 
+// VersionSwitch switches the prod app to the specified version. If verify is enabled for the app, the new
+// version is verified after the switch and the app is switched back on failure
 func (s *Server) VersionSwitch(ctx context.Context, mainAppPath string, dryRun bool, version string) (*types.AppVersionSwitchResponse, error) {
 	appPathDomain, err := parseAppPath(mainAppPath)
 	if err != nil {
 		return nil, err
 	}
 
+	ret, err := s.versionSwitch(ctx, appPathDomain, dryRun, version)
+	if err != nil || dryRun || ret.FromVersion == ret.ToVersion || ret.VerifyResult != nil {
+		// No verify if the new version failed to start
+		return ret, err
+	}
+
+	ret.VerifyResult, err = s.verifyApp(ctx, appPathDomain, "version_switch", ret.FromVersion)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Server) versionSwitch(ctx context.Context, appPathDomain types.AppPathDomain, dryRun bool, version string) (*types.AppVersionSwitchResponse, error) {
+
 	tx, err := s.db.BeginTransaction(ctx)
 	if err != nil {
 		return nil, err
@@ -161,15 +178,8 @@ func (s *Server) VersionSwitch(ctx context.Context, mainAppPath string, dryRun b
 		}
 	}
 
-	newVersion, err := fileStore.GetAppVersion(ctx, tx, versionInt)
+	fromVersion, err := s.setAppVersion(ctx, tx, appEntry, versionInt)
 	if err != nil {
-		return nil, fmt.Errorf("error getting version %d: %w", versionInt, err)
-	}
-
-	fromVersion := appEntry.Metadata.VersionMetadata.Version
-	appEntry.Metadata = *newVersion.Metadata
-	appEntry.Metadata.VersionMetadata.PreviousVersion = fromVersion
-	if err = s.db.UpdateAppMetadata(ctx, tx, appEntry); err != nil {
 		return nil, err
 	}
 
@@ -187,6 +197,30 @@ func (s *Server) VersionSwitch(ctx context.Context, mainAppPath string, dryRun b
 		return nil, err
 	}
 
-	s.apps.ClearAppsAudit(ctx, []types.AppPathDomain{appPathDomain}, "version-switch")
+	failedResults, err := s.switchApps(ctx, []types.AppPathDomain{appPathDomain}, "version-switch")
+	if err != nil {
+		return nil, err
+	}
+	if len(failedResults) > 0 {
+		// The new version failed to start, the app was reverted to the version which is serving requests
+		ret.VerifyResult = &failedResults[0]
+	}
 	return ret, nil
 }
+
+// setAppVersion updates the app metadata to the specified version. The version being switched from is returned
+func (s *Server) setAppVersion(ctx context.Context, tx types.Transaction, appEntry *types.AppEntry, versionInt int) (int, error) {
+	fileStore := metadata.NewFileStore(appEntry.Id, appEntry.Metadata.VersionMetadata.Version, s.db, tx)
+	newVersion, err := fileStore.GetAppVersion(ctx, tx, versionInt)
+	if err != nil {
+		return 0, fmt.Errorf("error getting version %d: %w", versionInt, err)
+	}
+
+	fromVersion := appEntry.Metadata.VersionMetadata.Version
+	appEntry.Metadata = *newVersion.Metadata
+	appEntry.Metadata.VersionMetadata.PreviousVersion = fromVersion
+	if err = s.db.UpdateAppMetadata(ctx, tx, appEntry); err != nil {
+		return 0, err
+	}
+	return fromVersion, nil
+}
@@ -0,0 +1,204 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/claceio/clace/internal/metadata"
+	"github.com/claceio/clace/internal/system"
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	BINARY_CHECK_LEN = 8000 // number of bytes checked for NUL to detect binary files
+)
+
+// VersionDiff returns the source file and metadata changes between two versions of an app.
+// Files are compared by their sha, so only the contents of changed files are loaded
+func (s *Server) VersionDiff(ctx context.Context, mainAppPath, fromVersion, toVersion string) (*types.AppVersionDiffResponse, error) {
+	appPathDomain, err := parseAppPath(mainAppPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fromInt, err := strconv.Atoi(fromVersion)
+	if err != nil {
+		return nil, types.CreateRequestError(fmt.Sprintf("invalid from version %s", fromVersion), http.StatusBadRequest)
+	}
+	toInt, err := strconv.Atoi(toVersion)
+	if err != nil {
+		return nil, types.CreateRequestError(fmt.Sprintf("invalid to version %s", toVersion), http.StatusBadRequest)
+	}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	appEntry, err := s.db.GetAppTx(ctx, tx, appPathDomain)
+	if err != nil {
+		return nil, err
+	}
+	if appEntry.IsDev {
+		return nil, fmt.Errorf("version commands not supported for dev app")
+	}
+
+	fromStore := metadata.NewFileStore(appEntry.Id, fromInt, s.db, tx)
+	fromAppVersion, err := fromStore.GetAppVersion(ctx, tx, fromInt)
+	if err != nil {
+		return nil, types.CreateRequestError(fmt.Sprintf("version %d not found for app %s", fromInt, appPathDomain), http.StatusNotFound)
+	}
+	toStore := metadata.NewFileStore(appEntry.Id, toInt, s.db, tx)
+	toAppVersion, err := toStore.GetAppVersion(ctx, tx, toInt)
+	if err != nil {
+		return nil, types.CreateRequestError(fmt.Sprintf("version %d not found for app %s", toInt, appPathDomain), http.StatusNotFound)
+	}
+
+	fromFiles, err := fromStore.GetAppFiles(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	toFiles, err := toStore.GetAppFiles(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileDiffs, err := diffVersionFiles(fromFiles, toFiles, func(sha string) ([]byte, error) {
+		return fromStore.GetFileContent(ctx, tx, sha)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.AppVersionDiffResponse{
+		FromVersion:     fromInt,
+		ToVersion:       toInt,
+		MetadataChanges: diffVersionMetadata(fromAppVersion.Metadata, toAppVersion.Metadata),
+		Files:           fileDiffs,
+	}, nil
+}
+
+// diffVersionFiles returns the diff for the files added, removed or modified, in name order.
+// Both file lists are expected to be sorted by name
+func diffVersionFiles(fromFiles, toFiles []types.AppFile, readFile func(sha string) ([]byte, error)) ([]types.VersionFileDiff, error) {
+	diffs := make([]types.VersionFileDiff, 0)
+	i, j := 0, 0
+	for i < len(fromFiles) || j < len(toFiles) {
+		var from, to *types.AppFile
+		switch {
+		case j == len(toFiles) || (i < len(fromFiles) && fromFiles[i].Name < toFiles[j].Name):
+			from = &fromFiles[i]
+			i++
+		case i == len(fromFiles) || toFiles[j].Name < fromFiles[i].Name:
+			to = &toFiles[j]
+			j++
+		default:
+			from, to = &fromFiles[i], &toFiles[j]
+			i++
+			j++
+			if from.Etag == to.Etag {
+				continue // same content
+			}
+		}
+
+		diff, err := diffVersionFile(from, to, readFile)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+func diffVersionFile(from, to *types.AppFile, readFile func(sha string) ([]byte, error)) (types.VersionFileDiff, error) {
+	var fromData, toData []byte
+	var err error
+	fromName, toName := "/dev/null", "/dev/null"
+	ret := types.VersionFileDiff{Status: types.FileDiffModified}
+
+	if from != nil {
+		ret.Name = from.Name
+		fromName = "a/" + from.Name
+		if fromData, err = readFile(from.Etag); err != nil {
+			return ret, fmt.Errorf("error reading file %s: %w", from.Name, err)
+		}
+	} else {
+		ret.Status = types.FileDiffAdded
+	}
+
+	if to != nil {
+		ret.Name = to.Name
+		toName = "b/" + to.Name
+		if toData, err = readFile(to.Etag); err != nil {
+			return ret, fmt.Errorf("error reading file %s: %w", to.Name, err)
+		}
+	} else {
+		ret.Status = types.FileDiffRemoved
+	}
+
+	if isBinary(fromData) || isBinary(toData) {
+		ret.Binary = true
+		return ret, nil
+	}
+
+	ret.Diff = system.UnifiedDiff(fromName, toName, string(fromData), string(toData))
+	return ret, nil
+}
+
+func isBinary(data []byte) bool {
+	check := data[:min(len(data), BINARY_CHECK_LEN)]
+	return bytes.IndexByte(check, 0) >= 0 || !utf8.Valid(data)
+}
+
+// diffVersionMetadata returns the metadata changes between two app versions
+func diffVersionMetadata(from, to *types.AppMetadata) []types.FieldDiff {
+	if from == nil {
+		from = &types.AppMetadata{}
+	}
+	if to == nil {
+		to = &types.AppMetadata{}
+	}
+
+	diffs := diffAppState(getAppState(&types.AppEntry{Metadata: *from}), getAppState(&types.AppEntry{Metadata: *to}))
+	diffs = appendValueDiff(diffs, "git_message", from.VersionMetadata.GitMessage, to.VersionMetadata.GitMessage)
+	diffs = appendSliceDiff(diffs, "permissions", formatPermissions(from.Permissions), formatPermissions(to.Permissions))
+	diffs = appendSliceDiff(diffs, "accounts", formatAccounts(from.Accounts), formatAccounts(to.Accounts))
+	return diffs
+}
+
+func formatPermissions(perms []types.Permission) []string {
+	ret := make([]string, 0, len(perms))
+	for _, p := range perms {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "%s.%s(%s)", p.Plugin, p.Method, strings.Join(p.Arguments, ", "))
+		if p.IsRead != nil {
+			if *p.IsRead {
+				buf.WriteString(" read")
+			} else {
+				buf.WriteString(" write")
+			}
+		}
+		if len(p.Secrets) > 0 {
+			fmt.Fprintf(&buf, " secrets=%v", p.Secrets)
+		}
+		ret = append(ret, buf.String())
+	}
+	return ret
+}
+
+func formatAccounts(accounts []types.AccountLink) []string {
+	ret := make([]string, 0, len(accounts))
+	for _, a := range accounts {
+		ret = append(ret, a.Plugin+":"+a.AccountName)
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestDiffVersionFiles(t *testing.T) {
+	contents := map[string]string{
+		"s1": "a\nb\n",
+		"s2": "a\nc\n",
+		"s3": "x\n",
+		"s4": "\x00\x01",
+	}
+	readFile := func(sha string) ([]byte, error) {
+		return []byte(contents[sha]), nil
+	}
+
+	from := []types.AppFile{{Name: "app.star", Etag: "s1"}, {Name: "img.png", Etag: "s4"}, {Name: "old.txt", Etag: "s3"}, {Name: "same.txt", Etag: "s3"}}
+	to := []types.AppFile{{Name: "app.star", Etag: "s2"}, {Name: "img.png", Etag: "s3"}, {Name: "new.txt", Etag: "s3"}, {Name: "same.txt", Etag: "s3"}}
+
+	diffs, err := diffVersionFiles(from, to, readFile)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "count", 4, len(diffs))
+
+	testutil.AssertEqualsString(t, "name", "app.star", diffs[0].Name)
+	testutil.AssertEqualsString(t, "status", string(types.FileDiffModified), string(diffs[0].Status))
+	testutil.AssertEqualsString(t, "diff", "--- a/app.star\n+++ b/app.star\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n", diffs[0].Diff)
+
+	testutil.AssertEqualsString(t, "name", "img.png", diffs[1].Name)
+	testutil.AssertEqualsBool(t, "binary", true, diffs[1].Binary)
+
+	testutil.AssertEqualsString(t, "name", "new.txt", diffs[2].Name)
+	testutil.AssertEqualsString(t, "status", string(types.FileDiffAdded), string(diffs[2].Status))
+	testutil.AssertEqualsString(t, "diff", "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+x\n", diffs[2].Diff)
+
+	testutil.AssertEqualsString(t, "name", "old.txt", diffs[3].Name)
+	testutil.AssertEqualsString(t, "status", string(types.FileDiffRemoved), string(diffs[3].Status))
+}
+
+func TestDiffVersionMetadata(t *testing.T) {
+	isRead := true
+	from := &types.AppMetadata{
+		VersionMetadata: types.VersionMetadata{GitCommit: "abc", GitMessage: "first"},
+		ParamValues:     map[string]string{"p1": "1"},
+		Permissions:     []types.Permission{{Plugin: "exec.in", Method: "run", Arguments: []string{"ls"}}},
+	}
+	to := &types.AppMetadata{
+		VersionMetadata: types.VersionMetadata{GitCommit: "def", GitMessage: "second"},
+		ParamValues:     map[string]string{"p1": "2"},
+		Permissions:     []types.Permission{{Plugin: "exec.in", Method: "run", Arguments: []string{"ls"}, IsRead: &isRead}},
+	}
+
+	diffs := diffVersionMetadata(from, to)
+	testutil.AssertEqualsInt(t, "count", 5, len(diffs))
+	testutil.AssertEqualsString(t, "commit", "commit", diffs[0].Field)
+	testutil.AssertEqualsString(t, "params", "params.p1", diffs[1].Field)
+	testutil.AssertEqualsString(t, "message", "second", diffs[2].New)
+	testutil.AssertEqualsString(t, "perm old", "exec.in.run(ls)", diffs[3].Old)
+	testutil.AssertEqualsString(t, "perm new", "exec.in.run(ls) read", diffs[4].New)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/claceio/clace/internal/metadata"
+	"github.com/claceio/clace/internal/types"
+)
+
+// VersionGC deletes the app versions which are outside the retention policy and then deletes the
+// file contents which are no longer referenced by any version. In dry run mode, the changes are
+// rolled back, the response has the versions and space which would be reclaimed
+func (s *Server) VersionGC(ctx context.Context, dryRun bool) (*types.VersionGCResponse, error) {
+	apps, err := s.db.GetAllApps(true)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ret := &types.VersionGCResponse{DryRun: dryRun, Apps: make([]types.VersionGCApp, 0)}
+	now := time.Now()
+	for _, appInfo := range apps {
+		if appInfo.IsDev {
+			continue // dev apps are not versioned
+		}
+
+		appEntry, err := s.db.GetAppTx(ctx, tx, appInfo.AppPathDomain)
+		if err != nil {
+			return nil, err
+		}
+
+		fileStore := metadata.NewFileStore(appEntry.Id, appEntry.Metadata.VersionMetadata.Version, s.db, tx)
+		versions, err := fileStore.GetAppVersions(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		deleteVersions := versionsToDelete(versions, appEntry.Metadata.VersionMetadata.Version,
+			appEntry.Metadata.VersionMetadata.PreviousVersion, s.config.System.VersionKeepCount, s.config.System.VersionKeepDays, now)
+		if len(deleteVersions) == 0 {
+			continue
+		}
+
+		if err := fileStore.DeleteAppVersions(ctx, tx, deleteVersions); err != nil {
+			return nil, err
+		}
+		ret.Apps = append(ret.Apps, types.VersionGCApp{AppPathDomain: appEntry.AppPathDomain(), Versions: deleteVersions})
+		ret.VersionsDeleted += len(deleteVersions)
+	}
+
+	if ret.FilesDeleted, ret.BytesReclaimed, err = s.db.DeleteUnusedFiles(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// No app changes, the app cache does not need to be cleared
+	if err := s.CompleteTransaction(ctx, tx, nil, dryRun, "version_gc"); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// versionsToDelete returns the versions which are outside the retention policy. The latest keepCount
+// versions and the versions newer than keepDays are retained. The active version and its previous
+// version are always retained. The versions are expected to be sorted in ascending order
+func versionsToDelete(versions []types.AppVersion, active, previous, keepCount, keepDays int, now time.Time) []int {
+	cutoff := now.Add(-time.Duration(keepDays) * 24 * time.Hour)
+	ret := make([]int, 0)
+	for i, v := range versions {
+		if v.Version == active || v.Version == previous {
+			continue
+		}
+		if len(versions)-i <= keepCount {
+			continue
+		}
+		if keepDays > 0 && v.CreateTime.After(cutoff) {
+			continue
+		}
+		ret = append(ret, v.Version)
+	}
+	return ret
+}
+
+// runVersionGC is called from the sync runner, the garbage collection is run once every
+// version_gc_mins interval
+func (s *Server) runVersionGC(ctx context.Context) {
+	if s.config.System.VersionGCMins <= 0 ||
+		time.Since(s.lastVersionGC) < time.Duration(s.config.System.VersionGCMins)*time.Minute {
+		return
+	}
+	s.lastVersionGC = time.Now()
+
+	ret, err := s.VersionGC(ctx, false)
+	if err != nil {
+		s.Error().Err(err).Msg("Error running version gc")
+		return
+	}
+	if ret.VersionsDeleted > 0 || ret.FilesDeleted > 0 {
+		s.Info().Msgf("version gc: deleted %d versions across %d apps, %d files, %d bytes reclaimed",
+			ret.VersionsDeleted, len(ret.Apps), ret.FilesDeleted, ret.BytesReclaimed)
+	}
+}
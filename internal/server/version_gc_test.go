@@ -0,0 +1,43 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+func TestVersionsToDelete(t *testing.T) {
+	now := time.Now()
+	versions := make([]types.AppVersion, 0)
+	for i := 1; i <= 10; i++ {
+		// version 10 is one day old, version 1 is ten days old
+		versions = append(versions, types.AppVersion{Version: i, CreateTime: now.Add(-time.Duration(11-i) * 24 * time.Hour)})
+	}
+
+	tests := []struct {
+		name                string
+		active, previous    int
+		keepCount, keepDays int
+		want                []int
+	}{
+		{"keep count", 10, 9, 3, 0, []int{1, 2, 3, 4, 5, 6, 7}},
+		{"keep all", 10, 9, 10, 0, []int{}},
+		{"active and previous", 2, 1, 3, 0, []int{3, 4, 5, 6, 7}},
+		{"keep days", 10, 9, 0, 5, []int{1, 2, 3, 4, 5, 6}},
+		{"count or days", 10, 9, 2, 3, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"days more than count", 10, 9, 8, 5, []int{1, 2}},
+		{"no retention", 10, 9, 0, 0, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+	}
+
+	for _, test := range tests {
+		got := versionsToDelete(versions, test.active, test.previous, test.keepCount, test.keepDays, now)
+		if !slices.Equal(test.want, got) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -47,6 +47,15 @@ func TestServerConfig(t *testing.T) {
 	testutil.AssertEqualsInt(t, "file debounce", 300, c.System.FileWatcherDebounceMillis)
 	testutil.AssertEqualsString(t, "node path", "", c.System.NodePath)
 	testutil.AssertEqualsString(t, "default domain", "localhost", c.System.DefaultDomain)
+	testutil.AssertEqualsInt(t, "drift check mins", 60, c.System.DriftCheckMins)
+	testutil.AssertEqualsInt(t, "version keep count", 25, c.System.VersionKeepCount)
+	testutil.AssertEqualsInt(t, "version keep days", 30, c.System.VersionKeepDays)
+	testutil.AssertEqualsInt(t, "version gc mins", 0, c.System.VersionGCMins)
+	testutil.AssertEqualsString(t, "container max memory", "", c.System.ContainerMaxMemory)
+	testutil.AssertEqualsInt(t, "container max pids", 0, c.System.ContainerMaxPids)
+	testutil.AssertEqualsInt(t, "container gc mins", 0, c.System.ContainerGCMins)
+	testutil.AssertEqualsInt(t, "container stats retain days", 7, c.System.ContainerStatsRetainDays)
+	testutil.AssertEqualsString(t, "container registry", "", c.System.ContainerRegistry)
 
 	// Global Settings
 	testutil.AssertEqualsString(t, "server uri", "$CL_HOME/run/clace.sock", c.ServerUri)
@@ -55,9 +64,13 @@ func TestServerConfig(t *testing.T) {
 	// Security Settings
 	testutil.AssertEqualsBool(t, "admin tcp", false, c.Security.AdminOverTCP)
 	testutil.AssertEqualsString(t, "admin password bcrypt", "", c.Security.AdminPasswordBcrypt)
+	testutil.AssertEqualsInt(t, "session idle timeout", 0, c.Security.SessionIdleTimeout)
+	testutil.AssertEqualsBool(t, "session store", false, c.Security.SessionStore)
 
 	// Container Settings
 	testutil.AssertEqualsString(t, "command", "auto", c.System.ContainerCommand)
+	testutil.AssertEqualsString(t, "runtime", "cli", c.System.ContainerRuntime)
+	testutil.AssertEqualsString(t, "socket", "", c.System.ContainerSocket)
 
 	// App CORS default Settings
 	testutil.AssertEqualsString(t, "cors origin", "*", c.AppConfig.CORS.AllowOrigin)
@@ -72,12 +85,36 @@ func TestServerConfig(t *testing.T) {
 	testutil.AssertEqualsInt(t, "timeout", 5, c.AppConfig.Container.HealthTimeoutSecs)
 	testutil.AssertEqualsInt(t, "idle", 180, c.AppConfig.Container.IdleShutdownSecs)
 	testutil.AssertEqualsInt(t, "status interval", 5, c.AppConfig.Container.StatusCheckIntervalSecs)
+	testutil.AssertEqualsString(t, "load balance", "round_robin", c.AppConfig.Container.LoadBalance)
+	testutil.AssertEqualsInt(t, "drain timeout", 30, c.AppConfig.Container.DrainTimeoutSecs)
+	testutil.AssertEqualsInt(t, "run logs retain", 10, c.AppConfig.Container.RunLogsRetain)
+	testutil.AssertEqualsInt(t, "stats interval", 0, c.AppConfig.Container.StatsIntervalSecs)
+	testutil.AssertEqualsBool(t, "build kit", true, c.AppConfig.Container.BuildKit)
+	testutil.AssertEqualsBool(t, "build cache from", true, c.AppConfig.Container.BuildCacheFrom)
+	testutil.AssertEqualsString(t, "memory", "", c.AppConfig.Container.Memory)
+	testutil.AssertEqualsBool(t, "read only", false, c.AppConfig.Container.ReadOnly)
 	testutil.AssertEqualsInt(t, "status attempts", 3, c.AppConfig.Container.StatusHealthAttempts)
 
 	testutil.AssertEqualsInt(t, "proxy max idle", 250, c.AppConfig.Proxy.MaxIdleConns)
 	testutil.AssertEqualsInt(t, "proxy idle timeout", 15, c.AppConfig.Proxy.IdleConnTimeoutSecs)
 	testutil.AssertEqualsBool(t, "proxy disable compression", true, c.AppConfig.Proxy.DisableCompression)
 	testutil.AssertEqualsString(t, "secrets provider", "env", c.AppConfig.Security.DefaultSecretsProvider)
+	testutil.AssertEqualsBool(t, "csrf protection", false, c.AppConfig.Security.CsrfProtection)
+
+	testutil.AssertEqualsString(t, "hsts", "", c.AppConfig.Headers.HSTS)
+	testutil.AssertEqualsString(t, "frame options", "", c.AppConfig.Headers.FrameOptions)
+	testutil.AssertEqualsString(t, "referrer policy", "strict-origin-when-cross-origin", c.AppConfig.Headers.ReferrerPolicy)
+	testutil.AssertEqualsString(t, "content type options", "nosniff", c.AppConfig.Headers.ContentTypeOptions)
+	testutil.AssertEqualsString(t, "csp", "", c.AppConfig.Headers.CSP)
+
+	testutil.AssertEqualsInt(t, "rate limit burst", 50, c.AppConfig.RateLimit.RequestBurst)
+	testutil.AssertEqualsInt(t, "rate limit plugin burst", 100, c.AppConfig.RateLimit.PluginCallBurst)
+	testutil.AssertEqualsString(t, "rate limit key", "user", c.AppConfig.RateLimit.KeyBy)
+	testutil.AssertEqualsInt(t, "rate limit max keys", 10000, c.AppConfig.RateLimit.MaxKeys)
+
+	testutil.AssertEqualsBool(t, "verify enabled", false, c.AppConfig.Verify.Enabled)
+	testutil.AssertEqualsString(t, "verify route", "", c.AppConfig.Verify.Route)
+	testutil.AssertEqualsInt(t, "verify attempts", 3, c.AppConfig.Verify.Attempts)
 }
 
 func TestClientConfig(t *testing.T) {
@@ -0,0 +1,86 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/claceio/clace/internal/types"
+)
+
+const (
+	CSRF_HEADER      = "X-CSRF-Token"
+	CSRF_FORM_FIELD  = "_csrf"
+	CSRF_COOKIE_NAME = "cl_csrf_"
+)
+
+// csrfCookieName returns the cookie name for the app. The name is unique per app, since apps with
+// nested paths will otherwise share the cookie
+func csrfCookieName(appId types.AppId) string {
+	return CSRF_COOKIE_NAME + string(appId)
+}
+
+// GetCsrfToken returns the CSRF token for the browser session. A new token is generated and set
+// as a session cookie if not already present
+func GetCsrfToken(w http.ResponseWriter, r *http.Request, appId types.AppId, appPath string) string {
+	cookieName := csrfCookieName(appId)
+	if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	if appPath == "" {
+		appPath = "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     appPath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// Update the request, so that multiple lookups in the same request return the same token
+	r.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+	return token
+}
+
+// ValidateCsrfToken checks the CSRF token for state changing requests. The token is read from the
+// X-CSRF-Token header or the _csrf form field and compared with the session cookie value. If no token
+// is passed, requests which the browser marks as same-origin are accepted, this handles pages rendered
+// with templates which do not include the token
+func ValidateCsrfToken(r *http.Request, appId types.AppId) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	requestToken := r.Header.Get(CSRF_HEADER)
+	if requestToken == "" {
+		contentType := r.Header.Get("Content-Type")
+		if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") || strings.HasPrefix(contentType, "multipart/form-data") {
+			requestToken = r.FormValue(CSRF_FORM_FIELD)
+		}
+	}
+
+	if requestToken == "" {
+		return r.Header.Get("Sec-Fetch-Site") == "same-origin"
+	}
+
+	cookie, err := r.Cookie(csrfCookieName(appId))
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(requestToken)) == 1
+}
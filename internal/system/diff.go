@@ -0,0 +1,192 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	DIFF_CONTEXT_LINES = 3
+	DIFF_MAX_EDITS     = 1000 // the trace memory is quadratic in the edit count, larger diffs are not shown
+)
+
+type diffOp struct {
+	kind byte // ' ' for unchanged, '-' for deleted, '+' for inserted
+	line string
+}
+
+// UnifiedDiff returns the unified diff between the from and to text, with three lines of context.
+// Empty string is returned if there are no changes. If more than DIFF_MAX_EDITS lines are changed,
+// only a note that the files differ is returned
+func UnifiedDiff(fromName, toName, from, to string) string {
+	ops, ok := diffLines(splitLines(from), splitLines(to))
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\nFiles differ, more than %d lines changed\n", fromName, toName, DIFF_MAX_EDITS)
+	}
+
+	var buf strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are within the context range
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*DIFF_CONTEXT_LINES {
+				break
+			}
+		}
+
+		hunkStart := max(start-DIFF_CONTEXT_LINES, 0)
+		hunkEnd := min(end+DIFF_CONTEXT_LINES, len(ops))
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&buf, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return buf.String()
+}
+
+func writeHunk(buf *strings.Builder, ops []diffOp, hunkStart, hunkEnd int) {
+	// Line numbers at the start of the hunk
+	fromLine, toLine := 1, 1
+	for _, op := range ops[:hunkStart] {
+		if op.kind != '+' {
+			fromLine++
+		}
+		if op.kind != '-' {
+			toLine++
+		}
+	}
+
+	fromCount, toCount := 0, 0
+	for _, op := range ops[hunkStart:hunkEnd] {
+		if op.kind != '+' {
+			fromCount++
+		}
+		if op.kind != '-' {
+			toCount++
+		}
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+	for _, op := range ops[hunkStart:hunkEnd] {
+		buf.WriteByte(op.kind)
+		buf.WriteString(op.line)
+		buf.WriteByte('\n')
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// Empty range refers to the line before
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the edit script from a to b, using the Myers diff algorithm. False is returned
+// if the edit script is longer than DIFF_MAX_EDITS
+func diffLines(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		// Added or removed file, no need to search
+		ops := make([]diffOp, 0, n+m)
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops, true
+	}
+
+	maxD := min(n+m, DIFF_MAX_EDITS)
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	trace := make([][]int, 0)
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		// Save the diagonals reachable in the previous step, used for backtracking
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down, insert
+			} else {
+				x = v[offset+k-1] + 1 // move right, delete
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	// Backtrack through the trace to build the edit script
+	ops := make([]diffOp, 0, max(n, m))
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		base := d + 1 // index of diagonal zero in the saved window
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[base+k-1] < v[base+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[base+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	slices.Reverse(ops)
+	return ops, true
+}
@@ -0,0 +1,56 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"same", "a\nb\n", "a\nb\n", ""},
+		{"empty", "", "", ""},
+		{"added file", "", "a\nb\n", "--- f\n+++ t\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed file", "a\n", "", "--- f\n+++ t\n@@ -1 +0,0 @@\n-a\n"},
+		{"change", "a\nb\nc\n", "a\nx\nc\n", "--- f\n+++ t\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"context", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nx\n6\n7\n8\n9\n",
+			"--- f\n+++ t\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n"},
+		{"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- f\n+++ t\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n"},
+		{"insert", "a\nc\n", "a\nb\nc\n", "--- f\n+++ t\n@@ -1,2 +1,3 @@\n a\n+b\n c\n"},
+	}
+
+	for _, test := range tests {
+		got := UnifiedDiff("f", "t", test.from, test.to)
+		if got != test.want {
+			t.Errorf("%s: expected\n%q\ngot\n%q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestUnifiedDiffMaxEdits(t *testing.T) {
+	var from, to strings.Builder
+	for i := range DIFF_MAX_EDITS {
+		fmt.Fprintf(&from, "a%d\n", i)
+		fmt.Fprintf(&to, "b%d\n", i)
+	}
+
+	// Added file is diffed irrespective of the size
+	got := UnifiedDiff("f", "t", "", to.String())
+	if !strings.HasPrefix(got, fmt.Sprintf("--- f\n+++ t\n@@ -0,0 +1,%d @@\n+b0\n", DIFF_MAX_EDITS)) {
+		t.Errorf("unexpected added file diff %q", got[:min(len(got), 100)])
+	}
+
+	got = UnifiedDiff("f", "t", from.String(), to.String())
+	want := fmt.Sprintf("--- f\n+++ t\nFiles differ, more than %d lines changed\n", DIFF_MAX_EDITS)
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got[:min(len(got), 100)])
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// EXEC_PROTOCOL is the protocol the app exec API switches the connection to. After the switch, the client
+// and the server exchange frames, with a five byte header (frame type, big endian payload size)
+const EXEC_PROTOCOL = "clace-exec"
+
+type ExecFrameType byte
+
+const (
+	ExecStdin      ExecFrameType = iota // client to server, input for the command
+	ExecStdinClose                      // client to server, end of input
+	ExecResize                          // client to server, terminal size as "rows cols"
+	ExecStdout                          // server to client, command output
+	ExecStderr                          // server to client, command error output, not used with a TTY
+	ExecExit                            // server to client, exit code of the command, the last frame sent
+	ExecError                           // server to client, error running the command, the last frame sent
+	ExecStart                           // server to client, the first frame sent, "true" if a TTY was allocated
+)
+
+// max payload size, larger writes are split into multiple frames
+const maxExecFrameSize = 32 * 1024
+
+// WriteExecFrame writes the frame with the payload to w
+func WriteExecFrame(w io.Writer, frameType ExecFrameType, data []byte) error {
+	for {
+		chunk := data[:min(len(data), maxExecFrameSize)]
+		header := [5]byte{byte(frameType)}
+		binary.BigEndian.PutUint32(header[1:], uint32(len(chunk)))
+		if _, err := w.Write(append(header[:], chunk...)); err != nil {
+			return err
+		}
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// ReadExecFrame reads the next frame from r. io.EOF is returned if the stream is closed before the
+// start of the frame
+func ReadExecFrame(r io.Reader) (ExecFrameType, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxExecFrameSize {
+		return 0, nil, fmt.Errorf("exec frame size %d exceeds max %d", size, maxExecFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return ExecFrameType(header[0]), data, nil
+}
+
+// ExecFrameWriter is an io.Writer which writes the data as frames of the type. The lock is used to
+// serialize the writes, when multiple writers share the stream
+type ExecFrameWriter struct {
+	W    io.Writer
+	Type ExecFrameType
+	Lock *sync.Mutex
+}
+
+func (e *ExecFrameWriter) Write(data []byte) (int, error) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	if err := WriteExecFrame(e.W, e.Type, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Upgrade does a POST request which switches the connection to the protocol. The returned connection
+// is used to exchange data with the server, the client timeout is not applied
+func (h *HttpClient) Upgrade(apiPath string, params url.Values, protocol string) (io.ReadWriteCloser, error) {
+	request, err := h.newRequest(http.MethodPost, apiPath, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", protocol)
+
+	client := *h.client
+	client.Timeout = 0
+	if t, ok := client.Transport.(*http.Transport); ok {
+		// Protocol switch is not supported with HTTP/2, use HTTP/1.1 for the request
+		t = t.Clone()
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if t.TLSClientConfig != nil {
+			t.TLSClientConfig.NextProtos = nil
+		}
+		client.Transport = t
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		if err := checkResponse(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("expected protocol switch, got status %d", resp.StatusCode)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("connection does not support protocol switch")
+	}
+	return conn, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestExecFrames(t *testing.T) {
+	var buf bytes.Buffer
+	var lock sync.Mutex
+	w := &ExecFrameWriter{W: &buf, Type: ExecStdout, Lock: &lock}
+	large := strings.Repeat("x", maxExecFrameSize+10)
+	_, err := w.Write([]byte(large))
+	testutil.AssertNoError(t, err)
+	testutil.AssertNoError(t, WriteExecFrame(&buf, ExecStdinClose, nil))
+	testutil.AssertNoError(t, WriteExecFrame(&buf, ExecExit, []byte("3")))
+
+	// Large writes are split into multiple frames
+	frameType, data, err := ReadExecFrame(&buf)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(ExecStdout), int(frameType))
+	testutil.AssertEqualsInt(t, "size", maxExecFrameSize, len(data))
+	frameType, data, err = ReadExecFrame(&buf)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(ExecStdout), int(frameType))
+	testutil.AssertEqualsInt(t, "size", 10, len(data))
+
+	frameType, data, err = ReadExecFrame(&buf)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(ExecStdinClose), int(frameType))
+	testutil.AssertEqualsInt(t, "size", 0, len(data))
+	frameType, data, err = ReadExecFrame(&buf)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualsInt(t, "type", int(ExecExit), int(frameType))
+	testutil.AssertEqualsString(t, "exit", "3", string(data))
+
+	_, _, err = ReadExecFrame(&buf)
+	testutil.AssertEqualsBool(t, "eof", true, err == io.EOF)
+
+	_, _, err = ReadExecFrame(bytes.NewReader([]byte{byte(ExecStdin), 0xff, 0, 0, 0}))
+	testutil.AssertErrorContains(t, err, "exceeds max")
+}
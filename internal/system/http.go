@@ -90,18 +90,70 @@ func (h *HttpClient) Delete(url string, params url.Values, output any) error {
 }
 
 func (h *HttpClient) request(method, apiPath string, params url.Values, input any, output any) error {
-	var resp *http.Response
-	var payloadBuf bytes.Buffer
+	request, err := h.newRequest(method, apiPath, params, input)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if output != nil {
+		if err := json.Unmarshal(body, output); err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stream does a GET request and copies the response body to w as it is received. The client
+// timeout is not applied, since streaming requests like log follow can be long running
+func (h *HttpClient) Stream(apiPath string, params url.Values, w io.Writer) error {
+	request, err := h.newRequest(http.MethodGet, apiPath, params, nil)
+	if err != nil {
+		return err
+	}
+
+	client := *h.client
+	client.Timeout = 0
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (h *HttpClient) newRequest(method, apiPath string, params url.Values, input any) (*http.Request, error) {
+	var payloadBuf bytes.Buffer
 	if input != nil {
 		if err := json.NewEncoder(&payloadBuf).Encode(input); err != nil {
-			return fmt.Errorf("error encoding request: %w", err)
+			return nil, fmt.Errorf("error encoding request: %w", err)
 		}
 	}
 
 	u, err := url.Parse(h.serverUri)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	u.Path = path.Join(u.Path, apiPath)
@@ -110,7 +162,7 @@ func (h *HttpClient) request(method, apiPath string, params url.Values, input an
 	}
 	request, err := http.NewRequest(method, u.String(), &payloadBuf)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	request.SetBasicAuth(h.user, h.password)
@@ -119,40 +171,25 @@ func (h *HttpClient) request(method, apiPath string, params url.Values, input an
 	if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
 		request.Header.Set("Content-Type", ApplicationJson)
 	}
+	return request, nil
+}
 
-	resp, err = h.client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		errBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		var errResp types.RequestError
-		parseErr := json.Unmarshal(errBody, &errResp)
-		if parseErr != nil || errResp.Code == 0 {
-			errResp.Code = resp.StatusCode
-			errResp.Message = string(errBody)
-		}
-		return errResp
-	}
-
-	if resp.StatusCode == http.StatusNoContent {
+// checkResponse returns the error from the response, nil if the status is success
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
 		return nil
 	}
-
-	body, err := io.ReadAll(resp.Body)
+	errBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	if output != nil {
-		if err := json.Unmarshal(body, output); err != nil {
-			return fmt.Errorf("error parsing response: %w", err)
-		}
+	var errResp types.RequestError
+	parseErr := json.Unmarshal(errBody, &errResp)
+	if parseErr != nil || errResp.Code == 0 {
+		errResp.Code = resp.StatusCode
+		errResp.Message = string(errBody)
 	}
-	return nil
+	return errResp
 }
 
 func MapServerHost(host string) string {
@@ -0,0 +1,137 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	REAL_IP_HEADER   = http.CanonicalHeaderKey("X-Real-IP")
+	FORWARDED_HEADER = http.CanonicalHeaderKey("X-Forwarded-For")
+)
+
+// ParseCIDRs parses a list of CIDR ranges. Plain IP addresses are accepted as a single host range
+func ParseCIDRs(entries []string) ([]*net.IPNet, error) {
+	ret := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %s", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			ret = append(ret, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s: %w", entry, err)
+		}
+		ret = append(ret, ipNet)
+	}
+	return ret, nil
+}
+
+func containsIP(ranges []*net.IPNet, ip net.IP) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRemoteIP returns the client IP address for the request. The X-Forwarded-For and X-Real-IP headers are
+// used only if the request was received from one of the trusted proxies. X-Forwarded-For is walked from the
+// right, skipping trusted proxy hops, the first untrusted address is the client address.
+func GetRemoteIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+
+	peerIP := net.ParseIP(remoteIP)
+	if peerIP == nil || !containsIP(trustedProxies, peerIP) {
+		// Request is not from a trusted proxy, ignore the forwarding headers
+		return remoteIP
+	}
+
+	forwarded := r.Header.Values(FORWARDED_HEADER)
+	if len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			hopIP := net.ParseIP(hop)
+			if hopIP == nil {
+				// Invalid entry, the hops to the left cannot be trusted
+				return remoteIP
+			}
+			if i == 0 || !containsIP(trustedProxies, hopIP) {
+				return hop
+			}
+			remoteIP = hop
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get(REAL_IP_HEADER)); realIP != "" && net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remoteIP
+}
+
+// IPFilter checks IP addresses against allow and deny CIDR lists
+type IPFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewIPFilter creates a IPFilter. Returns nil if there are no rules
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	allowNets, err := ParseCIDRs(allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list: %w", err)
+	}
+	denyNets, err := ParseCIDRs(deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list: %w", err)
+	}
+
+	if len(allowNets) == 0 && len(denyNets) == 0 {
+		return nil, nil
+	}
+	return &IPFilter{allow: allowNets, deny: denyNets}, nil
+}
+
+// Allowed checks whether the IP is permitted. Deny rules take precedence over allow rules. If
+// allow rules are present, the IP has to match one of them
+func (f *IPFilter) Allowed(remoteIP string) bool {
+	if f == nil {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	if containsIP(f.deny, ip) {
+		return false
+	}
+
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package system
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/claceio/clace/internal/testutil"
+)
+
+func TestGetRemoteIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		expected   string
+	}{
+		{"no proxy", "1.2.3.4:1000", "", "", "1.2.3.4"},
+		{"untrusted peer", "1.2.3.4:1000", "5.6.7.8", "9.9.9.9", "1.2.3.4"},
+		{"trusted peer", "127.0.0.1:1000", "5.6.7.8", "", "5.6.7.8"},
+		{"trusted hops skipped", "127.0.0.1:1000", "6.6.6.6, 5.6.7.8, 10.1.1.1", "", "5.6.7.8"},
+		{"all hops trusted", "127.0.0.1:1000", "10.2.2.2, 10.1.1.1", "", "10.2.2.2"},
+		{"invalid hop", "127.0.0.1:1000", "abc, 10.1.1.1", "", "10.1.1.1"},
+		{"real ip", "127.0.0.1:1000", "", "5.6.7.8", "5.6.7.8"},
+		{"ipv6", "[::1]:1000", "5.6.7.8", "", "::1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			r.Header.Set(FORWARDED_HEADER, tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set(REAL_IP_HEADER, tt.realIP)
+		}
+		testutil.AssertEqualsString(t, tt.name, tt.expected, GetRemoteIP(r, trusted))
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	filter, err := NewIPFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqualsBool(t, "no rules", true, filter.Allowed("1.2.3.4"))
+
+	_, err = NewIPFilter([]string{"10.0.0.0/33"}, nil)
+	testutil.AssertErrorContains(t, err, "invalid allow list")
+
+	filter, err = NewIPFilter([]string{"10.0.0.0/8", "192.168.1.5"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqualsBool(t, "allowed range", true, filter.Allowed("10.2.3.4"))
+	testutil.AssertEqualsBool(t, "allowed ip", true, filter.Allowed("192.168.1.5"))
+	testutil.AssertEqualsBool(t, "denied range", false, filter.Allowed("10.1.3.4"))
+	testutil.AssertEqualsBool(t, "not in allow", false, filter.Allowed("192.168.1.6"))
+	testutil.AssertEqualsBool(t, "invalid ip", false, filter.Allowed("abc"))
+
+	filter, err = NewIPFilter(nil, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqualsBool(t, "deny only", true, filter.Allowed("1.2.3.4"))
+	testutil.AssertEqualsBool(t, "deny only denied", false, filter.Allowed("10.0.0.1"))
+}
@@ -0,0 +1,17 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package system
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// NotifyTermResize relays the terminal resize signals to the channel
+func NotifyTermResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
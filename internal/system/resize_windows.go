@@ -0,0 +1,14 @@
+// Copyright (c) ClaceIO, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package system
+
+import (
+	"os"
+)
+
+// NotifyTermResize is a no-op on windows, there is no resize signal. The initial terminal size is used
+func NotifyTermResize(c chan<- os.Signal) {
+}
@@ -4,15 +4,26 @@
 package system
 
 import (
+	htmltemplate "html/template"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
 )
 
 // GetFuncMap returns a template.FuncMap that includes all the sprig functions except for env and expandenv.
+// The csrfField function is added, which generates the hidden form input for the CSRF token.
 func GetFuncMap() template.FuncMap {
 	funcMap := sprig.FuncMap()
 	delete(funcMap, "env")
 	delete(funcMap, "expandenv")
+	funcMap["csrfField"] = csrfField
 	return funcMap
 }
+
+// csrfField returns the hidden form field for the CSRF token, used as {{ csrfField .CsrfToken }}
+func csrfField(token string) htmltemplate.HTML {
+	if token == "" {
+		return ""
+	}
+	return htmltemplate.HTML(`<input type="hidden" name="` + CSRF_FORM_FIELD + `" value="` + htmltemplate.HTMLEscapeString(token) + `" />`)
+}
@@ -6,6 +6,7 @@ package types
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // RequestError is the error returned by the API
@@ -37,6 +38,7 @@ type CreateAppRequest struct {
 	IsDev            bool              `json:"is_dev"`
 	AppAuthn         AppAuthnType      `json:"app_authn"`
 	GitBranch        string            `json:"git_branch"`
+	GitTag           string            `json:"git_tag"` // tag name or pattern like v1.* or latest, the highest matching semver tag is used
 	GitCommit        string            `json:"git_commit"`
 	GitAuthName      string            `json:"git_auth_name"`
 	Spec             AppSpec           `json:"spec"`
@@ -55,6 +57,8 @@ type UpdateAppRequest struct {
 	StageWriteAccess   BoolValue   `json:"stage_write_access"`
 	PreviewWriteAccess BoolValue   `json:"preview_write_access"`
 	Spec               StringValue `json:"spec"`
+	AllowIPs           StringValue `json:"allow_ips"` // comma separated CIDR list, "-" to clear
+	DenyIPs            StringValue `json:"deny_ips"`  // comma separated CIDR list, "-" to clear
 }
 
 func CreateUpdateAppRequest() UpdateAppRequest {
@@ -64,6 +68,8 @@ func CreateUpdateAppRequest() UpdateAppRequest {
 		StageWriteAccess:   BoolValueUndefined,
 		PreviewWriteAccess: BoolValueUndefined,
 		Spec:               StringValueUndefined,
+		AllowIPs:           StringValueUndefined,
+		DenyIPs:            StringValueUndefined,
 	}
 }
 
@@ -151,6 +157,31 @@ type AppApplyResult struct {
 	Reloaded      []AppPathDomain   `json:"reloaded"`
 	Skipped       []AppPathDomain   `json:"skipped"`
 	Promoted      bool              `json:"promoted"`
+	Changes       []FieldDiff       `json:"changes"`
+}
+
+// FieldDiff is the change for one app property done by apply. Old is empty for
+// added values and New is empty for removed values
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type AppDiffAction string
+
+const (
+	AppDiffCreate  AppDiffAction = "create"
+	AppDiffUpdate  AppDiffAction = "update"
+	AppDiffDelete  AppDiffAction = "delete"
+	AppDiffDisable AppDiffAction = "disable"
+)
+
+// AppDiff is the list of changes done by apply for an app
+type AppDiff struct {
+	AppPathDomain AppPathDomain `json:"app_path_domain"`
+	Action        AppDiffAction `json:"action"`
+	Changes       []FieldDiff   `json:"changes"`
 }
 
 type AppApplyResponse struct {
@@ -164,11 +195,24 @@ type AppApplyResponse struct {
 	ReloadResults  []AppPathDomain     `json:"reload_results"`
 	SkippedResults []AppPathDomain     `json:"skipped_results"`
 	FilteredApps   []AppPathDomain     `json:"filtered_apps"`
+	PruneMode      ApplyPruneOption    `json:"prune_mode"`
+	PruneResults   []AppPathDomain     `json:"prune_results"`
+	Diffs          []AppDiff           `json:"diffs"`
 }
 
 type AppPromoteResponse struct {
 	DryRun         bool            `json:"dry_run"`
 	PromoteResults []AppPathDomain `json:"promote_results"`
+	VerifyResults  []VerifyResult  `json:"verify_results"`
+}
+
+// VerifyResult is the result of the verification done on a prod app after promote or version switch
+type VerifyResult struct {
+	AppPathDomain AppPathDomain `json:"app_path_domain"`
+	Version       int           `json:"version"`
+	Success       bool          `json:"success"`
+	Error         string        `json:"error"`
+	RevertedTo    int           `json:"reverted_to"` // the version switched back to on failure, zero if not reverted
 }
 
 type AppUpdateSettingsResponse struct {
@@ -208,10 +252,74 @@ type AppVersionFilesResponse struct {
 	Files []AppFile `json:"files"`
 }
 
+type FileDiffStatus string
+
+const (
+	FileDiffAdded    FileDiffStatus = "added"
+	FileDiffRemoved  FileDiffStatus = "removed"
+	FileDiffModified FileDiffStatus = "modified"
+)
+
+type VersionFileDiff struct {
+	Name   string         `json:"name"`
+	Status FileDiffStatus `json:"status"`
+	Binary bool           `json:"binary"`
+	Diff   string         `json:"diff"` // unified diff, empty for binary files
+}
+
+type AppVersionDiffResponse struct {
+	FromVersion     int               `json:"from_version"`
+	ToVersion       int               `json:"to_version"`
+	MetadataChanges []FieldDiff       `json:"metadata_changes"`
+	Files           []VersionFileDiff `json:"files"`
+}
+
+type VersionGCApp struct {
+	AppPathDomain
+	Versions []int `json:"versions"`
+}
+
+type VersionGCResponse struct {
+	DryRun          bool           `json:"dry_run"`
+	Apps            []VersionGCApp `json:"apps"`
+	VersionsDeleted int            `json:"versions_deleted"`
+	FilesDeleted    int            `json:"files_deleted"`
+	BytesReclaimed  int64          `json:"bytes_reclaimed"`
+}
+
+type ContainerGCResponse struct {
+	DryRun        bool     `json:"dry_run"`
+	RemoveVolumes bool     `json:"remove_volumes"` // whether the unused volumes were removed, they are only reported otherwise
+	Containers    []string `json:"containers"`
+	Images        []string `json:"images"`
+	Volumes       []string `json:"volumes"`
+	Networks      []string `json:"networks"`
+	Errors        []string `json:"errors"` // removal failures, the gc continues with the other entries
+}
+
+// AppStats is the container resource usage for an app, the current values are from the latest sample and
+// the peak values are the max across the samples in the requested duration
+type AppStats struct {
+	AppPathDomain
+	Id              AppId     `json:"id"`
+	Samples         int       `json:"samples"`
+	LastSampleTime  time.Time `json:"last_sample_time"`
+	Containers      int       `json:"containers"`
+	CpuPercent      float64   `json:"cpu_percent"`
+	MemoryBytes     int64     `json:"memory_bytes"`
+	PeakCpuPercent  float64   `json:"peak_cpu_percent"`
+	PeakMemoryBytes int64     `json:"peak_memory_bytes"`
+}
+
+type AppStatsResponse struct {
+	Stats []AppStats `json:"stats"`
+}
+
 type AppVersionSwitchResponse struct {
-	DryRun      bool `json:"dry_run"`
-	FromVersion int  `json:"from_version"`
-	ToVersion   int  `json:"to_version"`
+	DryRun       bool          `json:"dry_run"`
+	FromVersion  int           `json:"from_version"`
+	ToVersion    int           `json:"to_version"`
+	VerifyResult *VerifyResult `json:"verify_result"`
 }
 
 type AppToken struct {
@@ -251,6 +359,44 @@ type SyncListResponse struct {
 	Entries []*SyncEntry `json:"entries"`
 }
 
+// AppDrift is the list of changes between the applied config and the live app. The Old value in the
+// changes is the applied config value, the New value is the live value
+type AppDrift struct {
+	AppPathDomain AppPathDomain `json:"app_path_domain"`
+	ApplySource   string        `json:"apply_source"`
+	Changes       []FieldDiff   `json:"changes"`
+}
+
+type SyncDriftResponse struct {
+	Path   string      `json:"path"`
+	Drifts []*AppDrift `json:"drifts"`
+}
+
+// CanaryVersionStats is the http request stats for one version of the app since the canary was started
+type CanaryVersionStats struct {
+	AppPathDomain AppPathDomain `json:"app_path_domain"`
+	Version       int           `json:"version"`
+	Requests      int           `json:"requests"`
+	Errors        int           `json:"errors"`
+}
+
+type AppCanaryResponse struct {
+	DryRun        bool               `json:"dry_run"`
+	AppPathDomain AppPathDomain      `json:"app_path_domain"`
+	Canary        CanaryConfig       `json:"canary"`
+	Prod          CanaryVersionStats `json:"prod"`
+	Stage         CanaryVersionStats `json:"stage"`
+}
+
+type SessionListResponse struct {
+	Sessions []*SessionEntry `json:"sessions"`
+}
+
+type SessionRevokeResponse struct {
+	DryRun  bool     `json:"dry_run"`
+	Revoked []string `json:"revoked"`
+}
+
 type AppReloadOption string
 
 const (
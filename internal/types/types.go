@@ -38,6 +38,11 @@ const (
 	SHARED     ContextKey = "shared"
 	REQUEST_ID ContextKey = "request_id"
 	APP_ID     ContextKey = "app_id"
+
+	RATE_LIMIT_KEY   ContextKey = "rate_limit_key"
+	REMOTE_IP        ContextKey = "remote_ip"
+	CSP_NONCE        ContextKey = "csp_nonce"
+	CANARY_PROD_PATH ContextKey = "canary_prod_path" // set when the stage app serves a canary request for the prod app
 )
 
 const (
@@ -58,6 +63,10 @@ const (
 	CONTAINER_SOURCE_NIXPACKS     = "nixpacks"
 	CONTAINER_SOURCE_IMAGE_PREFIX = "image:"
 	CONTAINER_LIFETIME_COMMAND    = "command"
+	CONTAINER_OPTION_REPLICAS     = "replicas" // container option for the replica count, not passed to the container runtime
+	CONTAINER_MAX_REPLICAS        = 32
+	CONTAINER_LB_ROUND_ROBIN      = "round_robin"
+	CONTAINER_LB_LEAST_CONN       = "least_conn"
 )
 
 const (
@@ -96,16 +105,28 @@ type SecretConfig map[string]any
 type NodeConfig map[string]any
 
 type AppConfig struct {
-	CORS      CORS      `toml:"cors"`
-	Container Container `toml:"container"`
-	Proxy     Proxy     `toml:"proxy"`
-	FS        FS        `toml:"fs"`
-	Audit     Audit     `toml:"audit"`
-	Security  Security  `toml:"security"`
-	StarBase  string    `toml:"star_base"` // The base directory for starlark config files
+	CORS      CORS            `toml:"cors"`
+	Container Container       `toml:"container"`
+	Proxy     Proxy           `toml:"proxy"`
+	FS        FS              `toml:"fs"`
+	Audit     Audit           `toml:"audit"`
+	Security  Security        `toml:"security"`
+	RateLimit RateLimit       `toml:"rate_limit"`
+	Headers   SecurityHeaders `toml:"security_headers"`
+	Verify    Verify          `toml:"verify"`
+	StarBase  string          `toml:"star_base"` // The base directory for starlark config files
+}
+
+// Verify is the config for the verification done on prod apps after promote and version switch.
+// If the verification fails, the app is switched back to the previous version
+type Verify struct {
+	Enabled  bool   `toml:"enabled"`
+	Route    string `toml:"route"`    // app route for the GET smoke test, empty for container health check only
+	Attempts int    `toml:"attempts"` // attempts for the smoke test, one second apart
 }
 type Security struct {
 	DefaultSecretsProvider string `toml:"default_secrets_provider"`
+	CsrfProtection         bool   `toml:"csrf_protection"` // validate CSRF token for non-GET requests
 }
 
 type CORS struct {
@@ -138,6 +159,51 @@ type Container struct {
 	// Status check related config
 	StatusCheckIntervalSecs int `toml:"status_check_interval_secs"`
 	StatusHealthAttempts    int `toml:"status_health_attempts"`
+
+	// Load balancing across replicas, "round_robin" or "least_conn"
+	LoadBalance string `toml:"load_balance"`
+
+	// Blue/green switch related config
+	DrainTimeoutSecs int `toml:"drain_timeout_secs"` // wait for in-flight requests before stopping old containers
+
+	// Number of exited containers retained for command lifetime apps, for viewing the logs
+	RunLogsRetain int `toml:"run_logs_retain"`
+
+	// Interval for sampling the container cpu and memory usage. 0 (default) to disable
+	StatsIntervalSecs int `toml:"stats_interval_secs"`
+
+	// Image build related config
+	BuildKit       bool `toml:"build_kit"`        // enable BuildKit for docker builds, for cache mounts
+	BuildCacheFrom bool `toml:"build_cache_from"` // use the earlier images for the app as the build cache source
+
+	// Resource limits and security profile, empty or zero means no limit. The limits cannot exceed
+	// the max values in the system config
+	Memory          string `toml:"memory"` // like 512m or 2g
+	Cpus            string `toml:"cpus"`   // like 0.5 or 2
+	PidsLimit       int    `toml:"pids_limit"`
+	ReadOnly        bool   `toml:"read_only"` // read-only root filesystem
+	NoNewPrivileges bool   `toml:"no_new_privileges"`
+	User            string `toml:"user"` // user to run the container as, like 1000:1000
+}
+
+// SecurityHeaders is the config for the security related response headers. Empty value means the header is not set
+type SecurityHeaders struct {
+	HSTS               string `toml:"hsts"` // Strict-Transport-Security, set for HTTPS requests only
+	FrameOptions       string `toml:"frame_options"`
+	ReferrerPolicy     string `toml:"referrer_policy"`
+	ContentTypeOptions string `toml:"content_type_options"`
+	CSP                string `toml:"csp"` // Content-Security-Policy, {nonce} is replaced with a per request nonce
+	CSPReportOnly      bool   `toml:"csp_report_only"`
+}
+
+// RateLimit is the token bucket rate limit config for an app. A rate of zero disables the limit
+type RateLimit struct {
+	RequestsPerSec    float64 `toml:"requests_per_sec"`
+	RequestBurst      int     `toml:"request_burst"`
+	PluginCallsPerSec float64 `toml:"plugin_calls_per_sec"`
+	PluginCallBurst   int     `toml:"plugin_call_burst"`
+	KeyBy             string  `toml:"key_by"`   // "user" (user id, remote ip for anonymous users), "ip" or "app"
+	MaxKeys           int     `toml:"max_keys"` // max number of keys tracked per app
 }
 
 type Proxy struct {
@@ -178,17 +244,20 @@ type HttpsConfig struct {
 
 // SecurityConfig is the security related configuration
 type SecurityConfig struct {
-	AdminOverTCP             bool   `toml:"admin_over_tcp"`
-	AdminPasswordBcrypt      string `toml:"admin_password_bcrypt"`
-	AppDefaultAuthType       string `toml:"app_default_auth_type"`
-	SessionSecret            string `toml:"session_secret"`
-	SessionBlockKey          string `toml:"session_block_key"`
-	SessionMaxAge            int    `toml:"session_max_age"`
-	SessionHttpsOnly         bool   `toml:"session_https_only"`
-	CallbackUrl              string `toml:"callback_url"`
-	DefaultGitAuth           string `toml:"default_git_auth"`
-	StageEnableWriteAccess   bool   `toml:"stage_enable_write_access"`
-	PreviewEnableWriteAccess bool   `toml:"preview_enable_write_access"`
+	AdminOverTCP             bool     `toml:"admin_over_tcp"`
+	AdminPasswordBcrypt      string   `toml:"admin_password_bcrypt"`
+	AppDefaultAuthType       string   `toml:"app_default_auth_type"`
+	SessionSecret            string   `toml:"session_secret"`
+	SessionBlockKey          string   `toml:"session_block_key"`
+	SessionMaxAge            int      `toml:"session_max_age"`
+	SessionHttpsOnly         bool     `toml:"session_https_only"`
+	SessionIdleTimeout       int      `toml:"session_idle_timeout"` // idle timeout in seconds, zero to disable
+	SessionStore             bool     `toml:"session_store"`        // If true, sessions are tracked in the metadata db, allowing revocation
+	CallbackUrl              string   `toml:"callback_url"`
+	DefaultGitAuth           string   `toml:"default_git_auth"`
+	StageEnableWriteAccess   bool     `toml:"stage_enable_write_access"`
+	PreviewEnableWriteAccess bool     `toml:"preview_enable_write_access"`
+	TrustedProxies           []string `toml:"trusted_proxies"` // CIDR ranges of proxies whose X-Forwarded-For header is used
 }
 
 // MetadataConfig is the configuration for the Metadata persistence layer
@@ -215,6 +284,8 @@ type SystemConfig struct {
 	FileWatcherDebounceMillis int      `toml:"file_watcher_debounce_millis"`
 	NodePath                  string   `toml:"node_path"`
 	ContainerCommand          string   `toml:"container_command"`
+	ContainerRuntime          string   `toml:"container_runtime"` // "cli" or "api"
+	ContainerSocket           string   `toml:"container_socket"`  // Docker API socket path, used for the api runtime
 	DefaultDomain             string   `toml:"default_domain"`
 	RootServeListApps         string   `toml:"root_serve_list_apps"`
 	EnableCompression         bool     `toml:"enable_compression"`
@@ -223,6 +294,18 @@ type SystemConfig struct {
 	AllowedEnv                []string `toml:"allowed_env"`            // List of environment variables that are allowed to be used in the node config
 	DefaultScheduleMins       int      `toml:"default_schedule_mins"`  // Default schedule time in minutes for scheduled sync
 	MaxSyncFailureCount       int      `toml:"max_sync_failure_count"` // Max failure count for sync jobs
+	DriftCheckMins            int      `toml:"drift_check_mins"`       // Interval for the drift check on synced apps, 0 to disable
+	VersionKeepCount          int      `toml:"version_keep_count"`     // Number of latest versions retained per app
+	VersionKeepDays           int      `toml:"version_keep_days"`      // Versions newer than this are retained
+	VersionGCMins             int      `toml:"version_gc_mins"`        // Interval for the automatic version garbage collection, 0 (default) to disable
+	ContainerMaxMemory        string   `toml:"container_max_memory"`   // Max memory limit for app containers, "" for no max
+	ContainerMaxCpus          string   `toml:"container_max_cpus"`     // Max cpus limit for app containers, "" for no max
+	ContainerMaxPids          int      `toml:"container_max_pids"`     // Max pids limit for app containers, 0 for no max
+	ContainerGCMins           int      `toml:"container_gc_mins"`      // Interval for the container, image and network gc, 0 (default) to disable
+	// Number of days to retain the container stats samples
+	ContainerStatsRetainDays int `toml:"container_stats_retain_days"`
+	// Registry to push the built app images to, pulled from there by other nodes. "" to disable
+	ContainerRegistry string `toml:"container_registry"`
 }
 
 // GitAuth is a github auth config entry
@@ -352,6 +435,8 @@ type VersionMetadata struct {
 	Version         int    `json:"version"`
 	PreviousVersion int    `json:"previous_version"`
 	GitBranch       string `json:"git_branch"`
+	GitTagPattern   string `json:"git_tag_pattern"` // tag or tag pattern being tracked, empty if tracking a branch
+	GitTag          string `json:"git_tag"`         // tag which was checked out
 	GitCommit       string `json:"git_commit"`
 	GitMessage      string `json:"git_message"`
 	ApplyInfo       []byte `json:"apply_info"`
@@ -410,6 +495,28 @@ type AppSettings struct {
 	StageWriteAccess   bool          `json:"stage_write_access"`
 	PreviewWriteAccess bool          `json:"preview_write_access"`
 	WebhookTokens      WebhookTokens `json:"webhook_tokens"`
+	AllowIPs           []string      `json:"allow_ips"`    // CIDR ranges allowed to access the app, all allowed if empty
+	DenyIPs            []string      `json:"deny_ips"`     // CIDR ranges denied access to the app, takes precedence over allow
+	ApplySource        string        `json:"apply_source"` // the apply file path which manages the app, used for prune
+	ApplyPath          string        `json:"apply_path"`   // the apply file path last applied to the app, used for the drift check
+	Disabled           bool          `json:"disabled"`     // app disabled by apply prune, requests are rejected
+	Canary             CanaryConfig  `json:"canary"`       // traffic split between the prod and stage app
+}
+
+// CanarySticky is how a user is assigned to the canary (stage) version of an app
+type CanarySticky string
+
+const (
+	CanaryStickyCookie CanarySticky = "cookie" // random assignment, saved in a cookie
+	CanaryStickyUser   CanarySticky = "user"   // hash of the user id, cookie is used for anonymous users
+)
+
+// CanaryConfig is the canary config for a prod app. The configured percentage of users are served the stage
+// app at the prod app url
+type CanaryConfig struct {
+	Percent   int          `json:"percent"`    // percentage of users routed to the stage app, 0 means canary is disabled
+	Sticky    CanarySticky `json:"sticky"`     // how users are assigned to a version
+	StartTime time.Time    `json:"start_time"` // when the canary was started, used for the version stats
 }
 
 type WebhookTokens struct {
@@ -424,6 +531,7 @@ const (
 	WebhookReload        WebhookType = "reload"
 	WebhookReloadPromote WebhookType = "reload_promote"
 	WebhookPromote       WebhookType = "promote"
+	WebhookSync          WebhookType = "sync"
 )
 
 // SpecFiles is a map of file names to file data. JSON encoding uses base 64 encoding of file text
@@ -505,6 +613,19 @@ type AppFile struct {
 // Transaction is a wrapper around sql.Tx
 type Transaction struct {
 	*sql.Tx
+	// Promoted has the prod apps promoted in the transaction, mapped to the version before the promote.
+	// The promoted apps are verified after the transaction is committed
+	Promoted map[AppPathDomain]int
+}
+
+// RecordPromote records a prod app promote, retaining the version from before the first promote
+func (t *Transaction) RecordPromote(appPathDomain AppPathDomain, previousVersion int) {
+	if t.Promoted == nil {
+		return
+	}
+	if _, ok := t.Promoted[appPathDomain]; !ok {
+		t.Promoted[appPathDomain] = previousVersion
+	}
 }
 
 func (t *Transaction) IsInitialized() bool {
@@ -559,6 +680,15 @@ type AuditEvent struct {
 	Detail     string
 }
 
+// ContainerStatsSample is the resource usage of the app containers, summed across the replicas and services
+type ContainerStatsSample struct {
+	AppId       AppId
+	CreateTime  time.Time
+	CpuPercent  float64
+	MemoryBytes int64
+	Containers  int
+}
+
 type EventStatus string
 
 const (
@@ -603,11 +733,24 @@ type SyncMetadata struct {
 	Clobber     bool   `json:"clobber"`      // whether to force update the sync, overwriting non-declarative changes
 	ForceReload bool   `json:"force_reload"` // whether to force reload even if there is no new commit
 
+	Prune       ApplyPruneOption `json:"prune"`       // whether to delete or disable apps removed from the apply config
+	Environment string           `json:"environment"` // the environment value passed to the apply files
+
 	WebhookUrl        string `json:"webhook_url"`        // for webhook : the url to use
 	WebhookSecret     string `json:"webhook_secret"`     // for webhook : the secret to use
 	ScheduleFrequency int    `json:"schedule_frequency"` // for scheduled: the frequency of the sync, every N minutes
 }
 
+// ApplyPruneOption is the action taken for apps which were created by an apply file but are no
+// longer present in the apply config
+type ApplyPruneOption string
+
+const (
+	ApplyPruneNone    ApplyPruneOption = ""
+	ApplyPruneDelete  ApplyPruneOption = "delete"
+	ApplyPruneDisable ApplyPruneOption = "disable"
+)
+
 type SyncJobStatus struct {
 	State             string           `json:"state"`               // the state of the sync job
 	FailureCount      int              `json:"failure_count"`       // the number of times the sync job has failed recently
@@ -618,6 +761,16 @@ type SyncJobStatus struct {
 	ApplyResponse     AppApplyResponse `json:"app_apply_response"`  // the response of the apply job
 }
 
+// SessionEntry is a server side record of an SSO session, used for listing and revoking sessions
+type SessionEntry struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"user_id"`
+	Provider   string    `json:"provider"`
+	RemoteIP   string    `json:"remote_ip"`
+	CreateTime time.Time `json:"create_time"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
 // NotificationMessage is the message sent through the postgres listener
 type NotificationMessage struct {
 	MessageType string `json:"message_type"`
@@ -59,36 +59,54 @@ func execCommand(containerManager *app.ContainerManager, thread *starlark.Thread
 	}
 
 	ctx := app.GetContext(thread)
-	var cmd *exec.Cmd
-	var err error
+	var stdout io.Reader
+	var wait func() error
+	var stderr bytes.Buffer
 	if containerManager != nil {
-		cmd, err = containerManager.Run(ctx, pathStr, argsList, envList)
-		if err != nil {
-			return nil, fmt.Errorf("error running command in container: %w", err)
+		// cwd is not supported in container mode. The command is run in the background, the output
+		// is read from the pipe, which is closed when the command completes
+		reader, writer := io.Pipe()
+		var errWriter io.Writer = &stderr
+		if bool(includeStderr) {
+			errWriter = writer
+		}
+		done := make(chan error, 1)
+		go func() {
+			runErr := containerManager.Run(ctx, pathStr, argsList, envList, writer, errWriter)
+			if runErr != nil {
+				runErr = fmt.Errorf("error running command in container: %w", runErr)
+			}
+			writer.Close()
+			done <- runErr
+		}()
+		stdout = reader
+		wait = func() error {
+			return <-done
 		}
-		// cwd is not supported in container mode
 	} else {
-		cmd = exec.CommandContext(ctx, pathStr, argsList...)
+		cmd := exec.CommandContext(ctx, pathStr, argsList...)
 		cmd.Env = envList
 		if cwd != "" {
 			cmd.Dir = string(cwd)
 		}
-	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
-	}
-	var stderr bytes.Buffer
-	if bool(includeStderr) {
-		cmd.Stderr = cmd.Stdout
-	} else {
-		cmd.Stderr = &stderr
-	}
+		stdoutPipe, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if bool(includeStderr) {
+			cmd.Stderr = cmd.Stdout
+		} else {
+			cmd.Stderr = &stderr
+		}
 
-	if err := cmd.Start(); err != nil {
-		return nil, err
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		stdout = stdoutPipe
+		wait = cmd.Wait
 	}
 
+	var err error
 	var buf bytes.Buffer
 	var tempFile *os.File
 
@@ -113,7 +131,7 @@ func execCommand(containerManager *app.ContainerManager, thread *starlark.Thread
 				return nil, err
 			}
 		}
-		runErr = cmd.Wait()
+		runErr = wait()
 
 		if !processPartialBool && runErr != nil {
 			if stderr.Len() > 0 {
@@ -179,7 +197,7 @@ func execCommand(containerManager *app.ContainerManager, thread *starlark.Thread
 				return
 			}
 
-			runErr = cmd.Wait()
+			runErr = wait()
 			if runErr != nil {
 				yield(nil, fmt.Errorf("cmd failed: %w", runErr))
 			}